@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/ingest"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/likaia/nginxpulse/internal/timeutil"
+)
+
+// AnomalyStats 流量异常检测结果，Labels 与各 Series 的 Points 一一对应（逐小时）
+type AnomalyStats struct {
+	Labels    []string                 `json:"labels"`
+	Weeks     int                      `json:"weeks"`
+	Threshold float64                  `json:"threshold"`
+	Series    []ingest.AnomalySeries   `json:"series"`
+	Intervals []ingest.AnomalyInterval `json:"intervals"`
+}
+
+// GetType 实现 StatsResult 接口
+func (s AnomalyStats) GetType() string {
+	return "anomaly"
+}
+
+// AnomalyStatsManager 按周内小时基线的流量异常检测
+type AnomalyStatsManager struct {
+	repo *store.Repository
+}
+
+// NewAnomalyStatsManager 创建流量异常检测管理器
+func NewAnomalyStatsManager(userRepoPtr *store.Repository) *AnomalyStatsManager {
+	return &AnomalyStatsManager{
+		repo: userRepoPtr,
+	}
+}
+
+// Query 实现 StatsManager 接口
+func (m *AnomalyStatsManager) Query(query StatsQuery) (StatsResult, error) {
+	timeRange, _ := query.ExtraParam["timeRange"].(string)
+	startTime, endTime, err := timeutil.TimePeriod(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("解析时间范围失败: %v", err)
+	}
+
+	opts := ingest.AnomalyOptionsFromConfig()
+	if metrics, ok := query.ExtraParam["metrics"].([]string); ok && len(metrics) > 0 {
+		opts.Metrics = metrics
+	}
+	if weeks, ok := query.ExtraParam["weeks"].(int); ok && weeks > 0 {
+		opts.Weeks = weeks
+	}
+	if threshold, ok := query.ExtraParam["threshold"].(float64); ok && threshold > 0 {
+		opts.Threshold = threshold
+	}
+
+	// TimePeriod 的结束时间为当天 23:59:59，检测区间不含结束点
+	report, err := ingest.DetectAnomalies(m.repo, query.WebsiteID, startTime.Unix(), endTime.Unix()+1, opts)
+	if err != nil {
+		return nil, fmt.Errorf("流量异常检测失败: %v", err)
+	}
+
+	result := AnomalyStats{
+		Labels:    make([]string, 0),
+		Weeks:     report.Weeks,
+		Threshold: report.Threshold,
+		Series:    report.Series,
+		Intervals: report.Intervals,
+	}
+	if len(report.Series) > 0 {
+		for _, point := range report.Series[0].Points {
+			result.Labels = append(result.Labels, time.Unix(point.Bucket, 0).Format("01-02 15:00"))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,620 @@
+package analytics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich"
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/likaia/nginxpulse/internal/timeutil"
+)
+
+const (
+	BlocklistModeRate     = "rate"
+	BlocklistModeErrors   = "errors"
+	BlocklistModeSecurity = "security"
+	BlocklistModeFilter   = "filter"
+
+	BlocklistFormatNginx    = "nginx"
+	BlocklistFormatNginxGeo = "nginx-geo"
+	BlocklistFormatIPSet    = "ipset"
+	BlocklistFormatNFTables = "nftables"
+
+	defaultBlocklistSetName = "nginxpulse_blocklist"
+	defaultBlocklistExpire  = 24 * time.Hour
+	maxBlocklistLimit       = 5000
+	// filter 模式最多扫描的日志条数，避免宽泛的筛选条件拖垮数据库
+	blocklistFilterScanLimit = 20000
+	blocklistFilterPageSize  = 1000
+)
+
+// ErrInvalidBlocklistRequest 请求参数错误（站点、模式、格式、输出、筛选条件等），接口据此返回 400
+var ErrInvalidBlocklistRequest = fmt.Errorf("封禁名单参数错误")
+
+// BlocklistRequest 封禁名单生成参数。Mode 为空时不挑选新 IP，只按当前名单重新渲染 / 写入
+type BlocklistRequest struct {
+	// WebsiteID 为空或 all 表示全部站点
+	WebsiteID string `json:"id"`
+	Mode      string `json:"mode"`
+	TimeRange string `json:"timeRange"`
+	// MinRate rate 模式：单分钟请求峰值下限，默认 120
+	MinRate int `json:"minRate"`
+	// MinRequests / MinRatio errors 模式：请求数下限（默认 50）与 4xx 占比下限（默认 0.5）
+	MinRequests int     `json:"minRequests"`
+	MinRatio    float64 `json:"minRatio"`
+	// MinHits security / filter 模式：命中次数下限，默认 5
+	MinHits int `json:"minHits"`
+	// Severity security 模式只统计指定等级（逗号分隔），为空表示全部
+	Severity string `json:"severity"`
+	// Filter filter 模式引用的 security.blocklist.filters 名称
+	Filter string `json:"filter"`
+	Limit  int    `json:"limit"`
+	// Expire 覆盖配置的有效期，0 表示永久
+	Expire string `json:"expire"`
+	Format string `json:"format"`
+	// Output security.blocklist.outputs 中的名称，设置后原子写入对应文件
+	Output string `json:"output"`
+	DryRun bool   `json:"dryRun"`
+}
+
+// BlocklistCandidate 本次挑选出的 IP
+type BlocklistCandidate struct {
+	WebsiteID string `json:"website_id"`
+	IP        string `json:"ip"`
+	Hits      int64  `json:"hits"`
+	Note      string `json:"note"`
+}
+
+// BlocklistSkipped 因白名单或内网地址被排除的 IP
+type BlocklistSkipped struct {
+	IP     string `json:"ip"`
+	Reason string `json:"reason"`
+}
+
+// BlocklistResult 封禁名单生成结果
+type BlocklistResult struct {
+	Candidates []BlocklistCandidate   `json:"candidates"`
+	Skipped    []BlocklistSkipped     `json:"skipped"`
+	Entries    []store.BlocklistEntry `json:"entries"`
+	Format     string                 `json:"format"`
+	Content    string                 `json:"content"`
+	Written    string                 `json:"written,omitempty"`
+}
+
+// BuildBlocklist 按请求挑选 IP 写入封禁名单，并把当前有效名单渲染为指定格式
+func (f *StatsFactory) BuildBlocklist(req BlocklistRequest) (BlocklistResult, error) {
+	result := BlocklistResult{
+		Candidates: make([]BlocklistCandidate, 0),
+		Skipped:    make([]BlocklistSkipped, 0),
+	}
+	cfg := blocklistConfig()
+
+	var output *config.BlocklistOutputConfig
+	if name := strings.TrimSpace(req.Output); name != "" {
+		for i := range cfg.Outputs {
+			if cfg.Outputs[i].Name == name {
+				output = &cfg.Outputs[i]
+				break
+			}
+		}
+		if output == nil {
+			return result, fmt.Errorf("%w: 未配置的输出 %s", ErrInvalidBlocklistRequest, name)
+		}
+	}
+	format := strings.TrimSpace(req.Format)
+	if format == "" && output != nil {
+		format = output.Format
+	}
+	if format == "" {
+		format = BlocklistFormatNginx
+	}
+	if !IsBlocklistFormat(format) {
+		return result, fmt.Errorf("%w: 不支持的格式 %s", ErrInvalidBlocklistRequest, format)
+	}
+	result.Format = format
+
+	expire, err := parseBlocklistExpire(req.Expire, cfg.Expire)
+	if err != nil {
+		return result, err
+	}
+
+	websiteID := strings.TrimSpace(req.WebsiteID)
+	if strings.EqualFold(websiteID, "all") {
+		websiteID = ""
+	}
+	websiteIDs := []string{websiteID}
+	if websiteID == "" {
+		websiteIDs = config.GetAllWebsiteIDs()
+	} else if _, ok := config.GetWebsiteByID(websiteID); !ok {
+		return result, fmt.Errorf("%w: 站点不存在", ErrInvalidBlocklistRequest)
+	}
+
+	if req.Mode != "" {
+		allowlist := enrich.NewWhitelistMatcher(&config.WhitelistConfig{Enabled: true, IPs: cfg.Allowlist})
+		for _, id := range websiteIDs {
+			candidates, err := f.blocklistCandidates(id, req, cfg)
+			if err != nil {
+				return result, err
+			}
+			for _, candidate := range candidates {
+				if reason, skip := blocklistSkipReason(candidate.IP, allowlist); skip {
+					result.Skipped = append(result.Skipped, BlocklistSkipped{IP: candidate.IP, Reason: reason})
+					continue
+				}
+				result.Candidates = append(result.Candidates, candidate)
+			}
+		}
+	}
+
+	reason := req.Mode
+	if req.Mode == BlocklistModeFilter {
+		reason = BlocklistModeFilter + ":" + req.Filter
+	}
+	newEntries := make([]store.BlocklistEntry, 0, len(result.Candidates))
+	for _, candidate := range result.Candidates {
+		entry := store.BlocklistEntry{
+			WebsiteID: candidate.WebsiteID,
+			IP:        candidate.IP,
+			Reason:    reason,
+			Hits:      candidate.Hits,
+			Note:      candidate.Note,
+		}
+		if expire > 0 {
+			expiresAt := time.Now().Add(expire)
+			entry.ExpiresAt = &expiresAt
+		}
+		newEntries = append(newEntries, entry)
+	}
+
+	repo := f.repo
+	if !req.DryRun {
+		if _, err := repo.CleanupExpiredBlocklist(); err != nil {
+			return result, fmt.Errorf("清理过期封禁条目失败: %v", err)
+		}
+		if err := repo.UpsertBlocklistEntries(newEntries); err != nil {
+			return result, fmt.Errorf("保存封禁名单失败: %v", err)
+		}
+	}
+	entries, err := repo.ListBlocklistEntries(websiteID)
+	if err != nil {
+		return result, fmt.Errorf("查询封禁名单失败: %v", err)
+	}
+	if req.DryRun {
+		// 预览时把候选 IP 合并进当前名单，不落库
+		entries = append(entries, newEntries...)
+	}
+	result.Entries = entries
+
+	content, err := RenderBlocklist(entries, format, cfg.SetName)
+	if err != nil {
+		return result, err
+	}
+	result.Content = content
+
+	if output != nil && !req.DryRun {
+		if err := enrich.WriteFileAtomic(output.Path, []byte(content)); err != nil {
+			return result, fmt.Errorf("写入封禁名单文件失败: %v", err)
+		}
+		result.Written = output.Path
+	}
+	return result, nil
+}
+
+// IsBlocklistFormat 是否为支持的输出格式
+func IsBlocklistFormat(format string) bool {
+	switch format {
+	case BlocklistFormatNginx, BlocklistFormatNginxGeo, BlocklistFormatIPSet, BlocklistFormatNFTables:
+		return true
+	}
+	return false
+}
+
+func blocklistConfig() config.BlocklistConfig {
+	cfg := config.ReadConfig()
+	var blocklist config.BlocklistConfig
+	if cfg.Security != nil && cfg.Security.Blocklist != nil {
+		blocklist = *cfg.Security.Blocklist
+	}
+	if strings.TrimSpace(blocklist.SetName) == "" {
+		blocklist.SetName = defaultBlocklistSetName
+	}
+	return blocklist
+}
+
+// parseBlocklistExpire 请求参数优先于配置，均未设置时为 24h，0 表示永久
+func parseBlocklistExpire(values ...string) (time.Duration, error) {
+	for _, raw := range values {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if raw == "0" {
+			return 0, nil
+		}
+		expire, err := time.ParseDuration(raw)
+		if err != nil || expire < 0 {
+			return 0, fmt.Errorf("%w: 无效的有效期 %s", ErrInvalidBlocklistRequest, raw)
+		}
+		return expire, nil
+	}
+	return defaultBlocklistExpire, nil
+}
+
+func blocklistSkipReason(ip string, allowlist *enrich.WhitelistMatcher) (string, bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "invalid", true
+	}
+	if enrich.IsPrivateIP(parsed) || parsed.IsUnspecified() || parsed.IsLoopback() {
+		return "private", true
+	}
+	if match, ok := allowlist.Match(ip); ok {
+		return "allowlist:" + match.RuleValue, true
+	}
+	return "", false
+}
+
+func (f *StatsFactory) blocklistCandidates(
+	websiteID string, req BlocklistRequest, cfg config.BlocklistConfig,
+) ([]BlocklistCandidate, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > maxBlocklistLimit {
+		limit = maxBlocklistLimit
+	}
+	timeRange := req.TimeRange
+	if timeRange == "" {
+		timeRange = "today"
+	}
+
+	if req.Mode == BlocklistModeFilter {
+		return f.blocklistFilterCandidates(websiteID, req, cfg, timeRange, limit)
+	}
+
+	startTime, endTime, err := timeutil.TimePeriod(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 解析时间范围失败 %v", ErrInvalidBlocklistRequest, err)
+	}
+	args := []interface{}{startTime.Unix(), endTime.Unix()}
+
+	var query string
+	switch req.Mode {
+	case BlocklistModeRate:
+		minRate := req.MinRate
+		if minRate <= 0 {
+			minRate = 120
+		}
+		query = fmt.Sprintf(
+			`SELECT ip.ip, SUM(t.cnt), MAX(t.cnt)
+            FROM (
+                SELECT l.ip_id, l.timestamp / 60 AS minute, COUNT(*) AS cnt
+                FROM "%[1]s_nginx_logs" l
+                WHERE l.timestamp >= ? AND l.timestamp < ?
+                GROUP BY l.ip_id, minute
+            ) t
+            JOIN "%[1]s_dim_ip" ip ON ip.id = t.ip_id
+            GROUP BY ip.ip
+            HAVING MAX(t.cnt) >= ?
+            ORDER BY MAX(t.cnt) DESC, ip.ip
+            LIMIT ?`, websiteID,
+		)
+		args = append(args, minRate, limit)
+	case BlocklistModeErrors:
+		minRequests := req.MinRequests
+		if minRequests <= 0 {
+			minRequests = 50
+		}
+		minRatio := req.MinRatio
+		if minRatio <= 0 {
+			minRatio = 0.5
+		}
+		query = fmt.Sprintf(
+			`SELECT ip.ip, COUNT(*),
+                    COUNT(*) FILTER (WHERE l.status_code >= 400 AND l.status_code < 500)
+            FROM "%[1]s_nginx_logs" l
+            JOIN "%[1]s_dim_ip" ip ON ip.id = l.ip_id
+            WHERE l.timestamp >= ? AND l.timestamp < ?
+            GROUP BY ip.ip
+            HAVING COUNT(*) >= ?
+               AND COUNT(*) FILTER (WHERE l.status_code >= 400 AND l.status_code < 500)::float8 / COUNT(*) >= ?::float8
+            ORDER BY COUNT(*) FILTER (WHERE l.status_code >= 400 AND l.status_code < 500) DESC, ip.ip
+            LIMIT ?`, websiteID,
+		)
+		args = append(args, minRequests, minRatio, limit)
+	case BlocklistModeSecurity:
+		minHits := req.MinHits
+		if minHits <= 0 {
+			minHits = 5
+		}
+		severityFilter := ""
+		if severities := splitBlocklistList(req.Severity); len(severities) > 0 {
+			severityFilter = " AND a.severity IN (" + strings.TrimSuffix(strings.Repeat("?,", len(severities)), ",") + ")"
+			for _, severity := range severities {
+				args = append(args, severity)
+			}
+		}
+		query = fmt.Sprintf(
+			`SELECT ip.ip, COUNT(*), COUNT(DISTINCT a.attack_type)
+            FROM "%[1]s_nginx_logs" l
+            JOIN "%[1]s_dim_attack" a ON a.id = l.attack_id
+            JOIN "%[1]s_dim_ip" ip ON ip.id = l.ip_id
+            WHERE l.attack_id IS NOT NULL AND l.timestamp >= ? AND l.timestamp < ?%[2]s
+            GROUP BY ip.ip
+            HAVING COUNT(*) >= ?
+            ORDER BY COUNT(*) DESC, ip.ip
+            LIMIT ?`, websiteID, severityFilter,
+		)
+		args = append(args, minHits, limit)
+	default:
+		return nil, fmt.Errorf("%w: 不支持的模式 %s", ErrInvalidBlocklistRequest, req.Mode)
+	}
+
+	rows, err := f.repo.GetDB().Query(sqlutil.ReplacePlaceholders(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询封禁候选 IP 失败: %v", err)
+	}
+	defer rows.Close()
+
+	candidates := make([]BlocklistCandidate, 0)
+	for rows.Next() {
+		var (
+			ip     string
+			total  int64
+			metric int64
+		)
+		if err := rows.Scan(&ip, &total, &metric); err != nil {
+			return nil, fmt.Errorf("解析封禁候选 IP 失败: %v", err)
+		}
+		candidate := BlocklistCandidate{WebsiteID: websiteID, IP: ip, Hits: total}
+		switch req.Mode {
+		case BlocklistModeRate:
+			candidate.Note = fmt.Sprintf("峰值 %d 次/分钟，共 %d 次请求", metric, total)
+		case BlocklistModeErrors:
+			candidate.Hits = metric
+			candidate.Note = fmt.Sprintf("4xx %d / %d 次请求", metric, total)
+		case BlocklistModeSecurity:
+			candidate.Note = fmt.Sprintf("攻击命中 %d 次，%d 种类型", total, metric)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, rows.Err()
+}
+
+// blocklistFilterCandidates 按保存的日志筛选条件分页扫描，统计每个 IP 的命中次数
+func (f *StatsFactory) blocklistFilterCandidates(
+	websiteID string, req BlocklistRequest, cfg config.BlocklistConfig, timeRange string, limit int,
+) ([]BlocklistCandidate, error) {
+	saved, ok := cfg.Filters[req.Filter]
+	if req.Filter == "" || !ok {
+		return nil, fmt.Errorf("%w: 未配置的筛选条件 %s", ErrInvalidBlocklistRequest, req.Filter)
+	}
+	params := make(map[string]string, len(saved)+6)
+	for key, value := range saved {
+		params[key] = value
+	}
+	params["id"] = websiteID
+	params["page"] = "1"
+	params["pageSize"] = strconv.Itoa(blocklistFilterPageSize)
+	params["sortField"] = "timestamp"
+	params["sortOrder"] = "desc"
+	if params["timeRange"] == "" && params["timeStart"] == "" && params["timeEnd"] == "" {
+		params["timeRange"] = timeRange
+	}
+	query, err := f.BuildQueryFromRequest("logs", params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 筛选条件 %s 无效 %v", ErrInvalidBlocklistRequest, req.Filter, err)
+	}
+	manager, ok := f.GetManager("logs")
+	if !ok {
+		return nil, fmt.Errorf("未找到统计管理器: logs")
+	}
+
+	counts := make(map[string]int64)
+	scanned := 0
+	for page := 1; scanned < blocklistFilterScanLimit; page++ {
+		query.ExtraParam["page"] = page
+		query.ExtraParam["pageSize"] = blocklistFilterPageSize
+		queryResult, err := manager.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		logsResult, ok := queryResult.(LogsStats)
+		if !ok || len(logsResult.Logs) == 0 {
+			break
+		}
+		for _, log := range logsResult.Logs {
+			counts[log.IP]++
+		}
+		scanned += len(logsResult.Logs)
+		if logsResult.Pagination.Pages > 0 && page >= logsResult.Pagination.Pages {
+			break
+		}
+	}
+
+	minHits := int64(req.MinHits)
+	if minHits <= 0 {
+		minHits = 5
+	}
+	candidates := make([]BlocklistCandidate, 0)
+	for ip, count := range counts {
+		if count < minHits {
+			continue
+		}
+		candidates = append(candidates, BlocklistCandidate{
+			WebsiteID: websiteID,
+			IP:        ip,
+			Hits:      count,
+			Note:      fmt.Sprintf("筛选条件 %s 命中 %d 次", req.Filter, count),
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Hits != candidates[j].Hits {
+			return candidates[i].Hits > candidates[j].Hits
+		}
+		return candidates[i].IP < candidates[j].IP
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+func splitBlocklistList(raw string) []string {
+	values := make([]string, 0)
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// blocklistItem 渲染用的条目：同一 IP 在多个站点出现时合并，有效期取较晚者
+type blocklistItem struct {
+	ip      net.IP
+	text    string
+	hits    int64
+	reasons []string
+	expires *time.Time
+}
+
+func mergeBlocklistEntries(entries []store.BlocklistEntry) []*blocklistItem {
+	index := make(map[string]*blocklistItem, len(entries))
+	items := make([]*blocklistItem, 0, len(entries))
+	now := time.Now()
+	for _, entry := range entries {
+		parsed := net.ParseIP(entry.IP)
+		if parsed == nil {
+			continue
+		}
+		if entry.ExpiresAt != nil && !entry.ExpiresAt.After(now) {
+			continue
+		}
+		key := parsed.String()
+		item, ok := index[key]
+		if !ok {
+			item = &blocklistItem{ip: parsed, text: key, expires: entry.ExpiresAt}
+			index[key] = item
+			items = append(items, item)
+		} else if item.expires != nil && (entry.ExpiresAt == nil || entry.ExpiresAt.After(*item.expires)) {
+			item.expires = entry.ExpiresAt
+		}
+		item.hits += entry.Hits
+		if entry.Reason != "" && !containsString(item.reasons, entry.Reason) {
+			item.reasons = append(item.reasons, entry.Reason)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].text < items[j].text
+	})
+	return items
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// timeoutSeconds 剩余有效秒数，0 表示永久
+func (item *blocklistItem) timeoutSeconds(now time.Time) int64 {
+	if item.expires == nil {
+		return 0
+	}
+	seconds := int64(item.expires.Sub(now).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// RenderBlocklist 把封禁条目渲染为 nginx deny / geo include、ipset restore 文件或 nftables 脚本
+func RenderBlocklist(entries []store.BlocklistEntry, format, setName string) (string, error) {
+	if setName == "" {
+		setName = defaultBlocklistSetName
+	}
+	items := mergeBlocklistEntries(entries)
+	now := time.Now()
+
+	var b strings.Builder
+	header := fmt.Sprintf("# generated by nginxpulse at %s, %d entries\n", now.Format(time.RFC3339), len(items))
+	switch format {
+	case BlocklistFormatNginx:
+		b.WriteString(header)
+		for _, item := range items {
+			fmt.Fprintf(&b, "deny %s; # %s hits=%d%s\n", item.text, strings.Join(item.reasons, ","), item.hits,
+				blocklistExpireComment(item.expires))
+		}
+	case BlocklistFormatNginxGeo:
+		b.WriteString(header)
+		fmt.Fprintf(&b, "geo $%s {\n    default 0;\n", setName)
+		for _, item := range items {
+			fmt.Fprintf(&b, "    %s 1; # %s hits=%d%s\n", item.text, strings.Join(item.reasons, ","), item.hits,
+				blocklistExpireComment(item.expires))
+		}
+		b.WriteString("}\n")
+	case BlocklistFormatIPSet:
+		// 配合 ipset restore -exist 使用
+		b.WriteString(header)
+		setV6 := setName + "_v6"
+		fmt.Fprintf(&b, "create %s hash:net family inet timeout 0\n", setName)
+		fmt.Fprintf(&b, "create %s hash:net family inet6 timeout 0\n", setV6)
+		fmt.Fprintf(&b, "flush %s\nflush %s\n", setName, setV6)
+		for _, item := range items {
+			target := setName
+			if item.ip.To4() == nil {
+				target = setV6
+			}
+			fmt.Fprintf(&b, "add %s %s timeout %d\n", target, item.text, item.timeoutSeconds(now))
+		}
+	case BlocklistFormatNFTables:
+		// nft -f 执行；集合声明可重复执行，随后整体替换元素
+		b.WriteString(header)
+		fmt.Fprintf(&b, "table inet nginxpulse {\n")
+		fmt.Fprintf(&b, "    set %s_v4 {\n        type ipv4_addr\n        flags interval,timeout\n    }\n", setName)
+		fmt.Fprintf(&b, "    set %s_v6 {\n        type ipv6_addr\n        flags interval,timeout\n    }\n", setName)
+		b.WriteString("}\n")
+		fmt.Fprintf(&b, "flush set inet nginxpulse %s_v4\n", setName)
+		fmt.Fprintf(&b, "flush set inet nginxpulse %s_v6\n", setName)
+		v4 := make([]string, 0, len(items))
+		v6 := make([]string, 0)
+		for _, item := range items {
+			element := item.text
+			if timeout := item.timeoutSeconds(now); timeout > 0 {
+				element += fmt.Sprintf(" timeout %ds", timeout)
+			}
+			if item.ip.To4() != nil {
+				v4 = append(v4, element)
+			} else {
+				v6 = append(v6, element)
+			}
+		}
+		if len(v4) > 0 {
+			fmt.Fprintf(&b, "add element inet nginxpulse %s_v4 { %s }\n", setName, strings.Join(v4, ", "))
+		}
+		if len(v6) > 0 {
+			fmt.Fprintf(&b, "add element inet nginxpulse %s_v6 { %s }\n", setName, strings.Join(v6, ", "))
+		}
+	default:
+		return "", fmt.Errorf("%w: 不支持的格式 %s", ErrInvalidBlocklistRequest, format)
+	}
+	return b.String(), nil
+}
+
+func blocklistExpireComment(expires *time.Time) string {
+	if expires == nil {
+		return ""
+	}
+	return " expires=" + expires.Format(time.RFC3339)
+}
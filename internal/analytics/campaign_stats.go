@@ -0,0 +1,275 @@
+package analytics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/likaia/nginxpulse/internal/timeutil"
+)
+
+// 未携带对应参数时的分组名称
+const campaignNotSet = "(not set)"
+
+// 推广活动统计支持的分组维度
+var campaignDimensionExprs = map[string]string{
+	"campaign":      "c.campaign",
+	"source":        "c.source",
+	"medium":        "c.medium",
+	"source_medium": "c.source || ' / ' || c.medium",
+	"term":          "c.term",
+	"content":       "c.content",
+}
+
+// CampaignSeries 单个推广活动的时间序列，与 CampaignStats.Labels 一一对应
+type CampaignSeries struct {
+	Sessions  []int `json:"sessions"`
+	Pageviews []int `json:"pageviews"`
+	Visitors  []int `json:"visitors"`
+}
+
+// CampaignEntryPages 推广活动的入口页（按会话数排序）
+type CampaignEntryPages struct {
+	Key      []string `json:"key"`
+	Sessions []int    `json:"sessions"`
+}
+
+// CampaignStatsItem 单个推广活动的汇总数据
+type CampaignStatsItem struct {
+	Key        string             `json:"key"`
+	Sessions   int                `json:"sessions"`
+	PV         int                `json:"pv"`
+	UV         int                `json:"uv"`
+	Series     CampaignSeries     `json:"series"`
+	EntryPages CampaignEntryPages `json:"entryPages"`
+}
+
+// CampaignStats 推广活动统计结果，会话按入口 PV 携带的 UTM/点击 ID 归因
+type CampaignStats struct {
+	Dimension string              `json:"dimension"`
+	Labels    []string            `json:"labels"`
+	Campaigns []CampaignStatsItem `json:"campaigns"`
+}
+
+// GetType 实现 StatsResult 接口
+func (s CampaignStats) GetType() string {
+	return "campaign"
+}
+
+// CampaignStatsManager 推广活动统计
+type CampaignStatsManager struct {
+	repo *store.Repository
+}
+
+// NewCampaignStatsManager 创建推广活动统计管理器
+func NewCampaignStatsManager(userRepoPtr *store.Repository) *CampaignStatsManager {
+	return &CampaignStatsManager{
+		repo: userRepoPtr,
+	}
+}
+
+// Query 实现 StatsManager 接口
+func (m *CampaignStatsManager) Query(query StatsQuery) (StatsResult, error) {
+	timeRange, _ := query.ExtraParam["timeRange"].(string)
+	dimension, _ := query.ExtraParam["dimension"].(string)
+	if dimension == "" {
+		dimension = "campaign"
+	}
+	groupExpr, ok := campaignDimensionExprs[dimension]
+	if !ok {
+		return nil, fmt.Errorf("dimension 参数无效: %s", dimension)
+	}
+	viewType, _ := query.ExtraParam["viewType"].(string)
+	if viewType == "" {
+		viewType = "daily"
+	}
+	limit := 10
+	if value, ok := query.ExtraParam["limit"].(int); ok && value > 0 {
+		limit = value
+	}
+	entryLimit := 5
+	if value, ok := query.ExtraParam["entryLimit"].(int); ok && value > 0 {
+		entryLimit = value
+	}
+
+	startTime, endTime, err := timeutil.TimePeriod(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("解析时间范围失败: %v", err)
+	}
+	timePoints, labels := timeutil.TimePointsAndLabels(timeRange, viewType)
+
+	result := CampaignStats{
+		Dimension: dimension,
+		Labels:    labels,
+		Campaigns: make([]CampaignStatsItem, 0),
+	}
+
+	keyExpr := fmt.Sprintf("COALESCE(NULLIF(%s, ''), '%s')", groupExpr, campaignNotSet)
+	fromClause := campaignFromClause(query.WebsiteID, "")
+	baseArgs := []interface{}{startTime.Unix(), endTime.Unix()}
+
+	db := m.repo.GetDB()
+	rows, err := db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT %s AS campaign_key, COUNT(*), COALESCE(SUM(s.page_count), 0), COUNT(DISTINCT s.ip_id)
+        %s
+        GROUP BY campaign_key
+        ORDER BY COUNT(*) DESC, campaign_key
+        LIMIT ?`,
+		keyExpr, fromClause,
+	)), append(baseArgs, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("查询推广活动统计失败: %v", err)
+	}
+	defer rows.Close()
+
+	index := make(map[string]int)
+	for rows.Next() {
+		var item CampaignStatsItem
+		if err := rows.Scan(&item.Key, &item.Sessions, &item.PV, &item.UV); err != nil {
+			return nil, fmt.Errorf("解析推广活动统计失败: %v", err)
+		}
+		item.Series = CampaignSeries{
+			Sessions:  make([]int, len(timePoints)),
+			Pageviews: make([]int, len(timePoints)),
+			Visitors:  make([]int, len(timePoints)),
+		}
+		item.EntryPages = CampaignEntryPages{Key: make([]string, 0), Sessions: make([]int, 0)}
+		index[item.Key] = len(result.Campaigns)
+		result.Campaigns = append(result.Campaigns, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历推广活动统计失败: %v", err)
+	}
+	if len(result.Campaigns) == 0 {
+		return result, nil
+	}
+
+	keys := make([]interface{}, 0, len(result.Campaigns))
+	placeholders := make([]string, 0, len(result.Campaigns))
+	for _, item := range result.Campaigns {
+		keys = append(keys, item.Key)
+		placeholders = append(placeholders, "?")
+	}
+	keyFilter := fmt.Sprintf(" AND %s IN (%s)", keyExpr, strings.Join(placeholders, ", "))
+	filteredArgs := append(append([]interface{}{}, baseArgs...), keys...)
+
+	if len(timePoints) > 0 {
+		if err := m.fillSeries(&result, index, timePoints, keyExpr, fromClause+keyFilter, filteredArgs); err != nil {
+			return nil, fmt.Errorf("查询推广活动趋势失败: %v", err)
+		}
+	}
+	entryFrom := campaignFromClause(query.WebsiteID, fmt.Sprintf(
+		`JOIN "%s_dim_url" u ON u.id = s.entry_url_id`, query.WebsiteID,
+	)) + keyFilter
+	if err := m.fillEntryPages(&result, index, entryLimit, keyExpr, entryFrom, filteredArgs); err != nil {
+		return nil, fmt.Errorf("查询推广活动入口页失败: %v", err)
+	}
+	return result, nil
+}
+
+// campaignFromClause 返回按会话开始时间过滤的 FROM 子句（带 2 个时间参数），extraJoin 用于追加维表关联
+func campaignFromClause(websiteID, extraJoin string) string {
+	return fmt.Sprintf(
+		`FROM "%s_sessions" s
+        JOIN "%s_dim_campaign" c ON c.id = s.campaign_id
+        %s
+        WHERE s.campaign_id IS NOT NULL AND s.start_ts >= ? AND s.start_ts < ?`,
+		websiteID, websiteID, extraJoin,
+	)
+}
+
+// fillSeries 按时间点分桶统计会话数 / PV / UV，分桶边界直接取 TimePointsAndLabels 的时间点
+func (m *CampaignStatsManager) fillSeries(
+	result *CampaignStats, index map[string]int, timePoints []time.Time,
+	keyExpr, fromClause string, args []interface{}) error {
+
+	bounds := make([]string, 0, len(timePoints)+1)
+	for _, point := range timePoints {
+		bounds = append(bounds, strconv.FormatInt(point.Unix(), 10))
+	}
+	last := timePoints[len(timePoints)-1]
+	end := last.AddDate(0, 0, 1)
+	if len(timePoints) > 1 && timePoints[1].Sub(timePoints[0]) < 24*time.Hour {
+		end = last.Add(time.Hour)
+	}
+	bounds = append(bounds, strconv.FormatInt(end.Unix(), 10))
+
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT %s AS campaign_key,
+                width_bucket(s.start_ts, ARRAY[%s]::BIGINT[]) AS bucket,
+                COUNT(*), COALESCE(SUM(s.page_count), 0), COUNT(DISTINCT s.ip_id)
+        %s
+        GROUP BY campaign_key, bucket`,
+		keyExpr, strings.Join(bounds, ","), fromClause,
+	)), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			key      string
+			bucket   int
+			sessions int
+			pv       int
+			uv       int
+		)
+		if err := rows.Scan(&key, &bucket, &sessions, &pv, &uv); err != nil {
+			return err
+		}
+		idx, ok := index[key]
+		// width_bucket 对落在首个边界之前/末个边界之后的值返回 0 / len(bounds)
+		if !ok || bucket < 1 || bucket > len(timePoints) {
+			continue
+		}
+		series := &result.Campaigns[idx].Series
+		series.Sessions[bucket-1] = sessions
+		series.Pageviews[bucket-1] = pv
+		series.Visitors[bucket-1] = uv
+	}
+	return rows.Err()
+}
+
+// fillEntryPages 统计每个推广活动会话数最多的入口页
+func (m *CampaignStatsManager) fillEntryPages(
+	result *CampaignStats, index map[string]int, entryLimit int,
+	keyExpr, fromClause string, args []interface{}) error {
+
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT campaign_key, url, sessions
+        FROM (
+            SELECT %s AS campaign_key, u.url AS url, COUNT(*) AS sessions,
+                   ROW_NUMBER() OVER (PARTITION BY %s ORDER BY COUNT(*) DESC, u.url) AS rn
+            %s
+            GROUP BY campaign_key, u.url
+        ) ranked
+        WHERE rn <= ?
+        ORDER BY campaign_key, sessions DESC, url`,
+		keyExpr, keyExpr, fromClause,
+	)), append(args, entryLimit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			key      string
+			entryURL string
+			sessions int
+		)
+		if err := rows.Scan(&key, &entryURL, &sessions); err != nil {
+			return err
+		}
+		idx, ok := index[key]
+		if !ok {
+			continue
+		}
+		pages := &result.Campaigns[idx].EntryPages
+		pages.Key = append(pages.Key, entryURL)
+		pages.Sessions = append(pages.Sessions, sessions)
+	}
+	return rows.Err()
+}
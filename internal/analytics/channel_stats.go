@@ -0,0 +1,132 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/likaia/nginxpulse/internal/timeutil"
+)
+
+// 会话以站内跳转开始（如超时后继续浏览）时按直接访问计
+const channelKeyExpr = "CASE WHEN ch.channel = 'internal' THEN 'direct' ELSE ch.channel END"
+
+// 来源渠道统计支持的分组方式
+var channelGroupExprs = map[string]string{
+	"channel": channelKeyExpr,
+	"source":  "COALESCE(NULLIF(ch.source, ''), '(none)')",
+	"domain":  "COALESCE(NULLIF(ch.domain, ''), '(none)')",
+	"keyword": "ch.keyword",
+}
+
+// ChannelStats 来源渠道统计结果，会话按入口 PV 的来源归因
+type ChannelStats struct {
+	GroupBy         string   `json:"groupBy"`
+	Key             []string `json:"key"`
+	Sessions        []int    `json:"sessions"`
+	PV              []int    `json:"pv"`
+	UV              []int    `json:"uv"`
+	SessionsPercent []int    `json:"sessions_percent"`
+}
+
+// GetType 实现 StatsResult 接口
+func (s ChannelStats) GetType() string {
+	return "channel"
+}
+
+// ChannelStatsManager 来源渠道统计
+type ChannelStatsManager struct {
+	repo *store.Repository
+}
+
+// NewChannelStatsManager 创建来源渠道统计管理器
+func NewChannelStatsManager(userRepoPtr *store.Repository) *ChannelStatsManager {
+	return &ChannelStatsManager{
+		repo: userRepoPtr,
+	}
+}
+
+// Query 实现 StatsManager 接口
+func (m *ChannelStatsManager) Query(query StatsQuery) (StatsResult, error) {
+	groupBy, _ := query.ExtraParam["groupBy"].(string)
+	if groupBy == "" {
+		groupBy = "channel"
+	}
+	result := ChannelStats{
+		GroupBy:         groupBy,
+		Key:             make([]string, 0),
+		Sessions:        make([]int, 0),
+		PV:              make([]int, 0),
+		UV:              make([]int, 0),
+		SessionsPercent: make([]int, 0),
+	}
+	groupExpr, ok := channelGroupExprs[groupBy]
+	if !ok {
+		return result, fmt.Errorf("groupBy 参数无效: %s", groupBy)
+	}
+	limit := 20
+	if value, ok := query.ExtraParam["limit"].(int); ok && value > 0 {
+		limit = value
+	}
+
+	timeRange, _ := query.ExtraParam["timeRange"].(string)
+	startTime, endTime, err := timeutil.TimePeriod(timeRange)
+	if err != nil {
+		return result, fmt.Errorf("解析时间范围失败: %v", err)
+	}
+
+	conditions := "s.start_ts >= ? AND s.start_ts < ?"
+	args := []interface{}{startTime.Unix(), endTime.Unix()}
+	if channel, ok := query.ExtraParam["channel"].(string); ok && channel != "" {
+		conditions += fmt.Sprintf(" AND %s = ?", channelKeyExpr)
+		args = append(args, channel)
+	}
+	if groupBy == "keyword" {
+		conditions += " AND ch.keyword <> ''"
+	}
+
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT %[1]s AS channel_key, COUNT(*), COALESCE(SUM(s.page_count), 0), COUNT(DISTINCT s.ip_id)
+        FROM "%[2]s_sessions" s
+        JOIN "%[2]s_dim_channel" ch ON ch.id = s.channel_id
+        WHERE %[3]s
+        GROUP BY channel_key
+        ORDER BY COUNT(*) DESC, channel_key
+        LIMIT ?`,
+		groupExpr, query.WebsiteID, conditions,
+	)), append(args, limit)...)
+	if err != nil {
+		return result, fmt.Errorf("查询来源渠道统计失败: %v", err)
+	}
+	defer rows.Close()
+
+	totalSessions := 0
+	for rows.Next() {
+		var (
+			key      string
+			sessions int
+			pv       int
+			uv       int
+		)
+		if err := rows.Scan(&key, &sessions, &pv, &uv); err != nil {
+			return result, fmt.Errorf("解析来源渠道统计失败: %v", err)
+		}
+		result.Key = append(result.Key, key)
+		result.Sessions = append(result.Sessions, sessions)
+		result.PV = append(result.PV, pv)
+		result.UV = append(result.UV, uv)
+		totalSessions += sessions
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("遍历来源渠道统计失败: %v", err)
+	}
+
+	if totalSessions > 0 {
+		for _, sessions := range result.Sessions {
+			result.SessionsPercent = append(result.SessionsPercent,
+				int(math.Round(float64(sessions)/float64(totalSessions)*100)))
+		}
+	}
+	return result, nil
+}
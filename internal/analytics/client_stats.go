@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich"
 	"github.com/likaia/nginxpulse/internal/sqlutil"
 	"github.com/likaia/nginxpulse/internal/store"
 	"github.com/likaia/nginxpulse/internal/timeutil"
@@ -18,6 +19,9 @@ type ClientStats struct {
 	UV        []int    `json:"uv"`         // 独立访客数
 	PVPercent []int    `json:"pv_percent"` // PV 百分比
 	UVPercent []int    `json:"uv_percent"` // UV 百分比
+	// 仅地域统计返回：国家（global）或省级行政区（domestic / city）的 ISO 3166 代码，以及按语言设置本地化的名称
+	Codes []string `json:"codes,omitempty"`
+	Names []string `json:"names,omitempty"`
 }
 
 func (s ClientStats) GetType() string {
@@ -71,6 +75,30 @@ func NewLocationStatsManager(userRepoPtr *store.Repository) *ClientStatsManager
 	}
 }
 
+// NewRouteStatsManager 按归一化路由分组的 Top N 统计
+func NewRouteStatsManager(userRepoPtr *store.Repository) *ClientStatsManager {
+	return &ClientStatsManager{
+		repo:      userRepoPtr,
+		statsType: "route",
+	}
+}
+
+// NewExtraFieldStatsManager 按额外字段（extraFields）分组的 Top N 统计
+func NewExtraFieldStatsManager(userRepoPtr *store.Repository) *ClientStatsManager {
+	return &ClientStatsManager{
+		repo:      userRepoPtr,
+		statsType: "extra",
+	}
+}
+
+// NewNetworkStatsManager 按网络类型 / ASN / 组织分组的 Top N 统计
+func NewNetworkStatsManager(userRepoPtr *store.Repository) *ClientStatsManager {
+	return &ClientStatsManager{
+		repo:      userRepoPtr,
+		statsType: "network",
+	}
+}
+
 // 实现 StatsManager 接口
 func (s *ClientStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	result := ClientStats{
@@ -134,11 +162,20 @@ func (s *ClientStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	}
 
 	extraCondition := ""
+	var extraArgs []interface{}
+	// 地域统计额外返回的代码列
+	codeExpr := "''"
 	switch s.statsType {
 	case "url":
 		joinClause = fmt.Sprintf(`JOIN "%s_dim_url" u ON u.id = l.url_id`, query.WebsiteID)
 		selectExpr = "u.url"
 		groupExpr = "u.url"
+	case "route":
+		// 尚未归一化的历史日志回退到原始 URL，可通过 -rebuild-routes 重建
+		joinClause = fmt.Sprintf(`JOIN "%[1]s_dim_url" u ON u.id = l.url_id
+        LEFT JOIN "%[1]s_dim_route" rt ON rt.id = l.route_id`, query.WebsiteID)
+		selectExpr = "COALESCE(rt.route, u.url)"
+		groupExpr = selectExpr
 	case "referer":
 		joinClause = fmt.Sprintf(`JOIN "%s_dim_referer" r ON r.id = l.referer_id`, query.WebsiteID)
 	case "user_browser":
@@ -158,13 +195,66 @@ func (s *ClientStatsManager) Query(query StatsQuery) (StatsResult, error) {
 		if locationType == "global" {
 			selectExpr = "loc.global"
 			groupExpr = "loc.global"
-		} else if locationType != "domestic" && locationType != "city" {
+			codeExpr = "COALESCE(MAX(loc.country_code), '')"
+		} else if locationType == "domestic" || locationType == "city" {
+			codeExpr = "COALESCE(MAX(loc.region_code), '')"
+		} else {
 			selectExpr = "loc." + statsType
 			groupExpr = selectExpr
 		}
+	case "network":
+		joinClause = fmt.Sprintf(`LEFT JOIN "%s_dim_network" net ON net.id = l.network_id`, query.WebsiteID)
+		groupBy, _ := query.ExtraParam["groupBy"].(string)
+		expr, ok := networkGroupExprs[groupBy]
+		if !ok {
+			return result, fmt.Errorf("groupBy 参数无效: %s", groupBy)
+		}
+		selectExpr = expr
+		groupExpr = expr
+	}
+	// 浏览器 / 系统 / 设备下钻：在选中的分类内按版本（设备为品牌型号）分组，升级前的日志归为未知
+	if versionOf, _ := query.ExtraParam["versionOf"].(string); versionOf != "" {
+		versionExpr, ok := uaVersionExprs[s.statsType]
+		if !ok {
+			return result, fmt.Errorf("该统计类型不支持版本下钻: %s", s.statsType)
+		}
+		joinClause += fmt.Sprintf(`
+        LEFT JOIN "%s_dim_user_agent" uad ON uad.id = l.user_agent_id`, query.WebsiteID)
+		selectExpr = versionExpr
+		groupExpr = versionExpr
+		extraCondition = fmt.Sprintf(" AND ua.%s = ?", strings.TrimPrefix(s.statsType, "user_"))
+		extraArgs = append(extraArgs, versionOf)
 	}
 	if s.statsType == "location" && (locationType == "domestic" || locationType == "city") {
-		extraCondition = " AND loc.global = '中国'"
+		// 港澳台的国家代码同为 CN（地区代码 CN-HK / CN-MO / CN-TW）
+		extraCondition = " AND loc.country_code = 'CN'"
+	}
+	if s.statsType == "extra" {
+		field, _ := query.ExtraParam["field"].(string)
+		if !isExtraFieldAllowed(query.WebsiteID, field) {
+			return result, fmt.Errorf("额外字段未在 extraFields 中配置: %s", field)
+		}
+		// 字段名已通过白名单校验，分组表达式需与 SELECT 一致，因此直接拼接
+		selectExpr = fmt.Sprintf("l.extra ->> '%s'", strings.ReplaceAll(field, "'", "''"))
+		groupExpr = selectExpr
+		extraCondition = fmt.Sprintf(" AND %s IS NOT NULL", selectExpr)
+	}
+	// 网络类型 / ASN 过滤，适用于所有 Top N 统计
+	networkType, _ := query.ExtraParam["networkType"].(string)
+	asn, _ := query.ExtraParam["asn"].(int)
+	if networkType != "" || asn > 0 {
+		if s.statsType != "network" {
+			joinClause += fmt.Sprintf(`
+        LEFT JOIN "%s_dim_network" net ON net.id = l.network_id`, query.WebsiteID)
+		}
+		if networkType != "" {
+			extraCondition += " AND COALESCE(net.network_type, 'unknown') = ?"
+			extraArgs = append(extraArgs, networkType)
+		}
+		if asn > 0 {
+			extraCondition += " AND net.asn = ?"
+			extraArgs = append(extraArgs, asn)
+		}
 	}
 
 	// 构建、执行查询
@@ -172,16 +262,18 @@ func (s *ClientStatsManager) Query(query StatsQuery) (StatsResult, error) {
         SELECT 
             %[1]s AS url, 
             COUNT(*) AS pv,
-            COUNT(DISTINCT l.ip_id) AS uv
+            COUNT(DISTINCT l.ip_id) AS uv,
+            %[6]s AS code
         FROM "%[2]s_nginx_logs" l
         %[4]s
         WHERE l.pageview_flag = 1 AND l.timestamp >= ? AND l.timestamp < ?%[5]s
         GROUP BY %[3]s
         ORDER BY uv DESC
         LIMIT ?`,
-		selectExpr, query.WebsiteID, groupExpr, joinClause, extraCondition))
+		selectExpr, query.WebsiteID, groupExpr, joinClause, extraCondition, codeExpr))
 
-	rows, err := s.repo.GetDB().Query(dbQueryStr, startTime.Unix(), endTime.Unix(), limit)
+	args := append([]interface{}{startTime.Unix(), endTime.Unix()}, extraArgs...)
+	rows, err := s.repo.GetDB().Query(dbQueryStr, append(args, limit)...)
 	if err != nil {
 		return result, fmt.Errorf("查询URL统计失败: %v", err)
 	}
@@ -191,11 +283,15 @@ func (s *ClientStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	totalUV := 0
 
 	for rows.Next() {
-		var url string
+		var url, code string
 		var pv, uv int
-		if err := rows.Scan(&url, &pv, &uv); err != nil {
+		if err := rows.Scan(&url, &pv, &uv, &code); err != nil {
 			return result, fmt.Errorf("解析URL统计结果失败: %v", err)
 		}
+		if s.statsType == "location" {
+			result.Codes = append(result.Codes, code)
+			result.Names = append(result.Names, localizedLocationName(locationType, url, code))
+		}
 		result.Key = append(result.Key, url)
 		result.PV = append(result.PV, pv)
 		result.UV = append(result.UV, uv)
@@ -222,6 +318,56 @@ func (s *ClientStatsManager) Query(query StatsQuery) (StatsResult, error) {
 
 }
 
+// localizedLocationName 按语言设置返回地名，城市与无代码的记录使用原始文本
+func localizedLocationName(locationType, label, code string) string {
+	if code == "" || locationType == "city" {
+		return label
+	}
+	if locationType == "global" {
+		return enrich.LocalizedCountryName(code)
+	}
+	return enrich.LocalizedRegionName(code)
+}
+
+// 版本下钻的分组表达式
+var uaVersionExprs = map[string]string{
+	"user_browser": "COALESCE(NULLIF(TRIM(uad.browser || ' ' || uad.browser_version), ''), '未知版本')",
+	"user_os":      "COALESCE(NULLIF(TRIM(uad.os || ' ' || uad.os_version), ''), '未知版本')",
+	"user_device":  "COALESCE(NULLIF(TRIM(uad.device_brand || ' ' || uad.device_model), ''), '未知型号')",
+}
+
+// 网络统计的分组表达式，未分类的历史日志归为 unknown / 未知
+var networkGroupExprs = map[string]string{
+	"":     "COALESCE(net.network_type, 'unknown')",
+	"type": "COALESCE(net.network_type, 'unknown')",
+	"asn":  "CASE WHEN net.asn > 0 THEN 'AS' || net.asn || ' ' || net.org ELSE '未知' END",
+	"org":  "COALESCE(NULLIF(net.org, ''), '未知')",
+}
+
+// isExtraFieldAllowed 字段需出现在站点或任一来源的 extraFields 中
+func isExtraFieldAllowed(websiteID, field string) bool {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return false
+	}
+	website, ok := config.GetWebsiteByID(websiteID)
+	if !ok {
+		return false
+	}
+	allowed := append([]string{}, website.ExtraFields...)
+	for _, src := range website.Sources {
+		if src.Parse != nil {
+			allowed = append(allowed, src.Parse.ExtraFields...)
+		}
+	}
+	for _, name := range allowed {
+		if strings.TrimSpace(name) == field {
+			return true
+		}
+	}
+	return false
+}
+
 func buildInternalRefererCondition(domains []string, refererColumn string) string {
 	conditions := make([]string, 0, len(domains))
 	for _, raw := range domains {
@@ -1,6 +1,7 @@
 package analytics
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -14,38 +15,53 @@ import (
 
 // LogEntry 表示单条日志信息
 type LogEntry struct {
-	ID               int    `json:"id"`
-	IP               string `json:"ip"`
-	Timestamp        int64  `json:"timestamp"`
-	Time             string `json:"time"` // 格式化后的时间字符串
-	Method           string `json:"method"`
-	URL              string `json:"url"`
-	StatusCode       int    `json:"status_code"`
-	BytesSent        int    `json:"bytes_sent"`
-	Referer          string `json:"referer"`
-	UserBrowser      string `json:"user_browser"`
-	UserOS           string `json:"user_os"`
-	UserDevice       string `json:"user_device"`
-	DomesticLocation string `json:"domestic_location"`
-	GlobalLocation   string `json:"global_location"`
-	PageviewFlag     bool   `json:"pageview_flag"`
-	IsNewVisitor     bool   `json:"is_new_visitor"`
+	ID                 int    `json:"id"`
+	IP                 string `json:"ip"`
+	Timestamp          int64  `json:"timestamp"`
+	Time               string `json:"time"` // 格式化后的时间字符串
+	Method             string `json:"method"`
+	URL                string `json:"url"`
+	Route              string `json:"route"`
+	StatusCode         int    `json:"status_code"`
+	BytesSent          int    `json:"bytes_sent"`
+	Referer            string `json:"referer"`
+	UserBrowser        string `json:"user_browser"`
+	UserOS             string `json:"user_os"`
+	UserDevice         string `json:"user_device"`
+	UserAgent          string `json:"user_agent"`
+	DomesticLocation   string `json:"domestic_location"`
+	GlobalLocation     string `json:"global_location"`
+	PageviewFlag       bool   `json:"pageview_flag"`
+	IsNewVisitor       bool   `json:"is_new_visitor"`
+	ASN                int64  `json:"asn"`
+	NetworkOrg         string `json:"network_org"`
+	NetworkType        string `json:"network_type"`
+	CountryCode        string `json:"country_code"`
+	RegionCode         string `json:"region_code"`
+	AttackType         string `json:"attack_type"`
+	AttackRule         string `json:"attack_rule"`
+	AttackSeverity     string `json:"attack_severity"`
+	ReputationList     string `json:"reputation_list"`
+	ReputationCategory string `json:"reputation_category"`
+	// Extra 按 extraFields 白名单采集的额外字段
+	Extra map[string]string `json:"extra,omitempty"`
 }
 
 // LogsStats 日志查询结果
 type LogsStats struct {
-	Logs                               []LogEntry `json:"logs"`
-	IPParsing                          bool       `json:"ip_parsing"`
-	IPParsingProgress                  int        `json:"ip_parsing_progress"`
-	IPParsingEstimatedTotalSeconds     int64      `json:"ip_parsing_estimated_total_seconds,omitempty"`
-	IPParsingEstimatedRemainingSeconds int64      `json:"ip_parsing_estimated_remaining_seconds,omitempty"`
-	IPGeoParsing                       bool       `json:"ip_geo_parsing"`
-	IPGeoPending                       bool       `json:"ip_geo_pending"`
-	IPGeoProgress                      int        `json:"ip_geo_progress,omitempty"`
-	IPGeoEstimatedRemainingSeconds     int64      `json:"ip_geo_estimated_remaining_seconds,omitempty"`
-	ParsingPending                     bool       `json:"parsing_pending"`
-	ParsingPendingRange                *TimeRange `json:"parsing_pending_range,omitempty"`
-	ParsingPendingProgress             int        `json:"parsing_pending_progress,omitempty"`
+	Logs                               []LogEntry                `json:"logs"`
+	IPParsing                          bool                      `json:"ip_parsing"`
+	IPParsingProgress                  int                       `json:"ip_parsing_progress"`
+	IPParsingEstimatedTotalSeconds     int64                     `json:"ip_parsing_estimated_total_seconds,omitempty"`
+	IPParsingEstimatedRemainingSeconds int64                     `json:"ip_parsing_estimated_remaining_seconds,omitempty"`
+	IPParsingThroughput                *ingest.ParsingThroughput `json:"ip_parsing_throughput,omitempty"`
+	IPGeoParsing                       bool                      `json:"ip_geo_parsing"`
+	IPGeoPending                       bool                      `json:"ip_geo_pending"`
+	IPGeoProgress                      int                       `json:"ip_geo_progress,omitempty"`
+	IPGeoEstimatedRemainingSeconds     int64                     `json:"ip_geo_estimated_remaining_seconds,omitempty"`
+	ParsingPending                     bool                      `json:"parsing_pending"`
+	ParsingPendingRange                *TimeRange                `json:"parsing_pending_range,omitempty"`
+	ParsingPendingProgress             int                       `json:"parsing_pending_progress,omitempty"`
 	Pagination                         struct {
 		Total    int `json:"total"`
 		Page     int `json:"page"`
@@ -84,6 +100,10 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	result.IPParsingProgress = ingest.GetIPParsingProgress()
 	result.IPParsingEstimatedTotalSeconds = ingest.GetIPParsingEstimatedTotalSeconds()
 	result.IPParsingEstimatedRemainingSeconds = ingest.GetIPParsingEstimatedRemainingSeconds()
+	if result.IPParsing {
+		throughput := ingest.GetIPParsingThroughput()
+		result.IPParsingThroughput = &throughput
+	}
 	result.IPGeoParsing = ingest.IsIPGeoParsing()
 	if m.repo != nil {
 		if pendingCount, err := m.repo.CountIPGeoPending(); err == nil {
@@ -112,6 +132,13 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	var ipFilter string
 	var locationFilter string
 	var urlFilter string
+	var routeFilter string
+	var networkType string
+	var asnFilter int
+	var attackType string
+	var reputation string
+	var extraField string
+	var extraValue string
 	var pageviewOnly bool
 	var newVisitorFilter string
 	var includeNewVisitor bool
@@ -191,6 +218,27 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	if urlFilterVal, ok := query.ExtraParam["urlFilter"].(string); ok {
 		urlFilter = strings.TrimSpace(urlFilterVal)
 	}
+	if routeFilterVal, ok := query.ExtraParam["routeFilter"].(string); ok {
+		routeFilter = strings.TrimSpace(routeFilterVal)
+	}
+	if networkTypeVal, ok := query.ExtraParam["networkType"].(string); ok {
+		networkType = strings.TrimSpace(networkTypeVal)
+	}
+	if asnVal, ok := query.ExtraParam["asn"].(int); ok {
+		asnFilter = asnVal
+	}
+	if attackTypeVal, ok := query.ExtraParam["attackType"].(string); ok {
+		attackType = strings.TrimSpace(attackTypeVal)
+	}
+	if reputationVal, ok := query.ExtraParam["reputation"].(string); ok {
+		reputation = strings.TrimSpace(reputationVal)
+	}
+	if extraFieldVal, ok := query.ExtraParam["extraField"].(string); ok {
+		extraField = strings.TrimSpace(extraFieldVal)
+	}
+	if extraValueVal, ok := query.ExtraParam["extraValue"].(string); ok {
+		extraValue = extraValueVal
+	}
 	if pageviewOnlyVal, ok := query.ExtraParam["pageviewOnly"].(bool); ok {
 		pageviewOnly = pageviewOnlyVal
 	}
@@ -232,7 +280,17 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
         JOIN "%s_dim_url" u ON u.id = %s.url_id
         JOIN "%s_dim_referer" r ON r.id = %s.referer_id
         JOIN "%s_dim_ua" ua ON ua.id = %s.ua_id
-        JOIN "%s_dim_location" loc ON loc.id = %s.location_id`,
+        JOIN "%s_dim_location" loc ON loc.id = %s.location_id
+        LEFT JOIN "%s_dim_route" rt ON rt.id = %s.route_id
+        LEFT JOIN "%s_dim_user_agent" uad ON uad.id = %s.user_agent_id
+        LEFT JOIN "%s_dim_network" net ON net.id = %s.network_id
+        LEFT JOIN "%s_dim_attack" atk ON atk.id = %s.attack_id
+        LEFT JOIN "%s_dim_reputation" rep ON rep.id = %s.reputation_id`,
+		query.WebsiteID, logAlias,
+		query.WebsiteID, logAlias,
+		query.WebsiteID, logAlias,
+		query.WebsiteID, logAlias,
+		query.WebsiteID, logAlias,
 		query.WebsiteID, logAlias,
 		query.WebsiteID, logAlias,
 		query.WebsiteID, logAlias,
@@ -245,6 +303,8 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 			return "ip.ip"
 		case "url":
 			return "u.url"
+		case "route":
+			return "COALESCE(rt.route, u.url)"
 		case "referer":
 			return "r.referer"
 		case "user_browser":
@@ -253,10 +313,34 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 			return "ua.os"
 		case "user_device":
 			return "ua.device"
+		case "user_agent":
+			return "COALESCE(uad.user_agent, '')"
+		case "asn":
+			return "COALESCE(net.asn, 0)"
+		case "network_org":
+			return "COALESCE(net.org, '')"
+		case "network_type":
+			return "COALESCE(net.network_type, 'unknown')"
 		case "domestic_location":
 			return "loc.domestic"
 		case "global_location":
 			return "loc.global"
+		case "country_code":
+			return "COALESCE(loc.country_code, '')"
+		case "region_code":
+			return "COALESCE(loc.region_code, '')"
+		case "attack_type":
+			return "COALESCE(atk.attack_type, '')"
+		case "attack_rule":
+			return "COALESCE(atk.rule_id, '')"
+		case "attack_severity":
+			return "COALESCE(atk.severity, '')"
+		case "reputation_list":
+			return "COALESCE(rep.list_name, '')"
+		case "reputation_category":
+			return "COALESCE(rep.category, '')"
+		case "extra":
+			return fmt.Sprintf("COALESCE(%s.extra::text, '')", logAlias)
 		default:
 			return fmt.Sprintf("%s.%s", logAlias, name)
 		}
@@ -266,9 +350,12 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	var queryBuilder strings.Builder
 	var args []interface{}
 	selectFields := []string{
-		"id", "ip", "timestamp", "method", "url", "status_code",
-		"bytes_sent", "referer", "user_browser", "user_os", "user_device",
-		"domestic_location", "global_location", "pageview_flag",
+		"id", "ip", "timestamp", "method", "url", "route", "status_code",
+		"bytes_sent", "referer", "user_browser", "user_os", "user_device", "user_agent",
+		"domestic_location", "global_location", "pageview_flag", "extra",
+		"asn", "network_org", "network_type", "country_code", "region_code",
+		"attack_type", "attack_rule", "attack_severity",
+		"reputation_list", "reputation_category",
 	}
 	selectColumns := make([]string, 0, len(selectFields))
 	for _, field := range selectFields {
@@ -336,6 +423,33 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 		conditions = append(conditions, fmt.Sprintf("%s LIKE ?", column("url")))
 		args = append(args, "%"+urlFilter+"%")
 	}
+	if routeFilter != "" {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", column("route")))
+		args = append(args, routeFilter)
+	}
+	if networkType != "" {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", column("network_type")))
+		args = append(args, networkType)
+	}
+	if asnFilter > 0 {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", column("asn")))
+		args = append(args, asnFilter)
+	}
+	if attackType != "" {
+		condition, attackArgs := buildAttackTypeCondition(logAlias, attackType)
+		conditions = append(conditions, condition)
+		args = append(args, attackArgs...)
+	}
+	if reputation != "" {
+		condition, reputationArgs := buildReputationCondition(logAlias, reputation)
+		conditions = append(conditions, condition)
+		args = append(args, reputationArgs...)
+	}
+	if extraField != "" {
+		extraCondition, extraArgs := buildExtraFieldCondition(logAlias, extraField, extraValue)
+		conditions = append(conditions, extraCondition)
+		args = append(args, extraArgs...)
+	}
 	if statusCode > 0 {
 		conditions = append(conditions, fmt.Sprintf("%s = ?", column("status_code")))
 		args = append(args, statusCode)
@@ -362,8 +476,8 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 		args = append(args, botDeviceLabel)
 	}
 	if excludeForeign {
-		conditions = append(conditions, fmt.Sprintf("(%s = ? OR LOWER(%s) = ?)", column("global_location"), column("global_location")))
-		args = append(args, "中国", "china")
+		conditions = append(conditions, fmt.Sprintf("%s = ?", column("country_code")))
+		args = append(args, "CN")
 	}
 	if pageviewOnly {
 		conditions = append(conditions, fmt.Sprintf("%s = 1", column("pageview_flag")))
@@ -455,16 +569,23 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 		var log LogEntry
 		var pageviewFlag int
 		var isNewVisitor int
+		var extraRaw string
 		var err error
 
 		if includeNewVisitor {
-			err = rows.Scan(&log.ID, &log.IP, &log.Timestamp, &log.Method, &log.URL, &log.StatusCode,
-				&log.BytesSent, &log.Referer, &log.UserBrowser, &log.UserOS, &log.UserDevice,
-				&log.DomesticLocation, &log.GlobalLocation, &pageviewFlag, &isNewVisitor)
+			err = rows.Scan(&log.ID, &log.IP, &log.Timestamp, &log.Method, &log.URL, &log.Route, &log.StatusCode,
+				&log.BytesSent, &log.Referer, &log.UserBrowser, &log.UserOS, &log.UserDevice, &log.UserAgent,
+				&log.DomesticLocation, &log.GlobalLocation, &pageviewFlag, &extraRaw,
+				&log.ASN, &log.NetworkOrg, &log.NetworkType, &log.CountryCode, &log.RegionCode,
+				&log.AttackType, &log.AttackRule, &log.AttackSeverity,
+				&log.ReputationList, &log.ReputationCategory, &isNewVisitor)
 		} else {
-			err = rows.Scan(&log.ID, &log.IP, &log.Timestamp, &log.Method, &log.URL, &log.StatusCode,
-				&log.BytesSent, &log.Referer, &log.UserBrowser, &log.UserOS, &log.UserDevice,
-				&log.DomesticLocation, &log.GlobalLocation, &pageviewFlag)
+			err = rows.Scan(&log.ID, &log.IP, &log.Timestamp, &log.Method, &log.URL, &log.Route, &log.StatusCode,
+				&log.BytesSent, &log.Referer, &log.UserBrowser, &log.UserOS, &log.UserDevice, &log.UserAgent,
+				&log.DomesticLocation, &log.GlobalLocation, &pageviewFlag, &extraRaw,
+				&log.ASN, &log.NetworkOrg, &log.NetworkType, &log.CountryCode, &log.RegionCode,
+				&log.AttackType, &log.AttackRule, &log.AttackSeverity,
+				&log.ReputationList, &log.ReputationCategory)
 		}
 
 		if err != nil {
@@ -479,6 +600,11 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 		if includeNewVisitor {
 			log.IsNewVisitor = isNewVisitor == 1
 		}
+		if extraRaw != "" {
+			if err := json.Unmarshal([]byte(extraRaw), &log.Extra); err != nil {
+				return result, fmt.Errorf("解析额外字段失败: %v", err)
+			}
+		}
 
 		logs = append(logs, log)
 	}
@@ -535,6 +661,33 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 		countConditions = append(countConditions, fmt.Sprintf("%s LIKE ?", column("url")))
 		countArgs = append(countArgs, "%"+urlFilter+"%")
 	}
+	if routeFilter != "" {
+		countConditions = append(countConditions, fmt.Sprintf("%s = ?", column("route")))
+		countArgs = append(countArgs, routeFilter)
+	}
+	if networkType != "" {
+		countConditions = append(countConditions, fmt.Sprintf("%s = ?", column("network_type")))
+		countArgs = append(countArgs, networkType)
+	}
+	if asnFilter > 0 {
+		countConditions = append(countConditions, fmt.Sprintf("%s = ?", column("asn")))
+		countArgs = append(countArgs, asnFilter)
+	}
+	if attackType != "" {
+		condition, attackArgs := buildAttackTypeCondition(logAlias, attackType)
+		countConditions = append(countConditions, condition)
+		countArgs = append(countArgs, attackArgs...)
+	}
+	if reputation != "" {
+		condition, reputationArgs := buildReputationCondition(logAlias, reputation)
+		countConditions = append(countConditions, condition)
+		countArgs = append(countArgs, reputationArgs...)
+	}
+	if extraField != "" {
+		extraCondition, extraArgs := buildExtraFieldCondition(logAlias, extraField, extraValue)
+		countConditions = append(countConditions, extraCondition)
+		countArgs = append(countArgs, extraArgs...)
+	}
 	if statusCode > 0 {
 		countConditions = append(countConditions, fmt.Sprintf("%s = ?", column("status_code")))
 		countArgs = append(countArgs, statusCode)
@@ -561,8 +714,8 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 		countArgs = append(countArgs, botDeviceLabel)
 	}
 	if excludeForeign {
-		countConditions = append(countConditions, fmt.Sprintf("(%s = ? OR LOWER(%s) = ?)", column("global_location"), column("global_location")))
-		countArgs = append(countArgs, "中国", "china")
+		countConditions = append(countConditions, fmt.Sprintf("%s = ?", column("country_code")))
+		countArgs = append(countArgs, "CN")
 	}
 	if pageviewOnly {
 		countConditions = append(countConditions, fmt.Sprintf("%s = 1", column("pageview_flag")))
@@ -598,6 +751,35 @@ func (m *LogsStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	return result, nil
 }
 
+// buildExtraFieldCondition 额外字段过滤：指定值时按 JSONB 包含匹配（可走 GIN 索引），否则只要求字段存在
+func buildExtraFieldCondition(logAlias, field, value string) (string, []interface{}) {
+	if value == "" {
+		return fmt.Sprintf("%s.extra ->> ? IS NOT NULL", logAlias), []interface{}{field}
+	}
+	encoded, _ := json.Marshal(map[string]string{field: value})
+	return fmt.Sprintf("%s.extra @> CAST(CAST(? AS TEXT) AS JSONB)", logAlias), []interface{}{string(encoded)}
+}
+
+// buildAttackTypeCondition 攻击类型过滤："any" 表示命中任意攻击特征
+func buildAttackTypeCondition(logAlias, attackType string) (string, []interface{}) {
+	if attackType == "any" {
+		return fmt.Sprintf("%s.attack_id IS NOT NULL", logAlias), nil
+	}
+	return "atk.attack_type = ?", []interface{}{attackType}
+}
+
+// buildReputationCondition 信誉名单过滤："any" 表示命中任意名单，"none" 表示未命中，
+// 其余值匹配名单名称或分类（tor / drop / blocklist）
+func buildReputationCondition(logAlias, reputation string) (string, []interface{}) {
+	switch reputation {
+	case "any":
+		return fmt.Sprintf("%s.reputation_id IS NOT NULL", logAlias), nil
+	case "none":
+		return fmt.Sprintf("%s.reputation_id IS NULL", logAlias), nil
+	}
+	return "(rep.list_name = ? OR rep.category = ?)", []interface{}{reputation, reputation}
+}
+
 func countSelect(distinctIP bool) string {
 	if distinctIP {
 		return "COUNT(DISTINCT l.ip_id)"
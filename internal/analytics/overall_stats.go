@@ -608,6 +608,9 @@ func previousTimeRange(timeRange string) (time.Time, time.Time) {
 	case "week":
 		start, end, _ := timeutil.TimePeriod("week")
 		return start.AddDate(0, 0, -7), end.AddDate(0, 0, -7)
+	case "lastweek":
+		start, end, _ := timeutil.TimePeriod("lastweek")
+		return start.AddDate(0, 0, -7), end.AddDate(0, 0, -7)
 	case "month":
 		start, _, _ := timeutil.TimePeriod("month")
 		prevEnd := start.Add(-time.Second)
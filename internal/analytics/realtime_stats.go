@@ -109,6 +109,12 @@ func (m *RealtimeStatsManager) Query(query StatsQuery) (StatsResult, error) {
 	return result, nil
 }
 
+// ActiveVisitors 最近 window 内的活跃访客数，与实时统计的 activeCount 定义一致
+func (m *RealtimeStatsManager) ActiveVisitors(websiteID string, window time.Duration) (int, error) {
+	endTime := time.Now()
+	return m.activeVisitorCount(fmt.Sprintf("%s_nginx_logs", websiteID), endTime.Add(-window), endTime)
+}
+
 func (m *RealtimeStatsManager) activeVisitorCount(tableName string, startTime, endTime time.Time) (int, error) {
 	query := sqlutil.ReplacePlaceholders(fmt.Sprintf(`
         SELECT COUNT(DISTINCT ip_id)
@@ -0,0 +1,598 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/likaia/nginxpulse/internal/timeutil"
+)
+
+// 报告分节
+const (
+	ReportSectionOverview  = "overview"
+	ReportSectionTopURLs   = "top_urls"
+	ReportSectionReferers  = "referers"
+	ReportSectionErrors    = "errors"
+	ReportSectionVisitors  = "visitors"
+	ReportSectionCountries = "countries"
+)
+
+// ReportSections 支持的分节，按报告中的展示顺序排列
+var ReportSections = []string{
+	ReportSectionOverview,
+	ReportSectionTopURLs,
+	ReportSectionReferers,
+	ReportSectionErrors,
+	ReportSectionVisitors,
+	ReportSectionCountries,
+}
+
+const (
+	maxReportNameLen = 100
+	defaultReportTop = 10
+	maxReportTop     = 100
+)
+
+// NormalizeReportDefinition 校验报告定义并填充默认值
+func NormalizeReportDefinition(report *store.ReportDefinition) error {
+	if err := NormalizeReportPreview(report); err != nil {
+		return err
+	}
+	report.Channel = strings.TrimSpace(report.Channel)
+	if report.Channel == "" {
+		return fmt.Errorf("channel 不能为空")
+	}
+	if !reportChannelExists(report.Channel) {
+		return fmt.Errorf("通知渠道不存在: %s", report.Channel)
+	}
+	return nil
+}
+
+// NormalizeReportPreview 校验预览所需的字段，不要求配置渠道
+func NormalizeReportPreview(report *store.ReportDefinition) error {
+	report.Name = strings.TrimSpace(report.Name)
+	if report.Name == "" {
+		return fmt.Errorf("报告名称不能为空")
+	}
+	if len([]rune(report.Name)) > maxReportNameLen {
+		return fmt.Errorf("报告名称不能超过 %d 个字符", maxReportNameLen)
+	}
+
+	websiteIDs := make([]string, 0, len(report.WebsiteIDs))
+	seen := make(map[string]struct{}, len(report.WebsiteIDs))
+	for _, id := range report.WebsiteIDs {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		if _, ok := config.GetWebsiteByID(id); !ok {
+			return fmt.Errorf("站点不存在: %s", id)
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		websiteIDs = append(websiteIDs, id)
+	}
+	report.WebsiteIDs = websiteIDs
+
+	report.Schedule = strings.TrimSpace(report.Schedule)
+	if report.Schedule == "" {
+		report.Schedule = store.ReportScheduleDaily
+	}
+	defaultRange := "yesterday"
+	switch report.Schedule {
+	case store.ReportScheduleDaily:
+	case store.ReportScheduleWeekly:
+		defaultRange = "lastweek"
+		if report.Weekday < 0 || report.Weekday > 6 {
+			return fmt.Errorf("weekday 范围为 0（周日）~ 6")
+		}
+	default:
+		return fmt.Errorf("schedule 仅支持 daily、weekly")
+	}
+	if report.Hour < 0 || report.Hour > 23 {
+		return fmt.Errorf("hour 范围为 0 ~ 23")
+	}
+
+	report.TimeRange = strings.TrimSpace(report.TimeRange)
+	if report.TimeRange == "" {
+		report.TimeRange = defaultRange
+	}
+	if _, _, err := timeutil.TimePeriod(report.TimeRange); err != nil {
+		return fmt.Errorf("time_range 无效: %s", report.TimeRange)
+	}
+
+	sections := make([]string, 0, len(ReportSections))
+	for _, section := range report.Sections {
+		section = strings.TrimSpace(section)
+		if !isReportSection(section) {
+			return fmt.Errorf("不支持的报告分节: %s", section)
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) == 0 {
+		sections = append(sections, ReportSections...)
+	}
+	report.Sections = orderReportSections(sections)
+
+	if report.Limit == 0 {
+		report.Limit = defaultReportTop
+	}
+	if report.Limit < 1 || report.Limit > maxReportTop {
+		return fmt.Errorf("limit 范围为 1 ~ %d", maxReportTop)
+	}
+	return nil
+}
+
+func isReportSection(section string) bool {
+	for _, candidate := range ReportSections {
+		if candidate == section {
+			return true
+		}
+	}
+	return false
+}
+
+// orderReportSections 去重并按 ReportSections 的顺序排列
+func orderReportSections(sections []string) []string {
+	selected := make(map[string]struct{}, len(sections))
+	for _, section := range sections {
+		selected[section] = struct{}{}
+	}
+	ordered := make([]string, 0, len(selected))
+	for _, section := range ReportSections {
+		if _, ok := selected[section]; ok {
+			ordered = append(ordered, section)
+		}
+	}
+	return ordered
+}
+
+func reportChannelExists(name string) bool {
+	cfg := config.ReadConfig().Notifications
+	if cfg == nil {
+		return false
+	}
+	for _, channel := range cfg.Channels {
+		if strings.TrimSpace(channel.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReportData 渲染报告所需的数据，每个站点一节
+type ReportData struct {
+	ID          int64        `json:"id"`
+	Title       string       `json:"title"`
+	TimeRange   string       `json:"time_range"`
+	Period      string       `json:"period"`
+	Sections    []string     `json:"sections"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Sites       []ReportSite `json:"sites"`
+}
+
+// ReportSite 单个站点的报告内容，未选择的分节为空
+type ReportSite struct {
+	WebsiteID   string                `json:"website_id"`
+	WebsiteName string                `json:"website_name"`
+	Overview    *OverallStats         `json:"overview,omitempty"`
+	TopURLs     *ClientStats          `json:"top_urls,omitempty"`
+	Referers    *ClientStats          `json:"referers,omitempty"`
+	Countries   *ClientStats          `json:"countries,omitempty"`
+	ErrorURLs   []store.ErrorURLCount `json:"error_urls,omitempty"`
+}
+
+// BuildReport 按报告定义查询各站点的统计数据，复用 overall / url / referer / location 统计管理器
+func (f *StatsFactory) BuildReport(report store.ReportDefinition) (*ReportData, error) {
+	startTime, endTime, err := timeutil.TimePeriod(report.TimeRange)
+	if err != nil {
+		return nil, fmt.Errorf("解析时间范围失败: %v", err)
+	}
+	period := startTime.Format("2006-01-02")
+	if endDay := endTime.Format("2006-01-02"); endDay != period {
+		period += " ~ " + endDay
+	}
+
+	websiteIDs := report.WebsiteIDs
+	if len(websiteIDs) == 0 {
+		websiteIDs = config.GetAllWebsiteIDs()
+	}
+	sites := make([]ReportSite, 0, len(websiteIDs))
+	for _, id := range websiteIDs {
+		website, ok := config.GetWebsiteByID(id)
+		if !ok {
+			continue
+		}
+		sites = append(sites, ReportSite{WebsiteID: id, WebsiteName: website.Name})
+	}
+	if len(report.WebsiteIDs) == 0 {
+		// 全部站点时按名称排序，指定站点时保持定义中的顺序
+		sort.SliceStable(sites, func(i, j int) bool {
+			return sites[i].WebsiteName < sites[j].WebsiteName
+		})
+	}
+
+	sections := make(map[string]bool, len(report.Sections))
+	for _, section := range report.Sections {
+		sections[section] = true
+	}
+	limit := report.Limit
+	if limit <= 0 {
+		limit = defaultReportTop
+	}
+
+	for i := range sites {
+		site := &sites[i]
+		if sections[ReportSectionOverview] || sections[ReportSectionErrors] || sections[ReportSectionVisitors] {
+			result, err := f.QueryStats("overall", StatsQuery{
+				WebsiteID:  site.WebsiteID,
+				ExtraParam: map[string]interface{}{"timeRange": report.TimeRange},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("站点 %s 总体统计失败: %v", site.WebsiteName, err)
+			}
+			overall := result.(OverallStats)
+			site.Overview = &overall
+		}
+		clientQueries := []struct {
+			section string
+			manager string
+			target  **ClientStats
+		}{
+			{ReportSectionTopURLs, "url", &site.TopURLs},
+			{ReportSectionReferers, "referer", &site.Referers},
+			{ReportSectionCountries, "location", &site.Countries},
+		}
+		for _, item := range clientQueries {
+			if !sections[item.section] {
+				continue
+			}
+			params := map[string]interface{}{"timeRange": report.TimeRange, "limit": limit}
+			if item.manager == "location" {
+				params["locationType"] = "global"
+			}
+			result, err := f.QueryStats(item.manager, StatsQuery{WebsiteID: site.WebsiteID, ExtraParam: params})
+			if err != nil {
+				return nil, fmt.Errorf("站点 %s %s 统计失败: %v", site.WebsiteName, item.manager, err)
+			}
+			stats := result.(ClientStats)
+			*item.target = &stats
+		}
+		if sections[ReportSectionErrors] {
+			errorURLs, err := f.repo.TopErrorURLs(site.WebsiteID, startTime.Unix(), endTime.Unix()+1, limit)
+			if err != nil {
+				return nil, fmt.Errorf("站点 %s 错误请求统计失败: %v", site.WebsiteName, err)
+			}
+			site.ErrorURLs = errorURLs
+		}
+	}
+
+	return &ReportData{
+		ID:          report.ID,
+		Title:       fmt.Sprintf("%s（%s）", report.Name, period),
+		TimeRange:   report.TimeRange,
+		Period:      period,
+		Sections:    report.Sections,
+		GeneratedAt: time.Now(),
+		Sites:       sites,
+	}, nil
+}
+
+// reportRow 三种输出格式共用的表格行
+type reportRow struct {
+	Item   string
+	Status string
+	PV     string
+	UV     string
+	Value  string
+	Change string
+	// Raw CSV 中使用的原始数值（如流量字节数），为空时使用 Value
+	Raw string
+}
+
+type reportTable struct {
+	Section string
+	Title   string
+	Columns []string
+	Rows    []reportRow
+}
+
+type reportSiteView struct {
+	WebsiteID   string
+	WebsiteName string
+	Tables      []reportTable
+}
+
+// reportTables 将站点数据整理成表格，HTML / Markdown / CSV 共用同一份结构
+func reportTables(data *ReportData, site ReportSite) []reportTable {
+	tables := make([]reportTable, 0, len(data.Sections))
+	for _, section := range data.Sections {
+		switch section {
+		case ReportSectionOverview:
+			if site.Overview == nil {
+				continue
+			}
+			overview := site.Overview
+			previous := overview.Compare.Previous
+			tables = append(tables, reportTable{
+				Section: section,
+				Title:   "概览",
+				Columns: []string{"指标", "数值", "环比"},
+				Rows: []reportRow{
+					{Item: "PV", Value: strconv.Itoa(overview.PV), Change: formatChange(overview.PV, previous.PV)},
+					{Item: "UV", Value: strconv.Itoa(overview.UV), Change: formatChange(overview.UV, previous.UV)},
+					{Item: "会话数", Value: strconv.Itoa(overview.SessionCount), Change: formatChange(overview.SessionCount, previous.SessionCount)},
+					{Item: "流量", Value: formatReportBytes(overview.Traffic), Raw: strconv.FormatInt(overview.Traffic, 10)},
+				},
+			})
+		case ReportSectionTopURLs, ReportSectionReferers, ReportSectionCountries:
+			stats, title, column := site.TopURLs, "热门页面", "URL"
+			if section == ReportSectionReferers {
+				stats, title, column = site.Referers, "来源", "来源"
+			} else if section == ReportSectionCountries {
+				stats, title, column = site.Countries, "国家 / 地区", "国家 / 地区"
+			}
+			if stats == nil {
+				continue
+			}
+			table := reportTable{Section: section, Title: title, Columns: []string{column, "PV", "UV"}}
+			for i, key := range stats.Key {
+				row := reportRow{Item: key}
+				if i < len(stats.PV) {
+					row.PV = strconv.Itoa(stats.PV[i])
+				}
+				if i < len(stats.UV) {
+					row.UV = strconv.Itoa(stats.UV[i])
+				}
+				table.Rows = append(table.Rows, row)
+			}
+			tables = append(tables, table)
+		case ReportSectionErrors:
+			table := reportTable{Section: section, Title: "错误请求", Columns: []string{"URL", "状态码", "次数"}}
+			if site.Overview != nil {
+				current, previous := site.Overview.StatusCodeHits, site.Overview.StatusCodeHitsPrevious
+				table.Rows = append(table.Rows,
+					reportRow{Item: "4xx 合计", Value: strconv.Itoa(current.S4xx), Change: formatChange(current.S4xx, previous.S4xx)},
+					reportRow{Item: "5xx 合计", Value: strconv.Itoa(current.S5xx), Change: formatChange(current.S5xx, previous.S5xx)},
+				)
+			}
+			for _, item := range site.ErrorURLs {
+				table.Rows = append(table.Rows, reportRow{
+					Item:   item.URL,
+					Status: strconv.Itoa(item.StatusCode),
+					Value:  strconv.Itoa(item.Count),
+				})
+			}
+			tables = append(tables, table)
+		case ReportSectionVisitors:
+			if site.Overview == nil {
+				continue
+			}
+			overview := site.Overview
+			tables = append(tables, reportTable{
+				Section: section,
+				Title:   "新老访客",
+				Columns: []string{"类型", "访客数", "环比"},
+				Rows: []reportRow{
+					{Item: "新访客", Value: strconv.Itoa(overview.NewVisitorCount), Change: formatChange(overview.NewVisitorCount, overview.PrevNewVisitorCount)},
+					{Item: "老访客", Value: strconv.Itoa(overview.ReturningVisitorCount), Change: formatChange(overview.ReturningVisitorCount, overview.PrevReturningVisitorCount)},
+				},
+			})
+		}
+	}
+	return tables
+}
+
+// cells 按表格的列输出单元格
+func (t reportTable) cells(row reportRow) []string {
+	switch t.Section {
+	case ReportSectionTopURLs, ReportSectionReferers, ReportSectionCountries:
+		return []string{row.Item, row.PV, row.UV}
+	case ReportSectionErrors:
+		if row.Status == "" {
+			return []string{row.Item, "-", row.Value + changeSuffix(row.Change)}
+		}
+		return []string{row.Item, row.Status, row.Value}
+	default:
+		return []string{row.Item, row.Value, orDash(row.Change)}
+	}
+}
+
+func reportSiteViews(data *ReportData) []reportSiteView {
+	views := make([]reportSiteView, 0, len(data.Sites))
+	for _, site := range data.Sites {
+		views = append(views, reportSiteView{
+			WebsiteID:   site.WebsiteID,
+			WebsiteName: site.WebsiteName,
+			Tables:      reportTables(data, site),
+		})
+	}
+	return views
+}
+
+var reportHTMLTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"cells": func(table reportTable, row reportRow) []string { return table.cells(row) },
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="margin:0;padding:24px;background:#f5f6f8;font-family:-apple-system,'Segoe UI',Helvetica,Arial,sans-serif;color:#1f2329;">
+<div style="max-width:760px;margin:0 auto;background:#fff;border-radius:8px;padding:24px;">
+<h2 style="margin:0 0 4px;">{{.Title}}</h2>
+<p style="margin:0 0 16px;color:#8f959e;font-size:13px;">统计区间 {{.Period}}，生成于 {{.GeneratedAt.Format "2006-01-02 15:04"}}</p>
+{{range .Sites}}
+<h3 style="margin:24px 0 8px;border-left:4px solid #3370ff;padding-left:8px;">{{.WebsiteName}} <span style="color:#8f959e;font-weight:normal;font-size:13px;">{{.WebsiteID}}</span></h3>
+{{range $table := .Tables}}
+<h4 style="margin:16px 0 6px;">{{$table.Title}}</h4>
+<table cellpadding="6" cellspacing="0" style="width:100%;border-collapse:collapse;font-size:13px;">
+<tr>{{range $table.Columns}}<th align="left" style="background:#f2f3f5;border-bottom:1px solid #dee0e3;">{{.}}</th>{{end}}</tr>
+{{range $row := $table.Rows}}<tr>{{range cells $table $row}}<td style="border-bottom:1px solid #eff0f1;word-break:break-all;">{{.}}</td>{{end}}</tr>
+{{else}}<tr><td colspan="{{len $table.Columns}}" style="color:#8f959e;">暂无数据</td></tr>
+{{end}}</table>
+{{end}}
+{{else}}<p>没有可统计的站点。</p>
+{{end}}
+</div></body></html>
+`))
+
+// RenderReportHTML 渲染邮件使用的 HTML（内联样式）
+func RenderReportHTML(data *ReportData) (string, error) {
+	var buf bytes.Buffer
+	err := reportHTMLTemplate.Execute(&buf, struct {
+		Title       string
+		Period      string
+		GeneratedAt time.Time
+		Sites       []reportSiteView
+	}{data.Title, data.Period, data.GeneratedAt, reportSiteViews(data)})
+	if err != nil {
+		return "", fmt.Errorf("渲染报告失败: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// RenderReportMarkdown 渲染 IM 渠道与 webhook 使用的 Markdown
+func RenderReportMarkdown(data *ReportData) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", data.Title)
+	fmt.Fprintf(&b, "> 统计区间 %s，生成于 %s\n", data.Period, data.GeneratedAt.Format("2006-01-02 15:04"))
+	views := reportSiteViews(data)
+	if len(views) == 0 {
+		b.WriteString("\n没有可统计的站点。\n")
+	}
+	for _, site := range views {
+		fmt.Fprintf(&b, "\n### %s (%s)\n", site.WebsiteName, site.WebsiteID)
+		for _, table := range site.Tables {
+			fmt.Fprintf(&b, "\n**%s**\n\n", table.Title)
+			if len(table.Rows) == 0 {
+				b.WriteString("暂无数据\n")
+				continue
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(table.Columns, " | "))
+			b.WriteString("|" + strings.Repeat(" --- |", len(table.Columns)) + "\n")
+			for _, row := range table.Rows {
+				cells := table.cells(row)
+				for i, cell := range cells {
+					cells[i] = strings.ReplaceAll(cell, "|", `\|`)
+				}
+				fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+			}
+		}
+	}
+	return b.String()
+}
+
+// RenderReportCSV 渲染 CSV 附件，每行一个统计项
+func RenderReportCSV(data *ReportData) ([]byte, error) {
+	var buf bytes.Buffer
+	// UTF-8 BOM，便于 Excel 直接打开中文内容
+	buf.WriteString("\ufeff")
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write([]string{"website_id", "website_name", "section", "item", "status_code", "pv", "uv", "value", "change"}); err != nil {
+		return nil, err
+	}
+	for _, site := range reportSiteViews(data) {
+		for _, table := range site.Tables {
+			for _, row := range table.Rows {
+				value := row.Value
+				if row.Raw != "" {
+					value = row.Raw
+				}
+				record := []string{site.WebsiteID, site.WebsiteName, table.Section, row.Item, row.Status, row.PV, row.UV, value, row.Change}
+				if err := writer.Write(record); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReportCSVName 附件文件名，如 report-3-2024-05-06.csv
+func ReportCSVName(data *ReportData) string {
+	day := data.GeneratedAt.Format("2006-01-02")
+	if data.ID > 0 {
+		return fmt.Sprintf("report-%d-%s.csv", data.ID, day)
+	}
+	return fmt.Sprintf("report-%s.csv", day)
+}
+
+// RenderedReport 报告的三种输出格式
+type RenderedReport struct {
+	Data     *ReportData
+	HTML     string
+	Markdown string
+	CSV      []byte
+	CSVName  string
+}
+
+// RenderReport 查询并渲染报告
+func (f *StatsFactory) RenderReport(report store.ReportDefinition) (*RenderedReport, error) {
+	data, err := f.BuildReport(report)
+	if err != nil {
+		return nil, err
+	}
+	html, err := RenderReportHTML(data)
+	if err != nil {
+		return nil, err
+	}
+	csvData, err := RenderReportCSV(data)
+	if err != nil {
+		return nil, fmt.Errorf("生成 CSV 失败: %v", err)
+	}
+	return &RenderedReport{
+		Data:     data,
+		HTML:     html,
+		Markdown: RenderReportMarkdown(data),
+		CSV:      csvData,
+		CSVName:  ReportCSVName(data),
+	}, nil
+}
+
+// formatChange 环比变化百分比，上期为 0 时无法计算
+func formatChange(current, previous int) string {
+	if previous <= 0 {
+		return ""
+	}
+	change := float64(current-previous) / float64(previous) * 100
+	return fmt.Sprintf("%+.1f%%", change)
+}
+
+func changeSuffix(change string) string {
+	if change == "" {
+		return ""
+	}
+	return " (" + change + ")"
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func formatReportBytes(value int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(value)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", value)
+	}
+	return fmt.Sprintf("%.2f %s", size, units[unit])
+}
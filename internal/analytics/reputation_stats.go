@@ -0,0 +1,300 @@
+package analytics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/likaia/nginxpulse/internal/timeutil"
+)
+
+// ReputationCategoryItem 单个名单分类的汇总与时间序列（与 ReputationStats.Labels 一一对应）
+type ReputationCategoryItem struct {
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+	IPs    int    `json:"ips"`
+	Series []int  `json:"series"`
+}
+
+// ReputationListItem 单个名单的命中情况
+type ReputationListItem struct {
+	List     string `json:"list"`
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+	IPs      int    `json:"ips"`
+}
+
+// ReputationIPItem 命中名单的来源 IP
+type ReputationIPItem struct {
+	IP               string `json:"ip"`
+	List             string `json:"list"`
+	Category         string `json:"category"`
+	Count            int    `json:"count"`
+	Attacks          int    `json:"attacks"`
+	LastSeen         int64  `json:"last_seen"`
+	DomesticLocation string `json:"domestic_location"`
+	GlobalLocation   string `json:"global_location"`
+}
+
+// ReputationURLItem 名单 IP 访问的 URL
+type ReputationURLItem struct {
+	URL   string `json:"url"`
+	Count int    `json:"count"`
+	IPs   int    `json:"ips"`
+}
+
+// ReputationStats 信誉名单 IP 流量统计结果
+type ReputationStats struct {
+	Labels        []string                 `json:"labels"`
+	Total         int                      `json:"total"`
+	IPs           int                      `json:"ips"`
+	TotalRequests int                      `json:"totalRequests"`
+	Share         float64                  `json:"share"`
+	Categories    []ReputationCategoryItem `json:"categories"`
+	Lists         []ReputationListItem     `json:"lists"`
+	TopIPs        []ReputationIPItem       `json:"topIps"`
+	TopURLs       []ReputationURLItem      `json:"topUrls"`
+}
+
+// GetType 实现 StatsResult 接口
+func (s ReputationStats) GetType() string {
+	return "reputation"
+}
+
+// ReputationStatsManager 信誉名单 IP 流量统计
+type ReputationStatsManager struct {
+	repo *store.Repository
+}
+
+// NewReputationStatsManager 创建信誉名单统计管理器
+func NewReputationStatsManager(userRepoPtr *store.Repository) *ReputationStatsManager {
+	return &ReputationStatsManager{
+		repo: userRepoPtr,
+	}
+}
+
+// Query 实现 StatsManager 接口
+func (m *ReputationStatsManager) Query(query StatsQuery) (StatsResult, error) {
+	timeRange, _ := query.ExtraParam["timeRange"].(string)
+	viewType, _ := query.ExtraParam["viewType"].(string)
+	if viewType == "" {
+		viewType = "daily"
+	}
+	limit := 10
+	if value, ok := query.ExtraParam["limit"].(int); ok && value > 0 {
+		limit = value
+	}
+
+	startTime, endTime, err := timeutil.TimePeriod(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("解析时间范围失败: %v", err)
+	}
+	timePoints, labels := timeutil.TimePointsAndLabels(timeRange, viewType)
+
+	result := ReputationStats{
+		Labels:     labels,
+		Categories: make([]ReputationCategoryItem, 0),
+		Lists:      make([]ReputationListItem, 0),
+		TopIPs:     make([]ReputationIPItem, 0),
+		TopURLs:    make([]ReputationURLItem, 0),
+	}
+
+	filters := ""
+	args := []interface{}{startTime.Unix(), endTime.Unix()}
+	if category, ok := query.ExtraParam["category"].(string); ok && category != "" {
+		filters += " AND rep.category = ?"
+		args = append(args, category)
+	}
+	if list, ok := query.ExtraParam["list"].(string); ok && list != "" {
+		filters += " AND rep.list_name = ?"
+		args = append(args, list)
+	}
+	from := func(extraJoin string) string {
+		return reputationFromClause(query.WebsiteID, extraJoin) + filters
+	}
+	db := m.repo.GetDB()
+
+	if err := db.QueryRow(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT COUNT(*) FROM "%s_nginx_logs" WHERE timestamp >= ? AND timestamp < ?`, query.WebsiteID,
+	)), startTime.Unix(), endTime.Unix()).Scan(&result.TotalRequests); err != nil {
+		return nil, fmt.Errorf("查询请求总数失败: %v", err)
+	}
+	if err := db.QueryRow(sqlutil.ReplacePlaceholders(
+		`SELECT COUNT(*), COUNT(DISTINCT l.ip_id) `+from(""),
+	), args...).Scan(&result.Total, &result.IPs); err != nil {
+		return nil, fmt.Errorf("查询信誉名单统计失败: %v", err)
+	}
+	if result.Total == 0 {
+		return result, nil
+	}
+	if result.TotalRequests > 0 {
+		result.Share = float64(result.Total) / float64(result.TotalRequests)
+	}
+
+	// 名单分类
+	rows, err := db.Query(sqlutil.ReplacePlaceholders(
+		`SELECT rep.category, COUNT(*), COUNT(DISTINCT l.ip_id) `+from("")+`
+        GROUP BY rep.category
+        ORDER BY COUNT(*) DESC, rep.category`,
+	), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询名单分类统计失败: %v", err)
+	}
+	index := make(map[string]int)
+	for rows.Next() {
+		item := ReputationCategoryItem{Series: make([]int, len(timePoints))}
+		if err := rows.Scan(&item.Key, &item.Count, &item.IPs); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("解析名单分类统计失败: %v", err)
+		}
+		index[item.Key] = len(result.Categories)
+		result.Categories = append(result.Categories, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历名单分类统计失败: %v", err)
+	}
+
+	if len(timePoints) > 0 {
+		if err := m.fillSeries(&result, index, timePoints, from, args); err != nil {
+			return nil, fmt.Errorf("查询名单流量趋势失败: %v", err)
+		}
+	}
+	if err := m.fillLists(&result, from, args); err != nil {
+		return nil, fmt.Errorf("查询名单命中统计失败: %v", err)
+	}
+	if err := m.fillTopIPs(&result, query.WebsiteID, limit, from, args); err != nil {
+		return nil, fmt.Errorf("查询名单 IP 失败: %v", err)
+	}
+	if err := m.fillTopURLs(&result, query.WebsiteID, limit, from, args); err != nil {
+		return nil, fmt.Errorf("查询名单 IP 访问 URL 失败: %v", err)
+	}
+	return result, nil
+}
+
+// reputationFromClause 返回名单命中记录的 FROM 子句（带 2 个时间参数），extraJoin 用于追加维表关联
+func reputationFromClause(websiteID, extraJoin string) string {
+	return fmt.Sprintf(
+		`FROM "%[1]s_nginx_logs" l
+        JOIN "%[1]s_dim_reputation" rep ON rep.id = l.reputation_id
+        %[2]s
+        WHERE l.reputation_id IS NOT NULL AND l.timestamp >= ? AND l.timestamp < ?`,
+		websiteID, extraJoin,
+	)
+}
+
+// fillSeries 按时间点分桶统计各分类的请求数
+func (m *ReputationStatsManager) fillSeries(
+	result *ReputationStats, index map[string]int, timePoints []time.Time,
+	from func(string) string, args []interface{}) error {
+
+	bounds := make([]string, 0, len(timePoints)+1)
+	for _, point := range timePoints {
+		bounds = append(bounds, strconv.FormatInt(point.Unix(), 10))
+	}
+	last := timePoints[len(timePoints)-1]
+	end := last.AddDate(0, 0, 1)
+	if len(timePoints) > 1 && timePoints[1].Sub(timePoints[0]) < 24*time.Hour {
+		end = last.Add(time.Hour)
+	}
+	bounds = append(bounds, strconv.FormatInt(end.Unix(), 10))
+
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT rep.category, width_bucket(l.timestamp, ARRAY[%s]::BIGINT[]) AS bucket, COUNT(*)
+        %s
+        GROUP BY rep.category, bucket`,
+		strings.Join(bounds, ","), from(""),
+	)), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			key    string
+			bucket int
+			count  int
+		)
+		if err := rows.Scan(&key, &bucket, &count); err != nil {
+			return err
+		}
+		idx, ok := index[key]
+		if !ok || bucket < 1 || bucket > len(timePoints) {
+			continue
+		}
+		result.Categories[idx].Series[bucket-1] = count
+	}
+	return rows.Err()
+}
+
+func (m *ReputationStatsManager) fillLists(result *ReputationStats, from func(string) string, args []interface{}) error {
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(
+		`SELECT rep.list_name, rep.category, COUNT(*), COUNT(DISTINCT l.ip_id) `+from("")+`
+        GROUP BY rep.list_name, rep.category
+        ORDER BY COUNT(*) DESC, rep.list_name`,
+	), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item ReputationListItem
+		if err := rows.Scan(&item.List, &item.Category, &item.Count, &item.IPs); err != nil {
+			return err
+		}
+		result.Lists = append(result.Lists, item)
+	}
+	return rows.Err()
+}
+
+func (m *ReputationStatsManager) fillTopIPs(result *ReputationStats, websiteID string, limit int, from func(string) string, args []interface{}) error {
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT ip.ip, MAX(rep.list_name), MAX(rep.category), COUNT(*), COUNT(l.attack_id), MAX(l.timestamp),
+                MAX(loc.domestic), MAX(loc.global)
+        %s
+        GROUP BY ip.ip
+        ORDER BY COUNT(*) DESC, ip.ip
+        LIMIT ?`,
+		from(fmt.Sprintf(`JOIN "%[1]s_dim_ip" ip ON ip.id = l.ip_id
+        JOIN "%[1]s_dim_location" loc ON loc.id = l.location_id`, websiteID)),
+	)), append(append([]interface{}{}, args...), limit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item ReputationIPItem
+		if err := rows.Scan(&item.IP, &item.List, &item.Category, &item.Count, &item.Attacks, &item.LastSeen,
+			&item.DomesticLocation, &item.GlobalLocation); err != nil {
+			return err
+		}
+		result.TopIPs = append(result.TopIPs, item)
+	}
+	return rows.Err()
+}
+
+func (m *ReputationStatsManager) fillTopURLs(result *ReputationStats, websiteID string, limit int, from func(string) string, args []interface{}) error {
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT u.url, COUNT(*), COUNT(DISTINCT l.ip_id)
+        %s
+        GROUP BY u.url
+        ORDER BY COUNT(*) DESC, u.url
+        LIMIT ?`,
+		from(fmt.Sprintf(`JOIN "%s_dim_url" u ON u.id = l.url_id`, websiteID)),
+	)), append(append([]interface{}{}, args...), limit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item ReputationURLItem
+		if err := rows.Scan(&item.URL, &item.Count, &item.IPs); err != nil {
+			return err
+		}
+		result.TopURLs = append(result.TopURLs, item)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,297 @@
+package analytics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/likaia/nginxpulse/internal/timeutil"
+)
+
+// SecurityTypeItem 单个攻击类型的汇总与时间序列（与 SecurityStats.Labels 一一对应）
+type SecurityTypeItem struct {
+	Key    string `json:"key"`
+	Count  int    `json:"count"`
+	IPs    int    `json:"ips"`
+	Series []int  `json:"series"`
+}
+
+// SecurityIPItem 攻击来源 IP
+type SecurityIPItem struct {
+	IP               string   `json:"ip"`
+	Count            int      `json:"count"`
+	Types            []string `json:"types"`
+	LastSeen         int64    `json:"last_seen"`
+	DomesticLocation string   `json:"domestic_location"`
+	GlobalLocation   string   `json:"global_location"`
+}
+
+// SecurityURLItem 被攻击的 URL
+type SecurityURLItem struct {
+	URL   string   `json:"url"`
+	Count int      `json:"count"`
+	IPs   int      `json:"ips"`
+	Types []string `json:"types"`
+}
+
+// SecurityRuleItem 规则命中次数
+type SecurityRuleItem struct {
+	Rule     string `json:"rule"`
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Count    int    `json:"count"`
+}
+
+// SecurityStats Web 攻击特征统计结果
+type SecurityStats struct {
+	Labels  []string           `json:"labels"`
+	Total   int                `json:"total"`
+	IPs     int                `json:"ips"`
+	Types   []SecurityTypeItem `json:"types"`
+	TopIPs  []SecurityIPItem   `json:"topIps"`
+	TopURLs []SecurityURLItem  `json:"topUrls"`
+	Rules   []SecurityRuleItem `json:"rules"`
+}
+
+// GetType 实现 StatsResult 接口
+func (s SecurityStats) GetType() string {
+	return "security"
+}
+
+// SecurityStatsManager Web 攻击特征统计
+type SecurityStatsManager struct {
+	repo *store.Repository
+}
+
+// NewSecurityStatsManager 创建攻击特征统计管理器
+func NewSecurityStatsManager(userRepoPtr *store.Repository) *SecurityStatsManager {
+	return &SecurityStatsManager{
+		repo: userRepoPtr,
+	}
+}
+
+// Query 实现 StatsManager 接口
+func (m *SecurityStatsManager) Query(query StatsQuery) (StatsResult, error) {
+	timeRange, _ := query.ExtraParam["timeRange"].(string)
+	viewType, _ := query.ExtraParam["viewType"].(string)
+	if viewType == "" {
+		viewType = "daily"
+	}
+	limit := 10
+	if value, ok := query.ExtraParam["limit"].(int); ok && value > 0 {
+		limit = value
+	}
+
+	startTime, endTime, err := timeutil.TimePeriod(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("解析时间范围失败: %v", err)
+	}
+	timePoints, labels := timeutil.TimePointsAndLabels(timeRange, viewType)
+
+	result := SecurityStats{
+		Labels:  labels,
+		Types:   make([]SecurityTypeItem, 0),
+		TopIPs:  make([]SecurityIPItem, 0),
+		TopURLs: make([]SecurityURLItem, 0),
+		Rules:   make([]SecurityRuleItem, 0),
+	}
+
+	filters := ""
+	args := []interface{}{startTime.Unix(), endTime.Unix()}
+	if attackType, ok := query.ExtraParam["attackType"].(string); ok && attackType != "" {
+		filters += " AND atk.attack_type = ?"
+		args = append(args, attackType)
+	}
+	if severity, ok := query.ExtraParam["severity"].(string); ok && severity != "" {
+		filters += " AND atk.severity = ?"
+		args = append(args, severity)
+	}
+	from := func(extraJoin string) string {
+		return securityFromClause(query.WebsiteID, extraJoin) + filters
+	}
+	db := m.repo.GetDB()
+
+	if err := db.QueryRow(sqlutil.ReplacePlaceholders(
+		`SELECT COUNT(*), COUNT(DISTINCT l.ip_id) `+from(""),
+	), args...).Scan(&result.Total, &result.IPs); err != nil {
+		return nil, fmt.Errorf("查询攻击统计失败: %v", err)
+	}
+	if result.Total == 0 {
+		return result, nil
+	}
+
+	// 攻击类型
+	rows, err := db.Query(sqlutil.ReplacePlaceholders(
+		`SELECT atk.attack_type, COUNT(*), COUNT(DISTINCT l.ip_id) `+from("")+`
+        GROUP BY atk.attack_type
+        ORDER BY COUNT(*) DESC, atk.attack_type`,
+	), args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询攻击类型统计失败: %v", err)
+	}
+	index := make(map[string]int)
+	for rows.Next() {
+		item := SecurityTypeItem{Series: make([]int, len(timePoints))}
+		if err := rows.Scan(&item.Key, &item.Count, &item.IPs); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("解析攻击类型统计失败: %v", err)
+		}
+		index[item.Key] = len(result.Types)
+		result.Types = append(result.Types, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历攻击类型统计失败: %v", err)
+	}
+
+	if len(timePoints) > 0 {
+		if err := m.fillSeries(&result, index, timePoints, from, args); err != nil {
+			return nil, fmt.Errorf("查询攻击趋势失败: %v", err)
+		}
+	}
+	if err := m.fillTopIPs(&result, query.WebsiteID, limit, from, args); err != nil {
+		return nil, fmt.Errorf("查询攻击来源 IP 失败: %v", err)
+	}
+	if err := m.fillTopURLs(&result, query.WebsiteID, limit, from, args); err != nil {
+		return nil, fmt.Errorf("查询被攻击 URL 失败: %v", err)
+	}
+	if err := m.fillRules(&result, limit, from, args); err != nil {
+		return nil, fmt.Errorf("查询规则命中统计失败: %v", err)
+	}
+	return result, nil
+}
+
+// securityFromClause 返回攻击记录的 FROM 子句（带 2 个时间参数），extraJoin 用于追加维表关联
+func securityFromClause(websiteID, extraJoin string) string {
+	return fmt.Sprintf(
+		`FROM "%[1]s_nginx_logs" l
+        JOIN "%[1]s_dim_attack" atk ON atk.id = l.attack_id
+        %[2]s
+        WHERE l.attack_id IS NOT NULL AND l.timestamp >= ? AND l.timestamp < ?`,
+		websiteID, extraJoin,
+	)
+}
+
+// fillSeries 按时间点分桶统计各攻击类型的请求数
+func (m *SecurityStatsManager) fillSeries(
+	result *SecurityStats, index map[string]int, timePoints []time.Time,
+	from func(string) string, args []interface{}) error {
+
+	bounds := make([]string, 0, len(timePoints)+1)
+	for _, point := range timePoints {
+		bounds = append(bounds, strconv.FormatInt(point.Unix(), 10))
+	}
+	last := timePoints[len(timePoints)-1]
+	end := last.AddDate(0, 0, 1)
+	if len(timePoints) > 1 && timePoints[1].Sub(timePoints[0]) < 24*time.Hour {
+		end = last.Add(time.Hour)
+	}
+	bounds = append(bounds, strconv.FormatInt(end.Unix(), 10))
+
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT atk.attack_type, width_bucket(l.timestamp, ARRAY[%s]::BIGINT[]) AS bucket, COUNT(*)
+        %s
+        GROUP BY atk.attack_type, bucket`,
+		strings.Join(bounds, ","), from(""),
+	)), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			key    string
+			bucket int
+			count  int
+		)
+		if err := rows.Scan(&key, &bucket, &count); err != nil {
+			return err
+		}
+		idx, ok := index[key]
+		// width_bucket 对落在首个边界之前/末个边界之后的值返回 0 / len(bounds)
+		if !ok || bucket < 1 || bucket > len(timePoints) {
+			continue
+		}
+		result.Types[idx].Series[bucket-1] = count
+	}
+	return rows.Err()
+}
+
+func (m *SecurityStatsManager) fillTopIPs(result *SecurityStats, websiteID string, limit int, from func(string) string, args []interface{}) error {
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT ip.ip, COUNT(*), string_agg(DISTINCT atk.attack_type, ','), MAX(l.timestamp),
+                MAX(loc.domestic), MAX(loc.global)
+        %s
+        GROUP BY ip.ip
+        ORDER BY COUNT(*) DESC, ip.ip
+        LIMIT ?`,
+		from(fmt.Sprintf(`JOIN "%[1]s_dim_ip" ip ON ip.id = l.ip_id
+        JOIN "%[1]s_dim_location" loc ON loc.id = l.location_id`, websiteID)),
+	)), append(append([]interface{}{}, args...), limit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item SecurityIPItem
+		var types string
+		if err := rows.Scan(&item.IP, &item.Count, &types, &item.LastSeen,
+			&item.DomesticLocation, &item.GlobalLocation); err != nil {
+			return err
+		}
+		item.Types = strings.Split(types, ",")
+		result.TopIPs = append(result.TopIPs, item)
+	}
+	return rows.Err()
+}
+
+func (m *SecurityStatsManager) fillTopURLs(result *SecurityStats, websiteID string, limit int, from func(string) string, args []interface{}) error {
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT u.url, COUNT(*), COUNT(DISTINCT l.ip_id), string_agg(DISTINCT atk.attack_type, ',')
+        %s
+        GROUP BY u.url
+        ORDER BY COUNT(*) DESC, u.url
+        LIMIT ?`,
+		from(fmt.Sprintf(`JOIN "%s_dim_url" u ON u.id = l.url_id`, websiteID)),
+	)), append(append([]interface{}{}, args...), limit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item SecurityURLItem
+		var types string
+		if err := rows.Scan(&item.URL, &item.Count, &item.IPs, &types); err != nil {
+			return err
+		}
+		item.Types = strings.Split(types, ",")
+		result.TopURLs = append(result.TopURLs, item)
+	}
+	return rows.Err()
+}
+
+func (m *SecurityStatsManager) fillRules(result *SecurityStats, limit int, from func(string) string, args []interface{}) error {
+	rows, err := m.repo.GetDB().Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT atk.rule_id, atk.attack_type, atk.severity, COUNT(*)
+        %s
+        GROUP BY atk.rule_id, atk.attack_type, atk.severity
+        ORDER BY COUNT(*) DESC, atk.rule_id
+        LIMIT ?`,
+		from(""),
+	)), append(append([]interface{}{}, args...), limit)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item SecurityRuleItem
+		if err := rows.Scan(&item.Rule, &item.Type, &item.Severity, &item.Count); err != nil {
+			return err
+		}
+		result.Rules = append(result.Rules, item)
+	}
+	return rows.Err()
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/ingest"
 	"github.com/likaia/nginxpulse/internal/store"
 )
 
@@ -63,6 +64,7 @@ func (f *StatsFactory) registerDefaultManagers() {
 	f.managers["overall"] = NewOverallStatsManager(f.repo)
 
 	f.managers["url"] = NewURLStatsManager(f.repo)
+	f.managers["route"] = NewRouteStatsManager(f.repo)
 	f.managers["referer"] = NewrefererStatsManager(f.repo)
 
 	f.managers["browser"] = NewBrowserStatsManager(f.repo)
@@ -70,11 +72,18 @@ func (f *StatsFactory) registerDefaultManagers() {
 	f.managers["device"] = NewDeviceStatsManager(f.repo)
 
 	f.managers["location"] = NewLocationStatsManager(f.repo)
+	f.managers["extra"] = NewExtraFieldStatsManager(f.repo)
+	f.managers["network"] = NewNetworkStatsManager(f.repo)
 
 	f.managers["logs"] = NewLogsStatsManager(f.repo)
 	f.managers["session"] = NewSessionsStatsManager(f.repo)
 	f.managers["session_summary"] = NewSessionSummaryStatsManager(f.repo)
 	f.managers["realtime"] = NewRealtimeStatsManager(f.repo)
+	f.managers["campaign"] = NewCampaignStatsManager(f.repo)
+	f.managers["channel"] = NewChannelStatsManager(f.repo)
+	f.managers["security"] = NewSecurityStatsManager(f.repo)
+	f.managers["reputation"] = NewReputationStatsManager(f.repo)
+	f.managers["anomaly"] = NewAnomalyStatsManager(f.repo)
 }
 
 // GetManager 获取指定类型的统计管理器
@@ -190,15 +199,23 @@ func (f *StatsFactory) BuildQueryFromRequest(
 		"timeseries":      {"id": "string", "timeRange": "string", "viewType": "string"},
 		"overall":         {"id": "string", "timeRange": "string"},
 		"url":             {"id": "string", "timeRange": "string", "limit": "int"},
+		"route":           {"id": "string", "timeRange": "string", "limit": "int"},
 		"referer":         {"id": "string", "timeRange": "string", "limit": "int"},
 		"browser":         {"id": "string", "timeRange": "string", "limit": "int"},
 		"os":              {"id": "string", "timeRange": "string", "limit": "int"},
 		"device":          {"id": "string", "timeRange": "string", "limit": "int"},
 		"location":        {"id": "string", "timeRange": "string", "limit": "int", "locationType": "string"},
+		"extra":           {"id": "string", "timeRange": "string", "limit": "int", "field": "string"},
+		"network":         {"id": "string", "timeRange": "string", "limit": "int"},
 		"logs":            {"id": "string", "page": "int", "pageSize": "int", "sortField": "string", "sortOrder": "enum:asc,desc"},
 		"session":         {"id": "string", "page": "int", "pageSize": "int"},
 		"session_summary": {"id": "string", "timeRange": "string"},
 		"realtime":        {"id": "string"},
+		"campaign":        {"id": "string", "timeRange": "string"},
+		"channel":         {"id": "string", "timeRange": "string"},
+		"security":        {"id": "string", "timeRange": "string"},
+		"reputation":      {"id": "string", "timeRange": "string"},
+		"anomaly":         {"id": "string", "timeRange": "string"},
 	}
 
 	// 检查是否支持的统计类型
@@ -313,12 +330,27 @@ func (f *StatsFactory) BuildQueryFromRequest(
 		if ipFilter, ok := params["ipFilter"]; ok && ipFilter != "" {
 			query.ExtraParam["ipFilter"] = ipFilter
 		}
+		if attackType, ok := params["attackType"]; ok && attackType != "" {
+			query.ExtraParam["attackType"] = attackType
+		}
+		if reputation, ok := params["reputation"]; ok && reputation != "" {
+			query.ExtraParam["reputation"] = reputation
+		}
 		if locationFilter, ok := params["locationFilter"]; ok && locationFilter != "" {
 			query.ExtraParam["locationFilter"] = locationFilter
 		}
 		if urlFilter, ok := params["urlFilter"]; ok && urlFilter != "" {
 			query.ExtraParam["urlFilter"] = urlFilter
 		}
+		if routeFilter, ok := params["routeFilter"]; ok && routeFilter != "" {
+			query.ExtraParam["routeFilter"] = routeFilter
+		}
+		if extraField, ok := params["extraField"]; ok && extraField != "" {
+			query.ExtraParam["extraField"] = extraField
+			if extraValue, ok := params["extraValue"]; ok && extraValue != "" {
+				query.ExtraParam["extraValue"] = extraValue
+			}
+		}
 		if pageviewOnlyRaw, ok := params["pageviewOnly"]; ok && pageviewOnlyRaw != "" {
 			switch strings.ToLower(pageviewOnlyRaw) {
 			case "true", "1":
@@ -383,6 +415,147 @@ func (f *StatsFactory) BuildQueryFromRequest(
 			query.ExtraParam["entryLimit"] = value
 		}
 	}
+	if statsType == "browser" || statsType == "os" || statsType == "device" {
+		if versionOf, ok := params["versionOf"]; ok && versionOf != "" {
+			query.ExtraParam["versionOf"] = versionOf
+		}
+	}
+	switch statsType {
+	case "logs", "url", "route", "referer", "browser", "os", "device", "location", "extra", "network":
+		if err := parseNetworkFilters(params, query.ExtraParam); err != nil {
+			return query, err
+		}
+	}
+	if statsType == "network" {
+		if groupBy, ok := params["groupBy"]; ok && groupBy != "" {
+			if groupBy != "type" && groupBy != "asn" && groupBy != "org" {
+				return query, fmt.Errorf("groupBy 参数无效")
+			}
+			query.ExtraParam["groupBy"] = groupBy
+		}
+	}
+	if statsType == "campaign" {
+		if dimension, ok := params["dimension"]; ok && dimension != "" {
+			query.ExtraParam["dimension"] = dimension
+		}
+		if viewType, ok := params["viewType"]; ok && viewType != "" {
+			if viewType != "hourly" && viewType != "daily" {
+				return query, fmt.Errorf("viewType 参数无效")
+			}
+			query.ExtraParam["viewType"] = viewType
+		}
+		for _, name := range []string{"limit", "entryLimit"} {
+			if _, ok := params[name]; ok && params[name] != "" {
+				value, err := getRequiredInt(params, name, 1)
+				if err != nil {
+					return query, err
+				}
+				query.ExtraParam[name] = value
+			}
+		}
+	}
+	if statsType == "channel" {
+		if groupBy, ok := params["groupBy"]; ok && groupBy != "" {
+			query.ExtraParam["groupBy"] = groupBy
+		}
+		if channel, ok := params["channel"]; ok && channel != "" {
+			query.ExtraParam["channel"] = channel
+		}
+		if _, ok := params["limit"]; ok && params["limit"] != "" {
+			value, err := getRequiredInt(params, "limit", 1)
+			if err != nil {
+				return query, err
+			}
+			query.ExtraParam["limit"] = value
+		}
+	}
+	if statsType == "security" {
+		if viewType, ok := params["viewType"]; ok && viewType != "" {
+			if viewType != "hourly" && viewType != "daily" {
+				return query, fmt.Errorf("viewType 参数无效")
+			}
+			query.ExtraParam["viewType"] = viewType
+		}
+		if attackType, ok := params["attackType"]; ok && attackType != "" {
+			query.ExtraParam["attackType"] = attackType
+		}
+		if severity, ok := params["severity"]; ok && severity != "" {
+			switch severity {
+			case "low", "medium", "high", "critical":
+			default:
+				return query, fmt.Errorf("severity 参数无效")
+			}
+			query.ExtraParam["severity"] = severity
+		}
+		if _, ok := params["limit"]; ok && params["limit"] != "" {
+			value, err := getRequiredInt(params, "limit", 1)
+			if err != nil {
+				return query, err
+			}
+			query.ExtraParam["limit"] = value
+		}
+	}
+	if statsType == "reputation" {
+		if viewType, ok := params["viewType"]; ok && viewType != "" {
+			if viewType != "hourly" && viewType != "daily" {
+				return query, fmt.Errorf("viewType 参数无效")
+			}
+			query.ExtraParam["viewType"] = viewType
+		}
+		if category, ok := params["category"]; ok && category != "" {
+			query.ExtraParam["category"] = category
+		}
+		if list, ok := params["list"]; ok && list != "" {
+			query.ExtraParam["list"] = list
+		}
+		if _, ok := params["limit"]; ok && params["limit"] != "" {
+			value, err := getRequiredInt(params, "limit", 1)
+			if err != nil {
+				return query, err
+			}
+			query.ExtraParam["limit"] = value
+		}
+	}
+	if statsType == "anomaly" {
+		if metricsRaw, ok := params["metrics"]; ok && metricsRaw != "" {
+			metrics := make([]string, 0)
+			for _, metric := range strings.Split(metricsRaw, ",") {
+				metric = strings.ToLower(strings.TrimSpace(metric))
+				if metric == "" {
+					continue
+				}
+				valid := false
+				for _, candidate := range ingest.AnomalyMetrics {
+					if metric == candidate {
+						valid = true
+						break
+					}
+				}
+				if !valid {
+					return query, fmt.Errorf("metrics 参数无效: %s", metric)
+				}
+				metrics = append(metrics, metric)
+			}
+			query.ExtraParam["metrics"] = metrics
+		}
+		if _, ok := params["weeks"]; ok && params["weeks"] != "" {
+			value, err := getRequiredInt(params, "weeks", 1)
+			if err != nil {
+				return query, err
+			}
+			if value > 12 {
+				return query, fmt.Errorf("weeks 不能超过 12")
+			}
+			query.ExtraParam["weeks"] = value
+		}
+		if thresholdRaw, ok := params["threshold"]; ok && thresholdRaw != "" {
+			value, err := strconv.ParseFloat(thresholdRaw, 64)
+			if err != nil || value < 1 || value > 100 {
+				return query, fmt.Errorf("threshold 参数无效")
+			}
+			query.ExtraParam["threshold"] = value
+		}
+	}
 	if statsType == "realtime" {
 		if windowRaw, ok := params["window"]; ok && windowRaw != "" {
 			value, err := strconv.Atoi(windowRaw)
@@ -396,6 +569,21 @@ func (f *StatsFactory) BuildQueryFromRequest(
 	return query, nil
 }
 
+// parseNetworkFilters 解析网络类型与 ASN 过滤参数
+func parseNetworkFilters(params map[string]string, extra map[string]interface{}) error {
+	if networkType, ok := params["networkType"]; ok && networkType != "" {
+		extra["networkType"] = networkType
+	}
+	if _, ok := params["asn"]; ok && params["asn"] != "" {
+		value, err := getRequiredInt(params, "asn", 1)
+		if err != nil {
+			return err
+		}
+		extra["asn"] = value
+	}
+	return nil
+}
+
 // getRequiredInt 获取并验证必须的整数参数
 func getRequiredInt(params map[string]string, key string, minValue int) (int, error) {
 	if valueStr, ok := params[key]; ok && valueStr != "" {
@@ -18,6 +18,7 @@ import (
 	"github.com/likaia/nginxpulse/internal/enrich"
 	"github.com/likaia/nginxpulse/internal/ingest"
 	"github.com/likaia/nginxpulse/internal/logging"
+	"github.com/likaia/nginxpulse/internal/notify"
 	"github.com/likaia/nginxpulse/internal/server"
 	"github.com/likaia/nginxpulse/internal/store"
 	"github.com/likaia/nginxpulse/internal/version"
@@ -64,6 +65,10 @@ func Run() error {
 	}
 	defer repository.Close()
 
+	dispatcher := notify.NewDispatcher(repository)
+	dispatcher.Start(ctx)
+	repository.SetNotificationDispatcher(dispatcher)
+
 	logParser := ingest.NewLogParser(repository)
 	statsFactory := analytics.NewStatsFactory(repository)
 
@@ -81,6 +86,7 @@ func Run() error {
 	}
 
 	go worker.RunScheduler(ctx, logParser, interval)
+	go worker.RunReportScheduler(ctx, statsFactory, dispatcher)
 
 	return waitForShutdown(cancel, serverHandle)
 }
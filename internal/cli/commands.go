@@ -9,7 +9,11 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/likaia/nginxpulse/internal/analytics"
 	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich"
+	"github.com/likaia/nginxpulse/internal/ingest"
+	"github.com/likaia/nginxpulse/internal/store"
 	"github.com/likaia/nginxpulse/internal/version"
 )
 
@@ -18,6 +22,19 @@ func ProcessCliCommands() bool {
 	// 命令行参数
 	cleanApp := flag.Bool("clean", false, "清理nginxpulse服务、释放端口和删除数据")
 	showVer := flag.Bool("v", false, "显示版本信息")
+	rebuildRoutes := flag.String("rebuild-routes", "", "按当前 URL 归一化规则重建已有日志的路由（站点 ID，all 表示全部站点）")
+	ipGeoDB := flag.String("ip-geo-db", "", "安装新的 IP 离线库（ip2region xdb 或 mmdb 文件路径），运行中的服务会在下次定时任务时加载")
+	ipGeoDBProvider := flag.String("ip-geo-db-provider", "", "mmdb 离线库对应的查询源名称（查询链中只有一个 mmdb 查询源时可省略）")
+	ipGeoDBRole := flag.String("ip-geo-db-role", "", "mmdb 离线库用途：geo 或 asn（默认按数据库类型识别）")
+	regeolocate := flag.Bool("regeolocate", false, "安装离线库后将已缓存的 IP 重新加入归属地解析队列")
+	blocklistExport := flag.String("blocklist-export", "", "生成封禁名单（站点 ID，all 表示全部站点），未指定 -blocklist-output 时输出到标准输出")
+	blocklistMode := flag.String("blocklist-mode", "", "挑选 IP 的方式：rate、errors、security、filter（为空时只导出当前名单）")
+	blocklistFormat := flag.String("blocklist-format", "", "输出格式：nginx、nginx-geo、ipset、nftables（默认 nginx 或输出配置中的格式）")
+	blocklistOutput := flag.String("blocklist-output", "", "写入目标：security.blocklist.outputs 中的名称或文件路径（原子写入）")
+	blocklistRange := flag.String("blocklist-range", "today", "挑选 IP 的时间范围，与页面时间范围参数相同")
+	blocklistLimit := flag.Int("blocklist-limit", 100, "每个站点最多挑选的 IP 数")
+	blocklistFilter := flag.String("blocklist-filter", "", "filter 模式使用的 security.blocklist.filters 名称")
+	blocklistDryRun := flag.Bool("blocklist-dry-run", false, "只预览，不写入封禁名单和输出文件")
 	flag.Parse()
 
 	// 显示版本信息
@@ -47,6 +64,32 @@ func ProcessCliCommands() bool {
 		return true
 	}
 
+	// 重建 URL 归一化路由
+	if *rebuildRoutes != "" {
+		runRebuildRoutes(*rebuildRoutes)
+		return true
+	}
+
+	// 安装 IP 离线库
+	if *ipGeoDB != "" {
+		runInstallIPGeoDB(*ipGeoDB, *ipGeoDBProvider, *ipGeoDBRole, *regeolocate)
+		return true
+	}
+
+	// 导出封禁名单
+	if *blocklistExport != "" {
+		runBlocklistExport(analytics.BlocklistRequest{
+			WebsiteID: strings.TrimSpace(*blocklistExport),
+			Mode:      strings.TrimSpace(*blocklistMode),
+			TimeRange: strings.TrimSpace(*blocklistRange),
+			Limit:     *blocklistLimit,
+			Filter:    strings.TrimSpace(*blocklistFilter),
+			Format:    strings.TrimSpace(*blocklistFormat),
+			DryRun:    *blocklistDryRun,
+		}, strings.TrimSpace(*blocklistOutput))
+		return true
+	}
+
 	// 不需要退出，继续运行
 	return false
 }
@@ -119,6 +162,126 @@ func validateConfig() bool {
 	return true
 }
 
+// runRebuildRoutes 按当前 urlNormalize 配置重新计算已有日志的归一化路由
+func runRebuildRoutes(target string) {
+	target = strings.TrimSpace(target)
+	websiteIDs := []string{target}
+	if strings.EqualFold(target, "all") {
+		websiteIDs = config.GetAllWebsiteIDs()
+	}
+
+	repo, err := store.NewRepository()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "连接数据库失败: %v\n", err)
+		return
+	}
+	defer repo.Close()
+
+	for _, websiteID := range websiteIDs {
+		website, ok := config.GetWebsiteByID(websiteID)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "站点不存在: %s\n", websiteID)
+			continue
+		}
+		normalizer, err := enrich.NewURLNormalizer(website.URLNormalize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "站点 %s 的 URL 归一化配置无效: %v\n", website.Name, err)
+			continue
+		}
+		fmt.Printf("开始重建站点 %s (%s) 的路由...\n", website.Name, websiteID)
+		updated, err := repo.RebuildRoutes(websiteID, normalizer.NormalizeDecoded)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "重建站点 %s 的路由失败: %v\n", website.Name, err)
+			continue
+		}
+		fmt.Printf("站点 %s 路由重建完成，更新 %d 条日志\n", website.Name, updated)
+	}
+}
+
+// runInstallIPGeoDB 校验并安装 IP 离线库，可选重新解析已缓存的 IP
+func runInstallIPGeoDB(path, provider, role string, regeolocate bool) {
+	info, err := enrich.InstallIPGeoDBFromFile(strings.TrimSpace(path), enrich.IPGeoDBInstallOptions{
+		Provider: provider,
+		Role:     role,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "安装离线库失败: %v\n", err)
+		return
+	}
+	fmt.Printf("离线库已安装: %s（%s），版本 %s", info.Path, info.Kind, info.Version)
+	if !info.BuildTime.IsZero() {
+		fmt.Printf("，生成时间 %s", info.BuildTime.Format("2006-01-02"))
+	}
+	fmt.Println()
+	if !regeolocate {
+		return
+	}
+
+	repo, err := store.NewRepository()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "连接数据库失败: %v\n", err)
+		return
+	}
+	defer repo.Close()
+	count, err := ingest.RequeueCachedIPGeo(repo)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "重新解析 IP 归属地失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已将 %d 个 IP 加入重新解析队列\n", count)
+}
+
+// runBlocklistExport 生成封禁名单；output 优先匹配配置的输出名称，否则视为文件路径
+func runBlocklistExport(req analytics.BlocklistRequest, output string) {
+	outputPath := ""
+	if output != "" {
+		configured := false
+		if cfg := config.ReadConfig(); cfg.Security != nil && cfg.Security.Blocklist != nil {
+			for _, item := range cfg.Security.Blocklist.Outputs {
+				if item.Name == output {
+					configured = true
+					break
+				}
+			}
+		}
+		if configured {
+			req.Output = output
+		} else {
+			outputPath = output
+		}
+	}
+
+	repo, err := store.NewRepository()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "连接数据库失败: %v\n", err)
+		return
+	}
+	defer repo.Close()
+
+	result, err := analytics.NewStatsFactory(repo).BuildBlocklist(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "生成封禁名单失败: %v\n", err)
+		return
+	}
+	for _, skipped := range result.Skipped {
+		fmt.Fprintf(os.Stderr, "跳过 %s（%s）\n", skipped.IP, skipped.Reason)
+	}
+	fmt.Fprintf(os.Stderr, "新增 / 更新 %d 个 IP，当前名单共 %d 条\n", len(result.Candidates), len(result.Entries))
+
+	switch {
+	case result.Written != "":
+		fmt.Fprintf(os.Stderr, "已写入 %s\n", result.Written)
+	case outputPath != "" && !req.DryRun:
+		if err := enrich.WriteFileAtomic(outputPath, []byte(result.Content)); err != nil {
+			fmt.Fprintf(os.Stderr, "写入封禁名单文件失败: %v\n", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "已写入 %s\n", outputPath)
+	default:
+		fmt.Print(result.Content)
+	}
+}
+
 // cleanService 清理 nginxpulse 服务、释放端口和删除数据
 func cleanService() {
 	fmt.Println("开始清理nginxpulse服务...")
@@ -19,14 +19,29 @@ const (
 	DataDir            = "./var/nginxpulse_data"
 	ConfigFile         = "./configs/nginxpulse_config.json"
 	DefaultIPGeoAPIURL = "http://ip-api.com/batch"
+	// MaxExtraFields 单个站点/来源允许保存的额外字段数量上限
+	MaxExtraFields = 16
 )
 
+// DefaultCampaignClickIDs 默认识别的广告点击 ID 参数
+var DefaultCampaignClickIDs = []string{"gclid", "fbclid", "msclkid"}
+
 type Config struct {
 	System   SystemConfig    `json:"system"`
 	Server   ServerConfig    `json:"server"`
 	Database DatabaseConfig  `json:"database"`
 	Websites []WebsiteConfig `json:"websites"`
 	PVFilter PVFilterConfig  `json:"pvFilter"`
+	// RefererChannels 来源渠道识别的自定义规则
+	RefererChannels *RefererChannelsConfig `json:"refererChannels,omitempty"`
+	// Security Web 攻击特征检测
+	Security *SecurityConfig `json:"security,omitempty"`
+	// Notifications 系统通知外发渠道与路由
+	Notifications *NotificationsConfig `json:"notifications,omitempty"`
+	// Anomaly 按周内小时基线的流量异常检测
+	Anomaly *AnomalyConfig `json:"anomaly,omitempty"`
+	// Receivers 兼容第三方采集协议（Loki push、Elasticsearch _bulk、OTLP 等）的日志接收端点
+	Receivers *ReceiversConfig `json:"receivers,omitempty"`
 }
 
 type WebsiteConfig struct {
@@ -39,6 +54,12 @@ type WebsiteConfig struct {
 	TimeLayout string           `json:"timeLayout,omitempty"`
 	Sources    []SourceConfig   `json:"sources,omitempty"`
 	Whitelist  *WhitelistConfig `json:"whitelist,omitempty"`
+	// ExtraFields 额外保存到日志记录中的字段（命名分组 / logFormat 变量名），未列出的字段不入库
+	ExtraFields []string `json:"extraFields,omitempty"`
+	// URLNormalize URL 归一化规则，生成用于分组统计的路由
+	URLNormalize *URLNormalizeConfig `json:"urlNormalize,omitempty"`
+	// CampaignClickIDs 识别为广告点击的查询参数（如 gclid、fbclid），为空时使用 DefaultCampaignClickIDs
+	CampaignClickIDs []string `json:"campaignClickIds,omitempty"`
 }
 
 type SourceConfig struct {
@@ -83,6 +104,28 @@ type ParseConfig struct {
 	LogFormat  string `json:"logFormat,omitempty"`
 	LogRegex   string `json:"logRegex,omitempty"`
 	TimeLayout string `json:"timeLayout,omitempty"`
+	// ExtraFields 非空时替代站点级 extraFields
+	ExtraFields []string `json:"extraFields,omitempty"`
+}
+
+// URLNormalizeConfig URL 归一化配置。
+// 默认去除全部查询参数（keepParams 中的除外）；keepQuery 为 true 时保留查询参数（stripParams 中的除外）。
+type URLNormalizeConfig struct {
+	KeepQuery   bool     `json:"keepQuery,omitempty"`
+	KeepParams  []string `json:"keepParams,omitempty"`
+	StripParams []string `json:"stripParams,omitempty"`
+	// DisableAutoCollapse 关闭数字 / UUID 路径段的自动折叠
+	DisableAutoCollapse bool             `json:"disableAutoCollapse,omitempty"`
+	Rules               []URLRewriteRule `json:"rules,omitempty"`
+}
+
+// URLRewriteRule 路径改写规则，template 与 regex 二选一，按顺序命中第一条即停止。
+// template 形如 /user/{id}/posts，{name} 或 * 匹配单个路径段，结尾的 ** 匹配剩余路径；
+// regex 命中时按 replace 替换（支持 $1 引用）。
+type URLRewriteRule struct {
+	Template string `json:"template,omitempty"`
+	Regex    string `json:"regex,omitempty"`
+	Replace  string `json:"replace,omitempty"`
 }
 
 type WhitelistConfig struct {
@@ -97,6 +140,7 @@ type SystemConfig struct {
 	TaskInterval     string   `json:"taskInterval"` // "5m" "25s"
 	LogRetentionDays int      `json:"logRetentionDays"`
 	ParseBatchSize   int      `json:"parseBatchSize"`
+	ParseWorkers     int      `json:"parseWorkers,omitempty"` // 0 表示按 CPU 自动选择
 	IPGeoCacheLimit  int      `json:"ipGeoCacheLimit"`
 	IPGeoAPIURL      string   `json:"ipGeoApiUrl"`
 	DemoMode         bool     `json:"demoMode"`
@@ -104,6 +148,39 @@ type SystemConfig struct {
 	Language         string   `json:"language"`
 	WebBasePath      string   `json:"webBasePath,omitempty"`
 	MobilePWAEnabled bool     `json:"mobilePwaEnabled"`
+
+	// MetricsToken /metrics 专用令牌，为空时使用 accessKeys 校验
+	MetricsToken string `json:"metricsToken,omitempty"`
+
+	// IPGeoProviders IP 归属地查询链，按顺序查询，为空时使用 ip2region + ip-api
+	IPGeoProviders []IPGeoProviderConfig `json:"ipGeoProviders,omitempty"`
+}
+
+// IP 归属地查询源类型
+const (
+	IPGeoProviderIP2Region = "ip2region"
+	IPGeoProviderMMDB      = "mmdb"
+	IPGeoProviderIPAPI     = "ip-api"
+	IPGeoProviderHTTP      = "http"
+)
+
+// IPGeoProviderConfig IP 归属地查询源。
+// mmdb 读取本地 MaxMind / DB-IP 库（path 为国家或城市库，asnPath 为 ASN 库，可只配其一）；
+// http 按 url 逐个查询（{ip}、{lang} 会被替换），fieldMap 指定各字段在响应 JSON 中的路径（如 data.city）。
+// timeout 为单次查询超时，rateLimit 为每秒请求数（0 表示不限制），burst 为允许的突发请求数。
+type IPGeoProviderConfig struct {
+	Name         string            `json:"name,omitempty"`
+	Type         string            `json:"type"`
+	Path         string            `json:"path,omitempty"`
+	ASNPath      string            `json:"asnPath,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	Method       string            `json:"method,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	FieldMap     map[string]string `json:"fieldMap,omitempty"`
+	SuccessValue string            `json:"successValue,omitempty"`
+	Timeout      string            `json:"timeout,omitempty"`
+	RateLimit    float64           `json:"rateLimit,omitempty"`
+	Burst        int               `json:"burst,omitempty"`
 }
 
 type ServerConfig struct {
@@ -124,6 +201,189 @@ type PVFilterConfig struct {
 	ExcludeIPs        []string `json:"excludeIPs"`
 }
 
+// RefererChannelsConfig 来源渠道自定义规则，优先于内置的搜索引擎 / 社交站点 / 邮箱表
+type RefererChannelsConfig struct {
+	Rules []RefererChannelRule `json:"rules,omitempty"`
+}
+
+// RefererChannelRule 将来源域名归入指定渠道。
+// Domains 按后缀匹配（example.com 同时匹配 www.example.com），"google.*" 匹配任意后缀；
+// KeywordParams 为搜索关键词所在的查询参数。
+type RefererChannelRule struct {
+	Name          string   `json:"name"`
+	Channel       string   `json:"channel"`
+	Domains       []string `json:"domains"`
+	KeywordParams []string `json:"keywordParams,omitempty"`
+}
+
+// SecurityConfig Web 攻击特征检测。内置规则可被 RulesFile（默认 DataDir/security_rules.json）
+// 中同 id 的规则覆盖或禁用，文件修改后在下一次定时任务时重新加载。
+type SecurityConfig struct {
+	Disabled  bool   `json:"disabled,omitempty"`
+	RulesFile string `json:"rulesFile,omitempty"`
+	// NotifySeverity 达到该级别的命中写入系统通知：low / medium / high / critical / off，默认 high
+	NotifySeverity string `json:"notifySeverity,omitempty"`
+	// BruteForce 登录接口暴力破解 / 撞库检测，未配置时使用默认阈值
+	BruteForce *BruteForceConfig `json:"bruteForce,omitempty"`
+	// Reputation IP 信誉名单（本地黑名单文件），未配置时读取 DataDir/reputation
+	Reputation *ReputationConfig `json:"reputation,omitempty"`
+	// Blocklist 封禁名单导出（nginx deny / geo、ipset、nftables）
+	Blocklist *BlocklistConfig `json:"blocklist,omitempty"`
+}
+
+// BlocklistConfig 封禁名单导出。名单条目带有效期，重复命中时延长；
+// Outputs 为允许写入的目标文件，接口只能按名称引用，不能指定任意路径。
+type BlocklistConfig struct {
+	// Allowlist 永不导出的 IP / CIDR / 范围（内网地址始终排除）
+	Allowlist []string `json:"allowlist,omitempty"`
+	// Expire 条目有效期，默认 24h，0 表示永久
+	Expire string `json:"expire,omitempty"`
+	// SetName ipset / nftables 集合名称，默认 nginxpulse_blocklist
+	SetName string `json:"setName,omitempty"`
+	// Filters 保存的日志筛选条件（参数与 /api/stats/logs 相同），供 filter 模式按名称引用
+	Filters map[string]map[string]string `json:"filters,omitempty"`
+	Outputs []BlocklistOutputConfig      `json:"outputs,omitempty"`
+}
+
+// BlocklistOutputConfig 封禁名单写入目标
+type BlocklistOutputConfig struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Format nginx / nginx-geo / ipset / nftables
+	Format string `json:"format"`
+}
+
+// 通知渠道类型
+const (
+	NotifyChannelWebhook  = "webhook"
+	NotifyChannelEmail    = "email"
+	NotifyChannelSlack    = "slack"
+	NotifyChannelTelegram = "telegram"
+	NotifyChannelDingTalk = "dingtalk"
+	NotifyChannelWeCom    = "wecom"
+	NotifyChannelFeishu   = "feishu"
+)
+
+// NotificationsConfig 系统通知外发。Routes 为空时所有渠道接收全部通知
+type NotificationsConfig struct {
+	Channels []NotificationChannelConfig `json:"channels,omitempty"`
+	Routes   []NotificationRouteConfig   `json:"routes,omitempty"`
+	// RepeatInterval 同一通知（指纹）重复出现时，向同一渠道再次发送的最短间隔，默认 30m，0 表示每次都发送
+	RepeatInterval string `json:"repeatInterval,omitempty"`
+	// Retries 发送失败后的重试次数，默认 3
+	Retries *int `json:"retries,omitempty"`
+}
+
+// NotificationChannelConfig 通知渠道。URL 为 webhook / Slack / 钉钉 / 企业微信 / 飞书机器人地址，
+// Telegram 可用 URL 覆盖 API 地址（默认 https://api.telegram.org）
+type NotificationChannelConfig struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled,omitempty"`
+	URL      string `json:"url,omitempty"`
+	// Secret webhook 的 HMAC-SHA256 签名密钥，或钉钉 / 飞书机器人的加签密钥
+	Secret  string            `json:"secret,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Template webhook 请求体模板（Go text/template），渲染结果必须是 JSON，为空时发送默认结构
+	Template string      `json:"template,omitempty"`
+	BotToken string      `json:"botToken,omitempty"`
+	ChatID   string      `json:"chatId,omitempty"`
+	SMTP     *SMTPConfig `json:"smtp,omitempty"`
+}
+
+// SMTPConfig 邮件渠道。端口 465 使用 TLS 直连，其余端口在服务器支持时使用 STARTTLS
+type SMTPConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	// InsecureSkipVerify 跳过证书校验（自签名证书的内网邮件服务器）
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// NotificationRouteConfig 通知路由，条件为空表示不限；一条通知匹配多条路由时，渠道去重后各发送一次
+type NotificationRouteConfig struct {
+	Channels   []string `json:"channels"`
+	Levels     []string `json:"levels,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	// Websites 站点 ID，按通知元数据中的 website_id 匹配
+	Websites []string `json:"websites,omitempty"`
+}
+
+// AnomalyConfig 流量异常检测，基线取历史同一周内小时（如每周一 10 点）的数据。
+// 未配置时按默认值启用
+type AnomalyConfig struct {
+	// Disabled 为 true 时定时任务不再检测与通知，统计接口仍可用
+	Disabled bool `json:"disabled,omitempty"`
+	// Weeks 基线使用的历史周数，默认 4，最大 12；受 system.logRetentionDays 限制
+	Weeks int `json:"weeks,omitempty"`
+	// Threshold 异常分数阈值（相对基线的稳健 z 分数），默认 4
+	Threshold float64 `json:"threshold,omitempty"`
+	// Metrics 参与检测的指标：pv / uv / 4xx / 5xx / bytes，默认全部
+	Metrics []string `json:"metrics,omitempty"`
+}
+
+// ReceiversConfig 兼容第三方采集协议的日志接收端点，默认全部关闭，需逐个启用；
+// 未配置 token 且 accessKeys 为空时不会启动
+type ReceiversConfig struct {
+	// Token 接收端点专用令牌，为空时使用 accessKeys 校验
+	Token         string                       `json:"token,omitempty"`
+	Loki          *ReceiverConfig              `json:"loki,omitempty"`
+	Elasticsearch *ElasticsearchReceiverConfig `json:"elasticsearch,omitempty"`
+	OTLP          *ReceiverConfig              `json:"otlp,omitempty"`
+}
+
+// ReceiverConfig 单个接收端点。Routes 按顺序匹配，命中第一条即停止；
+// 全部未命中时按协议的默认标签（如 Loki 的 website）取站点 ID 或名称
+type ReceiverConfig struct {
+	Enabled bool                  `json:"enabled,omitempty"`
+	Routes  []ReceiverRouteConfig `json:"routes,omitempty"`
+}
+
+// ElasticsearchReceiverConfig Elasticsearch _bulk 兼容端点
+type ElasticsearchReceiverConfig struct {
+	ReceiverConfig
+	// Version 握手时返回的 Elasticsearch 版本号，默认 8.17.0；客户端版本更高时需调大
+	Version string `json:"version,omitempty"`
+}
+
+// ReceiverRouteConfig 接收路由，match 为 Loki 风格的标签选择器，如 {job="nginx", host=~"web-.*"}
+type ReceiverRouteConfig struct {
+	Match string `json:"match"`
+	// Website 站点 ID 或名称
+	Website string `json:"website"`
+	// Source 来源 ID，可对应站点 sources 中的 agent 来源以使用其解析配置
+	Source string `json:"source,omitempty"`
+}
+
+// ReputationConfig IP 信誉名单。目录下每个文件为一个名单，支持 FireHOL netset、
+// Spamhaus DROP（文本 / JSON）、Tor 出口列表与普通 IP / CIDR / 范围列表。
+type ReputationConfig struct {
+	Disabled bool   `json:"disabled,omitempty"`
+	Dir      string `json:"dir,omitempty"`
+	// RefreshInterval 检查名单文件变化的间隔，默认 10m
+	RefreshInterval string `json:"refreshInterval,omitempty"`
+}
+
+// BruteForceConfig 滑动窗口内同一 IP（或网段）对登录接口的 POST 次数、
+// 401/403/429 响应次数超过阈值即记为一次安全事件。
+type BruteForceConfig struct {
+	Disabled bool `json:"disabled,omitempty"`
+	// LoginPaths 登录接口路径，忽略大小写；以 * 结尾表示前缀匹配
+	LoginPaths []string `json:"loginPaths,omitempty"`
+	// Window 滑动窗口，默认 5m
+	Window                 string `json:"window,omitempty"`
+	LoginThreshold         int    `json:"loginThreshold,omitempty"`
+	FailureThreshold       int    `json:"failureThreshold,omitempty"`
+	SubnetLoginThreshold   int    `json:"subnetLoginThreshold,omitempty"`
+	SubnetFailureThreshold int    `json:"subnetFailureThreshold,omitempty"`
+	// IPv4Prefix / IPv6Prefix 网段聚合的前缀长度，默认 24 / 64
+	IPv4Prefix int `json:"ipv4Prefix,omitempty"`
+	IPv6Prefix int `json:"ipv6Prefix,omitempty"`
+}
+
 // ReadRawConfig 读取配置（支持环境变量覆盖与默认值）但不初始化全局变量
 func ReadRawConfig() (*Config, error) {
 	return loadConfig()
@@ -159,6 +419,22 @@ func GetWebsiteByID(id string) (WebsiteConfig, bool) {
 	return WebsiteConfig{}, false
 }
 
+// ResolveWebsiteID 按站点 ID 或站点名称查找站点，返回站点 ID
+func ResolveWebsiteID(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", false
+	}
+	if _, ok := GetWebsiteByID(value); ok {
+		return value, true
+	}
+	id := generateID(value)
+	if website, ok := GetWebsiteByID(id); ok && website.Name == value {
+		return id, true
+	}
+	return "", false
+}
+
 // GetAllWebsiteIDs 获取所有网站的 ID 列表
 func GetAllWebsiteIDs() []string {
 	var ids []string
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LabelMatcher 标签匹配条件，Op 为 =、!=、=~、!~
+type LabelMatcher struct {
+	Name  string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+// Matches 判断标签是否满足条件，缺失的标签按空字符串处理（与 Loki 一致）
+func (m LabelMatcher) Matches(labels map[string]string) bool {
+	value := labels[m.Name]
+	switch m.Op {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	case "!~":
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// LabelSelector Loki / Prometheus 风格的标签选择器，全部条件满足才算命中
+type LabelSelector []LabelMatcher
+
+// Matches 判断标签是否命中选择器，空选择器匹配全部
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for _, matcher := range s {
+		if !matcher.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelSelector 解析形如 {job="nginx", host=~"web-.*"} 的选择器，正则为全匹配
+func ParseLabelSelector(raw string) (LabelSelector, error) {
+	text := strings.TrimSpace(raw)
+	if !strings.HasPrefix(text, "{") || !strings.HasSuffix(text, "}") {
+		return nil, fmt.Errorf("选择器需要以 { 开头、} 结尾")
+	}
+	text = strings.TrimSpace(text[1 : len(text)-1])
+
+	var selector LabelSelector
+	for text != "" {
+		nameEnd := 0
+		for nameEnd < len(text) && isLabelNameChar(text[nameEnd], nameEnd == 0) {
+			nameEnd++
+		}
+		if nameEnd == 0 {
+			return nil, fmt.Errorf("标签名无效: %s", text)
+		}
+		matcher := LabelMatcher{Name: text[:nameEnd]}
+		text = strings.TrimSpace(text[nameEnd:])
+
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(text, op) {
+				matcher.Op = op
+				break
+			}
+		}
+		if matcher.Op == "" {
+			return nil, fmt.Errorf("标签 %s 缺少匹配符（=、!=、=~、!~）", matcher.Name)
+		}
+		text = strings.TrimSpace(text[len(matcher.Op):])
+
+		value, rest, err := unquoteLabelValue(text)
+		if err != nil {
+			return nil, fmt.Errorf("标签 %s 的值无效: %w", matcher.Name, err)
+		}
+		matcher.Value = value
+		if matcher.Op == "=~" || matcher.Op == "!~" {
+			matcher.re, err = regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("标签 %s 的正则无效: %w", matcher.Name, err)
+			}
+		}
+		selector = append(selector, matcher)
+
+		text = strings.TrimSpace(rest)
+		if strings.HasPrefix(text, ",") {
+			text = strings.TrimSpace(text[1:])
+		} else if text != "" {
+			return nil, fmt.Errorf("标签之间需要用逗号分隔")
+		}
+	}
+	return selector, nil
+}
+
+// ParseLabelSet 解析 {job="nginx", host="web-1"} 形式的标签集合（如 Loki protobuf 中的流标签）
+func ParseLabelSet(raw string) (map[string]string, error) {
+	selector, err := ParseLabelSelector(raw)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string, len(selector))
+	for _, matcher := range selector {
+		if matcher.Op != "=" {
+			return nil, fmt.Errorf("标签集合只支持 =")
+		}
+		labels[matcher.Name] = matcher.Value
+	}
+	return labels, nil
+}
+
+func isLabelNameChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	// 允许点号以便匹配 OpenTelemetry / ECS 风格的属性名，如 service.name
+	return !first && ((c >= '0' && c <= '9') || c == '.')
+}
+
+// unquoteLabelValue 读取开头的双引号 / 反引号字符串，返回值与剩余部分
+func unquoteLabelValue(text string) (string, string, error) {
+	if text == "" {
+		return "", "", fmt.Errorf("缺少引号")
+	}
+	quote := text[0]
+	if quote != '"' && quote != '`' {
+		return "", "", fmt.Errorf("值需要用双引号包裹")
+	}
+	for i := 1; i < len(text); i++ {
+		if quote == '"' && text[i] == '\\' {
+			i++
+			continue
+		}
+		if text[i] == quote {
+			value, err := strconv.Unquote(text[:i+1])
+			if err != nil {
+				return "", "", err
+			}
+			return value, text[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("引号未闭合")
+}
@@ -16,12 +16,14 @@ const (
 	envTaskInterval      = "TASK_INTERVAL"
 	envLogRetentionDays  = "LOG_RETENTION_DAYS"
 	envLogParseBatchSize = "LOG_PARSE_BATCH_SIZE"
+	envLogParseWorkers   = "LOG_PARSE_WORKERS"
 	envServerPort        = "SERVER_PORT"
 	envPVStatusCodes     = "PV_STATUS_CODES"
 	envPVExcludePatterns = "PV_EXCLUDE_PATTERNS"
 	envPVExcludeIPs      = "PV_EXCLUDE_IPS"
 	envDemoMode          = "DEMO_MODE"
 	envAccessKeys        = "ACCESS_KEYS"
+	envMetricsToken      = "METRICS_TOKEN"
 	envLanguage          = "APP_LANGUAGE"
 	envWebBasePath       = "WEB_BASE_PATH"
 	envMobilePWAEnabled  = "MOBILE_PWA_ENABLED"
@@ -172,6 +174,16 @@ func applyEnvOverrides(cfg *Config) error {
 		}
 		cfg.System.ParseBatchSize = parsed
 	}
+	if raw, key := getEnvValue(envLogParseWorkers); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("解析 %s 失败: %w", key, err)
+		}
+		if parsed < 0 {
+			return fmt.Errorf("%s 不能小于0", key)
+		}
+		cfg.System.ParseWorkers = parsed
+	}
 	if raw, key := getEnvValue(envIPGeoCacheLimit); raw != "" {
 		parsed, err := strconv.Atoi(raw)
 		if err != nil {
@@ -201,6 +213,9 @@ func applyEnvOverrides(cfg *Config) error {
 		}
 		cfg.System.AccessKeys = values
 	}
+	if raw, _ := getEnvValue(envMetricsToken); raw != "" {
+		cfg.System.MetricsToken = strings.TrimSpace(raw)
+	}
 
 	if raw, _ := getEnvValue(envLanguage); raw != "" {
 		cfg.System.Language = raw
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"net/mail"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"text/template"
+	"time"
 )
 
 type FieldError struct {
@@ -48,6 +52,38 @@ func ValidateConfig(cfg *Config, opts ValidateOptions) ValidationResult {
 		if strings.TrimSpace(site.Name) == "" {
 			addError(sitePrefix+".name", "站点名称不能为空")
 		}
+		validateExtraFields(sitePrefix+".extraFields", site.ExtraFields, addError)
+		if site.URLNormalize != nil {
+			for ridx, rule := range site.URLNormalize.Rules {
+				rulePrefix := fmt.Sprintf("%s.urlNormalize.rules[%d]", sitePrefix, ridx)
+				template := strings.TrimSpace(rule.Template)
+				pattern := strings.TrimSpace(rule.Regex)
+				switch {
+				case template != "" && pattern != "":
+					addError(rulePrefix, "template 与 regex 只能二选一")
+				case template != "":
+					if !strings.HasPrefix(template, "/") {
+						addError(rulePrefix+".template", "template 必须以 / 开头")
+					}
+				case pattern != "":
+					if _, err := regexp.Compile(pattern); err != nil {
+						addError(rulePrefix+".regex", fmt.Sprintf("regex 无效: %v", err))
+					}
+				default:
+					addError(rulePrefix, "template 或 regex 不能为空")
+				}
+			}
+		}
+		for cidx, param := range site.CampaignClickIDs {
+			if !campaignParamPattern.MatchString(strings.TrimSpace(param)) {
+				addError(fmt.Sprintf("%s.campaignClickIds[%d]", sitePrefix, cidx), fmt.Sprintf("点击 ID 参数名无效: %s", param))
+			}
+		}
+		for sidx, src := range site.Sources {
+			if src.Parse != nil {
+				validateExtraFields(fmt.Sprintf("%s.sources[%d].parse.extraFields", sitePrefix, sidx), src.Parse.ExtraFields, addError)
+			}
+		}
 
 		if len(site.Sources) == 0 {
 			if strings.TrimSpace(site.LogPath) == "" {
@@ -160,6 +196,9 @@ func ValidateConfig(cfg *Config, opts ValidateOptions) ValidationResult {
 	if cfg.System.ParseBatchSize <= 0 {
 		addError("system.parseBatchSize", "parseBatchSize 必须大于 0")
 	}
+	if cfg.System.ParseWorkers < 0 {
+		addError("system.parseWorkers", "parseWorkers 不能小于 0")
+	}
 	if cfg.System.IPGeoCacheLimit <= 0 {
 		addError("system.ipGeoCacheLimit", "ipGeoCacheLimit 必须大于 0")
 	}
@@ -178,6 +217,10 @@ func ValidateConfig(cfg *Config, opts ValidateOptions) ValidationResult {
 				"brand-mark.svg": {},
 				"app-config.js": {},
 				"health":       {},
+				"metrics":      {},
+				"loki":         {},
+				"es":           {},
+				"v1":           {},
 			}
 			if _, ok := reserved[strings.ToLower(basePath)]; ok {
 				addError("system.webBasePath", "webBasePath 与系统保留路径冲突")
@@ -185,6 +228,331 @@ func ValidateConfig(cfg *Config, opts ValidateOptions) ValidationResult {
 		}
 	}
 
+	if cfg.RefererChannels != nil {
+		for i, rule := range cfg.RefererChannels.Rules {
+			rulePrefix := fmt.Sprintf("refererChannels.rules[%d]", i)
+			if strings.TrimSpace(rule.Name) == "" {
+				addError(rulePrefix+".name", "规则名称不能为空")
+			}
+			switch strings.TrimSpace(rule.Channel) {
+			case "search", "social", "email", "referral":
+			default:
+				addError(rulePrefix+".channel", "channel 仅支持 search、social、email、referral")
+			}
+			if len(rule.Domains) == 0 {
+				addError(rulePrefix+".domains", "domains 不能为空")
+			}
+		}
+	}
+
+	if cfg.Security != nil {
+		switch strings.ToLower(strings.TrimSpace(cfg.Security.NotifySeverity)) {
+		case "", "low", "medium", "high", "critical", "off":
+		default:
+			addError("security.notifySeverity", "notifySeverity 仅支持 low、medium、high、critical、off")
+		}
+		if rulesFile := strings.TrimSpace(cfg.Security.RulesFile); rulesFile != "" && opts.CheckPaths {
+			if _, err := os.Stat(rulesFile); err != nil {
+				addWarning("security.rulesFile", "规则文件不存在，将仅使用内置规则")
+			}
+		}
+		if bf := cfg.Security.BruteForce; bf != nil {
+			if raw := strings.TrimSpace(bf.Window); raw != "" {
+				if window, err := time.ParseDuration(raw); err != nil || window <= 0 {
+					addError("security.bruteForce.window", "window 格式错误，例如 5m")
+				} else if window > 24*time.Hour {
+					addError("security.bruteForce.window", "window 不能超过 24h")
+				}
+			}
+			thresholds := []struct {
+				name  string
+				value int
+			}{
+				{"loginThreshold", bf.LoginThreshold},
+				{"failureThreshold", bf.FailureThreshold},
+				{"subnetLoginThreshold", bf.SubnetLoginThreshold},
+				{"subnetFailureThreshold", bf.SubnetFailureThreshold},
+			}
+			for _, item := range thresholds {
+				if item.value < 0 {
+					addError("security.bruteForce."+item.name, item.name+" 不能小于 0")
+				} else if item.value > 100000 {
+					addError("security.bruteForce."+item.name, item.name+" 不能超过 100000")
+				}
+			}
+			if bf.IPv4Prefix != 0 && (bf.IPv4Prefix < 8 || bf.IPv4Prefix > 32) {
+				addError("security.bruteForce.ipv4Prefix", "ipv4Prefix 取值范围为 8-32")
+			}
+			if bf.IPv6Prefix != 0 && (bf.IPv6Prefix < 16 || bf.IPv6Prefix > 128) {
+				addError("security.bruteForce.ipv6Prefix", "ipv6Prefix 取值范围为 16-128")
+			}
+			for i, path := range bf.LoginPaths {
+				if !strings.HasPrefix(strings.TrimSpace(path), "/") {
+					addError(fmt.Sprintf("security.bruteForce.loginPaths[%d]", i), "登录路径必须以 / 开头")
+				}
+			}
+		}
+		if bl := cfg.Security.Blocklist; bl != nil {
+			if raw := strings.TrimSpace(bl.Expire); raw != "" {
+				if expire, err := time.ParseDuration(raw); err != nil || expire < 0 {
+					addError("security.blocklist.expire", "expire 格式错误，例如 24h，0 表示永久")
+				}
+			}
+			if setName := strings.TrimSpace(bl.SetName); setName != "" &&
+				!regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,27}$`).MatchString(setName) {
+				addError("security.blocklist.setName", "setName 仅支持字母开头的字母、数字、下划线或短横线，最长 28 位（ipset 名称上限 31 位，需预留 _v6 后缀）")
+			}
+			for i, raw := range bl.Allowlist {
+				value := strings.TrimSpace(raw)
+				valid := net.ParseIP(value) != nil
+				if !valid && strings.Contains(value, "/") {
+					_, _, err := net.ParseCIDR(value)
+					valid = err == nil
+				}
+				if !valid && strings.Contains(value, "-") {
+					start, end, ok := strings.Cut(value, "-")
+					valid = ok && net.ParseIP(strings.TrimSpace(start)) != nil && net.ParseIP(strings.TrimSpace(end)) != nil
+				}
+				if !valid {
+					addError(fmt.Sprintf("security.blocklist.allowlist[%d]", i), "无效的 IP / CIDR / 范围")
+				}
+			}
+			outputNames := make(map[string]struct{}, len(bl.Outputs))
+			for i, output := range bl.Outputs {
+				outputPrefix := fmt.Sprintf("security.blocklist.outputs[%d]", i)
+				name := strings.TrimSpace(output.Name)
+				if name == "" {
+					addError(outputPrefix+".name", "输出名称不能为空")
+				} else if _, ok := outputNames[name]; ok {
+					addError(outputPrefix+".name", fmt.Sprintf("输出名称重复: %s", name))
+				}
+				outputNames[name] = struct{}{}
+				if !filepath.IsAbs(strings.TrimSpace(output.Path)) {
+					addError(outputPrefix+".path", "path 必须为绝对路径")
+				}
+				switch strings.TrimSpace(output.Format) {
+				case "nginx", "nginx-geo", "ipset", "nftables":
+				default:
+					addError(outputPrefix+".format", "format 仅支持 nginx、nginx-geo、ipset、nftables")
+				}
+			}
+		}
+		if rep := cfg.Security.Reputation; rep != nil {
+			if raw := strings.TrimSpace(rep.RefreshInterval); raw != "" {
+				if interval, err := time.ParseDuration(raw); err != nil || interval < time.Minute {
+					addError("security.reputation.refreshInterval", "refreshInterval 格式错误或小于 1m")
+				}
+			}
+			if dir := strings.TrimSpace(rep.Dir); dir != "" && opts.CheckPaths {
+				if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+					addWarning("security.reputation.dir", "信誉名单目录不存在，将不会标记 IP")
+				}
+			}
+		}
+	}
+
+	if notifications := cfg.Notifications; notifications != nil {
+		if raw := strings.TrimSpace(notifications.RepeatInterval); raw != "" && raw != "0" {
+			if interval, err := time.ParseDuration(raw); err != nil || interval < 0 {
+				addError("notifications.repeatInterval", "repeatInterval 格式错误，例如 30m，0 表示不限制")
+			}
+		}
+		if notifications.Retries != nil && (*notifications.Retries < 0 || *notifications.Retries > 10) {
+			addError("notifications.retries", "retries 范围为 0 ~ 10")
+		}
+		channelNames := make(map[string]struct{}, len(notifications.Channels))
+		for i, channel := range notifications.Channels {
+			channelPrefix := fmt.Sprintf("notifications.channels[%d]", i)
+			name := strings.TrimSpace(channel.Name)
+			if name == "" {
+				addError(channelPrefix+".name", "渠道名称不能为空")
+			} else if _, ok := channelNames[name]; ok {
+				addError(channelPrefix+".name", fmt.Sprintf("渠道名称重复: %s", name))
+			}
+			channelNames[name] = struct{}{}
+
+			requireURL := func() {
+				if raw := strings.TrimSpace(channel.URL); raw == "" {
+					addError(channelPrefix+".url", "url 不能为空")
+				} else if parsed, err := url.Parse(raw); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+					addError(channelPrefix+".url", "url 必须是 http(s) 地址")
+				}
+			}
+			switch strings.TrimSpace(channel.Type) {
+			case NotifyChannelWebhook:
+				requireURL()
+				if tpl := strings.TrimSpace(channel.Template); tpl != "" {
+					if _, err := template.New("webhook").Funcs(template.FuncMap{"json": func(interface{}) string { return "" }}).Parse(tpl); err != nil {
+						addError(channelPrefix+".template", fmt.Sprintf("模板解析失败: %v", err))
+					}
+				}
+			case NotifyChannelSlack, NotifyChannelDingTalk, NotifyChannelWeCom, NotifyChannelFeishu:
+				requireURL()
+			case NotifyChannelTelegram:
+				if strings.TrimSpace(channel.BotToken) == "" || strings.TrimSpace(channel.ChatID) == "" {
+					addError(channelPrefix, "telegram 渠道需要 botToken 与 chatId")
+				}
+				if strings.TrimSpace(channel.URL) != "" {
+					requireURL()
+				}
+			case NotifyChannelEmail:
+				smtpCfg := channel.SMTP
+				if smtpCfg == nil || strings.TrimSpace(smtpCfg.Host) == "" {
+					addError(channelPrefix+".smtp.host", "email 渠道需要 smtp.host")
+					break
+				}
+				if smtpCfg.Port < 0 || smtpCfg.Port > 65535 {
+					addError(channelPrefix+".smtp.port", "端口范围为 1 ~ 65535")
+				}
+				if _, err := mail.ParseAddress(strings.TrimSpace(smtpCfg.From)); err != nil {
+					addError(channelPrefix+".smtp.from", "发件人地址无效")
+				}
+				if len(smtpCfg.To) == 0 {
+					addError(channelPrefix+".smtp.to", "收件人不能为空")
+				}
+				for j, to := range smtpCfg.To {
+					if _, err := mail.ParseAddress(strings.TrimSpace(to)); err != nil {
+						addError(fmt.Sprintf("%s.smtp.to[%d]", channelPrefix, j), "收件人地址无效")
+					}
+				}
+			default:
+				addError(channelPrefix+".type", "type 仅支持 webhook、email、slack、telegram、dingtalk、wecom、feishu")
+			}
+		}
+		for i, route := range notifications.Routes {
+			routePrefix := fmt.Sprintf("notifications.routes[%d]", i)
+			if len(route.Channels) == 0 {
+				addError(routePrefix+".channels", "路由至少需要一个渠道")
+			}
+			for _, name := range route.Channels {
+				if _, ok := channelNames[strings.TrimSpace(name)]; !ok {
+					addError(routePrefix+".channels", fmt.Sprintf("未定义的渠道: %s", name))
+				}
+			}
+			for _, level := range route.Levels {
+				switch strings.TrimSpace(level) {
+				case "info", "warning":
+				default:
+					addError(routePrefix+".levels", fmt.Sprintf("不支持的级别: %s", level))
+				}
+			}
+		}
+	}
+
+	if anomaly := cfg.Anomaly; anomaly != nil {
+		if anomaly.Weeks < 0 || anomaly.Weeks > 12 {
+			addError("anomaly.weeks", "weeks 范围为 1 ~ 12")
+		}
+		if anomaly.Threshold < 0 || (anomaly.Threshold > 0 && anomaly.Threshold < 1) || anomaly.Threshold > 100 {
+			addError("anomaly.threshold", "threshold 范围为 1 ~ 100")
+		}
+		for i, metric := range anomaly.Metrics {
+			switch strings.ToLower(strings.TrimSpace(metric)) {
+			case "pv", "uv", "4xx", "5xx", "bytes":
+			default:
+				addError(fmt.Sprintf("anomaly.metrics[%d]", i), "指标仅支持 pv、uv、4xx、5xx、bytes")
+			}
+		}
+		if weeks := anomaly.Weeks; weeks > 0 && cfg.System.LogRetentionDays > 0 && weeks*7 > cfg.System.LogRetentionDays {
+			addWarning("anomaly.weeks", "weeks 超过日志保留天数，基线只能使用保留期内的数据")
+		}
+	}
+
+	if receivers := cfg.Receivers; receivers != nil {
+		type namedReceiver struct {
+			name     string
+			receiver *ReceiverConfig
+		}
+		receiverList := []namedReceiver{{"loki", receivers.Loki}, {"otlp", receivers.OTLP}}
+		if receivers.Elasticsearch != nil {
+			receiverList = append(receiverList, namedReceiver{"elasticsearch", &receivers.Elasticsearch.ReceiverConfig})
+			if version := strings.TrimSpace(receivers.Elasticsearch.Version); version != "" && !esVersionPattern.MatchString(version) {
+				addError("receivers.elasticsearch.version", "version 格式应为 8.17.0")
+			}
+		}
+		anyEnabled := false
+		for _, item := range receiverList {
+			if item.receiver == nil {
+				continue
+			}
+			anyEnabled = anyEnabled || item.receiver.Enabled
+			for i, route := range item.receiver.Routes {
+				routePrefix := fmt.Sprintf("receivers.%s.routes[%d]", item.name, i)
+				if _, err := ParseLabelSelector(route.Match); err != nil {
+					addError(routePrefix+".match", fmt.Sprintf("选择器无效: %v", err))
+				}
+				website := strings.TrimSpace(route.Website)
+				if website == "" {
+					addError(routePrefix+".website", "website 不能为空")
+					continue
+				}
+				found := false
+				for _, site := range cfg.Websites {
+					if site.Name == website || generateID(site.Name) == website {
+						found = true
+						break
+					}
+				}
+				if !found {
+					addError(routePrefix+".website", fmt.Sprintf("站点不存在: %s", website))
+				}
+			}
+		}
+		if anyEnabled && strings.TrimSpace(receivers.Token) == "" && !hasAccessKey(cfg.System.AccessKeys) {
+			addWarning("receivers.token", "未配置 token 且 accessKeys 为空，日志接收端点不会启动")
+		}
+	}
+
+	providerNames := make(map[string]struct{}, len(cfg.System.IPGeoProviders))
+	for i, provider := range cfg.System.IPGeoProviders {
+		providerPrefix := fmt.Sprintf("system.ipGeoProviders[%d]", i)
+		providerType := strings.TrimSpace(provider.Type)
+		name := strings.TrimSpace(provider.Name)
+		if name == "" {
+			name = providerType
+		}
+		if _, ok := providerNames[name]; ok {
+			addError(providerPrefix+".name", fmt.Sprintf("查询源名称重复: %s", name))
+		}
+		providerNames[name] = struct{}{}
+		switch providerType {
+		case IPGeoProviderIP2Region, IPGeoProviderIPAPI:
+		case IPGeoProviderMMDB:
+			if strings.TrimSpace(provider.Path) == "" && strings.TrimSpace(provider.ASNPath) == "" {
+				addError(providerPrefix+".path", "mmdb 查询源需要配置 path 或 asnPath")
+			} else if opts.CheckPaths {
+				for _, item := range [][2]string{{"path", provider.Path}, {"asnPath", provider.ASNPath}} {
+					if strings.TrimSpace(item[1]) == "" {
+						continue
+					}
+					if _, err := os.Stat(strings.TrimSpace(item[1])); err != nil {
+						addError(providerPrefix+"."+item[0], "mmdb 文件不存在或不可访问")
+					}
+				}
+			}
+		case IPGeoProviderHTTP:
+			if !strings.Contains(provider.URL, "{ip}") {
+				addError(providerPrefix+".url", "url 需要包含 {ip} 占位符")
+			}
+			if strings.TrimSpace(provider.FieldMap["country"]) == "" && strings.TrimSpace(provider.FieldMap["countryCode"]) == "" {
+				addError(providerPrefix+".fieldMap", "fieldMap 至少需要配置 country 或 countryCode")
+			}
+		default:
+			addError(providerPrefix+".type", "type 仅支持 ip2region、mmdb、ip-api、http")
+		}
+		if raw := strings.TrimSpace(provider.Timeout); raw != "" {
+			if timeout, err := time.ParseDuration(raw); err != nil || timeout <= 0 {
+				addError(providerPrefix+".timeout", "timeout 格式无效")
+			}
+		}
+		if provider.RateLimit < 0 {
+			addError(providerPrefix+".rateLimit", "rateLimit 不能小于 0")
+		}
+		if provider.Burst < 0 {
+			addError(providerPrefix+".burst", "burst 不能小于 0")
+		}
+	}
+
 	if len(cfg.PVFilter.StatusCodeInclude) == 0 {
 		addError("pvFilter.statusCodeInclude", "statusCodeInclude 不能为空")
 	}
@@ -195,6 +563,41 @@ func ValidateConfig(cfg *Config, opts ValidateOptions) ValidationResult {
 	return result
 }
 
+var esVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+var extraFieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+var campaignParamPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+func validateExtraFields(field string, names []string, addError func(string, string)) {
+	if len(names) > MaxExtraFields {
+		addError(field, fmt.Sprintf("extraFields 最多配置 %d 个字段", MaxExtraFields))
+		return
+	}
+	seen := make(map[string]struct{}, len(names))
+	for _, raw := range names {
+		name := strings.TrimSpace(raw)
+		if !extraFieldNamePattern.MatchString(name) {
+			addError(field, fmt.Sprintf("extraFields 字段名无效: %s", raw))
+			return
+		}
+		if _, ok := seen[name]; ok {
+			addError(field, fmt.Sprintf("extraFields 字段重复: %s", name))
+			return
+		}
+		seen[name] = struct{}{}
+	}
+}
+
+func hasAccessKey(keys []string) bool {
+	for _, key := range keys {
+		if strings.TrimSpace(key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func validateWhitelistIP(value string) error {
 	trimmed := strings.TrimSpace(value)
 	if trimmed == "" {
@@ -0,0 +1,480 @@
+package enrich
+
+import (
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+// geoName 地名的中英文名称
+type geoName struct {
+	zh string
+	en string
+}
+
+// countryNames ISO 3166-1 alpha-2 国家 / 地区代码
+var countryNames = map[string]geoName{
+	"AD": {"安道尔", "Andorra"},
+	"AE": {"阿联酋", "United Arab Emirates"},
+	"AF": {"阿富汗", "Afghanistan"},
+	"AG": {"安提瓜和巴布达", "Antigua and Barbuda"},
+	"AI": {"安圭拉", "Anguilla"},
+	"AL": {"阿尔巴尼亚", "Albania"},
+	"AM": {"亚美尼亚", "Armenia"},
+	"AO": {"安哥拉", "Angola"},
+	"AQ": {"南极洲", "Antarctica"},
+	"AR": {"阿根廷", "Argentina"},
+	"AS": {"美属萨摩亚", "American Samoa"},
+	"AT": {"奥地利", "Austria"},
+	"AU": {"澳大利亚", "Australia"},
+	"AW": {"阿鲁巴", "Aruba"},
+	"AX": {"奥兰群岛", "Åland Islands"},
+	"AZ": {"阿塞拜疆", "Azerbaijan"},
+	"BA": {"波黑", "Bosnia and Herzegovina"},
+	"BB": {"巴巴多斯", "Barbados"},
+	"BD": {"孟加拉国", "Bangladesh"},
+	"BE": {"比利时", "Belgium"},
+	"BF": {"布基纳法索", "Burkina Faso"},
+	"BG": {"保加利亚", "Bulgaria"},
+	"BH": {"巴林", "Bahrain"},
+	"BI": {"布隆迪", "Burundi"},
+	"BJ": {"贝宁", "Benin"},
+	"BL": {"圣巴泰勒米", "Saint Barthélemy"},
+	"BM": {"百慕大", "Bermuda"},
+	"BN": {"文莱", "Brunei"},
+	"BO": {"玻利维亚", "Bolivia"},
+	"BQ": {"荷兰加勒比区", "Caribbean Netherlands"},
+	"BR": {"巴西", "Brazil"},
+	"BS": {"巴哈马", "Bahamas"},
+	"BT": {"不丹", "Bhutan"},
+	"BW": {"博茨瓦纳", "Botswana"},
+	"BY": {"白俄罗斯", "Belarus"},
+	"BZ": {"伯利兹", "Belize"},
+	"CA": {"加拿大", "Canada"},
+	"CD": {"刚果（金）", "DR Congo"},
+	"CF": {"中非", "Central African Republic"},
+	"CG": {"刚果（布）", "Congo Republic"},
+	"CH": {"瑞士", "Switzerland"},
+	"CI": {"科特迪瓦", "Ivory Coast"},
+	"CK": {"库克群岛", "Cook Islands"},
+	"CL": {"智利", "Chile"},
+	"CM": {"喀麦隆", "Cameroon"},
+	"CN": {"中国", "China"},
+	"CO": {"哥伦比亚", "Colombia"},
+	"CR": {"哥斯达黎加", "Costa Rica"},
+	"CU": {"古巴", "Cuba"},
+	"CV": {"佛得角", "Cabo Verde"},
+	"CW": {"库拉索", "Curaçao"},
+	"CY": {"塞浦路斯", "Cyprus"},
+	"CZ": {"捷克", "Czechia"},
+	"DE": {"德国", "Germany"},
+	"DJ": {"吉布提", "Djibouti"},
+	"DK": {"丹麦", "Denmark"},
+	"DM": {"多米尼克", "Dominica"},
+	"DO": {"多米尼加", "Dominican Republic"},
+	"DZ": {"阿尔及利亚", "Algeria"},
+	"EC": {"厄瓜多尔", "Ecuador"},
+	"EE": {"爱沙尼亚", "Estonia"},
+	"EG": {"埃及", "Egypt"},
+	"ER": {"厄立特里亚", "Eritrea"},
+	"ES": {"西班牙", "Spain"},
+	"ET": {"埃塞俄比亚", "Ethiopia"},
+	"FI": {"芬兰", "Finland"},
+	"FJ": {"斐济", "Fiji"},
+	"FK": {"福克兰群岛", "Falkland Islands"},
+	"FM": {"密克罗尼西亚", "Micronesia"},
+	"FO": {"法罗群岛", "Faroe Islands"},
+	"FR": {"法国", "France"},
+	"GA": {"加蓬", "Gabon"},
+	"GB": {"英国", "United Kingdom"},
+	"GD": {"格林纳达", "Grenada"},
+	"GE": {"格鲁吉亚", "Georgia"},
+	"GF": {"法属圭亚那", "French Guiana"},
+	"GG": {"根西岛", "Guernsey"},
+	"GH": {"加纳", "Ghana"},
+	"GI": {"直布罗陀", "Gibraltar"},
+	"GL": {"格陵兰", "Greenland"},
+	"GM": {"冈比亚", "Gambia"},
+	"GN": {"几内亚", "Guinea"},
+	"GP": {"瓜德罗普", "Guadeloupe"},
+	"GQ": {"赤道几内亚", "Equatorial Guinea"},
+	"GR": {"希腊", "Greece"},
+	"GT": {"危地马拉", "Guatemala"},
+	"GU": {"关岛", "Guam"},
+	"GW": {"几内亚比绍", "Guinea-Bissau"},
+	"GY": {"圭亚那", "Guyana"},
+	"HK": {"香港", "Hong Kong"},
+	"HN": {"洪都拉斯", "Honduras"},
+	"HR": {"克罗地亚", "Croatia"},
+	"HT": {"海地", "Haiti"},
+	"HU": {"匈牙利", "Hungary"},
+	"ID": {"印度尼西亚", "Indonesia"},
+	"IE": {"爱尔兰", "Ireland"},
+	"IL": {"以色列", "Israel"},
+	"IM": {"马恩岛", "Isle of Man"},
+	"IN": {"印度", "India"},
+	"IQ": {"伊拉克", "Iraq"},
+	"IR": {"伊朗", "Iran"},
+	"IS": {"冰岛", "Iceland"},
+	"IT": {"意大利", "Italy"},
+	"JE": {"泽西岛", "Jersey"},
+	"JM": {"牙买加", "Jamaica"},
+	"JO": {"约旦", "Jordan"},
+	"JP": {"日本", "Japan"},
+	"KE": {"肯尼亚", "Kenya"},
+	"KG": {"吉尔吉斯斯坦", "Kyrgyzstan"},
+	"KH": {"柬埔寨", "Cambodia"},
+	"KI": {"基里巴斯", "Kiribati"},
+	"KM": {"科摩罗", "Comoros"},
+	"KN": {"圣基茨和尼维斯", "St Kitts and Nevis"},
+	"KP": {"朝鲜", "North Korea"},
+	"KR": {"韩国", "South Korea"},
+	"KW": {"科威特", "Kuwait"},
+	"KY": {"开曼群岛", "Cayman Islands"},
+	"KZ": {"哈萨克斯坦", "Kazakhstan"},
+	"LA": {"老挝", "Laos"},
+	"LB": {"黎巴嫩", "Lebanon"},
+	"LC": {"圣卢西亚", "Saint Lucia"},
+	"LI": {"列支敦士登", "Liechtenstein"},
+	"LK": {"斯里兰卡", "Sri Lanka"},
+	"LR": {"利比里亚", "Liberia"},
+	"LS": {"莱索托", "Lesotho"},
+	"LT": {"立陶宛", "Lithuania"},
+	"LU": {"卢森堡", "Luxembourg"},
+	"LV": {"拉脱维亚", "Latvia"},
+	"LY": {"利比亚", "Libya"},
+	"MA": {"摩洛哥", "Morocco"},
+	"MC": {"摩纳哥", "Monaco"},
+	"MD": {"摩尔多瓦", "Moldova"},
+	"ME": {"黑山", "Montenegro"},
+	"MF": {"法属圣马丁", "Saint Martin"},
+	"MG": {"马达加斯加", "Madagascar"},
+	"MH": {"马绍尔群岛", "Marshall Islands"},
+	"MK": {"北马其顿", "North Macedonia"},
+	"ML": {"马里", "Mali"},
+	"MM": {"缅甸", "Myanmar"},
+	"MN": {"蒙古", "Mongolia"},
+	"MO": {"澳门", "Macao"},
+	"MP": {"北马里亚纳群岛", "Northern Mariana Islands"},
+	"MQ": {"马提尼克", "Martinique"},
+	"MR": {"毛里塔尼亚", "Mauritania"},
+	"MS": {"蒙特塞拉特", "Montserrat"},
+	"MT": {"马耳他", "Malta"},
+	"MU": {"毛里求斯", "Mauritius"},
+	"MV": {"马尔代夫", "Maldives"},
+	"MW": {"马拉维", "Malawi"},
+	"MX": {"墨西哥", "Mexico"},
+	"MY": {"马来西亚", "Malaysia"},
+	"MZ": {"莫桑比克", "Mozambique"},
+	"NA": {"纳米比亚", "Namibia"},
+	"NC": {"新喀里多尼亚", "New Caledonia"},
+	"NE": {"尼日尔", "Niger"},
+	"NF": {"诺福克岛", "Norfolk Island"},
+	"NG": {"尼日利亚", "Nigeria"},
+	"NI": {"尼加拉瓜", "Nicaragua"},
+	"NL": {"荷兰", "Netherlands"},
+	"NO": {"挪威", "Norway"},
+	"NP": {"尼泊尔", "Nepal"},
+	"NR": {"瑙鲁", "Nauru"},
+	"NU": {"纽埃", "Niue"},
+	"NZ": {"新西兰", "New Zealand"},
+	"OM": {"阿曼", "Oman"},
+	"PA": {"巴拿马", "Panama"},
+	"PE": {"秘鲁", "Peru"},
+	"PF": {"法属波利尼西亚", "French Polynesia"},
+	"PG": {"巴布亚新几内亚", "Papua New Guinea"},
+	"PH": {"菲律宾", "Philippines"},
+	"PK": {"巴基斯坦", "Pakistan"},
+	"PL": {"波兰", "Poland"},
+	"PM": {"圣皮埃尔和密克隆", "Saint Pierre and Miquelon"},
+	"PR": {"波多黎各", "Puerto Rico"},
+	"PS": {"巴勒斯坦", "Palestine"},
+	"PT": {"葡萄牙", "Portugal"},
+	"PW": {"帕劳", "Palau"},
+	"PY": {"巴拉圭", "Paraguay"},
+	"QA": {"卡塔尔", "Qatar"},
+	"RE": {"留尼汪", "Réunion"},
+	"RO": {"罗马尼亚", "Romania"},
+	"RS": {"塞尔维亚", "Serbia"},
+	"RU": {"俄罗斯", "Russia"},
+	"RW": {"卢旺达", "Rwanda"},
+	"SA": {"沙特阿拉伯", "Saudi Arabia"},
+	"SB": {"所罗门群岛", "Solomon Islands"},
+	"SC": {"塞舌尔", "Seychelles"},
+	"SD": {"苏丹", "Sudan"},
+	"SE": {"瑞典", "Sweden"},
+	"SG": {"新加坡", "Singapore"},
+	"SI": {"斯洛文尼亚", "Slovenia"},
+	"SK": {"斯洛伐克", "Slovakia"},
+	"SL": {"塞拉利昂", "Sierra Leone"},
+	"SM": {"圣马力诺", "San Marino"},
+	"SN": {"塞内加尔", "Senegal"},
+	"SO": {"索马里", "Somalia"},
+	"SR": {"苏里南", "Suriname"},
+	"SS": {"南苏丹", "South Sudan"},
+	"ST": {"圣多美和普林西比", "São Tomé and Príncipe"},
+	"SV": {"萨尔瓦多", "El Salvador"},
+	"SX": {"荷属圣马丁", "Sint Maarten"},
+	"SY": {"叙利亚", "Syria"},
+	"SZ": {"斯威士兰", "Eswatini"},
+	"TC": {"特克斯和凯科斯群岛", "Turks and Caicos Islands"},
+	"TD": {"乍得", "Chad"},
+	"TG": {"多哥", "Togo"},
+	"TH": {"泰国", "Thailand"},
+	"TJ": {"塔吉克斯坦", "Tajikistan"},
+	"TL": {"东帝汶", "Timor-Leste"},
+	"TM": {"土库曼斯坦", "Turkmenistan"},
+	"TN": {"突尼斯", "Tunisia"},
+	"TO": {"汤加", "Tonga"},
+	"TR": {"土耳其", "Türkiye"},
+	"TT": {"特立尼达和多巴哥", "Trinidad and Tobago"},
+	"TV": {"图瓦卢", "Tuvalu"},
+	"TW": {"台湾", "Taiwan"},
+	"TZ": {"坦桑尼亚", "Tanzania"},
+	"UA": {"乌克兰", "Ukraine"},
+	"UG": {"乌干达", "Uganda"},
+	"US": {"美国", "United States"},
+	"UY": {"乌拉圭", "Uruguay"},
+	"UZ": {"乌兹别克斯坦", "Uzbekistan"},
+	"VA": {"梵蒂冈", "Vatican City"},
+	"VC": {"圣文森特和格林纳丁斯", "St Vincent and Grenadines"},
+	"VE": {"委内瑞拉", "Venezuela"},
+	"VG": {"英属维尔京群岛", "British Virgin Islands"},
+	"VI": {"美属维尔京群岛", "U.S. Virgin Islands"},
+	"VN": {"越南", "Vietnam"},
+	"VU": {"瓦努阿图", "Vanuatu"},
+	"WF": {"瓦利斯和富图纳", "Wallis and Futuna"},
+	"WS": {"萨摩亚", "Samoa"},
+	"XK": {"科索沃", "Kosovo"},
+	"YE": {"也门", "Yemen"},
+	"YT": {"马约特", "Mayotte"},
+	"ZA": {"南非", "South Africa"},
+	"ZM": {"赞比亚", "Zambia"},
+	"ZW": {"津巴布韦", "Zimbabwe"},
+}
+
+// chinaRegionNames ISO 3166-2:CN 省级行政区代码，港澳台按 CN-HK / CN-MO / CN-TW 归入中国
+var chinaRegionNames = map[string]geoName{
+	"CN-AH": {"安徽", "Anhui"},
+	"CN-BJ": {"北京", "Beijing"},
+	"CN-CQ": {"重庆", "Chongqing"},
+	"CN-FJ": {"福建", "Fujian"},
+	"CN-GD": {"广东", "Guangdong"},
+	"CN-GS": {"甘肃", "Gansu"},
+	"CN-GX": {"广西", "Guangxi"},
+	"CN-GZ": {"贵州", "Guizhou"},
+	"CN-HA": {"河南", "Henan"},
+	"CN-HB": {"湖北", "Hubei"},
+	"CN-HE": {"河北", "Hebei"},
+	"CN-HI": {"海南", "Hainan"},
+	"CN-HK": {"香港", "Hong Kong"},
+	"CN-HL": {"黑龙江", "Heilongjiang"},
+	"CN-HN": {"湖南", "Hunan"},
+	"CN-JL": {"吉林", "Jilin"},
+	"CN-JS": {"江苏", "Jiangsu"},
+	"CN-JX": {"江西", "Jiangxi"},
+	"CN-LN": {"辽宁", "Liaoning"},
+	"CN-MO": {"澳门", "Macao"},
+	"CN-NM": {"内蒙古", "Inner Mongolia"},
+	"CN-NX": {"宁夏", "Ningxia"},
+	"CN-QH": {"青海", "Qinghai"},
+	"CN-SC": {"四川", "Sichuan"},
+	"CN-SD": {"山东", "Shandong"},
+	"CN-SH": {"上海", "Shanghai"},
+	"CN-SN": {"陕西", "Shaanxi"},
+	"CN-SX": {"山西", "Shanxi"},
+	"CN-TJ": {"天津", "Tianjin"},
+	"CN-TW": {"台湾", "Taiwan"},
+	"CN-XJ": {"新疆", "Xinjiang"},
+	"CN-XZ": {"西藏", "Tibet"},
+	"CN-YN": {"云南", "Yunnan"},
+	"CN-ZJ": {"浙江", "Zhejiang"},
+}
+
+// countryAliases 查询源之间常见的不同写法
+var countryAliases = map[string]string{
+	"usa":                      "US",
+	"united states of america": "US",
+	"uk":                       "GB",
+	"great britain":            "GB",
+	"england":                  "GB",
+	"russian federation":       "RU",
+	"korea":                    "KR",
+	"republic of korea":        "KR",
+	"viet nam":                 "VN",
+	"turkey":                   "TR",
+	"czech republic":           "CZ",
+	"the netherlands":          "NL",
+	"hong kong sar":            "HK",
+	"macau":                    "MO",
+	"burma":                    "MM",
+	"swaziland":                "SZ",
+	"uae":                      "AE",
+
+	// ip2region 等中文库
+	"中国香港":     "HK",
+	"中国澳门":     "MO",
+	"中国台湾":     "TW",
+	"阿拉伯联合酋长国": "AE",
+	"沙特":       "SA",
+	"印尼":       "ID",
+	"澳洲":       "AU",
+}
+
+// chinaRegionSuffixes 省级行政区名称后缀，长后缀在前
+var chinaRegionSuffixes = []string{
+	"维吾尔自治区", "壮族自治区", "回族自治区", "特别行政区", "自治区", "省", "市",
+	" special administrative region", " autonomous region", " municipality", " province",
+	" uyghur", " uygur", " zhuang", " hui", " sar", " sheng", " shi",
+}
+
+var (
+	countryIndex     = make(map[string]string)
+	chinaRegionIndex = map[string]string{
+		"内蒙":         "CN-NM",
+		"nei mongol": "CN-NM",
+		"xizang":     "CN-XZ",
+		"macau":      "CN-MO",
+	}
+)
+
+func init() {
+	for code, name := range countryNames {
+		countryIndex[strings.ToLower(code)] = code
+		countryIndex[name.zh] = code
+		countryIndex[strings.ToLower(name.en)] = code
+	}
+	for alias, code := range countryAliases {
+		countryIndex[alias] = code
+	}
+	for code, name := range chinaRegionNames {
+		chinaRegionIndex[name.zh] = code
+		chinaRegionIndex[strings.ToLower(name.en)] = code
+	}
+}
+
+// CountryCodeFromName 由中文 / 英文国家名称或两位代码得到 ISO 3166-1 代码，无法识别时返回空
+func CountryCodeFromName(name string) string {
+	clean := strings.ToLower(normalizeLocationPart(name))
+	if clean == "" {
+		return ""
+	}
+	return countryIndex[clean]
+}
+
+// ChinaRegionCode 由省级行政区名称（中文或拼音，可带“省”“自治区”等后缀）得到 ISO 3166-2:CN 代码
+func ChinaRegionCode(name string) string {
+	clean := strings.ToLower(normalizeLocationPart(name))
+	if clean == "" {
+		return ""
+	}
+	if code, ok := chinaRegionIndex[clean]; ok {
+		return code
+	}
+	for _, suffix := range chinaRegionSuffixes {
+		if trimmed := strings.TrimSuffix(clean, suffix); trimmed != clean && trimmed != "" {
+			if code, ok := chinaRegionIndex[trimmed]; ok {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+// normalizeLocationCodes 统一代码写法：港澳台归入 CN 并使用 CN-HK / CN-MO / CN-TW，
+// 中国优先按省份名称匹配，其余地区代码补全国家前缀（如 US-CA）
+func normalizeLocationCodes(countryCode, regionCode, regionName string) (string, string) {
+	countryCode = strings.ToUpper(strings.TrimSpace(countryCode))
+	regionCode = strings.ToUpper(strings.TrimSpace(regionCode))
+	switch countryCode {
+	case "":
+		return "", ""
+	case "HK", "MO", "TW":
+		return "CN", "CN-" + countryCode
+	case "CN":
+		if code := ChinaRegionCode(regionName); code != "" {
+			return countryCode, code
+		}
+		candidate := "CN-" + strings.TrimPrefix(regionCode, "CN-")
+		if _, ok := chinaRegionNames[candidate]; ok {
+			return countryCode, candidate
+		}
+		return countryCode, ""
+	}
+	if regionCode != "" && !strings.Contains(regionCode, "-") {
+		regionCode = countryCode + "-" + regionCode
+	}
+	return countryCode, regionCode
+}
+
+// IsMainlandChina 是否为中国大陆（不含港澳台）
+func IsMainlandChina(countryCode, regionCode string) bool {
+	if !strings.EqualFold(strings.TrimSpace(countryCode), "CN") {
+		return false
+	}
+	switch strings.ToUpper(strings.TrimSpace(regionCode)) {
+	case "CN-HK", "CN-MO", "CN-TW":
+		return false
+	}
+	return true
+}
+
+// LocalizedCountryName 按语言设置返回国家名称，未收录的代码原样返回
+func LocalizedCountryName(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if name, ok := countryNames[code]; ok {
+		return localizedGeoName(name)
+	}
+	return code
+}
+
+// LocalizedRegionName 按语言设置返回中国省级行政区名称，其他地区代码原样返回
+func LocalizedRegionName(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if name, ok := chinaRegionNames[code]; ok {
+		return localizedGeoName(name)
+	}
+	return code
+}
+
+func localizedGeoName(name geoName) string {
+	if config.GetLanguage() == config.EnglishLanguage {
+		return name.en
+	}
+	return name.zh
+}
+
+// LocationCodesFromLabels 由已存储的 domestic / global 文本推导国家代码、地区代码与城市，
+// 用于代码字段上线前写入的历史数据
+func LocationCodesFromLabels(domestic, global string) (string, string, string) {
+	countryCode := CountryCodeFromName(global)
+	if countryCode == "" {
+		return "", "", ""
+	}
+	parts := make([]string, 0, 3)
+	for _, part := range strings.Split(domestic, "·") {
+		if clean := normalizeLocationPart(part); clean != "" {
+			parts = append(parts, clean)
+		}
+	}
+
+	regionName := ""
+	city := ""
+	if countryCode == "CN" {
+		// 国内格式为“省份·城市”，仅有一段时为直辖市或省份
+		if len(parts) > 0 && parts[0] != normalizeLocationPart(global) {
+			regionName = parts[0]
+		}
+		if len(parts) > 1 {
+			city = parts[len(parts)-1]
+		}
+	} else if len(parts) > 2 {
+		// 国外格式为“国家·地区·城市”
+		city = parts[2]
+	}
+	if isISPLabel(city) {
+		city = ""
+	}
+	countryCode, regionCode := normalizeLocationCodes(countryCode, "", regionName)
+	return countryCode, regionCode, city
+}
@@ -2,7 +2,6 @@ package enrich
 
 import (
 	"bytes"
-	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -24,6 +23,8 @@ import (
 var ipDataFiles embed.FS
 
 var (
+	// ipSearcherMu 保护搜索器的替换，数据库热更新时整体切换
+	ipSearcherMu  sync.RWMutex
 	ipSearcherV4  *xdb.Searcher
 	ipSearcherV6  *xdb.Searcher
 	vectorIndexV4 []byte
@@ -33,8 +34,7 @@ var (
 )
 
 const (
-	ipAPIFields    = "status,message,country,countryCode,region,regionName,city,isp,query"
-	ipAPITimeout   = 1200 * time.Millisecond
+	ipAPIFields    = "status,message,country,countryCode,region,regionName,city,lat,lon,isp,query"
 	maxIPCacheSize = 50000
 	ipAPIBatchSize = 100
 )
@@ -43,11 +43,17 @@ type IPLocation struct {
 	Domestic string
 	Global   string
 	Source   string
+	// CountryCode ISO 3166-1 代码，港澳台统一为 CN
+	CountryCode string
+	// RegionCode ISO 3166-2 代码，如 CN-GD、CN-HK、US-CA
+	RegionCode string
+	City       string
+	Latitude   float64
+	Longitude  float64
 }
 
 type ipLocationCacheEntry struct {
-	Domestic string
-	Global   string
+	Location IPLocation
 	Updated  time.Time
 }
 
@@ -63,15 +69,17 @@ type ipAPIBatchRequest struct {
 }
 
 type ipAPIBatchResponse struct {
-	Status      string `json:"status"`
-	Message     string `json:"message"`
-	Country     string `json:"country"`
-	CountryCode string `json:"countryCode"`
-	Region      string `json:"region"`
-	RegionName  string `json:"regionName"`
-	City        string `json:"city"`
-	ISP         string `json:"isp"`
-	Query       string `json:"query"`
+	Status      string  `json:"status"`
+	Message     string  `json:"message"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"countryCode"`
+	Region      string  `json:"region"`
+	RegionName  string  `json:"regionName"`
+	City        string  `json:"city"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	ISP         string  `json:"isp"`
+	Query       string  `json:"query"`
 }
 
 type ipRegionParts struct {
@@ -127,8 +135,37 @@ func extractIPRegionDBFile(embedPath, targetPath, label string) error {
 	return nil
 }
 
-// InitIPGeoLocation 初始化 IP 地理位置查询
+// InitIPGeoLocation 初始化 IP 地理位置查询链
 func InitIPGeoLocation() error {
+	providerCfgs := resolveIPGeoProviderConfigs(config.ReadConfig())
+	for _, cfg := range providerCfgs {
+		if strings.TrimSpace(cfg.Type) == config.IPGeoProviderIP2Region {
+			if err := initIP2Region(); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	providers, err := BuildIPGeoProviders(providerCfgs)
+	if err != nil {
+		return err
+	}
+	SetIPGeoProviders(providers)
+	names := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		names = append(names, provider.Name())
+	}
+	logrus.Infof("IP 归属地查询链: %s", strings.Join(names, " -> "))
+
+	loadIPGeoDBState(providerCfgs)
+	if err := InitIPNetworks(); err != nil {
+		logrus.WithError(err).Warn("加载网络分类数据失败")
+	}
+	return nil
+}
+
+func initIP2Region() error {
 	// 从嵌入的文件系统中提取数据库文件
 	v4Path, v6Path, err := ExtractIPRegionDBs()
 	if err != nil {
@@ -149,10 +186,12 @@ func InitIPGeoLocation() error {
 		return err
 	}
 
+	ipSearcherMu.Lock()
 	ipSearcherV4 = searcherV4
 	ipSearcherV6 = searcherV6
 	vectorIndexV4 = vIndexV4
 	vectorIndexV6 = vIndexV6
+	ipSearcherMu.Unlock()
 	logrus.Info("ip2region 初始化成功")
 	return nil
 }
@@ -187,60 +226,29 @@ func GetIPLocation(ip string) (string, string, error) {
 	if ip == "" || ip == "localhost" || ip == "127.0.0.1" || ip == "::1" {
 		return "本地", "本地", nil
 	}
-
-	if domestic, global, ok := getCachedLocation(ip); ok {
-		return domestic, global, nil
-	}
-
-	parsedIP := net.ParseIP(ip)
-	if parsedIP == nil {
+	if net.ParseIP(ip) == nil {
 		return "未知", "未知", fmt.Errorf("无效的 IP 地址")
 	}
 
-	// 检查是否是内网 IP
-	if isPrivateIP(parsedIP) {
-		return "内网", "本地网络", nil
+	results, failures, err := GetIPLocationBatch([]string{ip})
+	if loc, ok := results[ip]; ok {
+		return loc.Domestic, loc.Global, nil
 	}
-
-	localDomestic, localGlobal, localHasCity, localErr := queryIPLocationLocalDetailed(ip, parsedIP)
-	localUsable := localErr == nil && localDomestic != "" && localDomestic != "未知" && localGlobal != "" && localGlobal != "未知"
-	if localUsable && localHasCity {
-		setCachedLocation(ip, localDomestic, localGlobal)
-		return localDomestic, localGlobal, nil
+	if failure, ok := failures[ip]; ok {
+		return "未知", "未知", fmt.Errorf("%s 查询失败: %s", failure.Provider, failure.Reason)
 	}
-
-	remoteDomestic, remoteGlobal, remoteErr := queryIPLocationRemote(ip)
-	if remoteErr == nil {
-		if remoteDomestic == "" {
-			remoteDomestic = "未知"
-		}
-		if remoteGlobal == "" {
-			remoteGlobal = "未知"
-		}
-		if remoteDomestic != "未知" && remoteGlobal != "未知" {
-			setCachedLocation(ip, remoteDomestic, remoteGlobal)
-			return remoteDomestic, remoteGlobal, nil
-		}
-	}
-
-	if localUsable {
-		setCachedLocation(ip, localDomestic, localGlobal)
-		return localDomestic, localGlobal, nil
-	}
-
-	if remoteErr != nil {
-		return "未知", "未知", remoteErr
+	if err != nil {
+		return "未知", "未知", err
 	}
-	setCachedLocation(ip, "未知", "未知")
 	return "未知", "未知", nil
 }
 
-// GetIPLocationBatch 批量获取 IP 的地理位置信息（优先本地）
-// failures 返回远端 API 未能查询到的 IP 及原因
-func GetIPLocationBatch(ips []string) (map[string]IPLocation, map[string]string, error) {
+// GetIPLocationBatch 按查询链批量获取 IP 的地理位置信息
+// failures 返回所有查询源均未能查询到的 IP 及最后失败的查询源与原因
+func GetIPLocationBatch(ips []string) (map[string]IPLocation, map[string]IPGeoFailure, error) {
 	results := make(map[string]IPLocation, len(ips))
 	if len(ips) == 0 {
-		return results, map[string]string{}, nil
+		return results, map[string]IPGeoFailure{}, nil
 	}
 
 	unique := make([]string, 0, len(ips))
@@ -258,109 +266,95 @@ func GetIPLocationBatch(ips []string) (map[string]IPLocation, map[string]string,
 	}
 
 	toQuery := make([]string, 0, len(unique))
-	fallbacks := make(map[string]IPLocation, len(unique))
 	for _, ip := range unique {
-		if domestic, global, ok := getCachedLocation(ip); ok {
-			results[ip] = IPLocation{Domestic: domestic, Global: global, Source: "cache"}
+		if loc, ok := getCachedLocation(ip); ok {
+			loc.Source = "cache"
+			results[ip] = loc
 			continue
 		}
 
 		if ip == "localhost" || ip == "127.0.0.1" || ip == "::1" {
 			results[ip] = IPLocation{Domestic: "本地", Global: "本地", Source: "local"}
-			setCachedLocation(ip, "本地", "本地")
+			setCachedLocation(ip, results[ip])
 			continue
 		}
 
 		parsedIP := net.ParseIP(ip)
 		if parsedIP == nil {
 			results[ip] = IPLocation{Domestic: "未知", Global: "未知", Source: "invalid"}
-			setCachedLocation(ip, "未知", "未知")
+			setCachedLocation(ip, results[ip])
 			continue
 		}
 
-		if isPrivateIP(parsedIP) {
+		if IsPrivateIP(parsedIP) {
 			results[ip] = IPLocation{Domestic: "内网", Global: "本地网络", Source: "local"}
-			setCachedLocation(ip, "内网", "本地网络")
-			continue
-		}
-
-		localDomestic, localGlobal, localHasCity, localErr := queryIPLocationLocalDetailed(ip, parsedIP)
-		localUsable := localErr == nil && localDomestic != "" && localDomestic != "未知" && localGlobal != "" && localGlobal != "未知"
-		if localUsable && localHasCity {
-			results[ip] = IPLocation{Domestic: localDomestic, Global: localGlobal, Source: "local"}
-			setCachedLocation(ip, localDomestic, localGlobal)
+			setCachedLocation(ip, results[ip])
 			continue
 		}
-		if localUsable {
-			fallbacks[ip] = IPLocation{Domestic: localDomestic, Global: localGlobal, Source: "local"}
-		}
 		toQuery = append(toQuery, ip)
 	}
 
 	if len(toQuery) == 0 {
-		return results, map[string]string{}, nil
+		return results, map[string]IPGeoFailure{}, nil
 	}
 
-	remoteResults, remoteFailures, remoteErr := queryIPLocationRemoteBatch(toQuery)
+	resolved, failures, err := resolveIPGeoChain(GetIPGeoProviders(), toQuery)
 	for _, ip := range toQuery {
-		if entry, ok := remoteResults[ip]; ok {
-			results[ip] = IPLocation{Domestic: entry.Domestic, Global: entry.Global, Source: "remote"}
-			if entry.Domestic != "" && entry.Domestic != "未知" && entry.Global != "" && entry.Global != "未知" {
-				setCachedLocation(ip, entry.Domestic, entry.Global)
-			}
+		if loc, ok := resolved[ip]; ok {
+			results[ip] = loc
+			setCachedLocation(ip, loc)
 			continue
 		}
-		if fallback, ok := fallbacks[ip]; ok {
-			results[ip] = fallback
-			setCachedLocation(ip, fallback.Domestic, fallback.Global)
+		if _, failed := failures[ip]; failed {
 			continue
 		}
-		if remoteErr == nil {
-			if _, failed := remoteFailures[ip]; failed {
-				continue
-			}
-			results[ip] = IPLocation{Domestic: "未知", Global: "未知", Source: "unknown"}
-			setCachedLocation(ip, "未知", "未知")
-		}
+		results[ip] = IPLocation{Domestic: "未知", Global: "未知", Source: "unknown"}
+		setCachedLocation(ip, results[ip])
 	}
+	return results, failures, err
+}
 
-	if len(results) > 0 {
-		return results, remoteFailures, remoteErr
-	}
-	return results, remoteFailures, remoteErr
+// ip2regionProvider 内置 ip2region 离线库（中文地名，国内可精确到城市）
+type ip2regionProvider struct {
+	ipGeoProviderBase
 }
 
-func queryIPLocationLocalRegion(ip string, parsedIP net.IP) (string, error) {
-	searcher, err := pickIPSearcher(parsedIP)
-	if err != nil {
-		return "", err
+func newIP2RegionProvider(base ipGeoProviderBase) (IPGeoProvider, error) {
+	ipSearcherMu.RLock()
+	ready := ipSearcherV4 != nil && ipSearcherV6 != nil
+	ipSearcherMu.RUnlock()
+	if !ready {
+		return nil, fmt.Errorf("ip2region 未初始化")
 	}
+	return &ip2regionProvider{ipGeoProviderBase: base}, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
-	defer cancel()
-
-	resultCh := make(chan struct {
-		region string
-		err    error
-	}, 1)
+func (p *ip2regionProvider) Remote() bool {
+	return false
+}
 
-	go func() {
+func (p *ip2regionProvider) Lookup(ips []string) (map[string]IPGeoRecord, map[string]string, error) {
+	return p.lookupEach(ips, func(ip string) (IPGeoRecord, bool, error) {
+		searcher, err := pickIPSearcher(net.ParseIP(ip))
+		if err != nil {
+			return IPGeoRecord{}, false, err
+		}
 		region, err := searcher.SearchByStr(ip)
-		resultCh <- struct {
-			region string
-			err    error
-		}{region, err}
-	}()
-
-	select {
-	case <-ctx.Done():
-		return "", fmt.Errorf("IP 查询超时")
-	case result := <-resultCh:
-		if result.err != nil {
-			return "", result.err
+		if err != nil {
+			return IPGeoRecord{}, false, err
 		}
-		return result.region, nil
-	}
+		parts := parseIPRegionParts(region)
+		record := IPGeoRecord{
+			Country: normalizeLocationPart(parts.Country),
+			Region:  normalizeLocationPart(parts.Province),
+			City:    normalizeLocationPart(parts.City),
+			ISP:     normalizeLocationPart(parts.ISP),
+		}
+		if record.Country == "中国" {
+			record.CountryCode = "CN"
+		}
+		return record, record.usable(), nil
+	})
 }
 
 func pickIPSearcher(ip net.IP) (*xdb.Searcher, error) {
@@ -368,6 +362,8 @@ func pickIPSearcher(ip net.IP) (*xdb.Searcher, error) {
 		return nil, fmt.Errorf("无效的 IP 地址")
 	}
 
+	ipSearcherMu.RLock()
+	defer ipSearcherMu.RUnlock()
 	if ip.To4() != nil {
 		if ipSearcherV4 == nil {
 			return nil, fmt.Errorf("ip2region v4 未初始化")
@@ -385,63 +381,33 @@ func pickIPSearcher(ip net.IP) (*xdb.Searcher, error) {
 	return nil, fmt.Errorf("无效的 IP 地址")
 }
 
-func queryIPLocationLocalDetailed(ip string, parsedIP net.IP) (string, string, bool, error) {
-	if parsedIP == nil {
-		parsedIP = net.ParseIP(ip)
-		if parsedIP == nil {
-			return "未知", "未知", false, fmt.Errorf("无效的 IP 地址")
-		}
-	}
-
-	region, err := queryIPLocationLocalRegion(ip, parsedIP)
-	if err != nil {
-		return "未知", "未知", false, err
-	}
-	domestic, global, err := parseIPRegion(region)
-	if err != nil {
-		return domestic, global, false, err
-	}
-	parts := parseIPRegionParts(region)
-	city := removeSuffixes(strings.TrimSpace(parts.City))
-	if isISPLabel(city) {
-		city = ""
-	}
-	hasCity := city != "" && city != "0" && city != "未知"
-	return domestic, global, hasCity, nil
+// ipAPIProvider ip-api.com 批量接口（兼容 system.ipGeoApiUrl）
+type ipAPIProvider struct {
+	ipGeoProviderBase
+	url string
 }
 
-// 查询 IP 地理位置（本地库）
-func queryIPLocationLocal(ip string) (string, string, error) {
-	domestic, global, _, err := queryIPLocationLocalDetailed(ip, nil)
-	return domestic, global, err
+func newIPAPIProvider(base ipGeoProviderBase, cfg config.IPGeoProviderConfig) IPGeoProvider {
+	return &ipAPIProvider{ipGeoProviderBase: base, url: strings.TrimSpace(cfg.URL)}
 }
 
-// 查询 IP 地理位置（远程接口）
-func queryIPLocationRemote(ip string) (string, string, error) {
-	results, failures, err := queryIPLocationRemoteBatch([]string{ip})
-	if err != nil {
-		return "未知", "未知", err
-	}
-	if reason, ok := failures[ip]; ok && reason != "" {
-		return "未知", "未知", fmt.Errorf("ip-api 查询失败: %s", reason)
-	}
-	entry, ok := results[ip]
-	if !ok {
-		return "未知", "未知", fmt.Errorf("ip-api 返回为空")
-	}
-	return entry.Domestic, entry.Global, nil
+func (p *ipAPIProvider) Remote() bool {
+	return true
 }
 
-func queryIPLocationRemoteBatch(ips []string) (map[string]ipLocationCacheEntry, map[string]string, error) {
-	results := make(map[string]ipLocationCacheEntry, len(ips))
+func (p *ipAPIProvider) Lookup(ips []string) (map[string]IPGeoRecord, map[string]string, error) {
+	results := make(map[string]IPGeoRecord, len(ips))
 	failures := make(map[string]string)
 	if len(ips) == 0 {
 		return results, failures, nil
 	}
 
-	client := &http.Client{Timeout: ipAPITimeout}
+	client := &http.Client{Timeout: p.timeout}
 	var lastErr error
-	apiURL := resolveIPAPIURL()
+	apiURL := p.url
+	if apiURL == "" {
+		apiURL = resolveIPAPIURL()
+	}
 
 	for start := 0; start < len(ips); start += ipAPIBatchSize {
 		end := start + ipAPIBatchSize
@@ -450,6 +416,12 @@ func queryIPLocationRemoteBatch(ips []string) (map[string]ipLocationCacheEntry,
 		}
 
 		batch := ips[start:end]
+		if !p.limiter.wait(ipGeoRateLimitMaxWait) {
+			for _, ip := range batch {
+				failures[ip] = IPGeoReasonRateLimited
+			}
+			continue
+		}
 		language := resolveIPAPILanguage()
 		requestPayload := make([]ipAPIBatchRequest, 0, len(batch))
 		for _, ip := range batch {
@@ -522,61 +494,22 @@ func queryIPLocationRemoteBatch(ips []string) (map[string]ipLocationCacheEntry,
 				continue
 			}
 
-			domestic := formatDomesticLocation(item.Country, item.CountryCode, item.RegionName, item.City)
-			global := formatGlobalLocation(item.Country)
-			if domestic == "" {
-				domestic = "未知"
-			}
-			if global == "" {
-				global = "未知"
+			results[query] = IPGeoRecord{
+				Country:     item.Country,
+				CountryCode: item.CountryCode,
+				Region:      item.RegionName,
+				RegionCode:  item.Region,
+				City:        item.City,
+				ISP:         item.ISP,
+				Latitude:    item.Lat,
+				Longitude:   item.Lon,
 			}
-			results[query] = ipLocationCacheEntry{Domestic: domestic, Global: global}
 		}
 	}
 
 	return results, failures, lastErr
 }
 
-// 解析 ip2region 返回的地区信息
-func parseIPRegion(region string) (string, string, error) {
-	// 返回格式: 国家|区域|省份|城市|ISP
-	parts := parseIPRegionParts(region)
-	var domestic, global string
-
-	// 国内
-	if parts.Country == "中国" {
-		province := removeSuffixes(parts.Province)
-		city := removeSuffixes(parts.City)
-		if isISPLabel(city) {
-			city = ""
-		}
-		if province != "" && province != "0" {
-			if city != "" && city != "0" && city != province {
-				domestic = fmt.Sprintf("%s·%s", province, city)
-			} else {
-				domestic = province
-			}
-		} else if city != "" && city != "0" {
-			domestic = city
-		} else {
-			domestic = "中国"
-		}
-	} else if parts.Country == "0" || parts.Country == "" {
-		domestic = "未知"
-	} else {
-		domestic = joinLocationParts(parts.Country, parts.Province, parts.City)
-	}
-
-	// 全球
-	if parts.Country != "0" && parts.Country != "" {
-		global = parts.Country
-	} else {
-		global = "未知"
-	}
-
-	return domestic, global, nil
-}
-
 // 解析 ip2region
 func splitRegion(region string) []string {
 	parts := make([]string, 5)
@@ -682,45 +615,45 @@ func resolveIPAPIURL() string {
 	return config.GetIPGeoAPIURL()
 }
 
-func getIPLocationLocalOnly(ip string) (string, string, bool) {
+func getIPLocationLocalOnly(ip string) (IPLocation, bool) {
 	if ip == "" || ip == "localhost" || ip == "127.0.0.1" || ip == "::1" {
-		return "", "", false
+		return IPLocation{}, false
 	}
-	if domestic, global, ok := getCachedLocation(ip); ok {
-		return domestic, global, true
+	if loc, ok := getCachedLocation(ip); ok {
+		return loc, true
 	}
 	parsed := net.ParseIP(ip)
 	if parsed == nil {
-		return "", "", false
+		return IPLocation{}, false
 	}
-	if isPrivateIP(parsed) {
-		return "", "", false
+	if IsPrivateIP(parsed) {
+		return IPLocation{}, false
 	}
-	domestic, global, _, err := queryIPLocationLocalDetailed(ip, parsed)
-	if err != nil {
-		return "", "", false
+	loc, ok := lookupIPGeoLocal(ip)
+	if !ok {
+		return IPLocation{}, false
 	}
-	if domestic == "" || domestic == "未知" || global == "" || global == "未知" {
-		return domestic, global, false
+	if loc.Domestic == "" || loc.Domestic == "未知" || loc.Global == "" || loc.Global == "未知" {
+		return loc, false
 	}
-	setCachedLocation(ip, domestic, global)
-	return domestic, global, true
+	setCachedLocation(ip, loc)
+	return loc, true
 }
 
-func getCachedLocation(ip string) (string, string, bool) {
+func getCachedLocation(ip string) (IPLocation, bool) {
 	ipGeoCacheMu.RLock()
 	entry, ok := ipGeoCache[ip]
 	ipGeoCacheMu.RUnlock()
 	if !ok {
-		return "", "", false
+		return IPLocation{}, false
 	}
-	if entry.Domestic == "未知" && entry.Global == "未知" {
-		return "", "", false
+	if entry.Location.Domestic == "未知" && entry.Location.Global == "未知" {
+		return IPLocation{}, false
 	}
-	return entry.Domestic, entry.Global, true
+	return entry.Location, true
 }
 
-func setCachedLocation(ip, domestic, global string) {
+func setCachedLocation(ip string, loc IPLocation) {
 	if ip == "" {
 		return
 	}
@@ -730,8 +663,7 @@ func setCachedLocation(ip, domestic, global string) {
 		ipGeoCache = make(map[string]ipLocationCacheEntry)
 	}
 	ipGeoCache[ip] = ipLocationCacheEntry{
-		Domestic: domestic,
-		Global:   global,
+		Location: loc,
 		Updated:  time.Now(),
 	}
 }
@@ -759,8 +691,8 @@ func DeleteIPGeoCacheEntries(ips []string) {
 	}
 }
 
-// 是否是内网 IP
-func isPrivateIP(ip net.IP) bool {
+// IsPrivateIP 是否是内网 IP
+func IsPrivateIP(ip net.IP) bool {
 	if ip == nil {
 		return false
 	}
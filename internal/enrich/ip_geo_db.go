@@ -0,0 +1,588 @@
+package enrich
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich/mmdb"
+	"github.com/lionsoul2014/ip2region/binding/golang/xdb"
+	"github.com/sirupsen/logrus"
+)
+
+// 离线库类型
+const (
+	IPGeoDBIP2RegionV4 = "ip2region_v4"
+	IPGeoDBIP2RegionV6 = "ip2region_v6"
+	IPGeoDBMMDB        = "mmdb"
+)
+
+// mmdb 库用途
+const (
+	IPGeoDBRoleGeo = "geo"
+	IPGeoDBRoleASN = "asn"
+)
+
+const (
+	// MaxIPGeoDBSize 单个离线库文件的大小上限
+	MaxIPGeoDBSize      = 1 << 30
+	ipGeoDBManifestFile = "ip_geo_db.json"
+	// 旧搜索器延迟关闭，等待进行中的查询结束
+	ipGeoDBCloseDelay = time.Minute
+)
+
+// IPGeoDBInfo 离线库的版本与安装信息
+type IPGeoDBInfo struct {
+	Kind        string    `json:"kind"`
+	Provider    string    `json:"provider,omitempty"`
+	Role        string    `json:"role,omitempty"`
+	Path        string    `json:"path"`
+	Version     string    `json:"version"`
+	BuildTime   time.Time `json:"build_time,omitempty"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256,omitempty"`
+	InstalledAt time.Time `json:"installed_at,omitempty"`
+}
+
+// IPGeoDBInstallOptions mmdb 库的目标查询源与用途，ip2region 库无需指定
+type IPGeoDBInstallOptions struct {
+	Provider string
+	Role     string
+}
+
+var (
+	ipGeoDBMu     sync.Mutex
+	ipGeoDBLoaded = make(map[string]IPGeoDBInfo)
+)
+
+func (info IPGeoDBInfo) key() string {
+	if info.Kind == IPGeoDBMMDB {
+		return fmt.Sprintf("%s:%s:%s", info.Kind, info.Provider, info.Role)
+	}
+	return info.Kind
+}
+
+func ipGeoDBManifestPath() string {
+	return filepath.Join(config.DataDir, ipGeoDBManifestFile)
+}
+
+// InstallIPGeoDBFromFile 从本地路径安装离线库，源文件保持不变
+func InstallIPGeoDBFromFile(path string, opts IPGeoDBInstallOptions) (IPGeoDBInfo, error) {
+	return installIPGeoDBFile(path, opts, false)
+}
+
+// InstallUploadedIPGeoDB 安装已写入临时文件的上传库，校验通过后把该文件移动到目标路径
+func InstallUploadedIPGeoDB(path string, opts IPGeoDBInstallOptions) (IPGeoDBInfo, error) {
+	return installIPGeoDBFile(path, opts, true)
+}
+
+// installIPGeoDBFile 直接在磁盘上校验离线库（自动识别 ip2region xdb 与 mmdb），原子替换目标路径并替换运行中的查询源，
+// 同时在 DataDir 的 ip_geo_db.json 中记录版本信息。除 mmdb 读取器本身外不把文件读入内存
+func installIPGeoDBFile(path string, opts IPGeoDBInstallOptions, move bool) (IPGeoDBInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return IPGeoDBInfo{}, fmt.Errorf("读取离线库文件失败: %v", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return IPGeoDBInfo{}, fmt.Errorf("读取离线库文件失败: %v", err)
+	}
+	if stat.Size() > MaxIPGeoDBSize {
+		file.Close()
+		return IPGeoDBInfo{}, fmt.Errorf("离线库文件过大: %d 字节", stat.Size())
+	}
+	isMMDB, err := fileTailContains(file, stat.Size(), 128*1024, []byte("MaxMind.com"))
+	if err != nil {
+		file.Close()
+		return IPGeoDBInfo{}, fmt.Errorf("读取离线库文件失败: %v", err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	file.Close()
+	if err != nil {
+		return IPGeoDBInfo{}, fmt.Errorf("读取离线库文件失败: %v", err)
+	}
+
+	var (
+		info IPGeoDBInfo
+		swap func() error
+	)
+	if isMMDB {
+		info, swap, err = prepareMMDBInstall(path, opts)
+	} else {
+		info, swap, err = prepareIP2RegionInstall(path, stat.Size())
+	}
+	if err != nil {
+		return IPGeoDBInfo{}, err
+	}
+	info.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	info.Size = stat.Size()
+	info.InstalledAt = time.Now()
+
+	if err := placeIPGeoDBFile(path, info.Path, move); err != nil {
+		return IPGeoDBInfo{}, fmt.Errorf("写入离线库失败: %v", err)
+	}
+	if err := swap(); err != nil {
+		return IPGeoDBInfo{}, err
+	}
+	if err := recordIPGeoDB(info); err != nil {
+		logrus.WithError(err).Warn("记录离线库版本信息失败")
+	}
+	ipGeoDBMu.Lock()
+	ipGeoDBLoaded[info.key()] = info
+	ipGeoDBMu.Unlock()
+	ResetIPGeoCache()
+	logrus.Infof("已安装 IP 离线库 %s（%s），版本 %s", info.Path, info.Kind, info.Version)
+	return info, nil
+}
+
+// fileTailContains 判断文件末尾 size 字节内是否包含 marker
+func fileTailContains(file io.ReaderAt, fileSize, size int64, marker []byte) (bool, error) {
+	if fileSize < size {
+		size = fileSize
+	}
+	tail := make([]byte, size)
+	if _, err := file.ReadAt(tail, fileSize-size); err != nil && err != io.EOF {
+		return false, err
+	}
+	return bytes.Contains(tail, marker), nil
+}
+
+// placeIPGeoDBFile 把 src 原子替换到 dst：move 时优先直接重命名（跨文件系统时退回复制），否则流式复制到同目录临时文件后重命名
+func placeIPGeoDBFile(src, dst string, move bool) error {
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if move {
+		if err := os.Chmod(src, 0644); err == nil && os.Rename(src, dst) == nil {
+			return nil
+		}
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+func prepareIP2RegionInstall(path string, size int64) (IPGeoDBInfo, func() error, error) {
+	if size < int64(xdb.HeaderInfoLength+xdb.VectorIndexRows*xdb.VectorIndexCols*xdb.VectorIndexSize) {
+		return IPGeoDBInfo{}, nil, fmt.Errorf("无法识别的离线库格式（需要 ip2region xdb 或 mmdb）")
+	}
+	header, err := xdb.LoadHeaderFromFile(path)
+	if err != nil {
+		return IPGeoDBInfo{}, nil, fmt.Errorf("读取 ip2region 数据库头失败: %v", err)
+	}
+	info, version, err := inspectIP2RegionHeader(header)
+	if err != nil {
+		return IPGeoDBInfo{}, nil, err
+	}
+	if err := xdb.VerifyFromFile(path); err != nil {
+		return IPGeoDBInfo{}, nil, fmt.Errorf("ip2region 数据库校验失败: %v", err)
+	}
+	if err := probeIP2Region(version, path); err != nil {
+		return IPGeoDBInfo{}, nil, fmt.Errorf("ip2region 数据库校验失败: %v", err)
+	}
+
+	info.Path = dbPathV4
+	if info.Kind == IPGeoDBIP2RegionV6 {
+		info.Path = dbPathV6
+	}
+	return info, func() error {
+		return swapIP2RegionSearcher(info.Kind, info.Path)
+	}, nil
+}
+
+// probeIP2Region 直接读取文件试查，确认索引可用；损坏的文件可能导致越界，需要 recover
+func probeIP2Region(version *xdb.Version, path string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("数据损坏: %v", r)
+		}
+	}()
+	searcher, err := xdb.NewWithFileOnly(version, path)
+	if err != nil {
+		return err
+	}
+	defer searcher.Close()
+	probeIP := "1.1.1.1"
+	if version == xdb.IPv6 {
+		probeIP = "240e::1"
+	}
+	_, err = searcher.SearchByStr(probeIP)
+	return err
+}
+
+// inspectIP2RegionHeader 读取 xdb 头部的 IP 版本与生成时间
+func inspectIP2RegionHeader(header *xdb.Header) (IPGeoDBInfo, *xdb.Version, error) {
+	version, err := xdb.VersionFromHeader(header)
+	if err != nil {
+		return IPGeoDBInfo{}, nil, fmt.Errorf("无法识别的离线库格式（需要 ip2region xdb 或 mmdb）: %v", err)
+	}
+	info := IPGeoDBInfo{
+		Kind:    IPGeoDBIP2RegionV4,
+		Version: fmt.Sprintf("xdb v%d", header.Version),
+	}
+	if version == xdb.IPv6 {
+		info.Kind = IPGeoDBIP2RegionV6
+	}
+	if header.CreatedAt > 0 {
+		info.BuildTime = time.Unix(int64(header.CreatedAt), 0)
+	}
+	return info, version, nil
+}
+
+// swapIP2RegionSearcher 从磁盘重新打开搜索器并替换，旧搜索器延迟关闭
+func swapIP2RegionSearcher(kind, path string) error {
+	label := "v4"
+	if kind == IPGeoDBIP2RegionV6 {
+		label = "v6"
+	}
+	searcher, vIndex, err := initIPSearcher(path, label)
+	if err != nil {
+		return err
+	}
+	ipSearcherMu.Lock()
+	var old *xdb.Searcher
+	if kind == IPGeoDBIP2RegionV6 {
+		old = ipSearcherV6
+		ipSearcherV6 = searcher
+		vectorIndexV6 = vIndex
+	} else {
+		old = ipSearcherV4
+		ipSearcherV4 = searcher
+		vectorIndexV4 = vIndex
+	}
+	ipSearcherMu.Unlock()
+	if old != nil {
+		time.AfterFunc(ipGeoDBCloseDelay, old.Close)
+	}
+	return nil
+}
+
+func prepareMMDBInstall(path string, opts IPGeoDBInstallOptions) (IPGeoDBInfo, func() error, error) {
+	// 读取器只加载这一份数据，校验通过后直接替换运行中的查询源
+	reader, err := mmdb.Open(path)
+	if err != nil {
+		return IPGeoDBInfo{}, nil, fmt.Errorf("mmdb 数据库无效: %v", err)
+	}
+	meta := reader.Metadata()
+	role := strings.TrimSpace(opts.Role)
+	if role == "" {
+		role = IPGeoDBRoleGeo
+		upper := strings.ToUpper(meta.DatabaseType)
+		if strings.Contains(upper, "ASN") || strings.Contains(upper, "ISP") {
+			role = IPGeoDBRoleASN
+		}
+	}
+	if role != IPGeoDBRoleGeo && role != IPGeoDBRoleASN {
+		return IPGeoDBInfo{}, nil, fmt.Errorf("mmdb 用途无效: %s（可选 geo / asn）", role)
+	}
+
+	name, path, err := resolveMMDBTarget(opts.Provider, role)
+	if err != nil {
+		return IPGeoDBInfo{}, nil, err
+	}
+	info := IPGeoDBInfo{
+		Kind:     IPGeoDBMMDB,
+		Provider: name,
+		Role:     role,
+		Path:     path,
+		Version:  meta.DatabaseType,
+	}
+	if meta.BuildEpoch > 0 {
+		info.BuildTime = time.Unix(int64(meta.BuildEpoch), 0)
+	}
+	return info, func() error {
+		swapMMDBReader(name, role, reader)
+		return nil
+	}, nil
+}
+
+// resolveMMDBTarget 按配置找到目标 mmdb 查询源及对应的库路径；未指定名称时要求查询链中只有一个 mmdb 查询源
+func resolveMMDBTarget(provider, role string) (string, string, error) {
+	provider = strings.TrimSpace(provider)
+	var matched []config.IPGeoProviderConfig
+	for _, cfg := range resolveIPGeoProviderConfigs(config.ReadConfig()) {
+		if strings.TrimSpace(cfg.Type) != config.IPGeoProviderMMDB {
+			continue
+		}
+		name := strings.TrimSpace(cfg.Name)
+		if name == "" {
+			name = config.IPGeoProviderMMDB
+		}
+		if provider != "" && name != provider {
+			continue
+		}
+		cfg.Name = name
+		matched = append(matched, cfg)
+	}
+	switch {
+	case len(matched) == 0 && provider != "":
+		return "", "", fmt.Errorf("查询链中不存在 mmdb 查询源: %s", provider)
+	case len(matched) == 0:
+		return "", "", fmt.Errorf("查询链中没有 mmdb 查询源，请先在 system.ipGeoProviders 中配置")
+	case len(matched) > 1:
+		return "", "", fmt.Errorf("查询链中有多个 mmdb 查询源，请指定 provider")
+	}
+	path := strings.TrimSpace(matched[0].Path)
+	if role == IPGeoDBRoleASN {
+		path = strings.TrimSpace(matched[0].ASNPath)
+	}
+	if path == "" {
+		field := "path"
+		if role == IPGeoDBRoleASN {
+			field = "asnPath"
+		}
+		return "", "", fmt.Errorf("mmdb 查询源 %s 未配置 %s", matched[0].Name, field)
+	}
+	return matched[0].Name, path, nil
+}
+
+func swapMMDBReader(name, role string, reader *mmdb.Reader) {
+	for _, provider := range GetIPGeoProviders() {
+		if target, ok := provider.(*mmdbProvider); ok && target.Name() == name {
+			target.swapReader(role, reader)
+		}
+	}
+}
+
+// ListIPGeoDBs 返回当前加载的离线库信息
+func ListIPGeoDBs() []IPGeoDBInfo {
+	ipGeoDBMu.Lock()
+	defer ipGeoDBMu.Unlock()
+	items := make([]IPGeoDBInfo, 0, len(ipGeoDBLoaded))
+	for _, info := range ipGeoDBLoaded {
+		items = append(items, info)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].key() < items[j].key()
+	})
+	return items
+}
+
+// loadIPGeoDBState 启动时记录已加载离线库的版本：优先读取安装记录，其次读取文件头
+func loadIPGeoDBState(providerCfgs []config.IPGeoProviderConfig) {
+	manifest := readIPGeoDBManifest()
+	state := make(map[string]IPGeoDBInfo)
+	add := func(info IPGeoDBInfo) {
+		if recorded, ok := manifest[info.key()]; ok && recorded.Path == info.Path {
+			info = recorded
+		}
+		state[info.key()] = info
+	}
+
+	ipSearcherMu.RLock()
+	ip2regionReady := ipSearcherV4 != nil && ipSearcherV6 != nil
+	ipSearcherMu.RUnlock()
+	if ip2regionReady {
+		for _, path := range []string{dbPathV4, dbPathV6} {
+			if info, ok := describeIP2RegionFile(path); ok {
+				add(info)
+			}
+		}
+	}
+	for _, cfg := range providerCfgs {
+		if strings.TrimSpace(cfg.Type) != config.IPGeoProviderMMDB {
+			continue
+		}
+		name := strings.TrimSpace(cfg.Name)
+		if name == "" {
+			name = config.IPGeoProviderMMDB
+		}
+		for role, path := range map[string]string{IPGeoDBRoleGeo: cfg.Path, IPGeoDBRoleASN: cfg.ASNPath} {
+			if path = strings.TrimSpace(path); path == "" {
+				continue
+			}
+			if info, ok := describeMMDBFile(name, role, path); ok {
+				add(info)
+			}
+		}
+	}
+
+	ipGeoDBMu.Lock()
+	ipGeoDBLoaded = state
+	ipGeoDBMu.Unlock()
+}
+
+func describeIP2RegionFile(path string) (IPGeoDBInfo, bool) {
+	header, err := xdb.LoadHeaderFromFile(path)
+	if err != nil {
+		return IPGeoDBInfo{}, false
+	}
+	info, _, err := inspectIP2RegionHeader(header)
+	if err != nil {
+		return IPGeoDBInfo{}, false
+	}
+	info.Path = path
+	if stat, err := os.Stat(path); err == nil {
+		info.Size = stat.Size()
+	}
+	return info, true
+}
+
+func describeMMDBFile(name, role, path string) (IPGeoDBInfo, bool) {
+	reader, err := mmdb.Open(path)
+	if err != nil {
+		return IPGeoDBInfo{}, false
+	}
+	meta := reader.Metadata()
+	info := IPGeoDBInfo{
+		Kind:     IPGeoDBMMDB,
+		Provider: name,
+		Role:     role,
+		Path:     path,
+		Version:  meta.DatabaseType,
+	}
+	if meta.BuildEpoch > 0 {
+		info.BuildTime = time.Unix(int64(meta.BuildEpoch), 0)
+	}
+	if stat, err := os.Stat(path); err == nil {
+		info.Size = stat.Size()
+	}
+	return info, true
+}
+
+// ReloadIPGeoDBsIfChanged 加载其他进程（如命令行）安装的离线库，返回重新加载的数量
+func ReloadIPGeoDBsIfChanged() int {
+	manifest := readIPGeoDBManifest()
+	reloaded := 0
+	for key, recorded := range manifest {
+		ipGeoDBMu.Lock()
+		current, ok := ipGeoDBLoaded[key]
+		ipGeoDBMu.Unlock()
+		if ok && !recorded.InstalledAt.After(current.InstalledAt) {
+			continue
+		}
+		if !ok && recorded.Kind != IPGeoDBMMDB {
+			// ip2region 未启用时无需加载
+			ipSearcherMu.RLock()
+			ready := ipSearcherV4 != nil && ipSearcherV6 != nil
+			ipSearcherMu.RUnlock()
+			if !ready {
+				continue
+			}
+		}
+		var err error
+		switch recorded.Kind {
+		case IPGeoDBIP2RegionV4, IPGeoDBIP2RegionV6:
+			err = swapIP2RegionSearcher(recorded.Kind, recorded.Path)
+		case IPGeoDBMMDB:
+			var reader *mmdb.Reader
+			if reader, err = mmdb.Open(recorded.Path); err == nil {
+				swapMMDBReader(recorded.Provider, recorded.Role, reader)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			logrus.WithError(err).Warnf("加载离线库 %s 失败", recorded.Path)
+			continue
+		}
+		ipGeoDBMu.Lock()
+		ipGeoDBLoaded[key] = recorded
+		ipGeoDBMu.Unlock()
+		reloaded++
+		logrus.Infof("已加载更新的 IP 离线库 %s（%s），版本 %s", recorded.Path, recorded.Kind, recorded.Version)
+	}
+	if reloaded > 0 {
+		ResetIPGeoCache()
+	}
+	return reloaded
+}
+
+func readIPGeoDBManifest() map[string]IPGeoDBInfo {
+	manifest := make(map[string]IPGeoDBInfo)
+	data, err := os.ReadFile(ipGeoDBManifestPath())
+	if err != nil {
+		return manifest
+	}
+	var items []IPGeoDBInfo
+	if err := json.Unmarshal(data, &items); err != nil {
+		logrus.WithError(err).Warn("解析离线库安装记录失败")
+		return manifest
+	}
+	for _, item := range items {
+		manifest[item.key()] = item
+	}
+	return manifest
+}
+
+func recordIPGeoDB(info IPGeoDBInfo) error {
+	manifest := readIPGeoDBManifest()
+	manifest[info.key()] = info
+	items := make([]IPGeoDBInfo, 0, len(manifest))
+	for _, item := range manifest {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].key() < items[j].key()
+	})
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(ipGeoDBManifestPath(), data)
+}
+
+// WriteFileAtomic 先写入同目录临时文件再重命名，避免读到写了一半的文件
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,163 @@
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+// 单个响应最多读取 1MB
+const maxHTTPGeoResponseBytes = 1 << 20
+
+// httpGeoProvider 通用 HTTP JSON 查询源，每个 IP 请求一次，按 fieldMap 提取字段
+type httpGeoProvider struct {
+	ipGeoProviderBase
+	url          string
+	method       string
+	headers      map[string]string
+	fieldMap     map[string]string
+	successValue string
+	client       *http.Client
+}
+
+func newHTTPGeoProvider(base ipGeoProviderBase, cfg config.IPGeoProviderConfig) (IPGeoProvider, error) {
+	rawURL := strings.TrimSpace(cfg.URL)
+	if !strings.Contains(rawURL, "{ip}") {
+		return nil, fmt.Errorf("http 查询源 %s 的 url 需要包含 {ip}", base.name)
+	}
+	method := strings.ToUpper(strings.TrimSpace(cfg.Method))
+	if method == "" {
+		method = http.MethodGet
+	}
+	return &httpGeoProvider{
+		ipGeoProviderBase: base,
+		url:               rawURL,
+		method:            method,
+		headers:           cfg.Headers,
+		fieldMap:          cfg.FieldMap,
+		successValue:      strings.TrimSpace(cfg.SuccessValue),
+		client:            &http.Client{Timeout: base.timeout},
+	}, nil
+}
+
+func (p *httpGeoProvider) Remote() bool {
+	return true
+}
+
+func (p *httpGeoProvider) Lookup(ips []string) (map[string]IPGeoRecord, map[string]string, error) {
+	results := make(map[string]IPGeoRecord, len(ips))
+	failures := make(map[string]string)
+	var lastErr error
+	language := resolveIPAPILanguage()
+
+	for _, ip := range ips {
+		if !p.limiter.wait(ipGeoRateLimitMaxWait) {
+			failures[ip] = IPGeoReasonRateLimited
+			continue
+		}
+		payload, reason, err := p.fetch(ip, language)
+		if err != nil {
+			lastErr = err
+			failures[ip] = reason
+			continue
+		}
+		if status := strings.TrimSpace(p.fieldMap["status"]); status != "" && p.successValue != "" {
+			if jsonPathString(payload, status) != p.successValue {
+				failures[ip] = "api_fail"
+				continue
+			}
+		}
+		record := IPGeoRecord{
+			Country:     jsonPathString(payload, p.fieldMap["country"]),
+			CountryCode: jsonPathString(payload, p.fieldMap["countryCode"]),
+			Region:      jsonPathString(payload, p.fieldMap["region"]),
+			RegionCode:  jsonPathString(payload, p.fieldMap["regionCode"]),
+			City:        jsonPathString(payload, p.fieldMap["city"]),
+			ISP:         jsonPathString(payload, p.fieldMap["isp"]),
+			Latitude:    jsonPathFloat(payload, p.fieldMap["latitude"]),
+			Longitude:   jsonPathFloat(payload, p.fieldMap["longitude"]),
+		}
+		if record.usable() {
+			results[ip] = record
+		}
+	}
+	return results, failures, lastErr
+}
+
+func (p *httpGeoProvider) fetch(ip, language string) (interface{}, string, error) {
+	target := strings.NewReplacer(
+		"{ip}", url.PathEscape(ip),
+		"{lang}", url.QueryEscape(language),
+	).Replace(p.url)
+	req, err := http.NewRequest(p.method, target, nil)
+	if err != nil {
+		return nil, "request_error", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "nginxpulse/1.0")
+	for key, value := range p.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, "request_error", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "http_status", fmt.Errorf("%s 响应异常: %s", p.name, resp.Status)
+	}
+	var payload interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxHTTPGeoResponseBytes)).Decode(&payload); err != nil {
+		return nil, "decode_error", err
+	}
+	return payload, "", nil
+}
+
+// jsonPathString 按点分路径读取 JSON 字段（数字段表示数组下标），非字符串值转为文本
+func jsonPathString(payload interface{}, path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	current := payload
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			current = node[segment]
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return ""
+			}
+			current = node[idx]
+		default:
+			return ""
+		}
+	}
+	switch value := current.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return ""
+	}
+}
+
+// jsonPathFloat 按点分路径读取数值字段（兼容字符串形式的数字），缺失或无效时为 0
+func jsonPathFloat(payload interface{}, path string) float64 {
+	value, err := strconv.ParseFloat(jsonPathString(payload, path), 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,157 @@
+package enrich
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich/mmdb"
+	"github.com/sirupsen/logrus"
+)
+
+// mmdbProvider 本地 MaxMind / DB-IP 离线库，城市 / 国家库与 ASN 库可单独或同时配置；
+// 读取器可在运行中整体替换（见 InstallIPGeoDBFromFile）
+type mmdbProvider struct {
+	ipGeoProviderBase
+	geo atomic.Pointer[mmdb.Reader]
+	asn atomic.Pointer[mmdb.Reader]
+}
+
+func newMMDBProvider(base ipGeoProviderBase, cfg config.IPGeoProviderConfig) (IPGeoProvider, error) {
+	provider := &mmdbProvider{ipGeoProviderBase: base}
+	if path := strings.TrimSpace(cfg.Path); path != "" {
+		reader, err := openMMDB(path)
+		if err != nil {
+			return nil, err
+		}
+		provider.geo.Store(reader)
+	}
+	if path := strings.TrimSpace(cfg.ASNPath); path != "" {
+		reader, err := openMMDB(path)
+		if err != nil {
+			return nil, err
+		}
+		provider.asn.Store(reader)
+	}
+	if provider.geo.Load() == nil && provider.asn.Load() == nil {
+		return nil, fmt.Errorf("mmdb 查询源 %s 未配置数据库文件", base.name)
+	}
+	return provider, nil
+}
+
+func openMMDB(path string) (*mmdb.Reader, error) {
+	reader, err := mmdb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("加载 mmdb 数据库 %s 失败: %v", path, err)
+	}
+	meta := reader.Metadata()
+	logrus.Infof("已加载 mmdb 数据库 %s（%s）", path, meta.DatabaseType)
+	return reader, nil
+}
+
+func (p *mmdbProvider) Remote() bool {
+	return false
+}
+
+func (p *mmdbProvider) Lookup(ips []string) (map[string]IPGeoRecord, map[string]string, error) {
+	language := resolveMMDBLanguage()
+	return p.lookupEach(ips, func(ip string) (IPGeoRecord, bool, error) {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return IPGeoRecord{}, false, fmt.Errorf("无效的 IP 地址")
+		}
+		var record IPGeoRecord
+		if geo := p.geo.Load(); geo != nil {
+			data, err := geo.Lookup(parsed)
+			if err != nil {
+				return IPGeoRecord{}, false, err
+			}
+			if data != nil {
+				fillMMDBLocation(&record, data, language)
+			}
+		}
+		if asn := p.asn.Load(); asn != nil {
+			data, err := asn.Lookup(parsed)
+			if err != nil {
+				return IPGeoRecord{}, false, err
+			}
+			if data != nil {
+				fillMMDBNetwork(&record, data)
+			}
+		}
+		return record, record.usable(), nil
+	})
+}
+
+// lookupASN 供网络分类复用已配置的 ASN 库
+func (p *mmdbProvider) lookupASN(ip net.IP) (int64, string, bool) {
+	asn := p.asn.Load()
+	if asn == nil {
+		return 0, "", false
+	}
+	return readMMDBASN(asn, ip)
+}
+
+// swapReader 替换城市 / 国家库（geo）或 ASN 库（asn）
+func (p *mmdbProvider) swapReader(role string, reader *mmdb.Reader) {
+	if role == IPGeoDBRoleASN {
+		p.asn.Store(reader)
+		return
+	}
+	p.geo.Store(reader)
+}
+
+// fillMMDBLocation 读取 GeoLite2 / GeoIP2 / DB-IP 城市与国家库的通用结构
+func fillMMDBLocation(record *IPGeoRecord, data map[string]interface{}, language string) {
+	countryKey := "country"
+	if mmdb.Get(data, countryKey) == nil {
+		countryKey = "registered_country"
+	}
+	record.CountryCode = mmdb.GetString(data, countryKey, "iso_code")
+	record.Country = mmdbName(data, language, countryKey)
+	record.Region = mmdbName(data, language, "subdivisions", 0)
+	record.RegionCode = mmdb.GetString(data, "subdivisions", 0, "iso_code")
+	record.City = mmdbName(data, language, "city")
+	record.Latitude, _ = mmdb.GetFloat(data, "location", "latitude")
+	record.Longitude, _ = mmdb.GetFloat(data, "location", "longitude")
+	// GeoIP2 ISP / Enterprise 库直接包含运营商
+	if isp := mmdb.GetString(data, "isp"); isp != "" {
+		record.ISP = isp
+	}
+}
+
+// fillMMDBNetwork 读取 ASN / ISP 库
+func fillMMDBNetwork(record *IPGeoRecord, data map[string]interface{}) {
+	if isp := mmdb.GetString(data, "isp"); isp != "" {
+		record.ISP = isp
+		return
+	}
+	if org := mmdb.GetString(data, "autonomous_system_organization"); org != "" {
+		record.ISP = org
+	}
+}
+
+// mmdbName 读取 names 多语言字段，缺少当前语言时回退到英文
+func mmdbName(data map[string]interface{}, language string, path ...interface{}) string {
+	names, ok := mmdb.Get(data, append(path, "names")...).(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for _, lang := range []string{language, "en"} {
+		if name, ok := names[lang].(string); ok && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+func resolveMMDBLanguage() string {
+	switch config.GetLanguage() {
+	case config.EnglishLanguage:
+		return "en"
+	default:
+		return "zh-CN"
+	}
+}
@@ -0,0 +1,352 @@
+package enrich
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultLocalGeoTimeout  = 50 * time.Millisecond
+	defaultRemoteGeoTimeout = 1200 * time.Millisecond
+	// 限速时单次请求最多等待的时间，超过后本轮跳过，留待下次解析
+	ipGeoRateLimitMaxWait = 2 * time.Second
+)
+
+// IPGeoReasonRateLimited 因限速未查询的 IP，不计入失败记录（不进入冷却）
+const IPGeoReasonRateLimited = "rate_limited"
+
+// IPGeoRecord 查询源返回的归属地信息
+type IPGeoRecord struct {
+	Country     string
+	CountryCode string
+	Region      string
+	// RegionCode 地区代码，可为 ISO 3166-2 完整代码（US-CA）或不带国家前缀的部分（CA）
+	RegionCode string
+	City       string
+	ISP        string
+	Latitude   float64
+	Longitude  float64
+}
+
+// IPGeoFailure 查询失败的查询源与原因
+type IPGeoFailure struct {
+	Provider string
+	Reason   string
+}
+
+// IPGeoProvider IP 归属地查询源
+type IPGeoProvider interface {
+	// Name 查询源名称，写入缓存来源与失败记录
+	Name() string
+	// Remote 是否访问外部服务，白名单匹配等场景只使用本地查询源
+	Remote() bool
+	// Lookup 批量查询，failures 为查询失败的 IP 及原因；库中未收录的 IP 不出现在任何结果中
+	Lookup(ips []string) (map[string]IPGeoRecord, map[string]string, error)
+}
+
+var (
+	ipGeoProvidersMu sync.RWMutex
+	ipGeoProviders   []IPGeoProvider
+)
+
+// SetIPGeoProviders 替换当前的查询链
+func SetIPGeoProviders(providers []IPGeoProvider) {
+	ipGeoProvidersMu.Lock()
+	ipGeoProviders = append([]IPGeoProvider(nil), providers...)
+	ipGeoProvidersMu.Unlock()
+}
+
+// GetIPGeoProviders 返回当前查询链
+func GetIPGeoProviders() []IPGeoProvider {
+	ipGeoProvidersMu.RLock()
+	defer ipGeoProvidersMu.RUnlock()
+	return append([]IPGeoProvider(nil), ipGeoProviders...)
+}
+
+// resolveIPGeoProviderConfigs 返回配置的查询链，未配置时为 ip2region + ip-api
+func resolveIPGeoProviderConfigs(cfg *config.Config) []config.IPGeoProviderConfig {
+	if cfg != nil && len(cfg.System.IPGeoProviders) > 0 {
+		return cfg.System.IPGeoProviders
+	}
+	return []config.IPGeoProviderConfig{
+		{Type: config.IPGeoProviderIP2Region},
+		{Type: config.IPGeoProviderIPAPI},
+	}
+}
+
+// BuildIPGeoProviders 按配置创建查询链
+func BuildIPGeoProviders(cfgs []config.IPGeoProviderConfig) ([]IPGeoProvider, error) {
+	providers := make([]IPGeoProvider, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		provider, err := newIPGeoProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+func newIPGeoProvider(cfg config.IPGeoProviderConfig) (IPGeoProvider, error) {
+	providerType := strings.TrimSpace(cfg.Type)
+	name := strings.TrimSpace(cfg.Name)
+	if name == "" {
+		name = providerType
+	}
+	base := ipGeoProviderBase{
+		name:    name,
+		limiter: newIPGeoRateLimiter(cfg.RateLimit, cfg.Burst),
+	}
+	defaultTimeout := defaultRemoteGeoTimeout
+	if providerType == config.IPGeoProviderIP2Region || providerType == config.IPGeoProviderMMDB {
+		defaultTimeout = defaultLocalGeoTimeout
+	}
+	base.timeout = defaultTimeout
+	if raw := strings.TrimSpace(cfg.Timeout); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("IP 归属地查询源 %s 的 timeout 无效: %s", name, raw)
+		}
+		base.timeout = timeout
+	}
+
+	switch providerType {
+	case config.IPGeoProviderIP2Region:
+		return newIP2RegionProvider(base)
+	case config.IPGeoProviderMMDB:
+		return newMMDBProvider(base, cfg)
+	case config.IPGeoProviderIPAPI:
+		return newIPAPIProvider(base, cfg), nil
+	case config.IPGeoProviderHTTP:
+		return newHTTPGeoProvider(base, cfg)
+	default:
+		return nil, fmt.Errorf("不支持的 IP 归属地查询源: %s", cfg.Type)
+	}
+}
+
+// ipGeoProviderBase 查询源通用的名称、超时与限速
+type ipGeoProviderBase struct {
+	name    string
+	timeout time.Duration
+	limiter *ipGeoRateLimiter
+}
+
+func (b ipGeoProviderBase) Name() string {
+	return b.name
+}
+
+// lookupEach 逐个查询本地库，每个 IP 受超时与限速约束
+func (b ipGeoProviderBase) lookupEach(
+	ips []string,
+	lookup func(ip string) (IPGeoRecord, bool, error),
+) (map[string]IPGeoRecord, map[string]string, error) {
+	results := make(map[string]IPGeoRecord, len(ips))
+	failures := make(map[string]string)
+	for _, ip := range ips {
+		if !b.limiter.wait(ipGeoRateLimitMaxWait) {
+			failures[ip] = IPGeoReasonRateLimited
+			continue
+		}
+		record, found, err := lookupWithTimeout(b.timeout, func() (IPGeoRecord, bool, error) {
+			return lookup(ip)
+		})
+		if err != nil {
+			failures[ip] = "lookup_error"
+			continue
+		}
+		if found {
+			results[ip] = record
+		}
+	}
+	return results, failures, nil
+}
+
+func lookupWithTimeout(
+	timeout time.Duration,
+	lookup func() (IPGeoRecord, bool, error),
+) (IPGeoRecord, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type lookupResult struct {
+		record IPGeoRecord
+		found  bool
+		err    error
+	}
+	resultCh := make(chan lookupResult, 1)
+	go func() {
+		record, found, err := lookup()
+		resultCh <- lookupResult{record, found, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return IPGeoRecord{}, false, fmt.Errorf("IP 查询超时")
+	case result := <-resultCh:
+		return result.record, result.found, result.err
+	}
+}
+
+// ipGeoRateLimiter 令牌桶限速，rate 为每秒请求数
+type ipGeoRateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newIPGeoRateLimiter(rate float64, burst int) *ipGeoRateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &ipGeoRateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait 等待可用令牌，需要等待超过 maxWait 时放弃并返回 false
+func (l *ipGeoRateLimiter) wait(maxWait time.Duration) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return true
+	}
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	if delay > maxWait {
+		l.mu.Unlock()
+		return false
+	}
+	// 预占令牌（允许为负），后续请求顺延等待
+	l.tokens--
+	l.mu.Unlock()
+	time.Sleep(delay)
+	return true
+}
+
+func (r IPGeoRecord) usable() bool {
+	return normalizeLocationPart(r.Country) != "" || strings.TrimSpace(r.CountryCode) != ""
+}
+
+func (r IPGeoRecord) hasCity() bool {
+	city := removeSuffixes(normalizeLocationPart(r.City))
+	return city != "" && !isISPLabel(city)
+}
+
+func (r IPGeoRecord) location(source string) IPLocation {
+	country := r.Country
+	if normalizeLocationPart(country) == "" {
+		country = strings.ToUpper(strings.TrimSpace(r.CountryCode))
+	}
+	city := r.City
+	if isISPLabel(city) {
+		city = ""
+	}
+	domestic := formatDomesticLocation(country, r.CountryCode, r.Region, city)
+	global := formatGlobalLocation(country)
+	if domestic == "" {
+		domestic = "未知"
+	}
+	countryCode := r.CountryCode
+	if strings.TrimSpace(countryCode) == "" {
+		countryCode = CountryCodeFromName(country)
+	}
+	countryCode, regionCode := normalizeLocationCodes(countryCode, r.RegionCode, r.Region)
+	return IPLocation{
+		Domestic:    domestic,
+		Global:      global,
+		Source:      source,
+		CountryCode: countryCode,
+		RegionCode:  regionCode,
+		City:        normalizeLocationPart(city),
+		Latitude:    r.Latitude,
+		Longitude:   r.Longitude,
+	}
+}
+
+// resolveIPGeoChain 依次询问查询源：结果精确到城市即停止，仅到国家/省份的结果作为兜底并继续询问后续查询源。
+// 返回值中既未解析也未失败的 IP 表示所有查询源均未收录。
+func resolveIPGeoChain(providers []IPGeoProvider, ips []string) (map[string]IPLocation, map[string]IPGeoFailure, error) {
+	resolved := make(map[string]IPLocation, len(ips))
+	fallbacks := make(map[string]IPLocation)
+	failures := make(map[string]IPGeoFailure)
+	var lastErr error
+
+	pending := ips
+	for _, provider := range providers {
+		if len(pending) == 0 {
+			break
+		}
+		records, failed, err := provider.Lookup(pending)
+		if err != nil {
+			lastErr = err
+			logrus.WithError(err).Debugf("IP 归属地查询源 %s 查询失败", provider.Name())
+		}
+		next := make([]string, 0, len(pending))
+		for _, ip := range pending {
+			if record, ok := records[ip]; ok && record.usable() {
+				loc := record.location(provider.Name())
+				if record.hasCity() {
+					resolved[ip] = loc
+					delete(failures, ip)
+					continue
+				}
+				if _, exists := fallbacks[ip]; !exists {
+					fallbacks[ip] = loc
+				}
+			} else if provider.Remote() {
+				if reason, ok := failed[ip]; ok {
+					failures[ip] = IPGeoFailure{Provider: provider.Name(), Reason: reason}
+				} else if err != nil {
+					failures[ip] = IPGeoFailure{Provider: provider.Name(), Reason: "request_error"}
+				}
+			}
+			next = append(next, ip)
+		}
+		pending = next
+	}
+
+	for _, ip := range pending {
+		if fallback, ok := fallbacks[ip]; ok {
+			resolved[ip] = fallback
+			delete(failures, ip)
+		}
+	}
+	if len(failures) == 0 {
+		lastErr = nil
+	}
+	return resolved, failures, lastErr
+}
+
+// lookupIPGeoLocal 仅使用本地查询源查询单个 IP
+func lookupIPGeoLocal(ip string) (IPLocation, bool) {
+	local := make([]IPGeoProvider, 0)
+	for _, provider := range GetIPGeoProviders() {
+		if !provider.Remote() {
+			local = append(local, provider)
+		}
+	}
+	resolved, _, _ := resolveIPGeoChain(local, []string{ip})
+	loc, ok := resolved[ip]
+	return loc, ok
+}
@@ -0,0 +1,344 @@
+package enrich
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich/mmdb"
+	"github.com/sirupsen/logrus"
+)
+
+// 网络类型
+const (
+	NetworkHosting     = "hosting"
+	NetworkResidential = "residential"
+	NetworkUnknown     = "unknown"
+)
+
+const maxIPNetworkCacheSize = 50000
+
+// IPNetwork IP 所属网络（ASN、组织与类型）
+type IPNetwork struct {
+	ASN  int64
+	Org  string
+	Type string
+}
+
+// ipNetworkLabel CIDR 列表文件对应的组织与类型
+type ipNetworkLabel struct {
+	Org  string
+	Type string
+}
+
+// ipNetworkSource 可提供 ASN 信息的查询源
+type ipNetworkSource interface {
+	lookupASN(ip net.IP) (int64, string, bool)
+}
+
+// ipNetworkDB 已加载的 ASN 库与 CIDR 列表
+type ipNetworkDB struct {
+	asnReaders []*mmdb.Reader
+	prefixes   *PrefixTable[ipNetworkLabel]
+}
+
+var (
+	ipNetworkMu      sync.RWMutex
+	ipNetworkData    = &ipNetworkDB{prefixes: NewPrefixTable[ipNetworkLabel]()}
+	ipNetworkCache   = make(map[string]*IPNetwork)
+	ipNetworkCacheMu sync.RWMutex
+)
+
+// 常见云厂商 / IDC 的 ASN
+var hostingASNs = map[int64]struct{}{
+	16509:  {}, // Amazon
+	14618:  {}, // Amazon
+	15169:  {}, // Google
+	396982: {}, // Google Cloud
+	8075:   {}, // Microsoft
+	45102:  {}, // Alibaba
+	37963:  {}, // Alibaba
+	45090:  {}, // Tencent
+	132203: {}, // Tencent
+	136907: {}, // Huawei Cloud
+	55990:  {}, // Huawei Cloud
+	14061:  {}, // DigitalOcean
+	63949:  {}, // Linode
+	16276:  {}, // OVH
+	24940:  {}, // Hetzner
+	20473:  {}, // Vultr
+	31898:  {}, // Oracle
+	13335:  {}, // Cloudflare
+	51167:  {}, // Contabo
+	12876:  {}, // Scaleway
+	60781:  {}, // Leaseweb
+}
+
+var hostingOrgKeywords = []string{
+	"hosting", "cloud", "data center", "datacenter", "server", "vps", "colo",
+	"阿里云", "腾讯云", "华为云", "数据中心", "idc", "机房",
+}
+
+// IPNetworkDir 用户自定义网络数据目录
+func IPNetworkDir() string {
+	return filepath.Join(config.DataDir, "networks")
+}
+
+// InitIPNetworks 加载 DataDir/networks 下的 ASN 库（*.mmdb）与 CIDR 列表（*.txt / *.cidr / *.list）
+func InitIPNetworks() error {
+	db := &ipNetworkDB{prefixes: NewPrefixTable[ipNetworkLabel]()}
+	dir := IPNetworkDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	cidrCount := 0
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".mmdb":
+			reader, err := openMMDB(path)
+			if err != nil {
+				logrus.WithError(err).Warn("跳过无效的 ASN 数据库")
+				continue
+			}
+			db.asnReaders = append(db.asnReaders, reader)
+		case ".txt", ".cidr", ".list":
+			count, err := loadNetworkCIDRFile(db.prefixes, path)
+			if err != nil {
+				logrus.WithError(err).Warnf("读取 CIDR 列表 %s 失败", path)
+				continue
+			}
+			cidrCount += count
+		}
+	}
+
+	ipNetworkMu.Lock()
+	ipNetworkData = db
+	ipNetworkMu.Unlock()
+	ResetIPNetworkCache()
+	if len(db.asnReaders) > 0 || cidrCount > 0 {
+		logrus.Infof("已加载网络分类数据: %d 个 ASN 库, %d 条 CIDR", len(db.asnReaders), cidrCount)
+	}
+	return nil
+}
+
+// loadNetworkCIDRFile 每行一个 CIDR 或 IP，# 开头为注释；
+// 文件名为组织名称，类型默认为 hosting，可用 "# org: xxx" / "# type: residential" 覆盖
+func loadNetworkCIDRFile(table *PrefixTable[ipNetworkLabel], path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	label := ipNetworkLabel{
+		Org:  strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Type: NetworkHosting,
+	}
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			key, value, ok := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "#")), ":")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "org":
+				if value != "" {
+					label.Org = value
+				}
+			case "type":
+				label.Type = normalizeNetworkType(value)
+			}
+			continue
+		}
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = strings.TrimSpace(line[:idx])
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == ' ' || r == '\t'
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		prefix, ok := ParsePrefix(fields[0])
+		if !ok {
+			continue
+		}
+		table.Insert(prefix, label)
+		count++
+	}
+	return count, scanner.Err()
+}
+
+func normalizeNetworkType(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case NetworkResidential, "isp", "mobile":
+		return NetworkResidential
+	case NetworkUnknown:
+		return NetworkUnknown
+	default:
+		return NetworkHosting
+	}
+}
+
+// ResetIPNetworkCache 清空网络分类缓存
+func ResetIPNetworkCache() {
+	ipNetworkCacheMu.Lock()
+	ipNetworkCache = make(map[string]*IPNetwork)
+	ipNetworkCacheMu.Unlock()
+}
+
+// LookupIPNetwork 查询 IP 所属网络：CIDR 列表优先，其次 ASN 库，最后使用 ip2region 的运营商字段；
+// 内网或无效 IP 返回 nil
+func LookupIPNetwork(ip string) *IPNetwork {
+	ip = strings.TrimSpace(ip)
+	parsed := net.ParseIP(ip)
+	if parsed == nil || IsPrivateIP(parsed) {
+		return nil
+	}
+
+	ipNetworkCacheMu.RLock()
+	cached, ok := ipNetworkCache[ip]
+	ipNetworkCacheMu.RUnlock()
+	if ok {
+		return cached
+	}
+
+	result := classifyIPNetwork(parsed)
+	ipNetworkCacheMu.Lock()
+	if len(ipNetworkCache) >= maxIPNetworkCacheSize {
+		ipNetworkCache = make(map[string]*IPNetwork)
+	}
+	ipNetworkCache[ip] = result
+	ipNetworkCacheMu.Unlock()
+	return result
+}
+
+func classifyIPNetwork(ip net.IP) *IPNetwork {
+	ipNetworkMu.RLock()
+	db := ipNetworkData
+	ipNetworkMu.RUnlock()
+
+	result := &IPNetwork{Type: NetworkUnknown}
+	if label, ok := db.prefixes.Lookup(ip); ok {
+		result.Org = label.Org
+		result.Type = label.Type
+	}
+
+	asn, org, found := lookupASNReaders(db.asnReaders, ip)
+	if !found {
+		for _, provider := range GetIPGeoProviders() {
+			if source, ok := provider.(ipNetworkSource); ok {
+				if asn, org, found = source.lookupASN(ip); found {
+					break
+				}
+			}
+		}
+	}
+	if found {
+		result.ASN = asn
+		if result.Org == "" {
+			result.Org = org
+		}
+		if result.Type == NetworkUnknown {
+			result.Type = classifyASN(asn, org)
+		}
+	}
+
+	if result.Org == "" {
+		if isp := lookupIP2RegionISP(ip); isp != "" {
+			result.Org = isp
+			if result.Type == NetworkUnknown {
+				if isHostingOrg(isp) {
+					result.Type = NetworkHosting
+				} else if isISPLabel(isp) {
+					result.Type = NetworkResidential
+				}
+			}
+		}
+	}
+	return result
+}
+
+func lookupASNReaders(readers []*mmdb.Reader, ip net.IP) (int64, string, bool) {
+	for _, reader := range readers {
+		if asn, org, ok := readMMDBASN(reader, ip); ok {
+			return asn, org, true
+		}
+	}
+	return 0, "", false
+}
+
+// readMMDBASN 读取 GeoLite2-ASN / DB-IP ASN 库的通用字段
+func readMMDBASN(reader *mmdb.Reader, ip net.IP) (int64, string, bool) {
+	data, err := reader.Lookup(ip)
+	if err != nil || data == nil {
+		return 0, "", false
+	}
+	asn := mmdb.GetUint(data, "autonomous_system_number")
+	if asn == 0 {
+		return 0, "", false
+	}
+	org := mmdb.GetString(data, "autonomous_system_organization")
+	if org == "" {
+		org = mmdb.GetString(data, "isp")
+	}
+	return int64(asn), org, true
+}
+
+func classifyASN(asn int64, org string) string {
+	if _, ok := hostingASNs[asn]; ok {
+		return NetworkHosting
+	}
+	if isHostingOrg(org) {
+		return NetworkHosting
+	}
+	return NetworkResidential
+}
+
+func isHostingOrg(org string) bool {
+	clean := strings.ToLower(strings.TrimSpace(org))
+	if clean == "" {
+		return false
+	}
+	for _, keyword := range hostingOrgKeywords {
+		if strings.Contains(clean, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupIP2RegionISP 读取 ip2region 的运营商字段（未初始化时返回空）
+func lookupIP2RegionISP(ip net.IP) string {
+	searcher, err := pickIPSearcher(ip)
+	if err != nil {
+		return ""
+	}
+	region, err := searcher.SearchByStr(ip.String())
+	if err != nil {
+		return ""
+	}
+	return normalizeLocationPart(splitRegion(region)[4])
+}
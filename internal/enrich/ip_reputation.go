@@ -0,0 +1,407 @@
+package enrich
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// 信誉名单分类
+const (
+	ReputationTor       = "tor"
+	ReputationDrop      = "drop"
+	ReputationBlocklist = "blocklist"
+)
+
+const (
+	maxIPReputationCacheSize       = 50000
+	defaultReputationRefreshPeriod = 10 * time.Minute
+)
+
+// IPReputation IP 命中的信誉名单
+type IPReputation struct {
+	List     string `json:"list"`
+	Category string `json:"category"`
+}
+
+// IPReputationList 已加载的名单信息
+type IPReputationList struct {
+	Name       string    `json:"name"`
+	Category   string    `json:"category"`
+	File       string    `json:"file"`
+	Prefixes   int       `json:"prefixes"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// ipReputationDB 所有名单合并后的前缀表，值为名单下标
+type ipReputationDB struct {
+	lists     []IPReputationList
+	prefixes  *PrefixTable[uint16]
+	signature string
+	loadedAt  time.Time
+}
+
+var (
+	ipReputationMu      sync.RWMutex
+	ipReputationData    = &ipReputationDB{prefixes: NewPrefixTable[uint16]()}
+	ipReputationReady   bool
+	ipReputationCache   = make(map[string]*IPReputation)
+	ipReputationCacheMu sync.RWMutex
+)
+
+// IPReputationDir 信誉名单目录，默认 DataDir/reputation
+func IPReputationDir() string {
+	cfg := config.ReadConfig()
+	if cfg.Security != nil && cfg.Security.Reputation != nil {
+		if dir := strings.TrimSpace(cfg.Security.Reputation.Dir); dir != "" {
+			return dir
+		}
+	}
+	return filepath.Join(config.DataDir, "reputation")
+}
+
+func ipReputationDisabled() bool {
+	cfg := config.ReadConfig()
+	return cfg.Security != nil && cfg.Security.Reputation != nil && cfg.Security.Reputation.Disabled
+}
+
+func ipReputationRefreshPeriod() time.Duration {
+	cfg := config.ReadConfig()
+	if cfg.Security != nil && cfg.Security.Reputation != nil {
+		if raw := strings.TrimSpace(cfg.Security.Reputation.RefreshInterval); raw != "" {
+			if interval, err := time.ParseDuration(raw); err == nil && interval > 0 {
+				return interval
+			}
+		}
+	}
+	return defaultReputationRefreshPeriod
+}
+
+// InitIPReputation 加载信誉名单目录下的所有文件（按文件名排序，同一前缀以后加载的名单为准）
+func InitIPReputation() error {
+	db := &ipReputationDB{prefixes: NewPrefixTable[uint16](), loadedAt: time.Now()}
+	if ipReputationDisabled() {
+		swapIPReputation(db)
+		return nil
+	}
+	files, signature, err := scanIPReputationDir(IPReputationDir())
+	if err != nil {
+		swapIPReputation(db)
+		return err
+	}
+	db.signature = signature
+	for _, file := range files {
+		if len(db.lists) >= 1<<16 {
+			logrus.Warn("信誉名单数量过多，忽略其余文件")
+			break
+		}
+		list, err := loadIPReputationFile(db.prefixes, file.path, uint16(len(db.lists)))
+		if err != nil {
+			logrus.WithError(err).Warnf("读取信誉名单 %s 失败", file.path)
+			continue
+		}
+		list.ModifiedAt = file.modTime
+		db.lists = append(db.lists, list)
+	}
+	swapIPReputation(db)
+	if len(db.lists) > 0 {
+		logrus.Infof("已加载 IP 信誉名单: %d 个名单, %d 条前缀", len(db.lists), db.prefixes.Len())
+	}
+	return nil
+}
+
+func swapIPReputation(db *ipReputationDB) {
+	ipReputationMu.Lock()
+	ipReputationData = db
+	ipReputationReady = true
+	ipReputationMu.Unlock()
+	ipReputationCacheMu.Lock()
+	ipReputationCache = make(map[string]*IPReputation)
+	ipReputationCacheMu.Unlock()
+}
+
+// EnsureIPReputation 在尚未初始化时加载名单（解析预览使用）
+func EnsureIPReputation() {
+	ipReputationMu.RLock()
+	ready := ipReputationReady
+	ipReputationMu.RUnlock()
+	if !ready {
+		if err := InitIPReputation(); err != nil {
+			logrus.WithError(err).Warn("加载 IP 信誉名单失败")
+		}
+	}
+}
+
+// ReloadIPReputationIfChanged 距上次加载超过 refreshInterval 且名单文件有变化时重新加载，返回是否重新加载
+func ReloadIPReputationIfChanged() bool {
+	ipReputationMu.RLock()
+	ready := ipReputationReady
+	loadedAt := ipReputationData.loadedAt
+	signature := ipReputationData.signature
+	ipReputationMu.RUnlock()
+	if !ready || time.Since(loadedAt) < ipReputationRefreshPeriod() {
+		return false
+	}
+	_, current, err := scanIPReputationDir(IPReputationDir())
+	if err == nil && current == signature {
+		ipReputationMu.Lock()
+		ipReputationData.loadedAt = time.Now()
+		ipReputationMu.Unlock()
+		return false
+	}
+	if err := InitIPReputation(); err != nil {
+		logrus.WithError(err).Warn("重新加载 IP 信誉名单失败")
+	}
+	return true
+}
+
+// ListIPReputationLists 返回已加载的名单
+func ListIPReputationLists() []IPReputationList {
+	EnsureIPReputation()
+	ipReputationMu.RLock()
+	defer ipReputationMu.RUnlock()
+	lists := make([]IPReputationList, len(ipReputationData.lists))
+	copy(lists, ipReputationData.lists)
+	return lists
+}
+
+// LookupIPReputation 查询 IP 命中的名单，未命中或无效 IP 返回 nil
+func LookupIPReputation(ip string) *IPReputation {
+	ip = strings.TrimSpace(ip)
+	ipReputationMu.RLock()
+	db := ipReputationData
+	ipReputationMu.RUnlock()
+	if db.prefixes.Len() == 0 || ip == "" {
+		return nil
+	}
+
+	ipReputationCacheMu.RLock()
+	cached, ok := ipReputationCache[ip]
+	ipReputationCacheMu.RUnlock()
+	if ok {
+		return cached
+	}
+
+	var result *IPReputation
+	if parsed := net.ParseIP(ip); parsed != nil {
+		if index, found := db.prefixes.Lookup(parsed); found && int(index) < len(db.lists) {
+			list := db.lists[index]
+			result = &IPReputation{List: list.Name, Category: list.Category}
+		}
+	}
+	ipReputationCacheMu.Lock()
+	if len(ipReputationCache) >= maxIPReputationCacheSize {
+		ipReputationCache = make(map[string]*IPReputation)
+	}
+	ipReputationCache[ip] = result
+	ipReputationCacheMu.Unlock()
+	return result
+}
+
+type ipReputationFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// scanIPReputationDir 列出名单文件，并返回由文件名 / 大小 / 修改时间组成的签名
+func scanIPReputationDir(dir string) ([]ipReputationFile, string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	files := make([]ipReputationFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".txt", ".netset", ".ipset", ".cidr", ".list", ".json":
+		default:
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, ipReputationFile{
+			path:    filepath.Join(dir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	var signature strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&signature, "%s|%d|%d;", filepath.Base(file.path), file.size, file.modTime.UnixNano())
+	}
+	return files, signature.String(), nil
+}
+
+// loadIPReputationFile 逐行读取名单：
+//   - IP、CIDR 或 IP 范围（a-b），# 与 ; 之后为注释（FireHOL netset、Spamhaus DROP 文本格式）
+//   - Spamhaus DROP JSON 行（{"cidr": "..."}）
+//   - Tor exit-addresses 的 "ExitAddress <ip> ..." 行
+//
+// 名单名称为文件名，可用 "# name: xxx" / "# category: xxx" 覆盖
+func loadIPReputationFile(table *PrefixTable[uint16], path string, index uint16) (IPReputationList, error) {
+	base := filepath.Base(path)
+	list := IPReputationList{
+		Name:     strings.TrimSuffix(base, filepath.Ext(base)),
+		Category: guessReputationCategory(base),
+		File:     path,
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return list, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(strings.TrimLeft(line, "#;")), ":")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "name":
+				if value != "" {
+					list.Name = value
+				}
+			case "category":
+				if value != "" {
+					list.Category = strings.ToLower(value)
+				}
+			}
+			continue
+		}
+		for _, prefix := range parseReputationLine(line) {
+			table.Insert(prefix, index)
+			list.Prefixes++
+		}
+	}
+	return list, scanner.Err()
+}
+
+func parseReputationLine(line string) []*net.IPNet {
+	if strings.HasPrefix(line, "{") {
+		var entry struct {
+			CIDR string `json:"cidr"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.CIDR == "" {
+			return nil
+		}
+		line = entry.CIDR
+	}
+	if idx := strings.IndexAny(line, "#;"); idx >= 0 {
+		line = strings.TrimSpace(line[:idx])
+	}
+	fields := strings.FieldsFunc(line, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return nil
+	}
+	value := fields[0]
+	if strings.EqualFold(value, "ExitAddress") {
+		if len(fields) < 2 {
+			return nil
+		}
+		value = fields[1]
+	}
+	if strings.Contains(value, "-") {
+		return parseReputationRange(value)
+	}
+	if prefix, ok := ParsePrefix(value); ok {
+		return []*net.IPNet{prefix}
+	}
+	return nil
+}
+
+// parseReputationRange 将 IP 范围拆分为最少数量的 CIDR
+func parseReputationRange(value string) []*net.IPNet {
+	startRaw, endRaw, _ := strings.Cut(value, "-")
+	start, err := netip.ParseAddr(strings.TrimSpace(startRaw))
+	if err != nil {
+		return nil
+	}
+	end, err := netip.ParseAddr(strings.TrimSpace(endRaw))
+	if err != nil {
+		return nil
+	}
+	start, end = start.Unmap(), end.Unmap()
+	if start.Is4() != end.Is4() || end.Less(start) {
+		return nil
+	}
+	var prefixes []*net.IPNet
+	for {
+		bits := start.BitLen()
+		ones := bits
+		for ones > 0 {
+			candidate, err := start.Prefix(ones - 1)
+			if err != nil || candidate.Addr() != start || end.Less(lastAddr(candidate)) {
+				break
+			}
+			ones--
+		}
+		prefix := netip.PrefixFrom(start, ones)
+		prefixes = append(prefixes, &net.IPNet{
+			IP:   net.IP(start.AsSlice()),
+			Mask: net.CIDRMask(ones, bits),
+		})
+		last := lastAddr(prefix)
+		if last == end {
+			break
+		}
+		next := last.Next()
+		if !next.IsValid() {
+			break
+		}
+		start = next
+	}
+	return prefixes
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr()
+	bytes := addr.AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 1 << (7 - uint(bit%8))
+	}
+	last, _ := netip.AddrFromSlice(bytes)
+	return last
+}
+
+func guessReputationCategory(fileName string) string {
+	name := strings.ToLower(fileName)
+	switch {
+	case strings.HasPrefix(name, "tor") || strings.Contains(name, "_tor") ||
+		strings.Contains(name, "-tor") || strings.Contains(name, "exit"):
+		return ReputationTor
+	case strings.Contains(name, "drop") || strings.Contains(name, "spamhaus"):
+		return ReputationDrop
+	default:
+		return ReputationBlocklist
+	}
+}
@@ -0,0 +1,471 @@
+// Package mmdb 实现 MaxMind DB（.mmdb）格式的只读解析，用于 GeoLite2 / GeoIP2 / DB-IP 等离线库。
+// 格式说明见 https://maxmind.github.io/MaxMind-DB/
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// 数据段与搜索树之间固定 16 字节的分隔
+const dataSectionSeparator = 16
+
+// 元数据最多位于文件末尾 128KB 内
+const maxMetadataSize = 128 * 1024
+
+// 数据段中 map / 数组 / 指针的最大嵌套深度，防止构造的文件导致栈溢出
+const maxDecodeDepth = 64
+
+// ErrInvalidDatabase 文件不是有效的 MaxMind DB
+var ErrInvalidDatabase = errors.New("无效的 mmdb 文件")
+
+// Metadata 数据库元信息
+type Metadata struct {
+	DatabaseType string
+	Languages    []string
+	Description  map[string]string
+	BuildEpoch   uint64
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+}
+
+// Reader mmdb 读取器，文件整体加载到内存，可并发查询
+type Reader struct {
+	buffer    []byte
+	data      []byte
+	metadata  Metadata
+	nodeSize  uint
+	ipv4Start uint
+	ipv4Bits  int
+}
+
+// Open 读取并校验 mmdb 文件
+func Open(path string) (*Reader, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buffer)
+}
+
+// FromBytes 从内存数据创建读取器
+func FromBytes(buffer []byte) (*Reader, error) {
+	searchFrom := 0
+	if len(buffer) > maxMetadataSize {
+		searchFrom = len(buffer) - maxMetadataSize
+	}
+	idx := bytes.LastIndex(buffer[searchFrom:], metadataMarker)
+	if idx < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	metaStart := searchFrom + idx + len(metadataMarker)
+
+	metaDecoder := decoder{buffer: buffer[metaStart:]}
+	raw, _, err := metaDecoder.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("解析 mmdb 元数据失败: %w", err)
+	}
+	metaMap, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+	metadata := Metadata{
+		DatabaseType: asString(metaMap["database_type"]),
+		BuildEpoch:   asUint(metaMap["build_epoch"]),
+		IPVersion:    uint(asUint(metaMap["ip_version"])),
+		NodeCount:    uint(asUint(metaMap["node_count"])),
+		RecordSize:   uint(asUint(metaMap["record_size"])),
+		Description:  make(map[string]string),
+	}
+	if languages, ok := metaMap["languages"].([]interface{}); ok {
+		for _, lang := range languages {
+			metadata.Languages = append(metadata.Languages, asString(lang))
+		}
+	}
+	if desc, ok := metaMap["description"].(map[string]interface{}); ok {
+		for key, value := range desc {
+			metadata.Description[key] = asString(value)
+		}
+	}
+	switch metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("不支持的 mmdb record_size: %d", metadata.RecordSize)
+	}
+	if metadata.NodeCount == 0 {
+		return nil, ErrInvalidDatabase
+	}
+
+	nodeSize := metadata.RecordSize / 4
+	treeSize := metadata.NodeCount * nodeSize
+	dataStart := treeSize + dataSectionSeparator
+	if dataStart > uint(searchFrom+idx) {
+		return nil, ErrInvalidDatabase
+	}
+
+	reader := &Reader{
+		buffer:   buffer,
+		data:     buffer[dataStart : searchFrom+idx],
+		metadata: metadata,
+		nodeSize: nodeSize,
+	}
+	reader.initIPv4Start()
+	return reader, nil
+}
+
+// Metadata 返回数据库元信息
+func (r *Reader) Metadata() Metadata {
+	return r.metadata
+}
+
+// Lookup 查询 IP 对应的记录，未收录时返回 nil
+func (r *Reader) Lookup(ip net.IP) (map[string]interface{}, error) {
+	offset, found, err := r.lookupOffset(ip)
+	if err != nil || !found {
+		return nil, err
+	}
+	dec := decoder{buffer: r.data}
+	value, _, err := dec.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mmdb 记录类型异常")
+	}
+	return record, nil
+}
+
+// IPv6 库中 IPv4 地址位于 ::/96 子树，预先定位其起始节点
+func (r *Reader) initIPv4Start() {
+	if r.metadata.IPVersion != 6 {
+		r.ipv4Bits = 0
+		return
+	}
+	node := uint(0)
+	i := 0
+	for ; i < 96 && node < r.metadata.NodeCount; i++ {
+		node = r.readNode(node, 0)
+	}
+	r.ipv4Start = node
+	r.ipv4Bits = i
+}
+
+func (r *Reader) lookupOffset(ip net.IP) (uint, bool, error) {
+	if ip == nil {
+		return 0, false, fmt.Errorf("无效的 IP 地址")
+	}
+	bitCount := 128
+	node := uint(0)
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		bitCount = 32
+		node = r.ipv4Start
+		if r.metadata.IPVersion == 6 && r.ipv4Bits < 96 {
+			// ::/96 子树提前结束，说明该库不含 IPv4 数据
+			return r.resolveRecord(node)
+		}
+	} else if r.metadata.IPVersion == 4 {
+		return 0, false, fmt.Errorf("IPv4 数据库不支持 IPv6 查询")
+	} else {
+		ip = ip.To16()
+	}
+
+	for i := 0; i < bitCount && node < r.metadata.NodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = r.readNode(node, bit)
+	}
+	return r.resolveRecord(node)
+}
+
+func (r *Reader) resolveRecord(node uint) (uint, bool, error) {
+	switch {
+	case node == r.metadata.NodeCount:
+		return 0, false, nil
+	case node > r.metadata.NodeCount:
+		offset := node - r.metadata.NodeCount - dataSectionSeparator
+		if offset >= uint(len(r.data)) {
+			return 0, false, ErrInvalidDatabase
+		}
+		return offset, true, nil
+	default:
+		return 0, false, nil
+	}
+}
+
+func (r *Reader) readNode(node, bit uint) uint {
+	base := node * r.nodeSize
+	b := r.buffer[base : base+r.nodeSize]
+	switch r.metadata.RecordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4]))
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8]))
+	}
+}
+
+// 数据段字段类型
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeFloat64
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeSlice
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat32
+)
+
+type decoder struct {
+	buffer []byte
+}
+
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	return d.decodeAt(offset, 0)
+}
+
+func (d *decoder) decodeAt(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, fmt.Errorf("%w: 数据嵌套超过 %d 层", ErrInvalidDatabase, maxDecodeDepth)
+	}
+	if offset >= uint(len(d.buffer)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	ctrl := d.buffer[offset]
+	offset++
+	kind := int(ctrl >> 5)
+	if kind == typePointer {
+		pointer, next, err := d.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// 规范不允许指针指向指针，拒绝后指针链无法成环
+		if pointer >= uint(len(d.buffer)) || int(d.buffer[pointer]>>5) == typePointer {
+			return nil, 0, ErrInvalidDatabase
+		}
+		value, _, err := d.decodeAt(pointer, depth+1)
+		return value, next, err
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(d.buffer)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		kind = 7 + int(d.buffer[offset])
+		offset++
+	}
+	size, offset, err := d.sizeFromCtrl(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return d.decodeValue(kind, size, offset, depth)
+}
+
+func (d *decoder) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint((ctrl>>3)&0x3) + 1
+	if offset+size > uint(len(d.buffer)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	b := d.buffer[offset : offset+size]
+	var pointer uint
+	switch size {
+	case 1:
+		pointer = uint(ctrl&0x7)<<8 | uint(b[0])
+	case 2:
+		pointer = (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		pointer = (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + size, nil
+}
+
+func (d *decoder) sizeFromCtrl(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+	extra := size - 28
+	if offset+extra > uint(len(d.buffer)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	b := d.buffer[offset : offset+extra]
+	switch extra {
+	case 1:
+		size = 29 + uint(b[0])
+	case 2:
+		size = 285 + (uint(b[0])<<8 | uint(b[1]))
+	default:
+		size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+	}
+	return size, offset + extra, nil
+}
+
+func (d *decoder) decodeValue(kind int, size, offset uint, depth int) (interface{}, uint, error) {
+	// 每个元素至少占 1 字节（map 的键和值各至少 1 字节），元素数不可能超过剩余字节数，
+	// 据此拒绝虚报的容器大小，避免按文件中的数值预分配过大的内存
+	remaining := uint(len(d.buffer)) - offset
+	switch kind {
+	case typeMap:
+		if size > remaining/2 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		result := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decodeAt(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, after, err := d.decodeAt(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result[asString(key)] = value
+			offset = after
+		}
+		return result, offset, nil
+	case typeSlice:
+		if size > remaining {
+			return nil, 0, ErrInvalidDatabase
+		}
+		result := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decodeAt(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+			offset = next
+		}
+		return result, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeEndMarker, typeContainer:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buffer)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	b := d.buffer[offset : offset+size]
+	next := offset + size
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeFloat64:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat32:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		var value uint64
+		for _, c := range b {
+			value = value<<8 | uint64(c)
+		}
+		return value, next, nil
+	case typeInt32:
+		var value uint32
+		for _, c := range b {
+			value = value<<8 | uint32(c)
+		}
+		return int64(int32(value)), next, nil
+	case typeUint128:
+		// 仅在元数据等少数场景出现，按字节返回
+		return append([]byte(nil), b...), next, nil
+	default:
+		return nil, 0, fmt.Errorf("未知的 mmdb 字段类型: %d", kind)
+	}
+}
+
+func asString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return ""
+}
+
+func asUint(value interface{}) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int64:
+		if v > 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
+
+// Get 按路径读取嵌套字段，string 为 map 键、int 为数组下标，路径不存在时返回 nil
+func Get(record map[string]interface{}, path ...interface{}) interface{} {
+	var current interface{} = record
+	for _, key := range path {
+		switch k := key.(type) {
+		case string:
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			current = m[k]
+		case int:
+			list, ok := current.([]interface{})
+			if !ok || k < 0 || k >= len(list) {
+				return nil
+			}
+			current = list[k]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// GetString 按路径读取字符串字段
+func GetString(record map[string]interface{}, path ...interface{}) string {
+	return asString(Get(record, path...))
+}
+
+// GetUint 按路径读取无符号整数字段
+func GetUint(record map[string]interface{}, path ...interface{}) uint64 {
+	return asUint(Get(record, path...))
+}
+
+// GetFloat 按路径读取浮点字段
+func GetFloat(record map[string]interface{}, path ...interface{}) (float64, bool) {
+	value, ok := Get(record, path...).(float64)
+	return value, ok
+}
@@ -0,0 +1,107 @@
+package enrich
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// PrefixTable 按前缀长度分桶的 CIDR 表，查询时从最长前缀开始匹配，
+// 单次查询最多 129 次哈希查找，适合数十万条前缀
+type PrefixTable[T any] struct {
+	buckets map[int]map[[16]byte]T
+	lengths []int
+	size    int
+}
+
+// NewPrefixTable 创建空的 CIDR 表
+func NewPrefixTable[T any]() *PrefixTable[T] {
+	return &PrefixTable[T]{buckets: make(map[int]map[[16]byte]T)}
+}
+
+// ParsePrefix 解析 CIDR 或单个 IP（视为 /32、/128）
+func ParsePrefix(raw string) (*net.IPNet, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, false
+	}
+	if strings.Contains(raw, "/") {
+		_, prefix, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, false
+		}
+		return prefix, true
+	}
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return nil, false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, true
+	}
+	return &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}, true
+}
+
+// Insert 写入前缀，相同前缀后写入的值覆盖先前的值
+func (t *PrefixTable[T]) Insert(prefix *net.IPNet, value T) {
+	if prefix == nil {
+		return
+	}
+	ones, bits := prefix.Mask.Size()
+	if bits == 32 {
+		ones += 96
+	}
+	key := maskedPrefixKey(prefix.IP.To16(), ones)
+	bucket, ok := t.buckets[ones]
+	if !ok {
+		bucket = make(map[[16]byte]T)
+		t.buckets[ones] = bucket
+		t.lengths = append(t.lengths, ones)
+		sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+	}
+	if _, exists := bucket[key]; !exists {
+		t.size++
+	}
+	bucket[key] = value
+}
+
+// Lookup 返回包含 ip 的最长前缀对应的值
+func (t *PrefixTable[T]) Lookup(ip net.IP) (T, bool) {
+	var zero T
+	if t == nil || t.size == 0 {
+		return zero, false
+	}
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return zero, false
+	}
+	isV4 := ip.To4() != nil
+	for _, ones := range t.lengths {
+		// IPv4 前缀以 ::ffff:0:0/96 映射存储，短于 /96 的只可能是 IPv6 前缀
+		if isV4 && ones < 96 {
+			break
+		}
+		if value, ok := t.buckets[ones][maskedPrefixKey(ip16, ones)]; ok {
+			return value, true
+		}
+	}
+	return zero, false
+}
+
+// Len 返回前缀数量
+func (t *PrefixTable[T]) Len() int {
+	if t == nil {
+		return 0
+	}
+	return t.size
+}
+
+func maskedPrefixKey(ip net.IP, ones int) [16]byte {
+	var key [16]byte
+	copy(key[:], ip)
+	mask := net.CIDRMask(ones, 128)
+	for i := range key {
+		key[i] &= mask[i]
+	}
+	return key
+}
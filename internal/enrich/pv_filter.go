@@ -4,6 +4,7 @@ import (
 	"net"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/likaia/nginxpulse/internal/config"
 )
@@ -14,38 +15,61 @@ var (
 	excludeIPs      map[string]bool
 	statusCodes     map[int]bool
 	excludePrivate  bool
+	pvFiltersReady  bool
+	// pvFiltersMu 串行化规则初始化，避免解析预览与解析器初始化并发写入
+	pvFiltersMu sync.Mutex
 )
 
 // InitPVFilters 初始化PV过滤规则
 func InitPVFilters() {
+	pvFiltersMu.Lock()
+	defer pvFiltersMu.Unlock()
+	initPVFiltersLocked()
+}
+
+func initPVFiltersLocked() {
 	cfg := config.ReadConfig()
 
 	// 初始化状态码过滤
-	statusCodes = make(map[int]bool)
+	codes := make(map[int]bool)
 	for _, code := range cfg.PVFilter.StatusCodeInclude {
-		statusCodes[code] = true
+		codes[code] = true
 	}
 
 	// 初始化正则表达式过滤
-	excludePatterns = make([]*regexp.Regexp, len(cfg.PVFilter.ExcludePatterns))
+	patterns := make([]*regexp.Regexp, len(cfg.PVFilter.ExcludePatterns))
 	for i, pattern := range cfg.PVFilter.ExcludePatterns {
-		excludePatterns[i] = regexp.MustCompile(pattern)
+		patterns[i] = regexp.MustCompile(pattern)
 	}
 
 	// 初始化IP过滤
-	excludeIPs = make(map[string]bool)
+	ips := make(map[string]bool)
 	for _, ip := range cfg.PVFilter.ExcludeIPs {
 		normalized := normalizeIP(ip)
 		if normalized == "" {
 			continue
 		}
-		excludeIPs[normalized] = true
+		ips[normalized] = true
 	}
 
+	statusCodes = codes
+	excludePatterns = patterns
+	excludeIPs = ips
 	excludePrivate = true
 	if cfg.PVFilter.ExcludeIPs != nil && len(cfg.PVFilter.ExcludeIPs) == 0 {
 		excludePrivate = false
 	}
+	pvFiltersReady = true
+}
+
+// EnsurePVFilters 在尚未初始化时初始化 PV 过滤规则（初始化模式下解析预览使用）
+func EnsurePVFilters() {
+	pvFiltersMu.Lock()
+	defer pvFiltersMu.Unlock()
+	if pvFiltersReady {
+		return
+	}
+	initPVFiltersLocked()
 }
 
 // normalizeIP extracts a usable IP string from log tokens
@@ -108,7 +132,7 @@ func ShouldCountAsPageView(statusCode int, path string, ip string) int {
 	normalizedIP := normalizeIP(ip)
 
 	// 过滤内网/保留地址
-	if excludePrivate && isPrivateIP(net.ParseIP(normalizedIP)) {
+	if excludePrivate && IsPrivateIP(net.ParseIP(normalizedIP)) {
 		return 0
 	}
 
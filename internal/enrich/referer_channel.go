@@ -0,0 +1,223 @@
+package enrich
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+// 来源渠道
+const (
+	ChannelDirect   = "direct"
+	ChannelSearch   = "search"
+	ChannelSocial   = "social"
+	ChannelReferral = "referral"
+	ChannelEmail    = "email"
+	ChannelCampaign = "campaign"
+	// ChannelInternal 站内跳转，会话统计中按直接访问计
+	ChannelInternal = "internal"
+)
+
+// RefererSource 来源分类结果
+type RefererSource struct {
+	Channel string
+	// Source 命中规则的名称（如 baidu、wechat），未命中时为来源域名
+	Source  string
+	Domain  string
+	Keyword string
+}
+
+type channelRule struct {
+	name          string
+	channel       string
+	domains       []string
+	keywordParams []string
+}
+
+// 内置渠道表，可通过 refererChannels.rules 追加或覆盖
+var builtinChannelRules = []channelRule{
+	{name: "baidu", channel: ChannelSearch, domains: []string{"baidu.com"}, keywordParams: []string{"wd", "word", "kw", "q"}},
+	{name: "google", channel: ChannelSearch, domains: []string{"google.*"}, keywordParams: []string{"q"}},
+	{name: "bing", channel: ChannelSearch, domains: []string{"bing.com"}, keywordParams: []string{"q"}},
+	{name: "sogou", channel: ChannelSearch, domains: []string{"sogou.com"}, keywordParams: []string{"query", "keyword"}},
+	{name: "360", channel: ChannelSearch, domains: []string{"so.com"}, keywordParams: []string{"q"}},
+	{name: "shenma", channel: ChannelSearch, domains: []string{"sm.cn"}, keywordParams: []string{"q"}},
+	{name: "toutiao", channel: ChannelSearch, domains: []string{"so.toutiao.com"}, keywordParams: []string{"keyword"}},
+	{name: "yandex", channel: ChannelSearch, domains: []string{"yandex.*"}, keywordParams: []string{"text"}},
+	{name: "duckduckgo", channel: ChannelSearch, domains: []string{"duckduckgo.com"}, keywordParams: []string{"q"}},
+	{name: "yahoo", channel: ChannelSearch, domains: []string{"search.yahoo.com"}, keywordParams: []string{"p"}},
+	{name: "naver", channel: ChannelSearch, domains: []string{"search.naver.com"}, keywordParams: []string{"query"}},
+	{name: "wechat", channel: ChannelSocial, domains: []string{"weixin.qq.com", "wx.qq.com"}},
+	{name: "weibo", channel: ChannelSocial, domains: []string{"weibo.com", "weibo.cn", "t.cn"}},
+	{name: "zhihu", channel: ChannelSocial, domains: []string{"zhihu.com"}},
+	{name: "douban", channel: ChannelSocial, domains: []string{"douban.com"}},
+	{name: "xiaohongshu", channel: ChannelSocial, domains: []string{"xiaohongshu.com", "xhslink.com"}},
+	{name: "douyin", channel: ChannelSocial, domains: []string{"douyin.com"}},
+	{name: "bilibili", channel: ChannelSocial, domains: []string{"bilibili.com", "b23.tv"}},
+	{name: "facebook", channel: ChannelSocial, domains: []string{"facebook.com", "fb.me"}},
+	{name: "twitter", channel: ChannelSocial, domains: []string{"twitter.com", "x.com", "t.co"}},
+	{name: "linkedin", channel: ChannelSocial, domains: []string{"linkedin.com", "lnkd.in"}},
+	{name: "reddit", channel: ChannelSocial, domains: []string{"reddit.com"}},
+	{name: "instagram", channel: ChannelSocial, domains: []string{"instagram.com"}},
+	{name: "youtube", channel: ChannelSocial, domains: []string{"youtube.com", "youtu.be"}},
+	{name: "tiktok", channel: ChannelSocial, domains: []string{"tiktok.com"}},
+	{name: "telegram", channel: ChannelSocial, domains: []string{"t.me", "telegram.org"}},
+	{name: "qqmail", channel: ChannelEmail, domains: []string{"mail.qq.com", "exmail.qq.com"}},
+	{name: "netease-mail", channel: ChannelEmail, domains: []string{"mail.163.com", "mail.126.com", "mail.yeah.net"}},
+	{name: "gmail", channel: ChannelEmail, domains: []string{"mail.google.com"}},
+	{name: "outlook", channel: ChannelEmail, domains: []string{"outlook.live.com", "outlook.office.com", "outlook.office365.com"}},
+	{name: "yahoo-mail", channel: ChannelEmail, domains: []string{"mail.yahoo.com"}},
+	{name: "sina-mail", channel: ChannelEmail, domains: []string{"mail.sina.com.cn"}},
+	{name: "aliyun-mail", channel: ChannelEmail, domains: []string{"mail.aliyun.com", "qiye.aliyun.com"}},
+}
+
+var (
+	channelRulesMu     sync.RWMutex
+	customChannelRules []channelRule
+	channelRulesReady  bool
+)
+
+// InitRefererChannels 加载配置中的自定义渠道规则
+func InitRefererChannels() {
+	cfg := config.ReadConfig()
+	rules := make([]channelRule, 0)
+	if cfg.RefererChannels != nil {
+		for _, rule := range cfg.RefererChannels.Rules {
+			compiled := channelRule{
+				name:          strings.TrimSpace(rule.Name),
+				channel:       strings.TrimSpace(rule.Channel),
+				keywordParams: lowerTrimAll(rule.KeywordParams),
+			}
+			for _, domain := range rule.Domains {
+				if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+					compiled.domains = append(compiled.domains, strings.TrimPrefix(domain, "www."))
+				}
+			}
+			if compiled.name == "" || compiled.channel == "" || len(compiled.domains) == 0 {
+				continue
+			}
+			rules = append(rules, compiled)
+		}
+	}
+	channelRulesMu.Lock()
+	customChannelRules = rules
+	channelRulesReady = true
+	channelRulesMu.Unlock()
+}
+
+// EnsureRefererChannels 在尚未初始化时加载自定义渠道规则（解析预览使用）
+func EnsureRefererChannels() {
+	channelRulesMu.RLock()
+	ready := channelRulesReady
+	channelRulesMu.RUnlock()
+	if !ready {
+		InitRefererChannels()
+	}
+}
+
+// ClassifyReferer 按来源 URL 判断渠道：空来源为直接访问，站点自身域名为站内跳转，
+// 其余按规则表（自定义规则优先，同级取匹配最长的域名）识别，未命中为外链引荐。
+func ClassifyReferer(rawReferer string, siteDomains []string) RefererSource {
+	rawReferer = strings.TrimSpace(rawReferer)
+	if rawReferer == "" || rawReferer == "-" {
+		return RefererSource{Channel: ChannelDirect}
+	}
+	parsed, err := url.Parse(rawReferer)
+	if err != nil || parsed.Host == "" {
+		return RefererSource{Channel: ChannelDirect}
+	}
+	host := strings.ToLower(parsed.Hostname())
+	domain := strings.TrimPrefix(host, "www.")
+	if domain == "" {
+		return RefererSource{Channel: ChannelDirect}
+	}
+	for _, raw := range siteDomains {
+		if site := siteDomainHost(raw); site != "" && (site == host || site == domain) {
+			return RefererSource{Channel: ChannelInternal, Source: domain, Domain: domain}
+		}
+	}
+
+	channelRulesMu.RLock()
+	rule := matchChannelRule(customChannelRules, domain)
+	channelRulesMu.RUnlock()
+	if rule == nil {
+		rule = matchChannelRule(builtinChannelRules, domain)
+	}
+	if rule == nil {
+		return RefererSource{Channel: ChannelReferral, Source: domain, Domain: domain}
+	}
+	result := RefererSource{Channel: rule.channel, Source: rule.name, Domain: domain}
+	if len(rule.keywordParams) > 0 && parsed.RawQuery != "" {
+		query := parsed.Query()
+		for _, param := range rule.keywordParams {
+			if keyword := strings.TrimSpace(query.Get(param)); keyword != "" {
+				result.Keyword = keyword
+				break
+			}
+		}
+	}
+	return result
+}
+
+func matchChannelRule(rules []channelRule, domain string) *channelRule {
+	var (
+		best      *channelRule
+		bestScore int
+	)
+	for i := range rules {
+		for _, pattern := range rules[i].domains {
+			if score := matchChannelDomain(pattern, domain); score > bestScore {
+				best = &rules[i]
+				bestScore = score
+			}
+		}
+	}
+	return best
+}
+
+// matchChannelDomain 返回匹配长度（0 表示不匹配）：example.com 匹配自身及子域名，
+// google.* 匹配 google.com、www.google.com.hk 等
+func matchChannelDomain(pattern, domain string) int {
+	if strings.HasSuffix(pattern, ".*") {
+		label := strings.TrimSuffix(pattern, ".*")
+		if strings.HasPrefix(domain, label+".") || strings.Contains(domain, "."+label+".") {
+			return len(label) + 1
+		}
+		return 0
+	}
+	if domain == pattern || strings.HasSuffix(domain, "."+pattern) {
+		return len(pattern)
+	}
+	return 0
+}
+
+func siteDomainHost(raw string) string {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == "" {
+		return ""
+	}
+	if strings.Contains(raw, "://") {
+		if parsed, err := url.Parse(raw); err == nil {
+			raw = parsed.Host
+		}
+	}
+	raw = strings.TrimPrefix(raw, "//")
+	raw = strings.TrimSuffix(raw, "/")
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		raw = host
+	}
+	return raw
+}
+
+func lowerTrimAll(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
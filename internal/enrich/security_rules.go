@@ -0,0 +1,486 @@
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// Web 攻击类型
+const (
+	AttackSQLi          = "sqli"
+	AttackXSS           = "xss"
+	AttackPathTraversal = "path_traversal"
+	AttackProbe         = "probe"
+	AttackScanner       = "scanner"
+	AttackWebshell      = "webshell"
+	AttackRCE           = "rce"
+)
+
+// 严重级别，由低到高
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// 规则匹配对象
+const (
+	SecurityTargetURL       = "url"
+	SecurityTargetPath      = "path"
+	SecurityTargetUserAgent = "user_agent"
+)
+
+// SecurityRule 攻击特征规则，内置规则与规则文件共用同一结构。
+// Pattern 为不区分大小写的正则；Keywords 为可选的小写预筛词，目标中不含任一关键词时跳过正则。
+type SecurityRule struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Target      string   `json:"target"`
+	Pattern     string   `json:"pattern"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Severity    string   `json:"severity"`
+	Description string   `json:"description,omitempty"`
+	Disabled    bool     `json:"disabled,omitempty"`
+	// Builtin 仅用于接口展示，规则文件中无需填写
+	Builtin bool `json:"builtin,omitempty"`
+}
+
+// SecurityMatch 命中结果
+type SecurityMatch struct {
+	Type     string
+	RuleID   string
+	Severity string
+}
+
+type compiledSecurityRule struct {
+	SecurityRule
+	pattern *regexp.Regexp
+	rank    int
+}
+
+// 内置规则，可在规则文件中按 id 覆盖或禁用
+var builtinSecurityRules = []SecurityRule{
+	{ID: "sqli-union", Type: AttackSQLi, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern: `union(\s|/\*.*?\*/)+(all(\s|/\*.*?\*/)+)?select`, Keywords: []string{"union"},
+		Description: "UNION 注入"},
+	{ID: "sqli-boolean", Type: AttackSQLi, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern: `['"\)]\s*(or|and|xor)\s+['"]?[\w]+['"]?\s*(=|<|>|like\b)`, Keywords: []string{"'", "\"", ")"},
+		Description: "布尔盲注"},
+	{ID: "sqli-time", Type: AttackSQLi, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern: `\b(sleep|benchmark|pg_sleep)\s*\(|waitfor\s+delay\s`, Keywords: []string{"sleep", "benchmark", "waitfor"},
+		Description: "时间盲注"},
+	{ID: "sqli-error", Type: AttackSQLi, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern:     `\b(extractvalue|updatexml|load_file|group_concat|concat_ws)\s*\(`,
+		Keywords:    []string{"extractvalue", "updatexml", "load_file", "group_concat", "concat_ws"},
+		Description: "报错注入 / 数据读取函数"},
+	{ID: "sqli-schema", Type: AttackSQLi, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern:     `information_schema|pg_catalog|mysql\.user\b|sysobjects|xp_cmdshell`,
+		Keywords:    []string{"information_schema", "pg_catalog", "mysql.user", "sysobjects", "xp_cmdshell"},
+		Description: "系统表探测"},
+	{ID: "sqli-comment", Type: AttackSQLi, Target: SecurityTargetURL, Severity: SeverityMedium,
+		Pattern: `['"]\s*(--|/\*|;\s*(drop|select|insert|update|delete)\b)`, Keywords: []string{"'", "\""},
+		Description: "引号闭合后接注释或堆叠语句"},
+
+	{ID: "xss-script", Type: AttackXSS, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern: `<\s*/?\s*script\b`, Keywords: []string{"script"},
+		Description: "script 标签"},
+	{ID: "xss-event", Type: AttackXSS, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern:     `<[^>]*\bon(error|load|mouseover|focus|click|toggle|animationstart|pointerover)\s*=`,
+		Keywords:    []string{"onerror", "onload", "onmouseover", "onfocus", "onclick", "ontoggle", "onanimationstart", "onpointerover"},
+		Description: "HTML 事件属性"},
+	{ID: "xss-uri", Type: AttackXSS, Target: SecurityTargetURL, Severity: SeverityMedium,
+		Pattern: `(javascript|vbscript)\s*:|data:text/html`, Keywords: []string{"javascript", "vbscript", "data:text"},
+		Description: "脚本伪协议"},
+	{ID: "xss-tag", Type: AttackXSS, Target: SecurityTargetURL, Severity: SeverityMedium,
+		Pattern: `<\s*(iframe|svg|object|embed|img|body|details)\b[^>]*\b(src|on\w+)\s*=`, Keywords: []string{"<"},
+		Description: "可执行脚本的 HTML 标签"},
+	{ID: "xss-dom", Type: AttackXSS, Target: SecurityTargetURL, Severity: SeverityMedium,
+		Pattern:     `\b(alert|prompt|confirm)\s*\(|document\.(cookie|domain)|string\.fromcharcode`,
+		Keywords:    []string{"alert", "prompt", "confirm", "document.", "fromcharcode"},
+		Description: "常见 XSS 验证载荷"},
+
+	{ID: "traversal-dots", Type: AttackPathTraversal, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern: `(\.\.[/\\]){2,}|[/\\]\.\.[/\\]`, Keywords: []string{".."},
+		Description: "目录穿越"},
+	{ID: "traversal-files", Type: AttackPathTraversal, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern:     `/etc/(passwd|shadow|hosts|group)\b|/proc/self/|c:\\windows|\b(boot|win)\.ini\b`,
+		Keywords:    []string{"/etc/", "/proc/", "windows", "boot.ini", "win.ini"},
+		Description: "系统文件读取"},
+	{ID: "traversal-wrapper", Type: AttackPathTraversal, Target: SecurityTargetURL, Severity: SeverityHigh,
+		Pattern: `\b(php|file|phar|zip|expect|glob)://`, Keywords: []string{"://"},
+		Description: "文件包含伪协议"},
+
+	{ID: "probe-env", Type: AttackProbe, Target: SecurityTargetPath, Severity: SeverityMedium,
+		Pattern: `/\.env(\.[\w-]+)?$`, Keywords: []string{".env"},
+		Description: ".env 环境变量文件"},
+	{ID: "probe-vcs", Type: AttackProbe, Target: SecurityTargetPath, Severity: SeverityMedium,
+		Pattern: `/\.(git|svn|hg|bzr)(/|$)`, Keywords: []string{".git", ".svn", ".hg", ".bzr"},
+		Description: "版本库目录"},
+	{ID: "probe-config", Type: AttackProbe, Target: SecurityTargetPath, Severity: SeverityMedium,
+		Pattern:     `/(wp-config\.php[\w.~-]*|web\.config|\.htaccess|\.htpasswd|\.ds_store|\.aws/credentials|\.ssh/|id_[rd]sa|docker-compose\.ya?ml|config\.(php|inc|json|ya?ml)\.(bak|old|save|swp))$`,
+		Keywords:    []string{"wp-config", "web.config", ".ht", ".ds_store", ".aws", ".ssh", "id_", "docker-compose", "config."},
+		Description: "敏感配置文件"},
+	{ID: "probe-backup", Type: AttackProbe, Target: SecurityTargetPath, Severity: SeverityMedium,
+		Pattern:     `/(backup|backups|db|database|dump|www|wwwroot|site|web|htdocs)\.(sql|zip|rar|7z|tar|tar\.gz|tgz|bak)$`,
+		Keywords:    []string{".sql", ".zip", ".rar", ".7z", ".tar", ".tgz", ".bak"},
+		Description: "备份文件"},
+	{ID: "probe-wordpress", Type: AttackProbe, Target: SecurityTargetPath, Severity: SeverityLow,
+		Pattern: `/(wp-admin|wp-login\.php|xmlrpc\.php|wp-includes/wlwmanifest\.xml)`, Keywords: []string{"wp-", "xmlrpc"},
+		Description: "WordPress 后台探测（WordPress 站点可在规则文件中禁用）"},
+	{ID: "probe-admin", Type: AttackProbe, Target: SecurityTargetPath, Severity: SeverityLow,
+		Pattern:     `/(phpmyadmin|pma|myadmin|adminer(\.php)?|manager/html|actuator|solr/admin|console/login|druid/index\.html|_profiler|server-status)(/|$)`,
+		Keywords:    []string{"phpmyadmin", "pma", "myadmin", "adminer", "manager/html", "actuator", "solr", "console", "druid", "_profiler", "server-status"},
+		Description: "管理后台 / 运维端点探测"},
+
+	{ID: "scanner-ua", Type: AttackScanner, Target: SecurityTargetUserAgent, Severity: SeverityMedium,
+		Pattern:     `\b(sqlmap|nikto|nmap|masscan|zgrab|nuclei|acunetix|netsparker|appscan|awvs|openvas|nessus|wpscan|dirbuster|gobuster|dirsearch|feroxbuster|ffuf|wfuzz|hydra|jaeles|xray|fscan|w3af|arachni|whatweb|httpx|sqlninja|havij)\b`,
+		Description: "已知扫描器 User-Agent"},
+
+	{ID: "webshell-name", Type: AttackWebshell, Target: SecurityTargetPath, Severity: SeverityCritical,
+		Pattern:     `/(c99|r57|wso|b374k|alfa|indoxploit|phpspy|webshell|shell|cmd|chopper|behinder|godzilla|antsword|1|x|xx)\.(php\d?|phtml|jsp|jspx|asp|aspx|ashx)$`,
+		Keywords:    []string{".php", ".phtml", ".jsp", ".asp", ".ashx"},
+		Description: "常见 WebShell 文件名"},
+	{ID: "webshell-upload-dir", Type: AttackWebshell, Target: SecurityTargetPath, Severity: SeverityHigh,
+		Pattern:     `/(uploads?|images?|files|static|attachments?|wp-content/uploads)/[^?]*\.(php\d?|phtml|jsp|jspx|asp|aspx)$`,
+		Keywords:    []string{".php", ".phtml", ".jsp", ".asp"},
+		Description: "上传 / 静态目录中的脚本文件"},
+	{ID: "webshell-param", Type: AttackWebshell, Target: SecurityTargetURL, Severity: SeverityCritical,
+		Pattern:     `\.(php\d?|jsp|aspx?)\?(.*&)?(cmd|exec|command|shell|execute)=`,
+		Keywords:    []string{"cmd=", "exec", "command=", "shell="},
+		Description: "WebShell 命令参数"},
+
+	{ID: "rce-command", Type: AttackRCE, Target: SecurityTargetURL, Severity: SeverityCritical,
+		Pattern:     "([;|`]|\\$\\(|&&)\\s*(wget|curl|bash|sh|nc|ncat|python\\d?|perl|chmod|cat\\s+/etc|id|whoami|uname)\\b",
+		Keywords:    []string{";", "|", "`", "$(", "&&"},
+		Description: "命令注入"},
+	{ID: "rce-jndi", Type: AttackRCE, Target: SecurityTargetURL, Severity: SeverityCritical,
+		Pattern: `\$\{\s*(jndi|\$\{lower:j\}|j\$\{)`, Keywords: []string{"${"},
+		Description: "Log4Shell JNDI 注入"},
+	{ID: "rce-jndi-ua", Type: AttackRCE, Target: SecurityTargetUserAgent, Severity: SeverityCritical,
+		Pattern: `\$\{\s*(jndi|\$\{lower:j\}|j\$\{)`, Keywords: []string{"${"},
+		Description: "User-Agent 中的 Log4Shell JNDI 注入"},
+	{ID: "rce-ognl", Type: AttackRCE, Target: SecurityTargetURL, Severity: SeverityCritical,
+		Pattern: `%\{|\$\{.*(runtime|processbuilder|getruntime)|class\.module\.classloader`, Keywords: []string{"%{", "runtime", "processbuilder", "classloader"},
+		Description: "OGNL / SpEL 表达式注入"},
+}
+
+var (
+	securityRulesMu    sync.RWMutex
+	securityRules      []compiledSecurityRule
+	securityRulesReady bool
+	securityDisabled   bool
+	securityRulesMtime time.Time
+)
+
+// SecurityRulesFile 自定义规则文件路径
+func SecurityRulesFile() string {
+	cfg := config.ReadConfig()
+	if cfg.Security != nil {
+		if path := strings.TrimSpace(cfg.Security.RulesFile); path != "" {
+			return path
+		}
+	}
+	return filepath.Join(config.DataDir, "security_rules.json")
+}
+
+// InitSecurityRules 编译内置规则并合并规则文件
+func InitSecurityRules() {
+	cfg := config.ReadConfig()
+	disabled := cfg.Security != nil && cfg.Security.Disabled
+
+	path := SecurityRulesFile()
+	var mtime time.Time
+	var custom []SecurityRule
+	if stat, err := os.Stat(path); err == nil {
+		mtime = stat.ModTime()
+		if custom, err = readSecurityRulesFile(path); err != nil {
+			logrus.WithError(err).Warnf("读取攻击特征规则文件 %s 失败，仅使用内置规则", path)
+			custom = nil
+		}
+	}
+
+	rules := compileSecurityRules(mergeSecurityRules(builtinSecurityRules, custom))
+	securityRulesMu.Lock()
+	securityRules = rules
+	securityDisabled = disabled
+	securityRulesMtime = mtime
+	securityRulesReady = true
+	securityRulesMu.Unlock()
+	if len(custom) > 0 {
+		logrus.Infof("已加载攻击特征规则: %d 条（规则文件 %d 条）", len(rules), len(custom))
+	}
+}
+
+// EnsureSecurityRules 在尚未初始化时加载规则（解析预览使用）
+func EnsureSecurityRules() {
+	securityRulesMu.RLock()
+	ready := securityRulesReady
+	securityRulesMu.RUnlock()
+	if !ready {
+		InitSecurityRules()
+	}
+}
+
+// ReloadSecurityRulesIfChanged 规则文件修改（或删除）后重新加载，返回是否重新加载
+func ReloadSecurityRulesIfChanged() bool {
+	var mtime time.Time
+	if stat, err := os.Stat(SecurityRulesFile()); err == nil {
+		mtime = stat.ModTime()
+	}
+	securityRulesMu.RLock()
+	ready := securityRulesReady
+	changed := !mtime.Equal(securityRulesMtime)
+	securityRulesMu.RUnlock()
+	if !ready || !changed {
+		return false
+	}
+	InitSecurityRules()
+	return true
+}
+
+// ListSecurityRules 返回当前生效的规则（含被禁用的规则）
+func ListSecurityRules() []SecurityRule {
+	EnsureSecurityRules()
+	path := SecurityRulesFile()
+	custom, _ := readSecurityRulesFile(path)
+	merged := mergeSecurityRules(builtinSecurityRules, custom)
+	builtin := make(map[string]struct{}, len(builtinSecurityRules))
+	for _, rule := range builtinSecurityRules {
+		builtin[rule.ID] = struct{}{}
+	}
+	for i := range merged {
+		_, merged[i].Builtin = builtin[merged[i].ID]
+	}
+	return merged
+}
+
+// SaveSecurityRules 校验并写入规则文件，随后立即生效
+func SaveSecurityRules(rules []SecurityRule) error {
+	if rules == nil {
+		rules = []SecurityRule{}
+	}
+	if err := ValidateSecurityRules(rules); err != nil {
+		return err
+	}
+	for i := range rules {
+		rules[i].Builtin = false
+	}
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(SecurityRulesFile(), data); err != nil {
+		return fmt.Errorf("写入规则文件失败: %w", err)
+	}
+	InitSecurityRules()
+	return nil
+}
+
+// ValidateSecurityRules 校验规则文件内容，返回首个错误
+func ValidateSecurityRules(rules []SecurityRule) error {
+	seen := make(map[string]struct{}, len(rules))
+	for i, rule := range rules {
+		id := strings.TrimSpace(rule.ID)
+		if id == "" {
+			return fmt.Errorf("第 %d 条规则缺少 id", i+1)
+		}
+		if _, ok := seen[id]; ok {
+			return fmt.Errorf("规则 id 重复: %s", id)
+		}
+		seen[id] = struct{}{}
+		if rule.Disabled && rule.Pattern == "" {
+			// 仅用于禁用内置规则
+			continue
+		}
+		if strings.TrimSpace(rule.Type) == "" {
+			return fmt.Errorf("规则 %s 缺少 type", id)
+		}
+		switch rule.Target {
+		case "", SecurityTargetURL, SecurityTargetPath, SecurityTargetUserAgent:
+		default:
+			return fmt.Errorf("规则 %s 的 target 仅支持 url、path、user_agent", id)
+		}
+		if rule.Severity != "" && SeverityRank(rule.Severity) == 0 {
+			return fmt.Errorf("规则 %s 的 severity 仅支持 low、medium、high、critical", id)
+		}
+		if _, err := regexp.Compile("(?i)" + rule.Pattern); err != nil || rule.Pattern == "" {
+			return fmt.Errorf("规则 %s 的 pattern 无效: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// SeverityRank 严重级别排序值，未知级别为 0
+func SeverityRank(severity string) int {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case SeverityLow:
+		return 1
+	case SeverityMedium:
+		return 2
+	case SeverityHigh:
+		return 3
+	case SeverityCritical:
+		return 4
+	}
+	return 0
+}
+
+// SecurityNotifyRank 写入系统通知所需的最低严重级别，0 表示不通知
+func SecurityNotifyRank() int {
+	cfg := config.ReadConfig()
+	value := SeverityHigh
+	if cfg.Security != nil && strings.TrimSpace(cfg.Security.NotifySeverity) != "" {
+		value = cfg.Security.NotifySeverity
+	}
+	return SeverityRank(value)
+}
+
+// DetectAttack 按 URL（已解码的路径与查询）与 User-Agent 匹配攻击特征，
+// 多条命中时取严重级别最高的一条（同级取规则顺序靠前的）。
+func DetectAttack(rawURL, userAgent string) (SecurityMatch, bool) {
+	securityRulesMu.RLock()
+	rules := securityRules
+	disabled := securityDisabled
+	securityRulesMu.RUnlock()
+	if disabled || len(rules) == 0 {
+		return SecurityMatch{}, false
+	}
+
+	target := securityMatchTarget(rawURL)
+	path := target
+	if idx := strings.IndexByte(path, '?'); idx >= 0 {
+		path = path[:idx]
+	}
+	ua := strings.ToLower(userAgent)
+
+	var best *compiledSecurityRule
+	for i := range rules {
+		rule := &rules[i]
+		if best != nil && rule.rank <= best.rank {
+			continue
+		}
+		var value string
+		switch rule.Target {
+		case SecurityTargetPath:
+			value = path
+		case SecurityTargetUserAgent:
+			value = ua
+		default:
+			value = target
+		}
+		if value == "" || !containsAnyKeyword(value, rule.Keywords) {
+			continue
+		}
+		if rule.pattern.MatchString(value) {
+			best = rule
+		}
+	}
+	if best == nil {
+		return SecurityMatch{}, false
+	}
+	return SecurityMatch{Type: best.Type, RuleID: best.ID, Severity: best.Severity}, true
+}
+
+// securityMatchTarget 转小写并再解码一次，识别二次编码的载荷
+func securityMatchTarget(rawURL string) string {
+	value := strings.ToLower(rawURL)
+	if strings.Contains(value, "%") {
+		if decoded, err := url.PathUnescape(value); err == nil {
+			value = decoded
+		}
+	}
+	return strings.ReplaceAll(value, "+", " ")
+}
+
+func containsAnyKeyword(value string, keywords []string) bool {
+	if len(keywords) == 0 {
+		return true
+	}
+	for _, keyword := range keywords {
+		if strings.Contains(value, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func readSecurityRulesFile(path string) ([]SecurityRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []SecurityRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	if err := ValidateSecurityRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// mergeSecurityRules 规则文件中同 id 的规则覆盖内置规则（仅写 disabled 时保留原规则并禁用），其余追加在后
+func mergeSecurityRules(builtin, custom []SecurityRule) []SecurityRule {
+	merged := make([]SecurityRule, len(builtin), len(builtin)+len(custom))
+	copy(merged, builtin)
+	index := make(map[string]int, len(merged))
+	for i, rule := range merged {
+		index[rule.ID] = i
+	}
+	for _, rule := range custom {
+		rule.ID = strings.TrimSpace(rule.ID)
+		if i, ok := index[rule.ID]; ok {
+			if rule.Pattern == "" {
+				merged[i].Disabled = rule.Disabled
+				continue
+			}
+			merged[i] = rule
+			continue
+		}
+		if rule.Pattern == "" {
+			continue
+		}
+		index[rule.ID] = len(merged)
+		merged = append(merged, rule)
+	}
+	return merged
+}
+
+func compileSecurityRules(rules []SecurityRule) []compiledSecurityRule {
+	compiled := make([]compiledSecurityRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		pattern, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			logrus.WithError(err).Warnf("攻击特征规则 %s 无效，已跳过", rule.ID)
+			continue
+		}
+		if rule.Target == "" {
+			rule.Target = SecurityTargetURL
+		}
+		if SeverityRank(rule.Severity) == 0 {
+			rule.Severity = SeverityMedium
+		}
+		rule.Severity = strings.ToLower(strings.TrimSpace(rule.Severity))
+		rule.Keywords = lowerTrimAll(rule.Keywords)
+		compiled = append(compiled, compiledSecurityRule{
+			SecurityRule: rule,
+			pattern:      pattern,
+			rank:         SeverityRank(rule.Severity),
+		})
+	}
+	return compiled
+}
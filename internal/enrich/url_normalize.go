@@ -0,0 +1,263 @@
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+const (
+	collapsedIDSegment   = "{id}"
+	collapsedUUIDSegment = "{uuid}"
+)
+
+var (
+	numericSegmentPattern = regexp.MustCompile(`^\d+$`)
+	uuidSegmentPattern    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// URLNormalizer 将原始 URL 归一化为用于分组统计的路由
+type URLNormalizer struct {
+	keepQuery    bool
+	keepParams   map[string]struct{}
+	stripParams  map[string]struct{}
+	autoCollapse bool
+	rules        []urlRewriteRule
+}
+
+type urlRewriteRule struct {
+	template []string
+	regex    *regexp.Regexp
+	replace  string
+}
+
+// NewURLNormalizer 根据站点配置构建归一化器，cfg 为空时使用默认规则（去除查询参数、折叠数字/UUID 段）
+func NewURLNormalizer(cfg *config.URLNormalizeConfig) (*URLNormalizer, error) {
+	normalizer := &URLNormalizer{autoCollapse: true}
+	if cfg == nil {
+		return normalizer, nil
+	}
+	normalizer.keepQuery = cfg.KeepQuery
+	normalizer.autoCollapse = !cfg.DisableAutoCollapse
+	normalizer.keepParams = toParamSet(cfg.KeepParams)
+	normalizer.stripParams = toParamSet(cfg.StripParams)
+	for i, rule := range cfg.Rules {
+		compiled, err := compileURLRewriteRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("urlNormalize.rules[%d]: %w", i, err)
+		}
+		normalizer.rules = append(normalizer.rules, compiled)
+	}
+	return normalizer, nil
+}
+
+func compileURLRewriteRule(rule config.URLRewriteRule) (urlRewriteRule, error) {
+	template := strings.TrimSpace(rule.Template)
+	pattern := strings.TrimSpace(rule.Regex)
+	switch {
+	case template != "" && pattern != "":
+		return urlRewriteRule{}, errors.New("template 与 regex 只能二选一")
+	case template != "":
+		if !strings.HasPrefix(template, "/") {
+			return urlRewriteRule{}, errors.New("template 必须以 / 开头")
+		}
+		return urlRewriteRule{template: splitPathSegments(template)}, nil
+	case pattern != "":
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return urlRewriteRule{}, fmt.Errorf("regex 无效: %w", err)
+		}
+		return urlRewriteRule{regex: compiled, replace: rule.Replace}, nil
+	default:
+		return urlRewriteRule{}, errors.New("template 或 regex 不能为空")
+	}
+}
+
+// Normalize 返回归一化后的路由：路径先按规则改写（未命中时折叠数字/UUID 段），再按配置保留查询参数。
+// rawURL 为日志中未解码的请求 URI，先按原始的 ? 与 # 拆分再解码，编码后的 %3F、%26 不会被误当作分隔符
+func (n *URLNormalizer) Normalize(rawURL string) string {
+	return n.normalize(rawURL, true)
+}
+
+// NormalizeDecoded 归一化已解码的 URL。库中只保存解码后的 URL，重建路由时使用；
+// 路径或参数值中本就含 ? 或 & 的 URL 无法还原，结果可能与入库时不同
+func (n *URLNormalizer) NormalizeDecoded(decodedURL string) string {
+	return n.normalize(decodedURL, false)
+}
+
+func (n *URLNormalizer) normalize(value string, decode bool) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	path, rawQuery := value, ""
+	if idx := strings.IndexByte(value, '?'); idx >= 0 {
+		path, rawQuery = value[:idx], value[idx+1:]
+	}
+	if idx := strings.IndexByte(path, '#'); idx >= 0 {
+		path = path[:idx]
+	}
+	if decode {
+		if unescaped, err := url.PathUnescape(path); err == nil {
+			path = unescaped
+		}
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	route, matched := n.rewritePath(path)
+	if !matched && n.autoCollapse {
+		route = collapsePathSegments(route)
+	}
+	if query := n.filterQuery(rawQuery, decode); query != "" {
+		route += "?" + query
+	}
+	return route
+}
+
+func (n *URLNormalizer) rewritePath(path string) (string, bool) {
+	for _, rule := range n.rules {
+		if rule.regex != nil {
+			if rule.regex.MatchString(path) {
+				return rule.regex.ReplaceAllString(path, rule.replace), true
+			}
+			continue
+		}
+		if matchPathTemplate(rule.template, splitPathSegments(path)) {
+			return "/" + strings.Join(rule.template, "/"), true
+		}
+	}
+	return path, false
+}
+
+func (n *URLNormalizer) filterQuery(rawQuery string, decode bool) string {
+	if rawQuery == "" {
+		return ""
+	}
+	if !n.keepQuery && len(n.keepParams) == 0 {
+		return ""
+	}
+	values := parseDecodedQuery(rawQuery)
+	if decode {
+		parsed, err := url.ParseQuery(rawQuery)
+		if err != nil && len(parsed) == 0 {
+			return ""
+		}
+		values = parsed
+	}
+	for key := range values {
+		lowerKey := strings.ToLower(key)
+		if n.keepQuery {
+			if _, strip := n.stripParams[lowerKey]; strip {
+				delete(values, key)
+			}
+			continue
+		}
+		if _, keep := n.keepParams[lowerKey]; !keep {
+			delete(values, key)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range values[key] {
+			if value == "" {
+				parts = append(parts, key)
+				continue
+			}
+			parts = append(parts, key+"="+value)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// parseDecodedQuery 按 & 与 = 拆分已解码的查询串，不再二次解码
+func parseDecodedQuery(query string) url.Values {
+	values := make(url.Values)
+	for _, part := range strings.Split(query, "&") {
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		values[key] = append(values[key], value)
+	}
+	return values
+}
+
+func matchPathTemplate(template, segments []string) bool {
+	for i, part := range template {
+		if part == "**" && i == len(template)-1 {
+			return len(segments) >= i
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if part == "*" || isTemplatePlaceholder(part) {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return len(template) == len(segments)
+}
+
+func isTemplatePlaceholder(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func collapsePathSegments(path string) string {
+	segments := strings.Split(path, "/")
+	changed := false
+	for i, segment := range segments {
+		switch {
+		case segment == "":
+			continue
+		case numericSegmentPattern.MatchString(segment):
+			segments[i] = collapsedIDSegment
+			changed = true
+		case uuidSegmentPattern.MatchString(segment):
+			segments[i] = collapsedUUIDSegment
+			changed = true
+		}
+	}
+	if !changed {
+		return path
+	}
+	return strings.Join(segments, "/")
+}
+
+func splitPathSegments(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+func toParamSet(params []string) map[string]struct{} {
+	if len(params) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(params))
+	for _, param := range params {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if param == "" {
+			continue
+		}
+		set[param] = struct{}{}
+	}
+	return set
+}
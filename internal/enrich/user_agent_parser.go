@@ -1,11 +1,25 @@
 package enrich
 
-import "github.com/mileusna/useragent"
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mileusna/useragent"
+)
 
 // ParseUserAgent 解析 User-Agent 字符串
 func ParseUserAgent(uaString string) (browser, os, device string) {
+	return userAgentLabels(useragent.Parse(uaString))
+}
+
+// ParseUserAgentWithDetail 一次解析同时返回分类标签与版本 / 设备明细
+func ParseUserAgentWithDetail(uaString string) (browser, os, device string, detail UserAgentDetail) {
 	userAgent := useragent.Parse(uaString)
+	browser, os, device = userAgentLabels(userAgent)
+	return browser, os, device, userAgentDetail(userAgent, uaString)
+}
 
+func userAgentLabels(userAgent useragent.UserAgent) (browser, os, device string) {
 	if userAgent.Bot {
 		return "蜘蛛", "蜘蛛", "蜘蛛"
 	}
@@ -32,3 +46,99 @@ func ParseUserAgent(uaString string) (browser, os, device string) {
 
 	return browser, os, device
 }
+
+// UserAgentDetail User-Agent 的版本与设备明细
+type UserAgentDetail struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	DeviceBrand    string
+	DeviceModel    string
+}
+
+// 设备型号前缀与品牌的对应关系（Android UA 通常只包含型号）
+var deviceBrandPrefixes = []struct {
+	prefix string
+	brand  string
+}{
+	{"iPhone", "Apple"},
+	{"iPad", "Apple"},
+	{"iPod", "Apple"},
+	{"SM-", "Samsung"},
+	{"Galaxy", "Samsung"},
+	{"Pixel", "Google"},
+	{"Nexus", "Google"},
+	{"Redmi", "Xiaomi"},
+	{"MI ", "Xiaomi"},
+	{"Mi ", "Xiaomi"},
+	{"POCO", "Xiaomi"},
+	{"M2", "Xiaomi"},
+	{"HUAWEI", "Huawei"},
+	{"HONOR", "Honor"},
+	{"OPPO", "OPPO"},
+	{"CPH", "OPPO"},
+	{"PCLM", "OPPO"},
+	{"PBEM", "OPPO"},
+	{"vivo", "vivo"},
+	{"V2", "vivo"},
+	{"RMX", "realme"},
+	{"ONEPLUS", "OnePlus"},
+	{"moto", "Motorola"},
+	{"LM-", "LG"},
+	{"Lenovo", "Lenovo"},
+	{"MEIZU", "Meizu"},
+	{"Nokia", "Nokia"},
+}
+
+// userAgentDetail 提取浏览器主版本、系统版本（主.次）与设备品牌/型号
+func userAgentDetail(userAgent useragent.UserAgent, uaString string) UserAgentDetail {
+	if userAgent.Bot {
+		return UserAgentDetail{Browser: userAgent.Name}
+	}
+
+	detail := UserAgentDetail{
+		Browser: userAgent.Name,
+		OS:      userAgent.OS,
+	}
+	// Android WebView 的 UA 与 Chrome 相同，仅多出 "; wv)" 标记
+	if userAgent.OS == useragent.Android && strings.Contains(uaString, "; wv)") {
+		detail.Browser = "Android WebView"
+	}
+	if userAgent.VersionNo.Major > 0 {
+		detail.BrowserVersion = strconv.Itoa(userAgent.VersionNo.Major)
+	}
+	detail.OSVersion = majorMinorVersion(userAgent.OSVersion)
+
+	model := strings.TrimSpace(userAgent.Device)
+	if model == "" && userAgent.OS == useragent.MacOS {
+		model = "Mac"
+	}
+	detail.DeviceModel = model
+	detail.DeviceBrand = deviceBrand(model)
+	return detail
+}
+
+func majorMinorVersion(version string) string {
+	version = strings.TrimSpace(version)
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return strings.Join(parts, ".")
+}
+
+func deviceBrand(model string) string {
+	if model == "" {
+		return ""
+	}
+	if model == "Mac" {
+		return "Apple"
+	}
+	for _, item := range deviceBrandPrefixes {
+		if strings.HasPrefix(model, item.prefix) {
+			return item.brand
+		}
+	}
+	return ""
+}
@@ -125,10 +125,11 @@ func (m *WhitelistMatcher) Match(ip string) (WhitelistMatch, bool) {
 	if !m.locationRules {
 		return WhitelistMatch{}, false
 	}
-	domestic, global, ok := getIPLocationLocalOnly(normalized)
+	loc, ok := getIPLocationLocalOnly(normalized)
 	if !ok {
 		return WhitelistMatch{}, false
 	}
+	domestic, global := loc.Domestic, loc.Global
 	if len(m.cities) > 0 {
 		normalizedDomestic := normalizeLocationMatch(domestic)
 		for _, city := range m.cities {
@@ -142,7 +143,7 @@ func (m *WhitelistMatcher) Match(ip string) (WhitelistMatch, bool) {
 			}
 		}
 	}
-	if m.nonMainland && isNonMainland(domestic, global) {
+	if m.nonMainland && isNonMainland(loc) {
 		return WhitelistMatch{
 			RuleType:  "non_mainland",
 			RuleValue: "非大陆",
@@ -272,49 +273,10 @@ func trimLocationSuffix(value string) string {
 	return value
 }
 
-func isNonMainland(domestic, global string) bool {
-	global = strings.TrimSpace(global)
-	if global == "" || global == "未知" {
+// isNonMainland 按国家 / 地区代码判断是否为非大陆 IP，代码未知时不匹配
+func isNonMainland(loc IPLocation) bool {
+	if loc.CountryCode == "" {
 		return false
 	}
-	if !isChinaGlobal(global) {
-		return true
-	}
-	domestic = strings.TrimSpace(domestic)
-	if domestic == "" || domestic == "未知" {
-		return false
-	}
-	keywords := []string{
-		"香港",
-		"澳门",
-		"台湾",
-		"台北",
-		"台中",
-		"台南",
-		"高雄",
-		"新北",
-		"桃园",
-		"基隆",
-		"嘉义",
-		"新竹",
-		"屏东",
-	}
-	for _, key := range keywords {
-		if strings.Contains(domestic, key) {
-			return true
-		}
-	}
-	return false
-}
-
-func isChinaGlobal(value string) bool {
-	normalized := strings.TrimSpace(value)
-	if normalized == "" {
-		return false
-	}
-	if normalized == "中国" {
-		return true
-	}
-	normalized = strings.ToLower(normalized)
-	return normalized == "china" || normalized == "cn"
+	return !IsMainlandChina(loc.CountryCode, loc.RegionCode)
 }
@@ -0,0 +1,408 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+// 告警规则类型
+const (
+	AlertTypeStatusRatio = "status_ratio"
+	AlertTypePVDrop      = "pv_drop"
+	AlertTypeNewCountry  = "new_country"
+	AlertTypeURLStatus   = "url_status"
+)
+
+const (
+	maxAlertRuleNameLen = 100
+	maxAlertWindow      = 24 * time.Hour
+	maxAlertLookback    = 90 * 24 * time.Hour
+)
+
+var defaultAlertWindows = map[string]string{
+	AlertTypeStatusRatio: "5m",
+	AlertTypePVDrop:      "1h",
+	AlertTypeNewCountry:  "1h",
+	AlertTypeURLStatus:   "5m",
+}
+
+// NormalizeAlertRule 校验规则并补齐默认值，错误信息可直接返回给接口调用方
+func NormalizeAlertRule(rule *store.AlertRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.WebsiteID = strings.TrimSpace(rule.WebsiteID)
+	rule.Type = strings.TrimSpace(rule.Type)
+	if rule.Name == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	if len([]rune(rule.Name)) > maxAlertRuleNameLen {
+		return fmt.Errorf("规则名称不能超过 %d 个字符", maxAlertRuleNameLen)
+	}
+	if _, ok := config.GetWebsiteByID(rule.WebsiteID); !ok {
+		return fmt.Errorf("站点不存在")
+	}
+	defaultWindow, ok := defaultAlertWindows[rule.Type]
+	if !ok {
+		return fmt.Errorf("不支持的规则类型: %s", rule.Type)
+	}
+
+	params := make(map[string]string, len(rule.Params))
+	for key, value := range rule.Params {
+		if value = strings.TrimSpace(value); value != "" {
+			params[strings.TrimSpace(key)] = value
+		}
+	}
+	rule.Params = params
+
+	rule.Window = strings.TrimSpace(rule.Window)
+	if rule.Window == "" {
+		rule.Window = defaultWindow
+	}
+	window, err := time.ParseDuration(rule.Window)
+	if err != nil || window < time.Minute || window > maxAlertWindow {
+		return fmt.Errorf("window 格式错误，范围 1m ~ 24h")
+	}
+	rule.For = strings.TrimSpace(rule.For)
+	if rule.For != "" {
+		forDuration, err := time.ParseDuration(rule.For)
+		if err != nil || forDuration < 0 || forDuration > maxAlertWindow {
+			return fmt.Errorf("for 格式错误，范围 0 ~ 24h")
+		}
+	}
+	rule.Severity = strings.TrimSpace(rule.Severity)
+	if rule.Severity == "" {
+		rule.Severity = "warning"
+	}
+	if rule.Severity != "info" && rule.Severity != "warning" {
+		return fmt.Errorf("severity 仅支持 info、warning")
+	}
+	if rule.Threshold < 0 {
+		return fmt.Errorf("threshold 不能为负数")
+	}
+
+	switch rule.Type {
+	case AlertTypeStatusRatio:
+		if rule.Threshold > 100 {
+			return fmt.Errorf("threshold 为百分比，不能超过 100")
+		}
+		if _, _, err := parseAlertStatus(alertParam(params, "status", "5xx")); err != nil {
+			return err
+		}
+		if _, err := alertIntParam(params, "minRequests", 20); err != nil {
+			return err
+		}
+	case AlertTypePVDrop:
+		if rule.Threshold > 100 {
+			return fmt.Errorf("threshold 为百分比，不能超过 100")
+		}
+		if _, err := alertIntParam(params, "minPV", 100); err != nil {
+			return err
+		}
+		if offset, err := alertDurationParam(params, "offset", 7*24*time.Hour); err != nil || offset < window {
+			return fmt.Errorf("offset 格式错误，且不能小于 window")
+		}
+	case AlertTypeNewCountry:
+		lookback, err := alertDurationParam(params, "lookback", 7*24*time.Hour)
+		if err != nil || lookback <= window || lookback > maxAlertLookback {
+			return fmt.Errorf("lookback 格式错误，需大于 window 且不超过 90 天")
+		}
+		if _, err := alertIntParam(params, "minRequests", 1); err != nil {
+			return err
+		}
+	case AlertTypeURLStatus:
+		if alertParam(params, "url", "") == "" {
+			return fmt.Errorf("url 不能为空")
+		}
+		if _, _, err := parseAlertStatus(alertParam(params, "status", "404")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EvaluateAlertRules 评估所有启用的告警规则，状态变化写入历史，进入 firing / resolved 时写入系统通知
+func (p *LogParser) EvaluateAlertRules() int {
+	rules, err := p.repo.ListAlertRules("")
+	if err != nil {
+		logrus.WithError(err).Warn("读取告警规则失败")
+		return 0
+	}
+	now := time.Now()
+	fired := 0
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		website, ok := config.GetWebsiteByID(rule.WebsiteID)
+		if !ok {
+			continue
+		}
+		value, breached, message, err := p.measureAlertRule(rule, now)
+		if err != nil {
+			logrus.WithError(err).Warnf("评估告警规则 %s (%d) 失败", rule.Name, rule.ID)
+			continue
+		}
+		if p.applyAlertResult(rule, website.Name, value, breached, message, now) {
+			fired++
+		}
+	}
+	return fired
+}
+
+// applyAlertResult 推进状态机并保存，返回是否新进入 firing
+func (p *LogParser) applyAlertResult(
+	rule store.AlertRule, siteName string, value float64, breached bool, message string, now time.Time,
+) bool {
+	var forDuration time.Duration
+	if rule.For != "" {
+		forDuration, _ = time.ParseDuration(rule.For)
+	}
+
+	previous := rule.State
+	next := nextAlertState(rule, breached, forDuration, now)
+	rule.LastValue = value
+	rule.LastMessage = message
+	if next != previous {
+		rule.State = next
+		since := now
+		rule.StateSince = &since
+	}
+
+	var event *store.AlertEvent
+	if next != previous && next != store.AlertStateInactive {
+		event = &store.AlertEvent{
+			RuleID:    rule.ID,
+			WebsiteID: rule.WebsiteID,
+			RuleName:  rule.Name,
+			State:     next,
+			Value:     value,
+			Threshold: rule.Threshold,
+			Message:   message,
+		}
+	}
+	saved, err := p.repo.SaveAlertRuleState(rule, event)
+	if err != nil {
+		logrus.WithError(err).Warnf("保存告警规则 %s (%d) 状态失败", rule.Name, rule.ID)
+		return false
+	}
+	if !saved || next == previous {
+		return false
+	}
+
+	switch next {
+	case store.AlertStateFiring:
+		p.notifyAlert(rule, siteName, false)
+		return true
+	case store.AlertStateResolved:
+		p.notifyAlert(rule, siteName, true)
+	}
+	return false
+}
+
+// nextAlertState pending 持续 for 时长后进入 firing；条件不再满足时 firing 转为 resolved，pending 回到 inactive
+func nextAlertState(rule store.AlertRule, breached bool, forDuration time.Duration, now time.Time) string {
+	state := rule.State
+	if !breached {
+		switch state {
+		case store.AlertStateFiring:
+			return store.AlertStateResolved
+		case store.AlertStatePending:
+			return store.AlertStateInactive
+		case "":
+			return store.AlertStateInactive
+		}
+		return state
+	}
+	switch state {
+	case store.AlertStateFiring:
+		return state
+	case store.AlertStatePending:
+		if rule.StateSince == nil || now.Sub(*rule.StateSince) >= forDuration {
+			return store.AlertStateFiring
+		}
+		return state
+	}
+	if forDuration <= 0 {
+		return store.AlertStateFiring
+	}
+	return store.AlertStatePending
+}
+
+// notifyAlert 触发与恢复使用不同指纹，重复触发时累计次数并重新标记为未读
+func (p *LogParser) notifyAlert(rule store.AlertRule, siteName string, resolved bool) {
+	level, title := rule.Severity, "告警触发"
+	fingerprint := fmt.Sprintf("alert:%d", rule.ID)
+	if resolved {
+		level, title = "info", "告警恢复"
+		fingerprint += ":resolved"
+	}
+	entry := store.SystemNotification{
+		Level:       level,
+		Category:    "alert",
+		Title:       fmt.Sprintf("%s: %s", title, rule.Name),
+		Message:     fmt.Sprintf("站点 %s: %s", siteName, rule.LastMessage),
+		Fingerprint: fingerprint,
+		Metadata: map[string]interface{}{
+			"website_id":   rule.WebsiteID,
+			"website_name": siteName,
+			"rule_id":      rule.ID,
+			"rule_type":    rule.Type,
+			"state":        rule.State,
+			"value":        rule.LastValue,
+			"threshold":    rule.Threshold,
+		},
+	}
+	if _, err := p.repo.CreateSystemNotificationWithCount(entry, 1); err != nil {
+		logrus.WithError(err).Warn("写入告警通知失败")
+	}
+}
+
+// measureAlertRule 计算规则当前值，返回值、是否超过阈值与说明
+func (p *LogParser) measureAlertRule(rule store.AlertRule, now time.Time) (float64, bool, string, error) {
+	window, err := time.ParseDuration(rule.Window)
+	if err != nil || window <= 0 {
+		return 0, false, "", fmt.Errorf("window 无效: %s", rule.Window)
+	}
+	end := now.Unix()
+	start := now.Add(-window).Unix()
+	threshold := formatAlertNumber(rule.Threshold)
+
+	switch rule.Type {
+	case AlertTypeStatusRatio:
+		status := alertParam(rule.Params, "status", "5xx")
+		minStatus, maxStatus, err := parseAlertStatus(status)
+		if err != nil {
+			return 0, false, "", err
+		}
+		minRequests, _ := alertIntParam(rule.Params, "minRequests", 20)
+		total, matched, err := p.repo.AlertStatusRatio(rule.WebsiteID, start, end, minStatus, maxStatus)
+		if err != nil {
+			return 0, false, "", err
+		}
+		if total < int64(minRequests) {
+			return 0, false, fmt.Sprintf("近 %s 内仅 %d 次请求，样本不足 %d", rule.Window, total, minRequests), nil
+		}
+		ratio := float64(matched) * 100 / float64(total)
+		return ratio, ratio > rule.Threshold, fmt.Sprintf("近 %s 内 %s 占比 %s%%（%d/%d 次请求），阈值 %s%%",
+			rule.Window, status, formatAlertNumber(ratio), matched, total, threshold), nil
+
+	case AlertTypePVDrop:
+		minPV, _ := alertIntParam(rule.Params, "minPV", 100)
+		offset, _ := alertDurationParam(rule.Params, "offset", 7*24*time.Hour)
+		current, err := p.repo.AlertPageviews(rule.WebsiteID, start, end)
+		if err != nil {
+			return 0, false, "", err
+		}
+		baseline, err := p.repo.AlertPageviews(rule.WebsiteID, start-int64(offset.Seconds()), end-int64(offset.Seconds()))
+		if err != nil {
+			return 0, false, "", err
+		}
+		if baseline < int64(minPV) {
+			return 0, false, fmt.Sprintf("%s 前同期 PV %d，样本不足 %d", offset, baseline, minPV), nil
+		}
+		drop := float64(baseline-current) * 100 / float64(baseline)
+		return drop, drop > rule.Threshold, fmt.Sprintf("近 %s PV %d，较 %s 前同期 %d 下降 %s%%，阈值 %s%%",
+			rule.Window, current, offset, baseline, formatAlertNumber(drop), threshold), nil
+
+	case AlertTypeNewCountry:
+		lookback, _ := alertDurationParam(rule.Params, "lookback", 7*24*time.Hour)
+		minRequests, _ := alertIntParam(rule.Params, "minRequests", 1)
+		countries, err := p.repo.AlertNewCountries(rule.WebsiteID, now.Add(-lookback).Unix(), start, end)
+		if err != nil {
+			return 0, false, "", err
+		}
+		codes := make([]string, 0, len(countries))
+		for code, count := range countries {
+			if count >= int64(minRequests) {
+				codes = append(codes, code)
+			}
+		}
+		sort.Slice(codes, func(i, j int) bool {
+			if countries[codes[i]] != countries[codes[j]] {
+				return countries[codes[i]] > countries[codes[j]]
+			}
+			return codes[i] < codes[j]
+		})
+		if len(codes) == 0 {
+			return 0, false, fmt.Sprintf("近 %s 内没有新出现的国家/地区", rule.Window), nil
+		}
+		labels := make([]string, 0, len(codes))
+		for _, code := range codes {
+			labels = append(labels, fmt.Sprintf("%s(%d)", code, countries[code]))
+		}
+		value := float64(len(codes))
+		return value, value > rule.Threshold, fmt.Sprintf("近 %s 内出现 %s 内未出现过的国家/地区: %s",
+			rule.Window, lookback, strings.Join(labels, "、")), nil
+
+	case AlertTypeURLStatus:
+		url := alertParam(rule.Params, "url", "")
+		prefix := strings.HasSuffix(url, "*")
+		status := alertParam(rule.Params, "status", "404")
+		minStatus, maxStatus, err := parseAlertStatus(status)
+		if err != nil {
+			return 0, false, "", err
+		}
+		count, err := p.repo.AlertURLStatusCount(rule.WebsiteID, strings.TrimSuffix(url, "*"), prefix,
+			start, end, minStatus, maxStatus)
+		if err != nil {
+			return 0, false, "", err
+		}
+		value := float64(count)
+		return value, value > rule.Threshold, fmt.Sprintf("近 %s 内 %s 返回 %s 共 %d 次，阈值 %s",
+			rule.Window, url, status, count, threshold), nil
+	}
+	return 0, false, "", fmt.Errorf("不支持的规则类型: %s", rule.Type)
+}
+
+func alertParam(params map[string]string, key, fallback string) string {
+	if value := strings.TrimSpace(params[key]); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func alertIntParam(params map[string]string, key string, fallback int) (int, error) {
+	raw := alertParam(params, key, "")
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s 必须为非负整数", key)
+	}
+	return value, nil
+}
+
+func alertDurationParam(params map[string]string, key string, fallback time.Duration) (time.Duration, error) {
+	raw := alertParam(params, key, "")
+	if raw == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+// parseAlertStatus 解析状态码条件：具体状态码（404）或状态码类别（4xx / 5xx）
+func parseAlertStatus(raw string) (int, int, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if len(raw) == 3 && strings.HasSuffix(raw, "xx") && raw[0] >= '1' && raw[0] <= '5' {
+		base := int(raw[0]-'0') * 100
+		return base, base + 99, nil
+	}
+	code, err := strconv.Atoi(raw)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("status 格式错误，例如 404 或 5xx")
+	}
+	return code, code, nil
+}
+
+// formatAlertNumber 保留两位小数并去掉末尾的 0
+func formatAlertNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
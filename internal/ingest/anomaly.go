@@ -0,0 +1,381 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+// 异常检测指标
+const (
+	AnomalyMetricPV    = "pv"
+	AnomalyMetricUV    = "uv"
+	AnomalyMetric4xx   = "4xx"
+	AnomalyMetric5xx   = "5xx"
+	AnomalyMetricBytes = "bytes"
+)
+
+// 异常方向
+const (
+	AnomalySpike = "spike"
+	AnomalyDrop  = "drop"
+)
+
+const (
+	defaultAnomalyWeeks     = 4
+	maxAnomalyWeeks         = 12
+	defaultAnomalyThreshold = 4.0
+	// 至少需要的历史同期样本数，不足时不打分
+	minAnomalySamples = 2
+	// 整点后等待该时长再检测上一小时，避免日志尚未扫描完整
+	anomalySettleDelay = 5 * time.Minute
+	// MAD 换算为标准差的系数（正态分布）
+	madScale = 1.4826
+)
+
+// AnomalyMetrics 全部可检测指标
+var AnomalyMetrics = []string{
+	AnomalyMetricPV, AnomalyMetricUV, AnomalyMetric4xx, AnomalyMetric5xx, AnomalyMetricBytes,
+}
+
+type anomalyMetricSpec struct {
+	label string
+	value func(store.HourlyMetrics) int64
+	// minVolume 当前值与基线都低于该值时不判断，避免低流量时段的噪声
+	minVolume float64
+	// drop 是否检测下降（错误数下降不算异常）
+	drop bool
+}
+
+var anomalyMetricSpecs = map[string]anomalyMetricSpec{
+	AnomalyMetricPV: {
+		label: "PV", value: func(m store.HourlyMetrics) int64 { return m.PV }, minVolume: 20, drop: true,
+	},
+	AnomalyMetricUV: {
+		label: "UV", value: func(m store.HourlyMetrics) int64 { return m.UV }, minVolume: 10, drop: true,
+	},
+	AnomalyMetric4xx: {
+		label: "4xx", value: func(m store.HourlyMetrics) int64 { return m.S4xx }, minVolume: 20,
+	},
+	AnomalyMetric5xx: {
+		label: "5xx", value: func(m store.HourlyMetrics) int64 { return m.S5xx }, minVolume: 10,
+	},
+	AnomalyMetricBytes: {
+		label: "流量", value: func(m store.HourlyMetrics) int64 { return m.Traffic }, minVolume: 1 << 20, drop: true,
+	},
+}
+
+// AnomalyOptions 异常检测参数，零值使用默认值
+type AnomalyOptions struct {
+	Weeks     int
+	Threshold float64
+	Metrics   []string
+}
+
+// AnomalyPoint 单个小时的检测结果
+type AnomalyPoint struct {
+	Bucket   int64   `json:"bucket"`
+	Value    float64 `json:"value"`
+	Expected float64 `json:"expected"`
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+	Score    float64 `json:"score"`
+	Samples  int     `json:"samples"`
+	// Anomaly 为 spike / drop，正常时为空
+	Anomaly string `json:"anomaly,omitempty"`
+}
+
+// AnomalySeries 单个指标的逐小时检测结果
+type AnomalySeries struct {
+	Metric string         `json:"metric"`
+	Points []AnomalyPoint `json:"points"`
+}
+
+// AnomalyInterval 连续异常的小时合并后的区间，End 不含
+type AnomalyInterval struct {
+	Metric    string  `json:"metric"`
+	Direction string  `json:"direction"`
+	Start     int64   `json:"start"`
+	End       int64   `json:"end"`
+	Hours     int     `json:"hours"`
+	PeakScore float64 `json:"peakScore"`
+	// Value / Expected 为分数绝对值最大的那个小时的实际值与基线
+	Value    float64 `json:"value"`
+	Expected float64 `json:"expected"`
+}
+
+// AnomalyReport 检测结果
+type AnomalyReport struct {
+	Weeks     int               `json:"weeks"`
+	Threshold float64           `json:"threshold"`
+	Series    []AnomalySeries   `json:"series"`
+	Intervals []AnomalyInterval `json:"intervals"`
+}
+
+// AnomalyOptionsFromConfig 返回 anomaly 配置对应的检测参数
+func AnomalyOptionsFromConfig() AnomalyOptions {
+	cfg := config.ReadConfig().Anomaly
+	if cfg == nil {
+		return AnomalyOptions{}
+	}
+	return AnomalyOptions{Weeks: cfg.Weeks, Threshold: cfg.Threshold, Metrics: cfg.Metrics}
+}
+
+// normalize 填充默认值并校验指标
+func (o AnomalyOptions) normalize() (AnomalyOptions, error) {
+	if o.Weeks <= 0 {
+		o.Weeks = defaultAnomalyWeeks
+	}
+	if o.Weeks > maxAnomalyWeeks {
+		o.Weeks = maxAnomalyWeeks
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = defaultAnomalyThreshold
+	}
+	if len(o.Metrics) == 0 {
+		o.Metrics = AnomalyMetrics
+		return o, nil
+	}
+	metrics := make([]string, 0, len(o.Metrics))
+	seen := make(map[string]struct{}, len(o.Metrics))
+	for _, metric := range o.Metrics {
+		metric = strings.ToLower(strings.TrimSpace(metric))
+		if _, ok := anomalyMetricSpecs[metric]; !ok {
+			return o, fmt.Errorf("不支持的指标: %s", metric)
+		}
+		if _, ok := seen[metric]; ok {
+			continue
+		}
+		seen[metric] = struct{}{}
+		metrics = append(metrics, metric)
+	}
+	o.Metrics = metrics
+	return o, nil
+}
+
+// DetectAnomalies 对 [start, end) 内已结束的整点小时逐一与历史同一周内小时的基线比较。
+// 基线为最近 Weeks 周同期值的中位数，离散度取 MAD，分数为 (实际 - 基线) / 离散度
+func DetectAnomalies(repo *store.Repository, websiteID string, start, end int64, opts AnomalyOptions) (AnomalyReport, error) {
+	opts, err := opts.normalize()
+	if err != nil {
+		return AnomalyReport{}, err
+	}
+	report := AnomalyReport{
+		Weeks:     opts.Weeks,
+		Threshold: opts.Threshold,
+		Series:    make([]AnomalySeries, 0, len(opts.Metrics)),
+		Intervals: make([]AnomalyInterval, 0),
+	}
+
+	start = hourFloor(start)
+	end = hourFloor(end)
+	if current := hourFloor(time.Now().Unix()); end > current {
+		end = current
+	}
+	if end <= start {
+		for _, metric := range opts.Metrics {
+			report.Series = append(report.Series, AnomalySeries{Metric: metric, Points: make([]AnomalyPoint, 0)})
+		}
+		return report, nil
+	}
+
+	firstBucket, err := repo.FirstHourlyBucket(websiteID)
+	if err != nil {
+		return report, fmt.Errorf("查询最早聚合数据失败: %w", err)
+	}
+	// 多取 2 小时以覆盖夏令时切换
+	historyStart := time.Unix(start, 0).AddDate(0, 0, -7*opts.Weeks).Unix() - 2*3600
+	rows, err := repo.HourlyMetricsRange(websiteID, historyStart, end)
+	if err != nil {
+		return report, fmt.Errorf("查询小时聚合数据失败: %w", err)
+	}
+	byBucket := make(map[int64]store.HourlyMetrics, len(rows))
+	for _, row := range rows {
+		byBucket[row.Bucket] = row
+	}
+
+	buckets := make([]int64, 0, (end-start)/3600)
+	for bucket := start; bucket < end; bucket += 3600 {
+		buckets = append(buckets, bucket)
+	}
+
+	for _, metric := range opts.Metrics {
+		spec := anomalyMetricSpecs[metric]
+		series := AnomalySeries{Metric: metric, Points: make([]AnomalyPoint, 0, len(buckets))}
+		for _, bucket := range buckets {
+			point := AnomalyPoint{Bucket: bucket, Value: float64(spec.value(byBucket[bucket]))}
+			if firstBucket == 0 || bucket < firstBucket {
+				series.Points = append(series.Points, point)
+				continue
+			}
+			samples := make([]float64, 0, opts.Weeks)
+			for week := 1; week <= opts.Weeks; week++ {
+				sampleBucket := hourFloor(time.Unix(bucket, 0).AddDate(0, 0, -7*week).Unix())
+				if sampleBucket < firstBucket {
+					break
+				}
+				samples = append(samples, float64(spec.value(byBucket[sampleBucket])))
+			}
+			point.Samples = len(samples)
+			if len(samples) >= minAnomalySamples {
+				scoreAnomalyPoint(&point, samples, spec, opts.Threshold)
+			}
+			series.Points = append(series.Points, point)
+		}
+		report.Series = append(report.Series, series)
+		report.Intervals = append(report.Intervals, mergeAnomalyIntervals(metric, series.Points)...)
+	}
+	sort.SliceStable(report.Intervals, func(i, j int) bool {
+		return report.Intervals[i].Start < report.Intervals[j].Start
+	})
+	return report, nil
+}
+
+// scoreAnomalyPoint 计算基线、上下界与分数；离散度至少取基线的 10% 与泊松噪声 sqrt(基线)
+func scoreAnomalyPoint(point *AnomalyPoint, samples []float64, spec anomalyMetricSpec, threshold float64) {
+	expected := median(samples)
+	deviations := make([]float64, len(samples))
+	for i, sample := range samples {
+		deviations[i] = math.Abs(sample - expected)
+	}
+	scale := math.Max(madScale*median(deviations), math.Max(0.1*expected, math.Sqrt(expected)))
+	if scale < 1 {
+		scale = 1
+	}
+
+	point.Expected = roundScore(expected)
+	point.Lower = roundScore(math.Max(0, expected-threshold*scale))
+	point.Upper = roundScore(expected + threshold*scale)
+	point.Score = roundScore((point.Value - expected) / scale)
+	if math.Max(point.Value, expected) < spec.minVolume {
+		return
+	}
+	switch {
+	case point.Score >= threshold:
+		point.Anomaly = AnomalySpike
+	case spec.drop && (point.Score <= -threshold || (point.Value == 0 && expected >= spec.minVolume)):
+		// 基线有量而实际为 0 视为中断，即使历史波动较大
+		point.Anomaly = AnomalyDrop
+	}
+}
+
+func mergeAnomalyIntervals(metric string, points []AnomalyPoint) []AnomalyInterval {
+	intervals := make([]AnomalyInterval, 0)
+	var current *AnomalyInterval
+	for _, point := range points {
+		if point.Anomaly == "" {
+			current = nil
+			continue
+		}
+		if current != nil && current.Direction == point.Anomaly && current.End == point.Bucket {
+			current.End += 3600
+			current.Hours++
+		} else {
+			intervals = append(intervals, AnomalyInterval{
+				Metric: metric, Direction: point.Anomaly, Start: point.Bucket, End: point.Bucket + 3600, Hours: 1,
+			})
+			current = &intervals[len(intervals)-1]
+		}
+		if math.Abs(point.Score) > math.Abs(current.PeakScore) {
+			current.PeakScore = point.Score
+			current.Value = point.Value
+			current.Expected = point.Expected
+		}
+	}
+	return intervals
+}
+
+// EvaluateAnomalies 检测各站点上一个已结束的小时，异常时写入系统通知；每个小时只检测一次。
+// 返回发现的异常数
+func (p *LogParser) EvaluateAnomalies() int {
+	if cfg := config.ReadConfig().Anomaly; cfg != nil && cfg.Disabled {
+		return 0
+	}
+	opts := AnomalyOptionsFromConfig()
+	bucket := hourFloor(time.Now().Add(-anomalySettleDelay).Unix()) - 3600
+
+	p.anomalyMu.Lock()
+	defer p.anomalyMu.Unlock()
+	if p.anomalyChecked == nil {
+		p.anomalyChecked = make(map[string]int64)
+	}
+
+	found := 0
+	for _, websiteID := range config.GetAllWebsiteIDs() {
+		if p.anomalyChecked[websiteID] >= bucket {
+			continue
+		}
+		report, err := DetectAnomalies(p.repo, websiteID, bucket, bucket+3600, opts)
+		if err != nil {
+			logrus.WithError(err).Warnf("检测网站 %s 的流量异常失败", websiteID)
+			continue
+		}
+		p.anomalyChecked[websiteID] = bucket
+		for _, interval := range report.Intervals {
+			p.notifyAnomaly(websiteID, interval)
+			found++
+		}
+	}
+	return found
+}
+
+func (p *LogParser) notifyAnomaly(websiteID string, interval AnomalyInterval) {
+	spec := anomalyMetricSpecs[interval.Metric]
+	siteName := websiteID
+	if site, ok := config.GetWebsiteByID(websiteID); ok {
+		siteName = site.Name
+	}
+	direction := "骤增"
+	if interval.Direction == AnomalyDrop {
+		direction = "骤降"
+	}
+	title := fmt.Sprintf("流量异常: %s %s", spec.label, direction)
+	message := fmt.Sprintf("站点 %s 在 %s 的 %s 为 %s，历史同期基线 %s，异常分数 %s",
+		siteName,
+		time.Unix(interval.Start, 0).Format("2006-01-02 15:00"),
+		spec.label,
+		formatAlertNumber(interval.Value),
+		formatAlertNumber(interval.Expected),
+		formatAlertNumber(interval.PeakScore),
+	)
+	p.notifySystem("warning", "anomaly", title, message,
+		fmt.Sprintf("anomaly:%s:%s:%s", websiteID, interval.Metric, interval.Direction),
+		map[string]interface{}{
+			"website_id":   websiteID,
+			"website_name": siteName,
+			"metric":       interval.Metric,
+			"direction":    interval.Direction,
+			"bucket":       interval.Start,
+			"value":        interval.Value,
+			"expected":     interval.Expected,
+			"score":        interval.PeakScore,
+		},
+	)
+}
+
+func hourFloor(ts int64) int64 {
+	return (ts / 3600) * 3600
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+func roundScore(value float64) float64 {
+	return math.Round(value*100) / 100
+}
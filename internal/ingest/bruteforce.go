@@ -0,0 +1,466 @@
+package ingest
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	bruteForceKindLogin       = "login"
+	bruteForceKindAuthFailure = "auth_failure"
+	bruteForceScopeIP         = "ip"
+	bruteForceScopeSubnet     = "subnet"
+
+	// 超过该时长的事件只入库不发通知（例如首次导入历史日志）
+	bruteForceNotifyMaxAge = 24 * time.Hour
+	// 网段事件最多记录的不同 IP 数，超出后 ip_count 不再增长
+	bruteForceMaxSubnetIPs = 4096
+	// 空闲窗口的清理间隔
+	bruteForcePruneInterval = time.Minute
+)
+
+var defaultBruteForceLoginPaths = []string{
+	"/login",
+	"/signin",
+	"/wp-login.php",
+	"/xmlrpc.php",
+	"/user/login",
+	"/admin/login",
+	"/auth/login",
+	"/api/login",
+	"/api/auth/login",
+}
+
+type bruteForceSettings struct {
+	window                 time.Duration
+	loginExact             map[string]struct{}
+	loginPrefixes          []string
+	loginThreshold         int
+	failureThreshold       int
+	subnetLoginThreshold   int
+	subnetFailureThreshold int
+	ipv4Bits               int
+	ipv6Bits               int
+}
+
+type bruteForceEvent struct {
+	ts     int64
+	status int
+}
+
+// bruteForceTracker 单个 站点/类型/范围/对象 的滑动窗口状态
+type bruteForceTracker struct {
+	websiteID string
+	kind      string
+	scope     string
+	subject   string
+	// events 窗口内的请求，长度不超过阈值
+	events []bruteForceEvent
+	// windowIPs 网段窗口内出现过的 IP 及最后出现时间
+	windowIPs map[string]int64
+	lastTs    int64
+
+	incident    *store.SecurityIncident
+	incidentIPs map[string]struct{}
+	notify      bool
+}
+
+// pendingIncident 待写入的事件快照
+type pendingIncident struct {
+	websiteID string
+	incident  *store.SecurityIncident
+	notify    bool
+}
+
+// bruteForceDetector 登录接口暴力破解 / 撞库检测，状态常驻内存，跨批次累计
+type bruteForceDetector struct {
+	mu       sync.Mutex
+	settings bruteForceSettings
+	trackers map[string]*bruteForceTracker
+	// dirty 有未写入变化的窗口；closed 已关闭但尚未写入的事件
+	dirty  map[string]*bruteForceTracker
+	closed []pendingIncident
+	// newest 各站点已观测到的最新日志时间，用于清理空闲窗口
+	newest    map[string]int64
+	lastPrune time.Time
+}
+
+func newBruteForceDetector(cfg *config.SecurityConfig) *bruteForceDetector {
+	var bf config.BruteForceConfig
+	if cfg != nil && cfg.BruteForce != nil {
+		bf = *cfg.BruteForce
+	}
+	if bf.Disabled {
+		return nil
+	}
+	settings := bruteForceSettings{
+		window:                 5 * time.Minute,
+		loginExact:             make(map[string]struct{}),
+		loginThreshold:         positiveOr(bf.LoginThreshold, 20),
+		failureThreshold:       positiveOr(bf.FailureThreshold, 50),
+		subnetLoginThreshold:   positiveOr(bf.SubnetLoginThreshold, 60),
+		subnetFailureThreshold: positiveOr(bf.SubnetFailureThreshold, 150),
+		ipv4Bits:               positiveOr(bf.IPv4Prefix, 24),
+		ipv6Bits:               positiveOr(bf.IPv6Prefix, 64),
+	}
+	if raw := strings.TrimSpace(bf.Window); raw != "" {
+		if window, err := time.ParseDuration(raw); err == nil && window > 0 {
+			settings.window = window
+		}
+	}
+	paths := bf.LoginPaths
+	if len(paths) == 0 {
+		paths = defaultBruteForceLoginPaths
+	}
+	for _, path := range paths {
+		path = strings.ToLower(strings.TrimSpace(path))
+		if path == "" {
+			continue
+		}
+		if strings.HasSuffix(path, "*") {
+			settings.loginPrefixes = append(settings.loginPrefixes, strings.TrimSuffix(path, "*"))
+			continue
+		}
+		settings.loginExact[path] = struct{}{}
+	}
+	return &bruteForceDetector{
+		settings: settings,
+		trackers: make(map[string]*bruteForceTracker),
+		dirty:    make(map[string]*bruteForceTracker),
+		newest:   make(map[string]int64),
+	}
+}
+
+func positiveOr(value, fallback int) int {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+func (s bruteForceSettings) isLoginPath(rawURL string) bool {
+	path := rawURL
+	if idx := strings.IndexAny(path, "?#"); idx >= 0 {
+		path = path[:idx]
+	}
+	path = strings.ToLower(path)
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if _, ok := s.loginExact[path]; ok {
+		return true
+	}
+	for _, prefix := range s.loginPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAuthFailureStatus(status int) bool {
+	return status == 401 || status == 403 || status == 429
+}
+
+func (s bruteForceSettings) subnetOf(ip string) string {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := s.ipv6Bits
+	if addr.Is4() {
+		bits = s.ipv4Bits
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+// Observe 统计已落库的记录，命中阈值时打开事件；需在批次写入成功后调用
+func (d *bruteForceDetector) Observe(websiteID string, records []store.NginxLogRecord) {
+	if d == nil || len(records) == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range records {
+		record := &records[i]
+		if record.IP == "" {
+			continue
+		}
+		ts := record.Timestamp.Unix()
+		if ts > d.newest[websiteID] {
+			d.newest[websiteID] = ts
+		}
+		if strings.EqualFold(record.Method, "POST") && d.settings.isLoginPath(record.Url) {
+			d.observe(websiteID, bruteForceKindLogin, record, ts,
+				d.settings.loginThreshold, d.settings.subnetLoginThreshold)
+		}
+		if isAuthFailureStatus(record.Status) {
+			d.observe(websiteID, bruteForceKindAuthFailure, record, ts,
+				d.settings.failureThreshold, d.settings.subnetFailureThreshold)
+		}
+	}
+}
+
+func (d *bruteForceDetector) observe(
+	websiteID, kind string,
+	record *store.NginxLogRecord,
+	ts int64,
+	ipThreshold, subnetThreshold int,
+) {
+	d.track(websiteID, kind, bruteForceScopeIP, record.IP, record, ts, ipThreshold)
+	if subnet := d.settings.subnetOf(record.IP); subnet != "" {
+		d.track(websiteID, kind, bruteForceScopeSubnet, subnet, record, ts, subnetThreshold)
+	}
+}
+
+func (d *bruteForceDetector) track(
+	websiteID, kind, scope, subject string,
+	record *store.NginxLogRecord,
+	ts int64,
+	threshold int,
+) {
+	key := websiteID + "|" + kind + "|" + scope + "|" + subject
+	tracker, ok := d.trackers[key]
+	if !ok {
+		tracker = &bruteForceTracker{
+			websiteID: websiteID,
+			kind:      kind,
+			scope:     scope,
+			subject:   subject,
+		}
+		d.trackers[key] = tracker
+	}
+	window := int64(d.settings.window / time.Second)
+	if ts > tracker.lastTs {
+		tracker.lastTs = ts
+	}
+
+	// 已打开的事件：间隔未超过窗口则继续累计，否则关闭后重新判定
+	if tracker.incident != nil {
+		if ts-tracker.incident.LastTs <= window {
+			tracker.absorb(record.IP, record.Status, ts)
+			d.dirty[key] = tracker
+			return
+		}
+		d.closeIncident(key, tracker)
+	}
+
+	cutoff := tracker.lastTs - window
+	events := tracker.events[:0]
+	for _, event := range tracker.events {
+		if event.ts > cutoff {
+			events = append(events, event)
+		}
+	}
+	events = append(events, bruteForceEvent{ts: ts, status: record.Status})
+	if len(events) > threshold {
+		events = events[len(events)-threshold:]
+	}
+	tracker.events = events
+
+	distinctIPs := 1
+	if scope == bruteForceScopeSubnet {
+		if tracker.windowIPs == nil {
+			tracker.windowIPs = make(map[string]int64)
+		}
+		if _, ok := tracker.windowIPs[record.IP]; ok || len(tracker.windowIPs) < bruteForceMaxSubnetIPs {
+			tracker.windowIPs[record.IP] = ts
+		}
+		for ip, seen := range tracker.windowIPs {
+			if seen <= cutoff {
+				delete(tracker.windowIPs, ip)
+			}
+		}
+		distinctIPs = len(tracker.windowIPs)
+	}
+	if len(events) < threshold {
+		return
+	}
+	// 网段事件至少需要 2 个不同 IP，单 IP 已由 ip 范围覆盖
+	if scope == bruteForceScopeSubnet && distinctIPs < 2 {
+		return
+	}
+	tracker.openIncident(record)
+	d.dirty[key] = tracker
+}
+
+// openIncident 以窗口内的请求作为事件起点
+func (t *bruteForceTracker) openIncident(record *store.NginxLogRecord) {
+	t.incident = &store.SecurityIncident{
+		Kind:         t.kind,
+		Scope:        t.scope,
+		Subject:      t.subject,
+		FirstTs:      t.events[0].ts,
+		LastTs:       t.events[0].ts,
+		IPCount:      1,
+		SampleURL:    record.Url,
+		StatusCounts: make(map[string]int),
+	}
+	if t.scope == bruteForceScopeSubnet {
+		t.incidentIPs = make(map[string]struct{}, len(t.windowIPs))
+		for ip := range t.windowIPs {
+			t.incidentIPs[ip] = struct{}{}
+		}
+	}
+	for _, event := range t.events {
+		t.absorb("", event.status, event.ts)
+	}
+	t.notify = true
+	t.events = t.events[:0]
+	t.windowIPs = nil
+}
+
+func (t *bruteForceTracker) absorb(ip string, status int, ts int64) {
+	incident := t.incident
+	incident.Requests++
+	if ts > incident.LastTs {
+		incident.LastTs = ts
+	}
+	if ts < incident.FirstTs {
+		incident.FirstTs = ts
+	}
+	incident.StatusCounts[strconv.Itoa(status)]++
+	if t.scope == bruteForceScopeSubnet {
+		if ip != "" && len(t.incidentIPs) < bruteForceMaxSubnetIPs {
+			t.incidentIPs[ip] = struct{}{}
+		}
+		incident.IPCount = len(t.incidentIPs)
+	}
+}
+
+// closeIncident 结束当前事件，未写入的变化留待下次 Flush
+func (d *bruteForceDetector) closeIncident(key string, tracker *bruteForceTracker) {
+	if _, ok := d.dirty[key]; ok {
+		d.closed = append(d.closed, pendingIncident{
+			websiteID: tracker.websiteID,
+			incident:  tracker.incident,
+			notify:    tracker.notify,
+		})
+		delete(d.dirty, key)
+	}
+	tracker.incident = nil
+	tracker.incidentIPs = nil
+	tracker.notify = false
+}
+
+// Flush 写入有变化的事件，新事件同时生成系统通知，并定期清理空闲窗口
+func (d *bruteForceDetector) Flush(p *LogParser) {
+	if d == nil || p == nil || p.repo == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	closed := d.closed[:0]
+	for _, pending := range d.closed {
+		if !d.save(p, pending.websiteID, pending.incident, pending.notify) {
+			closed = append(closed, pending)
+		}
+	}
+	d.closed = closed
+	for key, tracker := range d.dirty {
+		if d.save(p, tracker.websiteID, tracker.incident, tracker.notify) {
+			tracker.notify = false
+			delete(d.dirty, key)
+		}
+	}
+
+	if time.Since(d.lastPrune) < bruteForcePruneInterval {
+		return
+	}
+	d.lastPrune = time.Now()
+	window := int64(d.settings.window / time.Second)
+	for key, tracker := range d.trackers {
+		if _, ok := d.dirty[key]; ok {
+			continue
+		}
+		idleSince := tracker.lastTs
+		if tracker.incident != nil && tracker.incident.LastTs > idleSince {
+			idleSince = tracker.incident.LastTs
+		}
+		if idleSince+window < d.newest[tracker.websiteID] {
+			delete(d.trackers, key)
+		}
+	}
+}
+
+// save 写入事件，失败时保留以便下次重试
+func (d *bruteForceDetector) save(p *LogParser, websiteID string, incident *store.SecurityIncident, notify bool) bool {
+	if err := p.repo.SaveSecurityIncident(websiteID, incident); err != nil {
+		logrus.WithError(err).Warnf("写入网站 %s 的安全事件失败", websiteID)
+		return false
+	}
+	if notify && incident.LastTs >= time.Now().Add(-bruteForceNotifyMaxAge).Unix() {
+		p.notifyBruteForce(websiteID, incident)
+	}
+	return true
+}
+
+func (p *LogParser) notifyBruteForce(websiteID string, incident *store.SecurityIncident) {
+	siteName := ""
+	if site, ok := config.GetWebsiteByID(websiteID); ok {
+		siteName = site.Name
+	}
+	metadata := map[string]interface{}{
+		"website_id":  websiteID,
+		"incident_id": incident.ID,
+		"kind":        incident.Kind,
+		"scope":       incident.Scope,
+		"subject":     incident.Subject,
+		"requests":    incident.Requests,
+		"ip_count":    incident.IPCount,
+		"first_ts":    incident.FirstTs,
+		"last_ts":     incident.LastTs,
+		"sample_url":  incident.SampleURL,
+	}
+	if siteName != "" {
+		metadata["website_name"] = siteName
+	}
+	entry := store.SystemNotification{
+		Level:       "warning",
+		Category:    "security",
+		Title:       "暴力破解告警",
+		Message:     buildBruteForceMessage(siteName, incident),
+		Fingerprint: buildBruteForceFingerprint(websiteID, incident.Kind, incident.Scope, incident.Subject),
+		Metadata:    metadata,
+	}
+	if _, err := p.repo.CreateSystemNotificationWithCount(entry, 1); err != nil {
+		logrus.WithError(err).Warn("写入暴力破解告警通知失败")
+	}
+}
+
+func buildBruteForceFingerprint(websiteID, kind, scope, subject string) string {
+	return fmt.Sprintf("bruteforce:%s:%s:%s:%s",
+		strings.TrimSpace(websiteID), kind, scope, strings.TrimSpace(subject))
+}
+
+func buildBruteForceMessage(siteName string, incident *store.SecurityIncident) string {
+	subject := "IP " + incident.Subject
+	if incident.Scope == bruteForceScopeSubnet {
+		subject = fmt.Sprintf("网段 %s（%d 个 IP）", incident.Subject, incident.IPCount)
+	}
+	action := "登录接口 POST"
+	if incident.Kind == bruteForceKindAuthFailure {
+		action = "401/403/429 响应"
+	}
+	duration := time.Duration(incident.LastTs-incident.FirstTs) * time.Second
+	message := fmt.Sprintf("%s 在 %s 内产生 %d 次%s，疑似暴力破解或撞库: %s",
+		subject, duration, incident.Requests, action, truncateSecurityURL(incident.SampleURL))
+	if siteName != "" {
+		message = fmt.Sprintf("站点 %s · %s", siteName, message)
+	}
+	return message
+}
@@ -0,0 +1,97 @@
+package ingest
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/store"
+)
+
+// 常见点击 ID 对应的广告平台，未收录的参数以参数名作为来源
+var clickIDSources = map[string]string{
+	"gclid":     "google",
+	"gbraid":    "google",
+	"wbraid":    "google",
+	"dclid":     "google",
+	"fbclid":    "facebook",
+	"msclkid":   "bing",
+	"ttclid":    "tiktok",
+	"twclid":    "twitter",
+	"li_fat_id": "linkedin",
+	"yclid":     "yandex",
+}
+
+// resolveCampaignClickIDs 返回站点识别的点击 ID 参数（小写），未配置时使用默认列表
+func resolveCampaignClickIDs(website config.WebsiteConfig) []string {
+	names := website.CampaignClickIDs
+	if len(names) == 0 {
+		names = config.DefaultCampaignClickIDs
+	}
+	result := make([]string, 0, len(names))
+	for _, raw := range names {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		if name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// extractCampaign 从原始请求 URL 的查询参数中提取 utm_* 与点击 ID，均不存在时返回 nil。
+// 仅有点击 ID 时来源取对应平台、媒介默认为 cpc。
+func extractCampaign(rawURL string, clickIDParams []string) *store.CampaignInfo {
+	idx := strings.IndexByte(rawURL, '?')
+	if idx < 0 || idx == len(rawURL)-1 {
+		return nil
+	}
+	rawQuery := rawURL[idx+1:]
+	if hash := strings.IndexByte(rawQuery, '#'); hash >= 0 {
+		rawQuery = rawQuery[:hash]
+	}
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil && len(values) == 0 {
+		return nil
+	}
+
+	params := make(map[string]string, len(values))
+	for key, list := range values {
+		lowerKey := strings.ToLower(key)
+		if _, ok := params[lowerKey]; ok || len(list) == 0 {
+			continue
+		}
+		if value := strings.TrimSpace(list[0]); value != "" {
+			params[lowerKey] = value
+		}
+	}
+
+	campaign := store.CampaignInfo{
+		Source:  params["utm_source"],
+		Medium:  params["utm_medium"],
+		Name:    params["utm_campaign"],
+		Term:    params["utm_term"],
+		Content: params["utm_content"],
+	}
+	for _, name := range clickIDParams {
+		if _, ok := params[name]; ok {
+			campaign.ClickID = name
+			break
+		}
+	}
+
+	if campaign == (store.CampaignInfo{}) {
+		return nil
+	}
+	if campaign.ClickID != "" {
+		if campaign.Source == "" {
+			campaign.Source = campaign.ClickID
+			if source, ok := clickIDSources[campaign.ClickID]; ok {
+				campaign.Source = source
+			}
+		}
+		if campaign.Medium == "" {
+			campaign.Medium = "cpc"
+		}
+	}
+	return &campaign
+}
@@ -0,0 +1,33 @@
+package ingest
+
+import (
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/enrich"
+	"github.com/likaia/nginxpulse/internal/store"
+)
+
+// classifyChannel 判断来源渠道：带 UTM / 点击 ID 的请求归为推广活动（utm_medium=email 归为邮件），
+// 其余按来源 URL 分类
+func classifyChannel(rawReferer string, campaign *store.CampaignInfo, siteDomains []string) *store.ChannelInfo {
+	source := enrich.ClassifyReferer(rawReferer, siteDomains)
+	if campaign != nil {
+		source.Channel = enrich.ChannelCampaign
+		if strings.EqualFold(campaign.Medium, "email") || strings.EqualFold(campaign.Medium, "e-mail") {
+			source.Channel = enrich.ChannelEmail
+		}
+		if campaign.Source != "" {
+			source.Source = campaign.Source
+		}
+		source.Keyword = ""
+		if campaign.Term != "" {
+			source.Keyword = campaign.Term
+		}
+	}
+	return &store.ChannelInfo{
+		Channel: source.Channel,
+		Source:  source.Source,
+		Domain:  source.Domain,
+		Keyword: source.Keyword,
+	}
+}
@@ -0,0 +1,96 @@
+package ingest
+
+import (
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+// resolveExtraFields 返回需要入库的额外字段白名单，来源上的配置优先于站点配置
+func resolveExtraFields(website config.WebsiteConfig, sourceCfg *config.SourceConfig) []string {
+	names := website.ExtraFields
+	if sourceCfg != nil && sourceCfg.Parse != nil && len(sourceCfg.Parse.ExtraFields) > 0 {
+		names = sourceCfg.Parse.ExtraFields
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, raw := range names {
+		name := strings.TrimSpace(raw)
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		result = append(result, name)
+		if len(result) >= config.MaxExtraFields {
+			break
+		}
+	}
+	return result
+}
+
+// extractRegexExtraFields 从正则匹配结果中取出白名单内的命名分组，空值与 "-" 不入库
+func extractRegexExtraFields(parser *logLineParser, matches []string) map[string]string {
+	if len(parser.extraFields) == 0 {
+		return nil
+	}
+	var extra map[string]string
+	for _, name := range parser.extraFields {
+		idx, ok := parser.indexMap[name]
+		if !ok || idx >= len(matches) {
+			continue
+		}
+		value := strings.TrimSpace(matches[idx])
+		if value == "" || value == "-" {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]string, len(parser.extraFields))
+		}
+		extra[name] = value
+	}
+	return extra
+}
+
+// extractJSONExtraFields 按点分路径（如 request.host、request.headers.X-Request-Id）取出白名单字段
+func extractJSONExtraFields(parser *logLineParser, payload map[string]interface{}) map[string]string {
+	if len(parser.extraFields) == 0 {
+		return nil
+	}
+	var extra map[string]string
+	for _, name := range parser.extraFields {
+		value := strings.TrimSpace(lookupJSONPath(payload, name))
+		if value == "" || value == "-" {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]string, len(parser.extraFields))
+		}
+		extra[name] = value
+	}
+	return extra
+}
+
+func lookupJSONPath(payload map[string]interface{}, path string) string {
+	parts := strings.Split(path, ".")
+	current := payload
+	for i, part := range parts {
+		if i == len(parts)-1 {
+			if _, ok := current[part]; ok {
+				return getString(current, part)
+			}
+			// 请求头名称不区分大小写，取第一个值
+			return getHeader(current, part)
+		}
+		current = getMap(current, part)
+		if current == nil {
+			return ""
+		}
+	}
+	return ""
+}
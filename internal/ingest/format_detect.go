@@ -0,0 +1,337 @@
+package ingest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/ingest/source"
+)
+
+const (
+	detectSampleBytes    = 64 * 1024
+	detectMaxSampleLines = 200
+	detectExampleLines   = 3
+	// 低于该置信度不给出建议配置
+	detectMinConfidence = 0.5
+	// 检测时不按保留天数过滤，避免历史样例被误判为不匹配
+	detectRetentionDays = 365 * 100
+)
+
+// 常见的自定义 nginx log_format，按从具体到宽泛排列
+var commonNginxLogFormats = []struct {
+	name   string
+	format string
+}{
+	{
+		name:   "nginx-upstream",
+		format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for" $request_time $upstream_response_time`,
+	},
+	{
+		name:   "nginx-xff",
+		format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`,
+	},
+	{
+		name:   "nginx-request-time",
+		format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time`,
+	},
+	{
+		name:   "nginx-vhost",
+		format: `$host $remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+	},
+	{
+		name:   "nginx-iso8601",
+		format: `$remote_addr - $remote_user [$time_iso8601] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+	},
+	{
+		name:   "nginx-common",
+		format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`,
+	},
+}
+
+// 参与检测的内置 logType（tengine 与 nginx 规则相同，不重复检测）
+var detectableLogTypes = []string{
+	"nginx",
+	"apache",
+	"nginx-ingress",
+	"traefik",
+	"envoy",
+	"haproxy",
+	"nginx-proxy-manager",
+	"caddy",
+}
+
+// LogFormatCandidate 单个候选格式的评分
+type LogFormatCandidate struct {
+	Name       string             `json:"name"`
+	Parse      config.ParseConfig `json:"parse"`
+	Matched    int                `json:"matched"`
+	Total      int                `json:"total"`
+	MatchRate  float64            `json:"match_rate"`
+	Coverage   float64            `json:"coverage"`
+	Confidence float64            `json:"confidence"`
+}
+
+// LogFormatDetection 日志格式检测结果
+type LogFormatDetection struct {
+	Suggested   *config.ParseConfig  `json:"suggested,omitempty"`
+	Candidate   string               `json:"candidate,omitempty"`
+	Confidence  float64              `json:"confidence"`
+	SampleLines int                  `json:"sample_lines"`
+	Target      string               `json:"target,omitempty"`
+	Candidates  []LogFormatCandidate `json:"candidates"`
+	Examples    []ParsePreviewLine   `json:"examples,omitempty"`
+}
+
+type detectCandidate struct {
+	name  string
+	parse config.ParseConfig
+}
+
+func buildDetectCandidates() []detectCandidate {
+	candidates := make([]detectCandidate, 0, len(detectableLogTypes)+len(commonNginxLogFormats))
+	for _, logType := range detectableLogTypes {
+		candidates = append(candidates, detectCandidate{
+			name:  logType,
+			parse: config.ParseConfig{LogType: logType},
+		})
+	}
+	for _, item := range commonNginxLogFormats {
+		candidates = append(candidates, detectCandidate{
+			name:  item.name,
+			parse: config.ParseConfig{LogType: "nginx", LogFormat: item.format},
+		})
+	}
+	return candidates
+}
+
+// DetectLogFormat 按匹配率为内置 logType 与常见 nginx 格式打分，并给出建议的解析配置。
+// 置信度 = 匹配率 × 平均覆盖率（正则匹配部分占整行的比例），用于区分只匹配了行前缀的宽松规则。
+func DetectLogFormat(lines []string) LogFormatDetection {
+	samples := make([]string, 0, len(lines))
+	for _, raw := range lines {
+		line := strings.TrimRight(raw, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		samples = append(samples, line)
+		if len(samples) >= detectMaxSampleLines {
+			break
+		}
+	}
+
+	result := LogFormatDetection{
+		SampleLines: len(samples),
+		Candidates:  make([]LogFormatCandidate, 0),
+	}
+	if len(samples) == 0 {
+		return result
+	}
+
+	detector := &LogParser{retentionDays: detectRetentionDays}
+	var (
+		bestParser  *logLineParser
+		bestMatched []string
+	)
+	for _, candidate := range buildDetectCandidates() {
+		parser, err := newLogLineParser(config.WebsiteConfig{}, &config.SourceConfig{Parse: &candidate.parse})
+		if err != nil {
+			continue
+		}
+		matched := make([]string, 0, len(samples))
+		coverageSum := 0.0
+		for _, line := range samples {
+			coverage, ok := detector.scoreDetectLine(parser, line)
+			if !ok {
+				continue
+			}
+			matched = append(matched, line)
+			coverageSum += coverage
+		}
+
+		item := LogFormatCandidate{
+			Name:    candidate.name,
+			Parse:   candidate.parse,
+			Matched: len(matched),
+			Total:   len(samples),
+		}
+		if len(matched) > 0 {
+			item.MatchRate = roundRatio(float64(len(matched)) / float64(len(samples)))
+			item.Coverage = roundRatio(coverageSum / float64(len(matched)))
+			item.Confidence = roundRatio(item.MatchRate * item.Coverage)
+		}
+		// 置信度相同的情况下保留先出现（更常用）的候选
+		if len(matched) > 0 && (bestParser == nil || item.Confidence > result.Confidence) {
+			result.Confidence = item.Confidence
+			result.Candidate = item.Name
+			bestParser = parser
+			bestMatched = matched
+		}
+		result.Candidates = append(result.Candidates, item)
+	}
+
+	sort.SliceStable(result.Candidates, func(i, j int) bool {
+		return result.Candidates[i].Confidence > result.Candidates[j].Confidence
+	})
+
+	if bestParser == nil || result.Confidence < detectMinConfidence {
+		return result
+	}
+	for _, item := range result.Candidates {
+		if item.Name == result.Candidate {
+			suggested := item.Parse
+			result.Suggested = &suggested
+			break
+		}
+	}
+	if len(bestMatched) > detectExampleLines {
+		bestMatched = bestMatched[:detectExampleLines]
+	}
+	result.Examples = previewWithParser(bestParser, bestMatched).Lines
+	return result
+}
+
+// scoreDetectLine 返回该行是否能被完整解析，以及匹配部分占整行的比例
+func (p *LogParser) scoreDetectLine(parser *logLineParser, line string) (float64, bool) {
+	switch parser.parseType {
+	case parseTypeCaddyJSON:
+		if _, err := p.parseCaddyJSONLine(line, parser); err != nil {
+			return 0, false
+		}
+		return 1, true
+	default:
+		if _, err := p.parseRegexLogLine(parser, line); err != nil {
+			return 0, false
+		}
+		loc := parser.regex.FindStringIndex(line)
+		if loc == nil || len(line) == 0 {
+			return 0, false
+		}
+		return float64(loc[1]-loc[0]) / float64(len(line)), true
+	}
+}
+
+func roundRatio(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// DetectLogFormatFromSource 通过 LogSource.OpenRange 从来源中采样日志行并检测格式
+func DetectLogFormatFromSource(ctx context.Context, srcCfg config.SourceConfig) (LogFormatDetection, error) {
+	src, err := source.NewFromConfig("", srcCfg)
+	if err != nil {
+		return LogFormatDetection{}, err
+	}
+	targets, err := src.ListTargets(ctx)
+	if err != nil {
+		return LogFormatDetection{}, err
+	}
+	target, ok := pickDetectTarget(targets)
+	if !ok {
+		return LogFormatDetection{}, errors.New("未找到可采样的日志文件")
+	}
+	lines, err := sampleTargetLines(ctx, src, target)
+	if err != nil {
+		return LogFormatDetection{}, fmt.Errorf("采样日志失败: %w", err)
+	}
+	result := DetectLogFormat(lines)
+	result.Target = target.Key
+	return result, nil
+}
+
+// DetectLogFormatFromPath 对本地 logPath（支持通配符）采样并检测格式
+func DetectLogFormatFromPath(ctx context.Context, logPath string) (LogFormatDetection, error) {
+	logPath = strings.TrimSpace(logPath)
+	if logPath == "" {
+		return LogFormatDetection{}, errors.New("logPath 不能为空")
+	}
+	srcCfg := config.SourceConfig{Type: string(source.SourceLocal), Path: logPath}
+	if strings.ContainsAny(logPath, "*?[") {
+		srcCfg.Pattern = logPath
+	}
+	return DetectLogFormatFromSource(ctx, srcCfg)
+}
+
+// pickDetectTarget 优先选择最近修改的非空未压缩文件，其次是压缩文件
+func pickDetectTarget(targets []source.TargetRef) (source.TargetRef, bool) {
+	var best source.TargetRef
+	found := false
+	for _, target := range targets {
+		if target.Meta.Size == 0 && !target.Meta.ModTime.IsZero() {
+			continue
+		}
+		if !found {
+			best = target
+			found = true
+			continue
+		}
+		if best.Meta.Compressed && !target.Meta.Compressed {
+			best = target
+			continue
+		}
+		if best.Meta.Compressed == target.Meta.Compressed && target.Meta.ModTime.After(best.Meta.ModTime) {
+			best = target
+		}
+	}
+	return best, found
+}
+
+// sampleTargetLines 读取目标末尾（压缩文件读取开头）的一段内容作为样例
+func sampleTargetLines(ctx context.Context, src source.LogSource, target source.TargetRef) ([]string, error) {
+	start := int64(0)
+	if !target.Meta.Compressed && target.Meta.Size > detectSampleBytes {
+		start = target.Meta.Size - detectSampleBytes
+	}
+	reader, err := src.OpenRange(ctx, target, start, -1)
+	if err != nil && errors.Is(err, source.ErrRangeNotSupported) && start > 0 {
+		start = 0
+		reader, err = src.OpenRange(ctx, target, 0, -1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		return nil, errors.New("日志来源未返回内容")
+	}
+	defer reader.Close()
+
+	var input io.Reader = reader
+	if target.Meta.Compressed {
+		gzReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzReader.Close()
+		input = gzReader
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(input, detectSampleBytes))
+	lines := make([]string, 0, 64)
+	var consumed int64
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		consumed += int64(len(line) + 1)
+		// 从文件中间开始读取时首行可能不完整
+		if first && start > 0 {
+			first = false
+			continue
+		}
+		first = false
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil && len(lines) == 0 {
+		return nil, err
+	}
+	// 读满采样上限时末行可能被截断
+	if start == 0 && consumed >= detectSampleBytes && len(lines) > 1 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, nil
+}
@@ -2,6 +2,7 @@ package ingest
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -150,6 +151,7 @@ func (p *LogParser) ProcessPendingIPGeo(limit int) int {
 				Domestic: loc.Domestic,
 				Global:   loc.Global,
 				Source:   loc.Source,
+				Geo:      geoInfoFromLocation(loc),
 			}
 		}
 		if p.repo != nil && len(fetched) > 0 {
@@ -159,6 +161,7 @@ func (p *LogParser) ProcessPendingIPGeo(limit int) int {
 					Domestic: loc.Domestic,
 					Global:   loc.Global,
 					Source:   loc.Source,
+					Geo:      geoInfoFromLocation(loc),
 				}
 			}
 			if err := p.repo.UpsertIPGeoCache(entries); err != nil {
@@ -192,50 +195,52 @@ func (p *LogParser) ProcessPendingIPGeo(limit int) int {
 		}
 
 		if p.repo != nil && (fetchErr != nil || len(failed) > 0) {
-			failureRecords := make(map[string]string, len(failed))
-			for ip, reason := range failed {
-				failureRecords[ip] = reason
-			}
-			if fetchErr != nil {
-				for _, ip := range pending {
-					ip = strings.TrimSpace(ip)
-					if ip == "" {
-						continue
-					}
-					if _, ok := results[ip]; ok {
-						continue
-					}
-					if _, ok := failureRecords[ip]; ok {
-						continue
-					}
-					failureRecords[ip] = "request_error"
+			// 按查询源分组记录失败，限速跳过的 IP 不记录，下次解析时重试
+			failureRecords := make(map[string]map[string]string)
+			failureCount := 0
+			for ip, failure := range failed {
+				if failure.Reason == enrich.IPGeoReasonRateLimited {
+					continue
 				}
+				if failureRecords[failure.Provider] == nil {
+					failureRecords[failure.Provider] = make(map[string]string)
+				}
+				failureRecords[failure.Provider][ip] = failure.Reason
+				failureCount++
 			}
 			detail := ""
 			if fetchErr != nil {
 				detail = fetchErr.Error()
 			}
-			if len(failureRecords) > 0 {
-				if err := p.repo.InsertIPGeoAPIFailures(failureRecords, "ip-api", detail, 0); err != nil {
-					logrus.WithError(err).Warn("记录 IP 归属地远端失败失败")
+			if failureCount > 0 {
+				for provider, records := range failureRecords {
+					if err := p.repo.InsertIPGeoAPIFailures(records, provider, detail, 0); err != nil {
+						logrus.WithError(err).Warn("记录 IP 归属地远端失败失败")
+					}
 				}
 				samples := make([]string, 0, 3)
-				for ip := range failureRecords {
-					samples = append(samples, ip)
-					if len(samples) >= 3 {
-						break
+				providers := make([]string, 0, len(failureRecords))
+				for provider, records := range failureRecords {
+					providers = append(providers, provider)
+					for ip := range records {
+						if len(samples) >= 3 {
+							break
+						}
+						samples = append(samples, ip)
 					}
 				}
+				sort.Strings(providers)
 				_, err := p.repo.CreateSystemNotification(store.SystemNotification{
 					Level:       "warning",
 					Category:    "ip_geo",
 					Title:       "IP 归属地查询失败",
-					Message:     fmt.Sprintf("远端 IP 归属地查询失败，已记录 %d 个 IP。", len(failureRecords)),
+					Message:     fmt.Sprintf("远端 IP 归属地查询失败，已记录 %d 个 IP。", failureCount),
 					Fingerprint: "ip_geo_api_failure",
 					Metadata: map[string]interface{}{
-						"count":   len(failureRecords),
-						"samples": samples,
-						"error":   detail,
+						"count":     failureCount,
+						"samples":   samples,
+						"providers": providers,
+						"error":     detail,
 					},
 				})
 				if err != nil {
@@ -351,3 +356,77 @@ func (p *LogParser) recoverPendingIPGeoFromLogs(limit int) int {
 
 	return len(cached)
 }
+
+// RequeueCachedIPGeo 将 ip_geo_cache 中的全部 IP 重新加入待解析队列（与异常修复相同：清除缓存、日志标记为待解析），
+// 用于更换离线库后重新解析归属地，返回处理的 IP 数量
+func RequeueCachedIPGeo(repo *store.Repository) (int, error) {
+	if repo == nil {
+		return 0, fmt.Errorf("数据库未初始化")
+	}
+	websiteIDs := config.GetAllWebsiteIDs()
+	total := 0
+	after := ""
+	for {
+		ips, err := repo.ListIPGeoCacheIPs(after, defaultIPGeoResolveBatch)
+		if err != nil {
+			return total, fmt.Errorf("读取 IP 归属地缓存失败: %v", err)
+		}
+		if len(ips) == 0 {
+			break
+		}
+		after = ips[len(ips)-1]
+		// 先删除缓存，避免回填任务读到旧结果
+		if err := repo.DeleteIPGeoCache(ips); err != nil {
+			return total, fmt.Errorf("删除 IP 归属地缓存失败: %v", err)
+		}
+		enrich.DeleteIPGeoCacheEntries(ips)
+		for _, websiteID := range websiteIDs {
+			if err := repo.MarkIPGeoPendingForWebsite(websiteID, ips, pendingLocationLabel); err != nil {
+				return total, fmt.Errorf("标记站点 %s 待解析失败: %v", websiteID, err)
+			}
+		}
+		if err := repo.UpsertIPGeoPending(ips); err != nil {
+			return total, fmt.Errorf("补充待解析队列失败: %v", err)
+		}
+		total += len(ips)
+	}
+	return total, nil
+}
+
+// BackfillLocationCodes 为各站点缺少国家代码的地理位置维度（历史数据、演示数据）补齐代码，返回处理的行数
+func (p *LogParser) BackfillLocationCodes() int {
+	if p == nil || p.repo == nil {
+		return 0
+	}
+	total := 0
+	for _, websiteID := range config.GetAllWebsiteIDs() {
+		for {
+			count, err := p.repo.BackfillLocationCodes(websiteID, resolveLocationCodes, defaultIPGeoResolveBatch)
+			if err != nil {
+				logrus.WithError(err).Warnf("回填站点 %s 的归属地代码失败", websiteID)
+				break
+			}
+			total += count
+			if count < defaultIPGeoResolveBatch {
+				break
+			}
+		}
+	}
+	return total
+}
+
+func geoInfoFromLocation(loc enrich.IPLocation) store.GeoInfo {
+	return store.GeoInfo{
+		CountryCode: loc.CountryCode,
+		RegionCode:  loc.RegionCode,
+		City:        loc.City,
+		Latitude:    loc.Latitude,
+		Longitude:   loc.Longitude,
+	}
+}
+
+// resolveLocationCodes 由已存储的归属地文本推导代码
+func resolveLocationCodes(domestic, global string) store.GeoInfo {
+	countryCode, regionCode, city := enrich.LocationCodesFromLabels(domestic, global)
+	return store.GeoInfo{CountryCode: countryCode, RegionCode: regionCode, City: city}
+}
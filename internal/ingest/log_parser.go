@@ -14,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -144,11 +145,17 @@ func (w parseWindow) allows(ts int64) bool {
 }
 
 type logLineParser struct {
-	regex      *regexp.Regexp
-	indexMap   map[string]int
-	timeLayout string
-	source     string
-	parseType  string
+	regex       *regexp.Regexp
+	indexMap    map[string]int
+	timeLayout  string
+	source      string
+	parseType   string
+	extraFields []string
+	normalizer  *enrich.URLNormalizer
+	// clickIDParams 识别为广告点击的查询参数（小写）
+	clickIDParams []string
+	// siteDomains 站点自身域名，用于识别站内跳转
+	siteDomains []string
 }
 
 type LogParser struct {
@@ -158,10 +165,15 @@ type LogParser struct {
 	demoMode          bool
 	retentionDays     int
 	parseBatchSize    int
+	parseWorkers      int
 	ipGeoCacheLimit   int
+	lineParsersMu     sync.RWMutex
 	lineParsers       map[string]*logLineParser // key: websiteID or websiteID:sourceID
 	dedup             *dedup.Cache
 	whitelistMatchers map[string]*enrich.WhitelistMatcher
+	bruteForce        *bruteForceDetector
+	anomalyMu         sync.Mutex
+	anomalyChecked    map[string]int64 // 各网站最近一次检测流量异常的小时桶
 }
 
 // NewLogParser 创建新的日志解析器
@@ -187,10 +199,12 @@ func NewLogParser(userRepoPtr *store.Repository) *LogParser {
 		demoMode:          cfg.System.DemoMode,
 		retentionDays:     retentionDays,
 		parseBatchSize:    parseBatchSize,
+		parseWorkers:      resolveParseWorkers(cfg.System.ParseWorkers),
 		ipGeoCacheLimit:   ipGeoCacheLimit,
 		lineParsers:       make(map[string]*logLineParser),
 		dedup:             dedup.NewCache(100000, 10*time.Minute),
 		whitelistMatchers: make(map[string]*enrich.WhitelistMatcher),
+		bruteForce:        newBruteForceDetector(cfg.Security),
 	}
 	for _, websiteID := range config.GetAllWebsiteIDs() {
 		if site, ok := config.GetWebsiteByID(websiteID); ok {
@@ -202,6 +216,11 @@ func NewLogParser(userRepoPtr *store.Repository) *LogParser {
 	parser.loadState()
 	parser.resetStateIfEmptyDB()
 	enrich.InitPVFilters()
+	enrich.InitRefererChannels()
+	enrich.InitSecurityRules()
+	if err := enrich.InitIPReputation(); err != nil {
+		logrus.WithError(err).Warn("加载 IP 信誉名单失败")
+	}
 	return parser
 }
 
@@ -710,6 +729,7 @@ func (p *LogParser) scanNginxLogsInternal(websiteIDs []string) []ParserResult {
 		p.refreshWebsiteRanges(id)
 		p.updateState()
 		parserResult.Duration = time.Since(startTime)
+		observeScan(id, parserResult)
 		parserResults[i] = parserResult
 	}
 
@@ -920,9 +940,11 @@ func (p *LogParser) scanSingleFile(
 				logrus.Errorf("无法设置文件读取位置 %s: %v", logPath, err)
 				p.notifyFileIO(websiteID, logPath, "设置文件读取位置", err)
 			} else {
-				entriesCount, _, minTs, maxTs := p.parseLogLines(
+				entriesCount, bytesRead, minTs, maxTs := p.parseLogLines(
 					file, websiteID, "", parserResult, parseWindow{minTs: cutoffTs},
 				)
+				// 仅推进到最后一个成功提交的批次末尾，未提交部分下次扫描重试
+				fileState.LastOffset = clampOffset(recentOffset+bytesRead, currentSize)
 				p.updateParsedRange(&fileState, minTs, maxTs)
 				if maxTs > fileState.LastTimestamp {
 					fileState.LastTimestamp = maxTs
@@ -999,7 +1021,7 @@ func (p *LogParser) scanSingleFile(
 	if isGzip {
 		fileState.LastOffset = startOffset + bytesRead
 	} else {
-		fileState.LastOffset = currentSize
+		fileState.LastOffset = clampOffset(startOffset+bytesRead, currentSize)
 	}
 	fileState.LastSize = currentSize
 	p.updateParsedRange(&fileState, minTs, maxTs)
@@ -1108,6 +1130,7 @@ func (p *LogParser) readFirstTimestamp(
 	}
 
 	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineBytes+2)
 	for scanner.Scan() {
 		line := scanner.Text()
 		ts, err := p.parseLogTimestamp(parser, line)
@@ -1217,98 +1240,12 @@ func (p *LogParser) findRecentOffset(
 	return 0, lastTs, nil
 }
 
-// parseLogLines 解析日志行并返回解析的记录数
+// parseLogLines 通过解析流水线处理日志行，返回已提交的记录数、已提交批次覆盖的字节数及时间范围。
+// 返回的字节数只包含成功落库的批次，调用方应据此推进文件偏移。
 func (p *LogParser) parseLogLines(
 	reader io.Reader, websiteID, sourceID string, parserResult *ParserResult, window parseWindow) (int, int64, int64, int64) {
-	scanner := bufio.NewScanner(reader)
-	entriesCount := 0
-	var minTs int64
-	var maxTs int64
-	parsedBuckets := make(map[int64]struct{})
-	var whitelistHits map[string]*whitelistHit
-	var batchWhitelistHits map[string]*whitelistHit
-
-	// 批量插入相关
-	batch := make([]store.NginxLogRecord, 0, p.parseBatchSize)
-
-	// 处理一批数据
-	processBatch := func() {
-		if len(batch) == 0 {
-			return
-		}
-
-		// 先把本批次 location 标记为“待解析”，确保日志落库后前端可见；
-		// 再在日志成功落库后写入 ip_geo_pending，避免“先入队、后落库”导致回填命中空 ip_id 后把队列误删。
-		p.markBatchIPGeoPending(batch)
-		if err := p.repo.BatchInsertLogsForWebsite(websiteID, batch); err != nil {
-			logrus.Errorf("批量插入网站 %s 的日志记录失败: %v", websiteID, err)
-			p.notifyDatabaseWrite(websiteID, "写入日志批次", err)
-		} else {
-			p.enqueueBatchIPGeo(batch)
-			whitelistHits = mergeWhitelistHits(whitelistHits, batchWhitelistHits)
-		}
-
-		batch = batch[:0] // 清空批次但保留容量
-		batchWhitelistHits = nil
-	}
-
-	// 逐行处理
-	const progressChunk = int64(64 * 1024)
-	var pendingBytes int64
-	var totalBytes int64
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineBytes := int64(len(line) + 1)
-		pendingBytes += lineBytes
-		totalBytes += lineBytes
-		if pendingBytes >= progressChunk {
-			addParsingProgress(pendingBytes)
-			pendingBytes = 0
-		}
-
-		entry, err := p.parseLogLine(websiteID, sourceID, line)
-		if err != nil {
-			continue
-		}
-		ts := entry.Timestamp.Unix()
-		if !window.allows(ts) {
-			continue
-		}
-		if matcher := p.whitelistMatchers[websiteID]; matcher != nil && matcher.Enabled() {
-			if match, ok := matcher.Match(entry.IP); ok {
-				batchWhitelistHits = p.recordWhitelistHit(websiteID, *entry, match, batchWhitelistHits)
-			}
-		}
-		batch = append(batch, *entry)
-		bucket := (ts / 3600) * 3600
-		parsedBuckets[bucket] = struct{}{}
-		if minTs == 0 || ts < minTs {
-			minTs = ts
-		}
-		if ts > maxTs {
-			maxTs = ts
-		}
-		entriesCount++
-		parserResult.TotalEntries++ // 累加到总结果中，而非赋值
-
-		if len(batch) >= p.parseBatchSize {
-			processBatch()
-		}
-	}
-
-	processBatch() // 处理剩余的记录
-	if pendingBytes > 0 {
-		addParsingProgress(pendingBytes)
-	}
-
-	if err := scanner.Err(); err != nil {
-		logrus.Errorf("扫描网站 %s 的文件时出错: %v", websiteID, err)
-		p.notifyLogParsing(websiteID, "", "扫描日志文件", err)
-	}
-	p.flushWhitelistHits(whitelistHits)
-
-	p.recordParsedHourBuckets(websiteID, parsedBuckets)
-	return entriesCount, totalBytes, minTs, maxTs // 返回当前文件的日志条数
+	result := p.runParsePipeline(reader, websiteID, sourceID, parserResult, window)
+	return result.entries, result.bytes, result.minTs, result.maxTs
 }
 
 // IngestLines parses and inserts streamed log lines for a website/source.
@@ -1323,6 +1260,15 @@ func (p *LogParser) IngestLines(websiteID, sourceID string, lines []string) (int
 		return 0, 0, err
 	}
 
+	return p.ingestRecords(websiteID, sourceID, len(lines), func(i int) (*store.NginxLogRecord, string, error) {
+		entry, err := p.parseLogLine(websiteID, sourceID, lines[i])
+		return entry, lines[i], err
+	})
+}
+
+// ingestRecords 逐条解析并按批次入库，parse 返回第 i 条的记录与用于去重的原始内容
+func (p *LogParser) ingestRecords(
+	websiteID, sourceID string, total int, parse func(i int) (*store.NginxLogRecord, string, error)) (int, int, error) {
 	batch := make([]store.NginxLogRecord, 0, p.parseBatchSize)
 	accepted := 0
 	deduped := 0
@@ -1331,6 +1277,9 @@ func (p *LogParser) IngestLines(websiteID, sourceID string, lines []string) (int
 	parsedBuckets := make(map[int64]struct{})
 	var whitelistHits map[string]*whitelistHit
 	var batchWhitelistHits map[string]*whitelistHit
+	var securityHits map[string]*securityHit
+	var batchSecurityHits map[string]*securityHit
+	notifyRank := enrich.SecurityNotifyRank()
 
 	processBatch := func() error {
 		if len(batch) == 0 {
@@ -1343,18 +1292,24 @@ func (p *LogParser) IngestLines(websiteID, sourceID string, lines []string) (int
 			return err
 		}
 		p.enqueueBatchIPGeo(batch)
+		p.bruteForce.Observe(websiteID, batch)
 		whitelistHits = mergeWhitelistHits(whitelistHits, batchWhitelistHits)
+		securityHits = mergeSecurityHits(securityHits, batchSecurityHits)
 		batch = batch[:0]
 		batchWhitelistHits = nil
+		batchSecurityHits = nil
 		return nil
 	}
 
-	for _, line := range lines {
-		entry, err := p.parseLogLine(websiteID, sourceID, line)
+	failures := 0
+	defer func() { observeParsedLines(websiteID, total, failures) }()
+	for i := 0; i < total; i++ {
+		entry, raw, err := parse(i)
 		if err != nil {
+			failures++
 			continue
 		}
-		key := buildDedupKey(websiteID, sourceID, line)
+		key := buildDedupKey(websiteID, sourceID, raw)
 		if p.dedup != nil && p.dedup.Seen(key) {
 			deduped++
 			continue
@@ -1364,6 +1319,7 @@ func (p *LogParser) IngestLines(websiteID, sourceID string, lines []string) (int
 				batchWhitelistHits = p.recordWhitelistHit(websiteID, *entry, match, batchWhitelistHits)
 			}
 		}
+		batchSecurityHits = p.recordSecurityHit(websiteID, *entry, notifyRank, batchSecurityHits)
 		batch = append(batch, *entry)
 		accepted++
 		ts := entry.Timestamp.Unix()
@@ -1387,6 +1343,8 @@ func (p *LogParser) IngestLines(websiteID, sourceID string, lines []string) (int
 		return accepted, deduped, err
 	}
 	p.flushWhitelistHits(whitelistHits)
+	p.flushSecurityHits(securityHits)
+	p.bruteForce.Flush(p)
 
 	if accepted > 0 {
 		p.recordParsedHourBuckets(websiteID, parsedBuckets)
@@ -1495,6 +1453,14 @@ func (p *LogParser) enqueueBatchIPGeo(batch []store.NginxLogRecord) {
 	}
 }
 
+// clampOffset 限制偏移不超过文件大小（读取期间文件被截断或替换时，已读取字节数可能超过扫描开始时的大小）
+func clampOffset(offset, size int64) int64 {
+	if size > 0 && offset > size {
+		return size
+	}
+	return offset
+}
+
 func isGzipFile(filePath string) bool {
 	return strings.HasSuffix(strings.ToLower(filePath), ".gz")
 }
@@ -1516,7 +1482,10 @@ func (p *LogParser) getLineParserForSource(websiteID, sourceID string) (*logLine
 	if sourceID != "" {
 		key = websiteID + ":" + sourceID
 	}
-	if parser, ok := p.lineParsers[key]; ok {
+	p.lineParsersMu.RLock()
+	parser, ok := p.lineParsers[key]
+	p.lineParsersMu.RUnlock()
+	if ok {
 		return parser, nil
 	}
 
@@ -1540,7 +1509,9 @@ func (p *LogParser) getLineParserForSource(websiteID, sourceID string) (*logLine
 		return nil, err
 	}
 
+	p.lineParsersMu.Lock()
 	p.lineParsers[key] = parser
+	p.lineParsersMu.Unlock()
 	return parser, nil
 }
 
@@ -1568,6 +1539,10 @@ func newLogLineParser(website config.WebsiteConfig, sourceCfg *config.SourceConf
 	if logType == "" {
 		logType = "nginx"
 	}
+	normalizer, err := enrich.NewURLNormalizer(website.URLNormalize)
+	if err != nil {
+		return nil, err
+	}
 
 	pattern := defaultNginxLogRegex
 	source := "default"
@@ -1587,9 +1562,13 @@ func newLogLineParser(website config.WebsiteConfig, sourceCfg *config.SourceConf
 		switch logType {
 		case "caddy":
 			return &logLineParser{
-				timeLayout: timeLayout,
-				source:     "caddy",
-				parseType:  parseTypeCaddyJSON,
+				timeLayout:    timeLayout,
+				source:        "caddy",
+				parseType:     parseTypeCaddyJSON,
+				extraFields:   resolveExtraFields(website, sourceCfg),
+				normalizer:    normalizer,
+				clickIDParams: resolveCampaignClickIDs(website),
+				siteDomains:   website.Domains,
 			}, nil
 		case "nginx":
 			// default nginx pattern
@@ -1639,11 +1618,15 @@ func newLogLineParser(website config.WebsiteConfig, sourceCfg *config.SourceConf
 	}
 
 	return &logLineParser{
-		regex:      regex,
-		indexMap:   indexMap,
-		timeLayout: timeLayout,
-		source:     source,
-		parseType:  parseType,
+		regex:         regex,
+		indexMap:      indexMap,
+		timeLayout:    timeLayout,
+		source:        source,
+		parseType:     parseType,
+		extraFields:   resolveExtraFields(website, sourceCfg),
+		normalizer:    normalizer,
+		clickIDParams: resolveCampaignClickIDs(website),
+		siteDomains:   website.Domains,
 	}, nil
 }
 
@@ -1764,7 +1747,8 @@ func tokenRegexForVar(name string, used map[string]bool, quoted bool) string {
 	case "upstream_header_time":
 		return addGroup("upstream_header_time", commaListPattern)
 	default:
-		return optionalTokenPattern
+		// 其余变量按变量名生成命名分组，可通过 extraFields 选择入库
+		return addGroup(name, optionalTokenPattern)
 	}
 }
 
@@ -1876,18 +1860,20 @@ func (p *LogParser) parseRegexLogLine(parser *logLineParser, line string) (*stor
 		}
 	}
 
-	if ip == "" || rawTime == "" || statusStr == "" || urlValue == "" {
-		return nil, errors.New("日志缺少必要字段")
+	if missing := missingFieldNames(map[string]string{
+		"ip": ip, "time": rawTime, "status": statusStr, "url": urlValue,
+	}); len(missing) > 0 {
+		return nil, fmt.Errorf("日志缺少必要字段: %s", strings.Join(missing, ", "))
 	}
 
 	timestamp, err := parseLogTime(rawTime, parser.timeLayout)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("时间字段解析失败 (%s): %w", rawTime, err)
 	}
 
 	statusCode, err := strconv.Atoi(statusStr)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("状态码无效 (%s): %w", statusStr, err)
 	}
 
 	bytesSent := 0
@@ -1901,7 +1887,15 @@ func (p *LogParser) parseRegexLogLine(parser *logLineParser, line string) (*stor
 	referPath := extractField(matches, parser.indexMap, refererAliases)
 
 	userAgent := extractField(matches, parser.indexMap, userAgentAliases)
-	return p.buildLogRecord(ip, method, urlValue, referPath, userAgent, statusCode, bytesSent, timestamp)
+	record, err := p.buildLogRecord(ip, method, urlValue, referPath, userAgent, statusCode, bytesSent, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	record.Extra = extractRegexExtraFields(parser, matches)
+	record.Route = parser.normalizer.Normalize(urlValue)
+	record.Campaign = extractCampaign(urlValue, parser.clickIDParams)
+	record.Channel = classifyChannel(referPath, record.Campaign, parser.siteDomains)
+	return record, nil
 }
 
 func (p *LogParser) parseCaddyJSONLine(line string, parser *logLineParser) (*store.NginxLogRecord, error) {
@@ -1941,7 +1935,15 @@ func (p *LogParser) parseCaddyJSONLine(line string, parser *logLineParser) (*sto
 		return nil, err
 	}
 
-	return p.buildLogRecord(ip, method, urlValue, referPath, userAgent, statusCode, bytesSent, timestamp)
+	record, err := p.buildLogRecord(ip, method, urlValue, referPath, userAgent, statusCode, bytesSent, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	record.Extra = extractJSONExtraFields(parser, payload)
+	record.Route = parser.normalizer.Normalize(urlValue)
+	record.Campaign = extractCampaign(urlValue, parser.clickIDParams)
+	record.Channel = classifyChannel(referPath, record.Campaign, parser.siteDomains)
+	return record, nil
 }
 
 func (p *LogParser) buildLogRecord(
@@ -1949,8 +1951,10 @@ func (p *LogParser) buildLogRecord(
 	statusCode, bytesSent int, timestamp time.Time) (*store.NginxLogRecord, error) {
 
 	ip = normalizeIP(ip)
-	if ip == "" || method == "" || urlValue == "" {
-		return nil, errors.New("日志缺少必要字段")
+	if missing := missingFieldNames(map[string]string{
+		"ip": ip, "method": method, "url": urlValue,
+	}); len(missing) > 0 {
+		return nil, fmt.Errorf("日志缺少必要字段: %s", strings.Join(missing, ", "))
 	}
 	if statusCode <= 0 {
 		return nil, errors.New("日志缺少状态码")
@@ -1958,7 +1962,7 @@ func (p *LogParser) buildLogRecord(
 
 	cutoffTime := time.Now().AddDate(0, 0, -p.retentionDays)
 	if timestamp.Before(cutoffTime) {
-		return nil, errors.New("日志超过保留天数")
+		return nil, fmt.Errorf("日志超过保留天数 (%d 天)", p.retentionDays)
 	}
 
 	decodedPath, err := url.QueryUnescape(urlValue)
@@ -1978,7 +1982,34 @@ func (p *LogParser) buildLogRecord(
 	}
 
 	pageviewFlag := enrich.ShouldCountAsPageView(statusCode, decodedPath, ip)
-	browser, os, device := enrich.ParseUserAgent(userAgent)
+	browser, os, device, detail := enrich.ParseUserAgentWithDetail(userAgent)
+	var uaInfo *store.UserAgentInfo
+	if userAgent != "-" {
+		uaInfo = &store.UserAgentInfo{
+			Raw:            userAgent,
+			Browser:        detail.Browser,
+			BrowserVersion: detail.BrowserVersion,
+			OS:             detail.OS,
+			OSVersion:      detail.OSVersion,
+			DeviceBrand:    detail.DeviceBrand,
+			DeviceModel:    detail.DeviceModel,
+		}
+	}
+	var networkInfo *store.NetworkInfo
+	if network := enrich.LookupIPNetwork(ip); network != nil {
+		networkInfo = &store.NetworkInfo{
+			ASN:  network.ASN,
+			Org:  network.Org,
+			Type: network.Type,
+		}
+	}
+	var reputationInfo *store.ReputationInfo
+	if reputation := enrich.LookupIPReputation(ip); reputation != nil {
+		reputationInfo = &store.ReputationInfo{
+			List:     reputation.List,
+			Category: reputation.Category,
+		}
+	}
 
 	return &store.NginxLogRecord{
 		ID:               0,
@@ -1995,9 +2026,25 @@ func (p *LogParser) buildLogRecord(
 		UserDevice:       device,
 		DomesticLocation: "",
 		GlobalLocation:   "",
+		UserAgent:        uaInfo,
+		Network:          networkInfo,
+		Attack:           detectAttack(decodedPath, userAgent),
+		Reputation:       reputationInfo,
 	}, nil
 }
 
+// missingFieldNames 返回值为空的字段名（按名称排序）
+func missingFieldNames(fields map[string]string) []string {
+	missing := make([]string, 0)
+	for name, value := range fields {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
 func normalizeIP(raw string) string {
 	ip := strings.TrimSpace(raw)
 	if ip == "" {
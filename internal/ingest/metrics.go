@@ -0,0 +1,45 @@
+package ingest
+
+import (
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/metrics"
+)
+
+var (
+	parsedLinesTotal = metrics.NewCounter(
+		"nginxpulse_parsed_lines_total",
+		"已读取并解析的日志行数",
+		"website",
+	)
+	parseFailuresTotal = metrics.NewCounter(
+		"nginxpulse_parse_failures_total",
+		"解析失败的日志行数（格式不匹配、缺少字段、超过保留天数等）",
+		"website",
+	)
+	scanDuration = metrics.NewHistogram(
+		"nginxpulse_scan_duration_seconds",
+		"单个站点一次日志扫描的耗时",
+		metrics.DefaultDurationBuckets,
+		"website", "result",
+	)
+	lastScanTimestamp = metrics.NewGauge(
+		"nginxpulse_last_scan_timestamp_seconds",
+		"站点最近一次扫描完成的 Unix 时间",
+		"website",
+	)
+)
+
+func observeParsedLines(websiteID string, lines, failures int) {
+	parsedLinesTotal.Add(float64(lines), websiteID)
+	parseFailuresTotal.Add(float64(failures), websiteID)
+}
+
+func observeScan(websiteID string, result ParserResult) {
+	status := "success"
+	if !result.Success {
+		status = "error"
+	}
+	scanDuration.Observe(result.Duration.Seconds(), websiteID, status)
+	lastScanTimestamp.Set(float64(time.Now().Unix()), websiteID)
+}
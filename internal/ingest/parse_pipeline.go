@@ -0,0 +1,369 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/enrich"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxAutoParseWorkers = 8
+	// 每个 worker 允许在途（已读取但未提交）的批次数，用于限制内存占用
+	parseInflightPerWorker = 4
+	// 单行日志上限，超出的行跳过但仍计入已读取字节，避免偏移卡在该行
+	maxLogLineBytes = 1 << 20
+	// 批次写入失败时的重试次数与间隔
+	commitRetryAttempts = 3
+	commitRetryDelay    = time.Second
+)
+
+// logLineReader 逐行读取并统计实际消耗的字节数（含 \r\n 与超长行），
+// 偏移据此推进，CRLF 日志与超长行都不会导致偏移错位
+type logLineReader struct {
+	reader *bufio.Reader
+}
+
+func newLogLineReader(reader io.Reader) *logLineReader {
+	return &logLineReader{reader: bufio.NewReaderSize(reader, 64*1024)}
+}
+
+// next 返回去掉行尾换行符的一行、该行消耗的字节数以及是否因超长被跳过；
+// 读到末尾返回 io.EOF，末行无换行符时仍按一行返回
+func (r *logLineReader) next() (string, int64, bool, error) {
+	var line []byte
+	var consumed int64
+	tooLong := false
+	for {
+		part, err := r.reader.ReadSlice('\n')
+		consumed += int64(len(part))
+		if !tooLong {
+			if len(line)+len(part) > maxLogLineBytes+2 {
+				tooLong = true
+				line = nil
+			} else {
+				line = append(line, part...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return "", consumed, false, err
+		}
+		if consumed == 0 {
+			return "", 0, false, io.EOF
+		}
+		if tooLong {
+			return "", consumed, true, nil
+		}
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+		return string(line), consumed, false, nil
+	}
+}
+
+// parseChunk 读取阶段产出的一批原始日志行
+type parseChunk struct {
+	seq   int
+	lines []string
+	bytes int64
+}
+
+// parsedChunk 解析阶段产出的一批记录，按 seq 顺序提交
+type parsedChunk struct {
+	seq           int
+	lineCount     int
+	bytes         int64
+	records       []store.NginxLogRecord
+	whitelistHits map[string]*whitelistHit
+	securityHits  map[string]*securityHit
+	buckets       map[int64]struct{}
+	minTs         int64
+	maxTs         int64
+}
+
+// parsePipelineResult 汇总已提交批次的结果；bytes 只统计已成功落库的批次覆盖的字节数
+type parsePipelineResult struct {
+	entries int
+	bytes   int64
+	minTs   int64
+	maxTs   int64
+	failed  bool
+}
+
+func resolveParseWorkers(configured int) int {
+	if configured > 0 {
+		return configured
+	}
+	workers := runtime.NumCPU()
+	if workers > maxAutoParseWorkers {
+		workers = maxAutoParseWorkers
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// runParsePipeline 读取 -> N 个解析 worker -> 有序提交。
+// 批次严格按读取顺序提交，一旦某批因数据库不可用写入失败即停止后续提交，
+// 调用方据此只把偏移推进到最后一个成功提交的批次末尾；
+// 数据库可用但批次本身反复写入失败时逐条写入并丢弃失败记录，避免整个文件卡死。
+func (p *LogParser) runParsePipeline(
+	reader io.Reader, websiteID, sourceID string, parserResult *ParserResult, window parseWindow,
+) parsePipelineResult {
+	workers := resolveParseWorkers(p.parseWorkers)
+	setParsingWorkers(workers)
+	// 预先构建行解析器，避免多个 worker 并发初始化
+	if _, err := p.getLineParserForSource(websiteID, sourceID); err != nil {
+		logrus.Errorf("网站 %s 的日志解析配置无效: %v", websiteID, err)
+		p.notifyLogParsing(websiteID, "", "日志解析配置", err)
+		return parsePipelineResult{failed: true}
+	}
+
+	chunkCh := make(chan parseChunk, workers)
+	parsedCh := make(chan parsedChunk, workers)
+	inflight := make(chan struct{}, workers*parseInflightPerWorker)
+	stopCh := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() {
+		stopOnce.Do(func() { close(stopCh) })
+	}
+
+	// 读取阶段
+	var scanErr error
+	go func() {
+		defer close(chunkCh)
+		lines := newLogLineReader(reader)
+		seq := 0
+		chunk := parseChunk{lines: make([]string, 0, p.parseBatchSize)}
+		emit := func() bool {
+			// 只含被跳过超长行的批次也要提交，让偏移越过这些字节
+			if len(chunk.lines) == 0 && chunk.bytes == 0 {
+				return true
+			}
+			select {
+			case inflight <- struct{}{}:
+			case <-stopCh:
+				return false
+			}
+			chunk.seq = seq
+			seq++
+			select {
+			case chunkCh <- chunk:
+			case <-stopCh:
+				return false
+			}
+			chunk = parseChunk{lines: make([]string, 0, p.parseBatchSize)}
+			return true
+		}
+		for {
+			line, consumed, skipped, err := lines.next()
+			if err != nil {
+				if err != io.EOF {
+					// 出错前已读取的完整行照常提交，出错的残行不计入偏移
+					if emit() {
+						scanErr = err
+					}
+					return
+				}
+				break
+			}
+			chunk.bytes += consumed
+			if skipped {
+				logrus.Warnf("网站 %s 的日志中有一行超过 %d 字节，已跳过", websiteID, maxLogLineBytes)
+				continue
+			}
+			chunk.lines = append(chunk.lines, line)
+			if len(chunk.lines) >= p.parseBatchSize {
+				if !emit() {
+					return
+				}
+			}
+		}
+		emit()
+	}()
+
+	// 解析阶段
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunkCh {
+				parsed := p.parseChunk(websiteID, sourceID, chunk, window)
+				select {
+				case parsedCh <- parsed:
+				case <-stopCh:
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(parsedCh)
+	}()
+
+	// 提交阶段：按 seq 重排后依次写入
+	result := parsePipelineResult{}
+	parsedBuckets := make(map[int64]struct{})
+	var whitelistHits map[string]*whitelistHit
+	var securityHits map[string]*securityHit
+	pending := make(map[int]parsedChunk)
+	nextSeq := 0
+	for parsed := range parsedCh {
+		if result.failed {
+			continue
+		}
+		pending[parsed.seq] = parsed
+		for {
+			chunk, ok := pending[nextSeq]
+			if !ok {
+				break
+			}
+			delete(pending, nextSeq)
+			nextSeq++
+			if !p.commitParsedChunk(websiteID, &chunk) {
+				result.failed = true
+				stop()
+				break
+			}
+			<-inflight
+			whitelistHits = mergeWhitelistHits(whitelistHits, chunk.whitelistHits)
+			securityHits = mergeSecurityHits(securityHits, chunk.securityHits)
+			for bucket := range chunk.buckets {
+				parsedBuckets[bucket] = struct{}{}
+			}
+			if chunk.minTs > 0 && (result.minTs == 0 || chunk.minTs < result.minTs) {
+				result.minTs = chunk.minTs
+			}
+			if chunk.maxTs > result.maxTs {
+				result.maxTs = chunk.maxTs
+			}
+			result.entries += len(chunk.records)
+			result.bytes += chunk.bytes
+			parserResult.TotalEntries += len(chunk.records)
+			addParsingProgress(chunk.bytes)
+			addParsingCommitted(int64(chunk.lineCount), int64(len(chunk.records)))
+		}
+	}
+
+	if scanErr != nil {
+		logrus.Errorf("扫描网站 %s 的文件时出错: %v", websiteID, scanErr)
+		p.notifyLogParsing(websiteID, "", "扫描日志文件", scanErr)
+	}
+	p.flushWhitelistHits(whitelistHits)
+	p.flushSecurityHits(securityHits)
+	p.bruteForce.Flush(p)
+	p.recordParsedHourBuckets(websiteID, parsedBuckets)
+	return result
+}
+
+// parseChunk 解析一批日志行并完成 UA/白名单等富化，不访问数据库
+func (p *LogParser) parseChunk(websiteID, sourceID string, chunk parseChunk, window parseWindow) parsedChunk {
+	parsed := parsedChunk{
+		seq:       chunk.seq,
+		lineCount: len(chunk.lines),
+		bytes:     chunk.bytes,
+		records:   make([]store.NginxLogRecord, 0, len(chunk.lines)),
+		buckets:   make(map[int64]struct{}),
+	}
+	matcher := p.whitelistMatchers[websiteID]
+	notifyRank := enrich.SecurityNotifyRank()
+	failures := 0
+	defer func() { observeParsedLines(websiteID, len(chunk.lines), failures) }()
+	for _, line := range chunk.lines {
+		entry, err := p.parseLogLine(websiteID, sourceID, line)
+		if err != nil {
+			failures++
+			continue
+		}
+		ts := entry.Timestamp.Unix()
+		if !window.allows(ts) {
+			continue
+		}
+		if matcher != nil && matcher.Enabled() {
+			if match, ok := matcher.Match(entry.IP); ok {
+				parsed.whitelistHits = p.recordWhitelistHit(websiteID, *entry, match, parsed.whitelistHits)
+			}
+		}
+		parsed.securityHits = p.recordSecurityHit(websiteID, *entry, notifyRank, parsed.securityHits)
+		parsed.records = append(parsed.records, *entry)
+		parsed.buckets[(ts/3600)*3600] = struct{}{}
+		if parsed.minTs == 0 || ts < parsed.minTs {
+			parsed.minTs = ts
+		}
+		if ts > parsed.maxTs {
+			parsed.maxTs = ts
+		}
+	}
+	return parsed
+}
+
+// commitParsedChunk 写入一批记录，返回是否成功（成功时 chunk.records 可能已剔除无法写入的记录）。
+// 批次写入失败会重试；重试用尽后若数据库仍可连通，说明是批次内容本身有问题，
+// 改为逐条写入并丢弃失败的记录，让偏移继续推进
+func (p *LogParser) commitParsedChunk(websiteID string, chunk *parsedChunk) bool {
+	if len(chunk.records) == 0 {
+		return true
+	}
+	// 先把本批次 location 标记为“待解析”，确保日志落库后前端可见；
+	// 再在日志成功落库后写入 ip_geo_pending，避免“先入队、后落库”导致回填命中空 ip_id 后把队列误删。
+	p.markBatchIPGeoPending(chunk.records)
+	var err error
+	for attempt := 0; attempt < commitRetryAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(commitRetryDelay * time.Duration(attempt))
+		}
+		if err = p.repo.BatchInsertLogsForWebsite(websiteID, chunk.records); err == nil {
+			break
+		}
+		logrus.Errorf("批量插入网站 %s 的日志记录失败（第 %d 次）: %v", websiteID, attempt+1, err)
+	}
+	if err != nil {
+		if pingErr := p.repo.GetDB().Ping(); pingErr != nil {
+			p.notifyDatabaseWrite(websiteID, "写入日志批次", err)
+			return false
+		}
+		chunk.records = p.commitRecordsOneByOne(websiteID, chunk.records, err)
+		if len(chunk.records) == 0 && p.repo.GetDB().Ping() != nil {
+			// 逐条写入期间数据库断开，按写入失败处理，下次扫描从本批次重新开始
+			p.notifyDatabaseWrite(websiteID, "写入日志批次", err)
+			return false
+		}
+	}
+	p.enqueueBatchIPGeo(chunk.records)
+	p.bruteForce.Observe(websiteID, chunk.records)
+	return true
+}
+
+// commitRecordsOneByOne 逐条写入反复失败的批次，返回写入成功的记录；失败的记录记日志后丢弃
+func (p *LogParser) commitRecordsOneByOne(
+	websiteID string, records []store.NginxLogRecord, batchErr error,
+) []store.NginxLogRecord {
+	committed := records[:0]
+	dropped := 0
+	for _, record := range records {
+		if err := p.repo.BatchInsertLogsForWebsite(websiteID, []store.NginxLogRecord{record}); err != nil {
+			dropped++
+			logrus.Warnf("网站 %s 丢弃无法写入的日志记录（%s %s %s）: %v",
+				websiteID, record.Timestamp.Format(time.RFC3339), record.Method, record.Url, err)
+			continue
+		}
+		committed = append(committed, record)
+	}
+	if dropped > 0 {
+		logrus.Errorf("网站 %s 的日志批次反复写入失败，已丢弃其中 %d 条无法写入的记录", websiteID, dropped)
+		p.notifyDatabaseWrite(websiteID, "写入日志批次",
+			fmt.Errorf("已跳过 %d 条无法写入的记录: %w", dropped, batchErr))
+	}
+	return committed
+}
@@ -0,0 +1,250 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich"
+	"github.com/likaia/nginxpulse/internal/store"
+)
+
+// MaxParsePreviewLines 单次解析预览允许的最大样例行数
+const MaxParsePreviewLines = 200
+
+// ParsePreviewRecord 归一化后的日志记录（与入库字段一致）
+type ParsePreviewRecord struct {
+	IP           string `json:"ip"`
+	Timestamp    int64  `json:"timestamp"`
+	Time         string `json:"time"`
+	Method       string `json:"method"`
+	URL          string `json:"url"`
+	Route        string `json:"route"`
+	StatusCode   int    `json:"status_code"`
+	BytesSent    int    `json:"bytes_sent"`
+	Referer      string `json:"referer"`
+	UserBrowser  string `json:"user_browser"`
+	UserOS       string `json:"user_os"`
+	UserDevice   string `json:"user_device"`
+	PageviewFlag bool   `json:"pageview_flag"`
+	// Extra 按 extraFields 白名单保留的额外字段
+	Extra map[string]string `json:"extra,omitempty"`
+	// Campaign 从 URL 中提取的推广活动参数
+	Campaign *store.CampaignInfo `json:"campaign,omitempty"`
+	// Channel 来源渠道分类
+	Channel *store.ChannelInfo `json:"channel,omitempty"`
+	// Attack 命中的 Web 攻击特征
+	Attack *store.AttackInfo `json:"attack,omitempty"`
+	// Reputation 命中的 IP 信誉名单
+	Reputation *store.ReputationInfo `json:"reputation,omitempty"`
+}
+
+// ParsePreviewLine 单行解析结果
+type ParsePreviewLine struct {
+	Index   int                 `json:"index"`
+	Raw     string              `json:"raw"`
+	Success bool                `json:"success"`
+	Error   string              `json:"error,omitempty"`
+	Fields  map[string]string   `json:"fields,omitempty"`
+	Record  *ParsePreviewRecord `json:"record,omitempty"`
+}
+
+// ParsePreviewResult 解析预览结果
+type ParsePreviewResult struct {
+	Source     string             `json:"source"`
+	ParseType  string             `json:"parse_type"`
+	Pattern    string             `json:"pattern,omitempty"`
+	TimeLayout string             `json:"time_layout,omitempty"`
+	Total      int                `json:"total"`
+	Matched    int                `json:"matched"`
+	Failed     int                `json:"failed"`
+	Lines      []ParsePreviewLine `json:"lines"`
+}
+
+// PreviewParseLines 使用站点/来源/内联解析配置解析样例日志，不写入任何数据。
+// inline 不为空时完全替代站点与来源上的解析配置。
+func PreviewParseLines(websiteID, sourceID string, inline *config.ParseConfig, lines []string) (ParsePreviewResult, error) {
+	website := config.WebsiteConfig{}
+	var sourceCfg *config.SourceConfig
+	websiteID = strings.TrimSpace(websiteID)
+	sourceID = strings.TrimSpace(sourceID)
+	if websiteID != "" {
+		site, ok := config.GetWebsiteByID(websiteID)
+		if !ok {
+			return ParsePreviewResult{}, errors.New("站点不存在")
+		}
+		website = site
+	}
+	if sourceID != "" {
+		for i := range website.Sources {
+			if strings.TrimSpace(website.Sources[i].ID) == sourceID {
+				sourceCfg = &website.Sources[i]
+				break
+			}
+		}
+		if sourceCfg == nil {
+			return ParsePreviewResult{}, fmt.Errorf("未找到日志来源: %s", sourceID)
+		}
+	}
+	if inline != nil {
+		website.LogType = ""
+		website.LogFormat = ""
+		website.LogRegex = ""
+		website.TimeLayout = ""
+		sourceCfg = &config.SourceConfig{ID: sourceID, Parse: inline}
+	}
+
+	parser, err := newLogLineParser(website, sourceCfg)
+	if err != nil {
+		return ParsePreviewResult{}, err
+	}
+	return previewWithParser(parser, lines), nil
+}
+
+func previewWithParser(parser *logLineParser, lines []string) ParsePreviewResult {
+	enrich.EnsurePVFilters()
+	enrich.EnsureRefererChannels()
+	enrich.EnsureSecurityRules()
+	enrich.EnsureIPReputation()
+	// 预览只展示解析结果，与格式检测一样不按保留天数过滤，历史样例也能正常解析
+	previewer := &LogParser{retentionDays: detectRetentionDays}
+
+	result := ParsePreviewResult{
+		Source:     parser.source,
+		ParseType:  parser.parseType,
+		TimeLayout: parser.timeLayout,
+		Lines:      make([]ParsePreviewLine, 0, len(lines)),
+	}
+	if parser.regex != nil {
+		result.Pattern = parser.regex.String()
+	}
+
+	for i, raw := range lines {
+		line := strings.TrimRight(raw, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		item := ParsePreviewLine{Index: i, Raw: line}
+		item.Fields = extractPreviewFields(parser, line)
+
+		var (
+			entry    *ParsePreviewRecord
+			parseErr error
+		)
+		switch parser.parseType {
+		case parseTypeCaddyJSON:
+			record, err := previewer.parseCaddyJSONLine(line, parser)
+			entry, parseErr = toPreviewRecord(record), err
+		default:
+			record, err := previewer.parseRegexLogLine(parser, line)
+			entry, parseErr = toPreviewRecord(record), err
+		}
+		result.Total++
+		if parseErr != nil {
+			item.Error = parseErr.Error()
+			result.Failed++
+		} else {
+			item.Success = true
+			item.Record = entry
+			result.Matched++
+		}
+		result.Lines = append(result.Lines, item)
+	}
+	return result
+}
+
+func toPreviewRecord(record *store.NginxLogRecord) *ParsePreviewRecord {
+	if record == nil {
+		return nil
+	}
+	return &ParsePreviewRecord{
+		IP:           record.IP,
+		Timestamp:    record.Timestamp.Unix(),
+		Time:         formatPreviewTime(record.Timestamp),
+		Method:       record.Method,
+		URL:          record.Url,
+		Route:        record.Route,
+		StatusCode:   record.Status,
+		BytesSent:    record.BytesSent,
+		Referer:      record.Referer,
+		UserBrowser:  record.UserBrowser,
+		UserOS:       record.UserOs,
+		UserDevice:   record.UserDevice,
+		PageviewFlag: record.PageviewFlag == 1,
+		Extra:        record.Extra,
+		Campaign:     record.Campaign,
+		Channel:      record.Channel,
+		Attack:       record.Attack,
+		Reputation:   record.Reputation,
+	}
+}
+
+// extractPreviewFields 返回一行日志中提取到的原始字段
+func extractPreviewFields(parser *logLineParser, line string) map[string]string {
+	fields := make(map[string]string)
+	if parser.parseType == parseTypeCaddyJSON {
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		var payload map[string]interface{}
+		if err := decoder.Decode(&payload); err != nil {
+			return nil
+		}
+		flattenPreviewFields("", payload, fields, 0)
+		return fields
+	}
+	if parser.regex == nil {
+		return nil
+	}
+	matches := parser.regex.FindStringSubmatch(line)
+	if len(matches) == 0 {
+		return nil
+	}
+	for name, idx := range parser.indexMap {
+		if idx < len(matches) {
+			fields[name] = matches[idx]
+		}
+	}
+	return fields
+}
+
+func flattenPreviewFields(prefix string, value interface{}, fields map[string]string, depth int) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if depth >= 3 {
+			if encoded, err := json.Marshal(typed); err == nil {
+				fields[prefix] = string(encoded)
+			}
+			return
+		}
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenPreviewFields(name, typed[key], fields, depth+1)
+		}
+	case []interface{}:
+		parts := make([]string, 0, len(typed))
+		for _, item := range typed {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		fields[prefix] = strings.Join(parts, ", ")
+	case nil:
+		fields[prefix] = ""
+	default:
+		fields[prefix] = fmt.Sprint(typed)
+	}
+}
+
+func formatPreviewTime(ts time.Time) string {
+	return ts.Format("2006-01-02 15:04:05 -0700")
+}
@@ -7,10 +7,26 @@ import (
 )
 
 type parseProgressState struct {
-	TotalBytes     int64
-	ProcessedBytes int64
-	StartedAt      time.Time
-	UpdatedAt      time.Time
+	TotalBytes       int64
+	ProcessedBytes   int64
+	LinesRead        int64
+	EntriesCommitted int64
+	BatchesCommitted int64
+	Workers          int
+	StartedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// ParsingThroughput 日志解析流水线吞吐指标
+type ParsingThroughput struct {
+	Workers          int     `json:"workers"`
+	LinesRead        int64   `json:"lines_read"`
+	EntriesCommitted int64   `json:"entries_committed"`
+	BatchesCommitted int64   `json:"batches_committed"`
+	BytesCommitted   int64   `json:"bytes_committed"`
+	LinesPerSecond   float64 `json:"lines_per_second"`
+	EntriesPerSecond float64 `json:"entries_per_second"`
+	BytesPerSecond   float64 `json:"bytes_per_second"`
 }
 
 var (
@@ -56,6 +72,22 @@ func addParsingProgress(deltaBytes int64) {
 	parseProgressMu.Unlock()
 }
 
+func setParsingWorkers(workers int) {
+	parseProgressMu.Lock()
+	parseProgress.Workers = workers
+	parseProgressMu.Unlock()
+}
+
+// addParsingCommitted 记录一个已提交批次覆盖的行数与入库条数
+func addParsingCommitted(lines, entries int64) {
+	parseProgressMu.Lock()
+	parseProgress.LinesRead += lines
+	parseProgress.EntriesCommitted += entries
+	parseProgress.BatchesCommitted++
+	parseProgress.UpdatedAt = time.Now()
+	parseProgressMu.Unlock()
+}
+
 func finalizeParsingProgress() {
 	parseProgressMu.Lock()
 	if parseProgress.TotalBytes > 0 {
@@ -138,3 +170,33 @@ func GetIPParsingEstimatedRemainingSeconds() int64 {
 
 	return int64(math.Ceil(remaining))
 }
+
+// GetIPParsingThroughput 返回当前（或最近一次）解析任务的吞吐指标
+func GetIPParsingThroughput() ParsingThroughput {
+	parseProgressMu.RLock()
+	state := parseProgress
+	parseProgressMu.RUnlock()
+
+	result := ParsingThroughput{
+		Workers:          state.Workers,
+		LinesRead:        state.LinesRead,
+		EntriesCommitted: state.EntriesCommitted,
+		BatchesCommitted: state.BatchesCommitted,
+		BytesCommitted:   state.ProcessedBytes,
+	}
+	if state.StartedAt.IsZero() {
+		return result
+	}
+	end := time.Now()
+	if !IsIPParsing() && state.UpdatedAt.After(state.StartedAt) {
+		end = state.UpdatedAt
+	}
+	elapsed := end.Sub(state.StartedAt).Seconds()
+	if elapsed <= 0 {
+		return result
+	}
+	result.LinesPerSecond = math.Round(float64(state.LinesRead)/elapsed*10) / 10
+	result.EntriesPerSecond = math.Round(float64(state.EntriesCommitted)/elapsed*10) / 10
+	result.BytesPerSecond = math.Round(float64(state.ProcessedBytes) / elapsed)
+	return result
+}
@@ -0,0 +1,89 @@
+package receiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Elasticsearch 文档中可作为原始日志行的字段（Filebeat / Logstash 为 message，Fluentd docker 日志为 log）
+var messageFieldNames = []string{"message", "log", "event.original"}
+
+// BulkItem _bulk 请求中的一个操作
+type BulkItem struct {
+	Action string
+	Index  string
+	ID     string
+	// Fields 展开后的文档字段，delete 操作为空
+	Fields map[string]string
+	// Source 文档原文，用于去重
+	Source string
+	// Err 解析失败原因，不为空时该操作返回 400
+	Err error
+}
+
+// Message 返回文档中的原始日志行
+func (item BulkItem) Message() string {
+	return firstField(item.Fields, messageFieldNames)
+}
+
+// ParseBulk 解析 _bulk 请求体（NDJSON：操作行 + 文档行），defaultIndex 为路径中的索引名
+func ParseBulk(body []byte, defaultIndex string) ([]BulkItem, error) {
+	var items []BulkItem
+	lines := bytes.Split(body, []byte("\n"))
+	for i := 0; i < len(lines); i++ {
+		line := bytes.TrimSpace(lines[i])
+		if len(line) == 0 {
+			continue
+		}
+		var action map[string]struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return nil, fmt.Errorf("第 %d 行不是有效的 bulk 操作", i+1)
+		}
+		var item BulkItem
+		for name, meta := range action {
+			item = BulkItem{Action: name, Index: meta.Index, ID: meta.ID}
+		}
+		if item.Index == "" {
+			item.Index = defaultIndex
+		}
+
+		switch item.Action {
+		case "index", "create":
+		case "update":
+			i++ // 跳过文档行
+			item.Err = fmt.Errorf("不支持 update 操作")
+			items = append(items, item)
+			continue
+		case "delete":
+			item.Err = fmt.Errorf("不支持 delete 操作")
+			items = append(items, item)
+			continue
+		default:
+			return nil, fmt.Errorf("第 %d 行的操作 %s 无效", i+1, item.Action)
+		}
+
+		i++
+		if i >= len(lines) {
+			return nil, fmt.Errorf("第 %d 行的操作缺少文档", i)
+		}
+		source := bytes.TrimSpace(lines[i])
+		decoder := json.NewDecoder(bytes.NewReader(source))
+		decoder.UseNumber()
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			item.Err = fmt.Errorf("文档不是有效的 JSON: %v", err)
+		} else {
+			item.Fields = FlattenJSON(doc)
+			item.Source = string(source)
+		}
+		if item.Index == "" && item.Err == nil {
+			item.Err = fmt.Errorf("缺少索引名")
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
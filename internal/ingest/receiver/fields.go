@@ -0,0 +1,128 @@
+package receiver
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/ingest"
+)
+
+// 结构化字段的候选名称，依次为 OpenTelemetry 语义约定、ECS（Filebeat / Logstash）与 nginx 变量名
+var (
+	ipFieldNames        = []string{"client.address", "client.ip", "source.address", "source.ip", "http.client_ip", "remote_addr", "client_ip"}
+	methodFieldNames    = []string{"http.request.method", "http.method", "request_method", "method"}
+	urlFieldNames       = []string{"url.original", "http.target", "request_uri", "uri"}
+	pathFieldNames      = []string{"url.path"}
+	queryFieldNames     = []string{"url.query"}
+	statusFieldNames    = []string{"http.response.status_code", "http.status_code", "status"}
+	bytesFieldNames     = []string{"http.response.body.size", "http.response.body.bytes", "http.response_content_length", "body_bytes_sent", "bytes_sent"}
+	refererFieldNames   = []string{"http.request.header.referer", "http.request.referrer", "http_referer", "referer", "referrer"}
+	userAgentFieldNames = []string{"user_agent.original", "http.user_agent", "http_user_agent", "user_agent"}
+	timeFieldNames      = []string{"@timestamp", "timestamp", "time_iso8601", "time_local", "time"}
+	requestFieldNames   = []string{"request"}
+)
+
+// StructuredFromFields 从扁平字段中识别访问日志，缺少 IP、方法、URL、状态码或时间时返回 false。
+// ts 非零时优先作为日志时间（如 OTLP 的 timeUnixNano）
+func StructuredFromFields(fields map[string]string, ts time.Time) (ingest.StructuredLog, bool) {
+	item := ingest.StructuredLog{
+		IP:         firstField(fields, ipFieldNames),
+		Method:     strings.ToUpper(firstField(fields, methodFieldNames)),
+		URL:        firstField(fields, urlFieldNames),
+		Referer:    firstField(fields, refererFieldNames),
+		UserAgent:  firstField(fields, userAgentFieldNames),
+		Time:       ts,
+		Attributes: fields,
+	}
+	if item.URL == "" {
+		if path := firstField(fields, pathFieldNames); path != "" {
+			item.URL = path
+			if query := firstField(fields, queryFieldNames); query != "" {
+				item.URL += "?" + query
+			}
+		}
+	}
+	if item.Method == "" || item.URL == "" {
+		if request := firstField(fields, requestFieldNames); request != "" {
+			if method, uri, err := ingest.ParseRequestLine(request); err == nil {
+				if item.Method == "" {
+					item.Method = method
+				}
+				if item.URL == "" {
+					item.URL = uri
+				}
+			}
+		}
+	}
+	status, err := strconv.Atoi(firstField(fields, statusFieldNames))
+	if err != nil || item.IP == "" || item.Method == "" || item.URL == "" {
+		return ingest.StructuredLog{}, false
+	}
+	item.Status = status
+	if bytesSent, err := strconv.Atoi(firstField(fields, bytesFieldNames)); err == nil {
+		item.BytesSent = bytesSent
+	}
+	if item.Referer == "-" {
+		item.Referer = ""
+	}
+	if item.Time.IsZero() {
+		raw := firstField(fields, timeFieldNames)
+		if raw == "" {
+			return ingest.StructuredLog{}, false
+		}
+		parsed, err := ingest.ParseLogTime(raw)
+		if err != nil {
+			return ingest.StructuredLog{}, false
+		}
+		item.Time = parsed
+	}
+	return item, true
+}
+
+func firstField(fields map[string]string, names []string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(fields[name]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// FlattenJSON 把嵌套对象展开为点号连接的扁平字段；数组只保留第一个标量元素
+func FlattenJSON(doc map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(doc))
+	flattenInto(fields, "", doc)
+	return fields
+}
+
+func flattenInto(fields map[string]string, prefix string, value interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenInto(fields, name, item)
+		}
+	case []interface{}:
+		for _, item := range typed {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}, nil:
+				continue
+			}
+			flattenInto(fields, prefix, item)
+			return
+		}
+	case string:
+		fields[prefix] = typed
+	case json.Number:
+		fields[prefix] = typed.String()
+	case float64:
+		fields[prefix] = strconv.FormatFloat(typed, 'f', -1, 64)
+	case bool:
+		fields[prefix] = strconv.FormatBool(typed)
+	}
+}
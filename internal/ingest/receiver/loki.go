@@ -0,0 +1,197 @@
+package receiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// MaxBodyBytes 请求体（压缩后）上限
+	MaxBodyBytes = 32 << 20
+	// maxDecodedBytes 解压后的请求体上限
+	maxDecodedBytes = 128 << 20
+)
+
+// LokiStream Loki push 请求中的一个流
+type LokiStream struct {
+	Labels map[string]string
+	Lines  []string
+}
+
+// ReadBody 读取请求体，处理 Content-Encoding: gzip
+func ReadBody(body io.Reader, contentEncoding string) ([]byte, error) {
+	reader := io.LimitReader(body, MaxBodyBytes+1)
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("gzip 解压失败: %w", err)
+		}
+		defer gz.Close()
+		data, err := io.ReadAll(io.LimitReader(gz, maxDecodedBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("gzip 解压失败: %w", err)
+		}
+		if len(data) > maxDecodedBytes {
+			return nil, fmt.Errorf("解压后超过 %d 字节", maxDecodedBytes)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("不支持的 Content-Encoding: %s", contentEncoding)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxBodyBytes {
+		return nil, fmt.Errorf("请求体超过 %d 字节", MaxBodyBytes)
+	}
+	return data, nil
+}
+
+// DecodeLokiPush 解析 Loki push 请求：application/json，或 snappy 压缩的 protobuf（默认）
+func DecodeLokiPush(body []byte, contentType string) ([]LokiStream, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/json" {
+		return decodeLokiJSON(body)
+	}
+	raw, err := snappy.Decode(body, maxDecodedBytes)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLokiProto(raw)
+}
+
+func decodeLokiJSON(body []byte) ([]LokiStream, error) {
+	var payload struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("JSON 解析失败: %w", err)
+	}
+	streams := make([]LokiStream, 0, len(payload.Streams))
+	for _, item := range payload.Streams {
+		stream := LokiStream{Labels: item.Stream, Lines: make([]string, 0, len(item.Values))}
+		// 每个值为 [时间戳, 日志行] 或 [时间戳, 日志行, 结构化元数据]
+		for _, value := range item.Values {
+			if len(value) < 2 {
+				return nil, fmt.Errorf("values 格式错误")
+			}
+			var line string
+			if err := json.Unmarshal(value[1], &line); err != nil {
+				return nil, fmt.Errorf("values 格式错误: %w", err)
+			}
+			stream.Lines = append(stream.Lines, line)
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// decodeLokiProto 解析 logproto.PushRequest，只读取流标签与日志行：
+//
+//	PushRequest  { repeated StreamAdapter streams = 1; }
+//	StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	EntryAdapter  { Timestamp timestamp = 1; string line = 2; }
+func decodeLokiProto(data []byte) ([]LokiStream, error) {
+	var streams []LokiStream
+	err := walkProto(data, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		var labels string
+		var lines []string
+		err := walkProto(value, func(num protowire.Number, value []byte) error {
+			switch num {
+			case 1:
+				labels = string(value)
+			case 2:
+				return walkProto(value, func(num protowire.Number, value []byte) error {
+					if num == 2 {
+						lines = append(lines, string(value))
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		parsed, err := config.ParseLabelSet(labels)
+		if err != nil {
+			return err
+		}
+		streams = append(streams, LokiStream{Labels: parsed, Lines: lines})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("protobuf 解析失败: %w", err)
+	}
+	return streams, nil
+}
+
+// walkProto 遍历消息的字段，length-delimited 字段交给 visit，其他类型跳过
+func walkProto(data []byte, visit func(num protowire.Number, value []byte) error) error {
+	return walkProtoFields(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		return visit(num, value)
+	})
+}
+
+// walkProtoFields 遍历消息的全部字段：length-delimited 字段的内容在 value 中，
+// varint / fixed32 / fixed64 字段的值在 scalar 中，group 字段跳过
+func walkProtoFields(data []byte, visit func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		var scalar uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			scalar, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			scalar, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			scalar = uint64(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := visit(num, typ, value, scalar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
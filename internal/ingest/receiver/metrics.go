@@ -0,0 +1,15 @@
+package receiver
+
+import "github.com/likaia/nginxpulse/internal/metrics"
+
+var receiverLinesTotal = metrics.NewCounter(
+	"nginxpulse_receiver_lines_total",
+	"接收端点收到的日志行数（accepted 已入库、deduped 重复、dropped 未匹配站点或解析失败）",
+	"receiver", "result",
+)
+
+func observeLines(receiver string, result Result) {
+	receiverLinesTotal.Add(float64(result.Accepted), receiver, "accepted")
+	receiverLinesTotal.Add(float64(result.Deduped), receiver, "deduped")
+	receiverLinesTotal.Add(float64(result.Dropped), receiver, "dropped")
+}
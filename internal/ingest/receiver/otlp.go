@@ -0,0 +1,470 @@
+package receiver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// OTLPResourceLogs OTLP 请求中同一资源下的日志
+type OTLPResourceLogs struct {
+	// Resource 资源属性，如 service.name、host.name，用于路由
+	Resource map[string]string
+	Records  []OTLPLogRecord
+}
+
+// OTLPLogRecord 一条 OTLP 日志
+type OTLPLogRecord struct {
+	// Time 取 timeUnixNano，缺失时取 observedTimeUnixNano，均缺失时为零值
+	Time time.Time
+	// Body 字符串类型的日志内容（原始日志行）
+	Body string
+	// Fields 资源属性、map 类型的日志内容与日志属性合并后的扁平字段，后者优先
+	Fields map[string]string
+}
+
+// IsOTLPJSON 判断请求是否为 OTLP JSON 编码，否则按 protobuf 处理
+func IsOTLPJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json"
+}
+
+// DecodeOTLPLogs 解析 OTLP/HTTP 的 ExportLogsServiceRequest（application/x-protobuf 或 application/json）
+func DecodeOTLPLogs(body []byte, contentType string) ([]OTLPResourceLogs, error) {
+	if IsOTLPJSON(contentType) {
+		return decodeOTLPJSON(body)
+	}
+	return decodeOTLPProto(body)
+}
+
+func newOTLPRecord(resource map[string]string, timeNano, observedNano uint64) OTLPLogRecord {
+	record := OTLPLogRecord{Fields: make(map[string]string, len(resource)+8)}
+	for key, value := range resource {
+		record.Fields[key] = value
+	}
+	if timeNano == 0 {
+		timeNano = observedNano
+	}
+	if timeNano > 0 && timeNano <= math.MaxInt64 {
+		record.Time = time.Unix(0, int64(timeNano))
+	}
+	return record
+}
+
+// decodeOTLPProto 按 opentelemetry-proto 的字段编号解析：
+//
+//	ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+//	ResourceLogs { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+//	Resource     { repeated KeyValue attributes = 1; }
+//	ScopeLogs    { repeated LogRecord log_records = 2; }
+//	LogRecord    { fixed64 time_unix_nano = 1; fixed64 observed_time_unix_nano = 11;
+//	               AnyValue body = 5; repeated KeyValue attributes = 6; }
+func decodeOTLPProto(data []byte) ([]OTLPResourceLogs, error) {
+	var result []OTLPResourceLogs
+	err := walkProto(data, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		item := OTLPResourceLogs{Resource: map[string]string{}}
+		var scopes [][]byte
+		err := walkProto(value, func(num protowire.Number, value []byte) error {
+			switch num {
+			case 1:
+				return walkProto(value, func(num protowire.Number, value []byte) error {
+					if num == 1 {
+						return flattenKeyValueProto(item.Resource, "", value)
+					}
+					return nil
+				})
+			case 2:
+				// 资源属性可能排在 scope_logs 之后，先收集再解析
+				scopes = append(scopes, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, scope := range scopes {
+			err := walkProto(scope, func(num protowire.Number, value []byte) error {
+				if num != 2 {
+					return nil
+				}
+				record, err := decodeOTLPRecordProto(item.Resource, value)
+				if err != nil {
+					return err
+				}
+				item.Records = append(item.Records, record)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		result = append(result, item)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("protobuf 解析失败: %w", err)
+	}
+	return result, nil
+}
+
+func decodeOTLPRecordProto(resource map[string]string, data []byte) (OTLPLogRecord, error) {
+	var timeNano, observedNano uint64
+	var body []byte
+	var attributes [][]byte
+	err := walkProtoFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			timeNano = scalar
+		case num == 11 && typ == protowire.Fixed64Type:
+			observedNano = scalar
+		case num == 5 && typ == protowire.BytesType:
+			body = value
+		case num == 6 && typ == protowire.BytesType:
+			attributes = append(attributes, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return OTLPLogRecord{}, err
+	}
+
+	record := newOTLPRecord(resource, timeNano, observedNano)
+	if body != nil {
+		// map 类型的内容展开为字段，其他类型作为原始日志行
+		isMap := false
+		if err := walkProto(body, func(num protowire.Number, value []byte) error {
+			if num == 6 {
+				isMap = true
+			}
+			return nil
+		}); err != nil {
+			return OTLPLogRecord{}, err
+		}
+		if isMap {
+			if err := flattenAnyValueProto(record.Fields, "", body); err != nil {
+				return OTLPLogRecord{}, err
+			}
+		} else {
+			values := map[string]string{}
+			if err := flattenAnyValueProto(values, "body", body); err != nil {
+				return OTLPLogRecord{}, err
+			}
+			record.Body = values["body"]
+		}
+	}
+	for _, value := range attributes {
+		if err := flattenKeyValueProto(record.Fields, "", value); err != nil {
+			return OTLPLogRecord{}, err
+		}
+	}
+	return record, nil
+}
+
+// AnyValue 中 map / 数组的最大嵌套层数，超出时拒绝请求，防止构造的请求耗尽栈空间
+const maxOTLPValueDepth = 32
+
+var errOTLPValueTooDeep = fmt.Errorf("属性嵌套超过 %d 层", maxOTLPValueDepth)
+
+// otlpFlattener 把 AnyValue 展开为点号连接的扁平字段。path 为当前字段名，
+// 进入下一层时追加、返回时截断，不在每一层重新拼接前缀
+type otlpFlattener struct {
+	fields map[string]string
+	path   []byte
+}
+
+func newOTLPFlattener(fields map[string]string, prefix string) *otlpFlattener {
+	return &otlpFlattener{fields: fields, path: append(make([]byte, 0, 64), prefix...)}
+}
+
+func (f *otlpFlattener) set(value string) {
+	f.fields[string(f.path)] = value
+}
+
+// push 进入子字段 key，返回用于 pop 的原长度
+func (f *otlpFlattener) push(key string) int {
+	mark := len(f.path)
+	if mark > 0 {
+		f.path = append(f.path, '.')
+	}
+	f.path = append(f.path, key...)
+	return mark
+}
+
+func (f *otlpFlattener) pop(mark int) {
+	f.path = f.path[:mark]
+}
+
+// flattenKeyValueProto 解析 KeyValue { string key = 1; AnyValue value = 2; }
+func flattenKeyValueProto(fields map[string]string, prefix string, data []byte) error {
+	return newOTLPFlattener(fields, prefix).keyValueProto(data, 0)
+}
+
+// flattenAnyValueProto 解析 AnyValue，与 FlattenJSON 一致：map 展开为点号字段，数组只保留第一个标量
+func flattenAnyValueProto(fields map[string]string, name string, data []byte) error {
+	return newOTLPFlattener(fields, name).anyValueProto(data, 0)
+}
+
+func (f *otlpFlattener) keyValueProto(data []byte, depth int) error {
+	var key string
+	var value []byte
+	err := walkProto(data, func(num protowire.Number, item []byte) error {
+		switch num {
+		case 1:
+			key = string(item)
+		case 2:
+			value = item
+		}
+		return nil
+	})
+	if err != nil || key == "" || value == nil {
+		return err
+	}
+	mark := f.push(key)
+	err = f.anyValueProto(value, depth)
+	f.pop(mark)
+	return err
+}
+
+// anyValueProto 解析 AnyValue：
+//
+//	AnyValue { string string_value = 1; bool bool_value = 2; int64 int_value = 3; double double_value = 4;
+//	           ArrayValue array_value = 5; KeyValueList kvlist_value = 6; bytes bytes_value = 7; }
+func (f *otlpFlattener) anyValueProto(data []byte, depth int) error {
+	if depth > maxOTLPValueDepth {
+		return errOTLPValueTooDeep
+	}
+	return walkProtoFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			f.set(string(value))
+		case 2:
+			f.set(strconv.FormatBool(scalar != 0))
+		case 3:
+			f.set(strconv.FormatInt(int64(scalar), 10))
+		case 4:
+			f.set(strconv.FormatFloat(math.Float64frombits(scalar), 'f', -1, 64))
+		case 5:
+			found := false
+			return walkProto(value, func(num protowire.Number, item []byte) error {
+				if num != 1 || found {
+					return nil
+				}
+				nested := false
+				if err := walkProto(item, func(num protowire.Number, _ []byte) error {
+					nested = nested || num == 5 || num == 6
+					return nil
+				}); err != nil || nested {
+					return err
+				}
+				found = true
+				return f.anyValueProto(item, depth+1)
+			})
+		case 6:
+			return walkProto(value, func(num protowire.Number, item []byte) error {
+				if num != 1 {
+					return nil
+				}
+				return f.keyValueProto(item, depth+1)
+			})
+		case 7:
+			f.set(base64.StdEncoding.EncodeToString(value))
+		}
+		return nil
+	})
+}
+
+// OTLP JSON 编码：字段名为 lowerCamelCase，64 位整数可能是字符串
+type otlpJSONRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpJSONKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			LogRecords []struct {
+				TimeUnixNano         json.Number        `json:"timeUnixNano"`
+				ObservedTimeUnixNano json.Number        `json:"observedTimeUnixNano"`
+				Body                 *otlpJSONAnyValue  `json:"body"`
+				Attributes           []otlpJSONKeyValue `json:"attributes"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string            `json:"key"`
+	Value *otlpJSONAnyValue `json:"value"`
+}
+
+type otlpJSONAnyValue struct {
+	StringValue *string      `json:"stringValue"`
+	BoolValue   *bool        `json:"boolValue"`
+	IntValue    *json.Number `json:"intValue"`
+	DoubleValue *json.Number `json:"doubleValue"`
+	BytesValue  *string      `json:"bytesValue"`
+	ArrayValue  *struct {
+		Values []otlpJSONAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []otlpJSONKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+}
+
+func (v *otlpJSONAnyValue) flatten(fields map[string]string, name string) error {
+	return newOTLPFlattener(fields, name).anyValueJSON(v, 0)
+}
+
+func flattenKeyValuesJSON(fields map[string]string, prefix string, values []otlpJSONKeyValue) error {
+	return newOTLPFlattener(fields, prefix).keyValuesJSON(values, 0)
+}
+
+func (f *otlpFlattener) anyValueJSON(v *otlpJSONAnyValue, depth int) error {
+	if depth > maxOTLPValueDepth {
+		return errOTLPValueTooDeep
+	}
+	switch {
+	case v == nil:
+	case v.StringValue != nil:
+		f.set(*v.StringValue)
+	case v.BoolValue != nil:
+		f.set(strconv.FormatBool(*v.BoolValue))
+	case v.IntValue != nil:
+		f.set(v.IntValue.String())
+	case v.DoubleValue != nil:
+		f.set(v.DoubleValue.String())
+	case v.BytesValue != nil:
+		f.set(*v.BytesValue)
+	case v.ArrayValue != nil:
+		for i := range v.ArrayValue.Values {
+			item := &v.ArrayValue.Values[i]
+			if item.ArrayValue == nil && item.KvlistValue == nil {
+				return f.anyValueJSON(item, depth+1)
+			}
+		}
+	case v.KvlistValue != nil:
+		return f.keyValuesJSON(v.KvlistValue.Values, depth+1)
+	}
+	return nil
+}
+
+func (f *otlpFlattener) keyValuesJSON(values []otlpJSONKeyValue, depth int) error {
+	for _, item := range values {
+		if item.Key == "" {
+			continue
+		}
+		mark := f.push(item.Key)
+		err := f.anyValueJSON(item.Value, depth)
+		f.pop(mark)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeOTLPJSON(body []byte) ([]OTLPResourceLogs, error) {
+	var payload otlpJSONRequest
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("JSON 解析失败: %w", err)
+	}
+	result := make([]OTLPResourceLogs, 0, len(payload.ResourceLogs))
+	for _, resourceLogs := range payload.ResourceLogs {
+		item := OTLPResourceLogs{Resource: map[string]string{}}
+		if err := flattenKeyValuesJSON(item.Resource, "", resourceLogs.Resource.Attributes); err != nil {
+			return nil, err
+		}
+		for _, scope := range resourceLogs.ScopeLogs {
+			for _, raw := range scope.LogRecords {
+				timeNano, err := parseOTLPNano(raw.TimeUnixNano)
+				if err != nil {
+					return nil, err
+				}
+				observedNano, err := parseOTLPNano(raw.ObservedTimeUnixNano)
+				if err != nil {
+					return nil, err
+				}
+				record := newOTLPRecord(item.Resource, timeNano, observedNano)
+				if raw.Body != nil {
+					if raw.Body.KvlistValue != nil {
+						if err := raw.Body.flatten(record.Fields, ""); err != nil {
+							return nil, err
+						}
+					} else {
+						values := map[string]string{}
+						if err := raw.Body.flatten(values, "body"); err != nil {
+							return nil, err
+						}
+						record.Body = values["body"]
+					}
+				}
+				if err := flattenKeyValuesJSON(record.Fields, "", raw.Attributes); err != nil {
+					return nil, err
+				}
+				item.Records = append(item.Records, record)
+			}
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func parseOTLPNano(value json.Number) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	nano, err := strconv.ParseUint(value.String(), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("时间戳 %s 无效", value)
+	}
+	return nano, nil
+}
+
+// EncodeOTLPResponse 编码 ExportLogsServiceResponse；rejected 大于 0 时带上 partial_success
+func EncodeOTLPResponse(jsonEncoding bool, rejected int, message string) []byte {
+	if jsonEncoding {
+		if rejected == 0 {
+			return []byte("{}")
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"partialSuccess": map[string]string{
+				"rejectedLogRecords": strconv.Itoa(rejected),
+				"errorMessage":       message,
+			},
+		})
+		return data
+	}
+	if rejected == 0 {
+		return []byte{}
+	}
+	// ExportLogsPartialSuccess { int64 rejected_log_records = 1; string error_message = 2; }
+	var partial []byte
+	partial = protowire.AppendTag(partial, 1, protowire.VarintType)
+	partial = protowire.AppendVarint(partial, uint64(rejected))
+	partial = protowire.AppendTag(partial, 2, protowire.BytesType)
+	partial = protowire.AppendString(partial, message)
+	var data []byte
+	data = protowire.AppendTag(data, 1, protowire.BytesType)
+	return protowire.AppendBytes(data, partial)
+}
+
+// EncodeOTLPStatus 编码错误响应体 google.rpc.Status { int32 code = 1; string message = 2; }
+func EncodeOTLPStatus(jsonEncoding bool, code int, message string) []byte {
+	if jsonEncoding {
+		data, _ := json.Marshal(map[string]interface{}{"code": code, "message": message})
+		return data
+	}
+	var data []byte
+	data = protowire.AppendTag(data, 1, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(code))
+	data = protowire.AppendTag(data, 2, protowire.BytesType)
+	return protowire.AppendString(data, message)
+}
@@ -0,0 +1,158 @@
+// Package receiver 解析第三方采集协议（Loki push、Elasticsearch _bulk、OTLP 等）的请求，按标签路由到站点后交给 LogParser 入库。
+package receiver
+
+import (
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/ingest"
+	"github.com/sirupsen/logrus"
+)
+
+// Target 日志写入的站点与来源
+type Target struct {
+	WebsiteID string
+	SourceID  string
+}
+
+type route struct {
+	selector config.LabelSelector
+	target   Target
+	ok       bool
+}
+
+// Router 按配置的路由把标签映射到站点，全部未命中时依次按 fallbackLabels 的值查找站点
+type Router struct {
+	routes         []route
+	fallbackLabels []string
+	defaultSource  string
+}
+
+// NewRouter 编译接收端点的路由；选择器无效或站点不存在的路由会被跳过（配置校验时已提示）
+func NewRouter(cfg *config.ReceiverConfig, defaultSource string, fallbackLabels ...string) *Router {
+	router := &Router{fallbackLabels: fallbackLabels, defaultSource: defaultSource}
+	if cfg == nil {
+		return router
+	}
+	for i, item := range cfg.Routes {
+		selector, err := config.ParseLabelSelector(item.Match)
+		if err != nil {
+			logrus.WithError(err).Warnf("接收路由 %d 的选择器无效，已跳过", i)
+			continue
+		}
+		websiteID, ok := config.ResolveWebsiteID(item.Website)
+		source := strings.TrimSpace(item.Source)
+		if source == "" {
+			source = defaultSource
+		}
+		// 站点不存在时仍保留路由，命中后丢弃，避免落入后续路由
+		router.routes = append(router.routes, route{
+			selector: selector,
+			target:   Target{WebsiteID: websiteID, SourceID: source},
+			ok:       ok,
+		})
+	}
+	return router
+}
+
+// Resolve 返回标签对应的站点与来源
+func (r *Router) Resolve(labels map[string]string) (Target, bool) {
+	for _, item := range r.routes {
+		if item.selector.Matches(labels) {
+			return item.target, item.ok
+		}
+	}
+	for _, label := range r.fallbackLabels {
+		if websiteID, ok := config.ResolveWebsiteID(labels[label]); ok {
+			return Target{WebsiteID: websiteID, SourceID: r.defaultSource}, true
+		}
+	}
+	return Target{}, false
+}
+
+// Batch 按站点与来源分组的待入库日志，原始日志行与结构化日志分开写入
+type Batch struct {
+	receiver string
+	order    []Target
+	groups   map[Target]*batchGroup
+	dropped  int
+}
+
+type batchGroup struct {
+	lines      []string
+	structured []ingest.StructuredLog
+}
+
+// NewBatch 创建分组，receiver 用于指标标签
+func NewBatch(receiver string) *Batch {
+	return &Batch{receiver: receiver, groups: make(map[Target]*batchGroup)}
+}
+
+func (b *Batch) group(target Target) *batchGroup {
+	group, ok := b.groups[target]
+	if !ok {
+		group = &batchGroup{}
+		b.groups[target] = group
+		b.order = append(b.order, target)
+	}
+	return group
+}
+
+// Add 追加一行原始日志，按站点（或来源）的解析配置解析
+func (b *Batch) Add(target Target, line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	group := b.group(target)
+	group.lines = append(group.lines, line)
+}
+
+// AddStructured 追加一条结构化日志，跳过正则解析
+func (b *Batch) AddStructured(target Target, item ingest.StructuredLog) {
+	group := b.group(target)
+	group.structured = append(group.structured, item)
+}
+
+// Drop 记录未能路由到站点的日志行数
+func (b *Batch) Drop(count int) {
+	b.dropped += count
+}
+
+// Result 入库结果
+type Result struct {
+	Accepted int `json:"accepted"`
+	Deduped  int `json:"deduped"`
+	// Dropped 未命中站点或解析失败的行数
+	Dropped int `json:"dropped"`
+}
+
+// Ingest 逐组写入日志，遇到数据库错误时立即返回，以便客户端重试
+func (b *Batch) Ingest(logParser *ingest.LogParser) (Result, error) {
+	result := Result{Dropped: b.dropped}
+	defer func() { observeLines(b.receiver, result) }()
+	for _, target := range b.order {
+		group := b.groups[target]
+		if len(group.lines) > 0 {
+			accepted, deduped, err := logParser.IngestLines(target.WebsiteID, target.SourceID, group.lines)
+			result.Accepted += accepted
+			result.Deduped += deduped
+			if err != nil {
+				return result, err
+			}
+			result.Dropped += len(group.lines) - accepted - deduped
+		}
+		if len(group.structured) > 0 {
+			accepted, deduped, err := logParser.IngestStructured(target.WebsiteID, target.SourceID, group.structured)
+			result.Accepted += accepted
+			result.Deduped += deduped
+			if err != nil {
+				return result, err
+			}
+			result.Dropped += len(group.structured) - accepted - deduped
+		}
+	}
+	if b.dropped > 0 {
+		logrus.Debugf("%s 接收端点有 %d 行日志未匹配到站点，已丢弃", b.receiver, b.dropped)
+	}
+	return result, nil
+}
@@ -0,0 +1,179 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+// 超过该时长的攻击命中只入库不发通知（例如首次导入历史日志）
+const securityNotifyMaxAge = 24 * time.Hour
+
+type securityHit struct {
+	count       int
+	websiteID   string
+	log         store.NginxLogRecord
+	fingerprint string
+}
+
+// detectAttack 匹配 Web 攻击特征，未命中返回 nil
+func detectAttack(decodedURL, userAgent string) *store.AttackInfo {
+	match, ok := enrich.DetectAttack(decodedURL, userAgent)
+	if !ok {
+		return nil
+	}
+	return &store.AttackInfo{
+		Type:     match.Type,
+		RuleID:   match.RuleID,
+		Severity: match.Severity,
+	}
+}
+
+// recordSecurityHit 记录达到通知级别的攻击命中，同一站点 / 攻击类型 / IP 合并计数
+func (p *LogParser) recordSecurityHit(
+	websiteID string,
+	log store.NginxLogRecord,
+	notifyRank int,
+	hits map[string]*securityHit,
+) map[string]*securityHit {
+	if log.Attack == nil || notifyRank <= 0 || enrich.SeverityRank(log.Attack.Severity) < notifyRank {
+		return hits
+	}
+	if log.Timestamp.Before(time.Now().Add(-securityNotifyMaxAge)) {
+		return hits
+	}
+	fingerprint := buildSecurityFingerprint(websiteID, log.Attack.Type, log.IP)
+	if fingerprint == "" {
+		return hits
+	}
+	if hits == nil {
+		hits = make(map[string]*securityHit)
+	}
+	if existing, ok := hits[fingerprint]; ok {
+		existing.count++
+		// 保留严重级别最高的一条作为通知内容
+		if enrich.SeverityRank(log.Attack.Severity) > enrich.SeverityRank(existing.log.Attack.Severity) {
+			existing.log = log
+		}
+		return hits
+	}
+	hits[fingerprint] = &securityHit{
+		count:       1,
+		websiteID:   websiteID,
+		log:         log,
+		fingerprint: fingerprint,
+	}
+	return hits
+}
+
+func mergeSecurityHits(dst, src map[string]*securityHit) map[string]*securityHit {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]*securityHit, len(src))
+	}
+	for fingerprint, hit := range src {
+		if existing, ok := dst[fingerprint]; ok {
+			existing.count += hit.count
+			if enrich.SeverityRank(hit.log.Attack.Severity) > enrich.SeverityRank(existing.log.Attack.Severity) {
+				existing.log = hit.log
+			}
+			continue
+		}
+		dst[fingerprint] = hit
+	}
+	return dst
+}
+
+func (p *LogParser) flushSecurityHits(hits map[string]*securityHit) {
+	if p == nil || p.repo == nil || len(hits) == 0 {
+		return
+	}
+	for _, hit := range hits {
+		siteName := ""
+		if site, ok := config.GetWebsiteByID(hit.websiteID); ok {
+			siteName = site.Name
+		}
+		attack := hit.log.Attack
+		metadata := map[string]interface{}{
+			"website_id":  hit.websiteID,
+			"ip":          hit.log.IP,
+			"url":         hit.log.Url,
+			"method":      hit.log.Method,
+			"status":      hit.log.Status,
+			"timestamp":   hit.log.Timestamp.Unix(),
+			"time":        hit.log.Timestamp.Format(time.RFC3339),
+			"attack_type": attack.Type,
+			"rule_id":     attack.RuleID,
+			"severity":    attack.Severity,
+		}
+		if siteName != "" {
+			metadata["website_name"] = siteName
+		}
+		entry := store.SystemNotification{
+			Level:       "warning",
+			Category:    "security",
+			Title:       "Web 攻击告警",
+			Message:     buildSecurityMessage(siteName, hit.log),
+			Fingerprint: hit.fingerprint,
+			Metadata:    metadata,
+		}
+		if _, err := p.repo.CreateSystemNotificationWithCount(entry, hit.count); err != nil {
+			logrus.WithError(err).Warn("写入攻击告警通知失败")
+		}
+	}
+}
+
+func buildSecurityFingerprint(websiteID, attackType, ip string) string {
+	normalizedID := strings.TrimSpace(websiteID)
+	normalizedIP := strings.TrimSpace(ip)
+	if normalizedID == "" || normalizedIP == "" || attackType == "" {
+		return ""
+	}
+	return fmt.Sprintf("security:%s:%s:%s", normalizedID, attackType, normalizedIP)
+}
+
+func buildSecurityMessage(siteName string, log store.NginxLogRecord) string {
+	message := fmt.Sprintf("IP %s 疑似%s（规则 %s）: %s %s",
+		log.IP, attackTypeLabel(log.Attack.Type), log.Attack.RuleID, log.Method, truncateSecurityURL(log.Url))
+	if siteName != "" {
+		message = fmt.Sprintf("站点 %s · %s", siteName, message)
+	}
+	return message
+}
+
+func attackTypeLabel(attackType string) string {
+	switch attackType {
+	case enrich.AttackSQLi:
+		return "SQL 注入"
+	case enrich.AttackXSS:
+		return "XSS 攻击"
+	case enrich.AttackPathTraversal:
+		return "目录穿越"
+	case enrich.AttackProbe:
+		return "敏感文件探测"
+	case enrich.AttackScanner:
+		return "扫描器访问"
+	case enrich.AttackWebshell:
+		return "WebShell 访问"
+	case enrich.AttackRCE:
+		return "命令执行"
+	default:
+		return "攻击（" + attackType + "）"
+	}
+}
+
+func truncateSecurityURL(value string) string {
+	const maxRunes = 200
+	runes := []rune(value)
+	if len(runes) <= maxRunes {
+		return value
+	}
+	return string(runes[:maxRunes]) + "…"
+}
@@ -164,7 +164,7 @@ func (p *LogParser) scanTarget(
 		state.LastOffset = meta.Size
 		state.BackfillDone = true
 	} else {
-		state.LastOffset = startOffset + bytesRead
+		state.LastOffset = clampOffset(startOffset+bytesRead, meta.Size)
 		state.BackfillDone = true
 	}
 	state.LastSize = meta.Size
@@ -0,0 +1,90 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/store"
+)
+
+// StructuredLog 已结构化的访问日志（如 Elasticsearch 文档、OTLP 属性），入库时跳过正则解析
+type StructuredLog struct {
+	IP        string
+	Method    string
+	URL       string
+	Referer   string
+	UserAgent string
+	Status    int
+	BytesSent int
+	Time      time.Time
+	// Attributes 原始字段（嵌套字段以点号连接），按站点 extraFields 采集额外字段
+	Attributes map[string]string
+	// Raw 原始内容，用于去重
+	Raw string
+}
+
+// IngestStructured 写入已结构化的访问日志，去重、安全检测与归属地解析与 IngestLines 一致
+func (p *LogParser) IngestStructured(websiteID, sourceID string, logs []StructuredLog) (int, int, error) {
+	if websiteID == "" {
+		return 0, 0, errors.New("websiteID 不能为空")
+	}
+	if len(logs) == 0 {
+		return 0, 0, nil
+	}
+	parser, err := p.getLineParserForSource(websiteID, sourceID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return p.ingestRecords(websiteID, sourceID, len(logs), func(i int) (*store.NginxLogRecord, string, error) {
+		item := logs[i]
+		if item.Time.IsZero() {
+			return nil, "", errors.New("日志缺少时间字段")
+		}
+		record, err := p.buildLogRecord(item.IP, item.Method, item.URL, item.Referer, item.UserAgent, item.Status, item.BytesSent, item.Time)
+		if err != nil {
+			return nil, "", err
+		}
+		record.Extra = structuredExtraFields(parser, item.Attributes)
+		record.Route = parser.normalizer.Normalize(item.URL)
+		record.Campaign = extractCampaign(item.URL, parser.clickIDParams)
+		record.Channel = classifyChannel(item.Referer, record.Campaign, parser.siteDomains)
+
+		raw := item.Raw
+		if raw == "" {
+			raw = fmt.Sprintf("%s\x1f%d\x1f%s\x1f%s\x1f%d\x1f%d\x1f%s\x1f%s",
+				item.IP, item.Time.UnixNano(), item.Method, item.URL, item.Status, item.BytesSent, item.Referer, item.UserAgent)
+		}
+		return record, raw, nil
+	})
+}
+
+func structuredExtraFields(parser *logLineParser, attributes map[string]string) map[string]string {
+	if len(parser.extraFields) == 0 || len(attributes) == 0 {
+		return nil
+	}
+	var extra map[string]string
+	for _, name := range parser.extraFields {
+		value := strings.TrimSpace(attributes[name])
+		if value == "" || value == "-" {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]string, len(parser.extraFields))
+		}
+		extra[name] = value
+	}
+	return extra
+}
+
+// ParseRequestLine 拆分 "GET /path HTTP/1.1" 形式的请求行
+func ParseRequestLine(line string) (string, string, error) {
+	return parseRequestLine(line)
+}
+
+// ParseLogTime 按 nginx 默认格式、RFC3339 或 Unix 时间戳解析时间
+func ParseLogTime(raw string) (time.Time, error) {
+	return parseLogTime(strings.TrimSpace(raw), "")
+}
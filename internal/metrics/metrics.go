@@ -0,0 +1,304 @@
+// Package metrics 提供 Prometheus 文本格式的指标导出。
+// 指标在包级变量中注册，标签组合数量受 maxSeriesPerFamily 限制，超出后合并到 "other"。
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// 单个指标的标签组合上限，防止异常输入导致时间序列无限增长
+	maxSeriesPerFamily = 1000
+	// OverflowLabel 超出上限或不在白名单内的标签值
+	OverflowLabel = "other"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// DefaultDurationBuckets 耗时类直方图的默认分桶（秒）
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// 仅直方图使用
+	bucketCounts []uint64
+	count        uint64
+}
+
+type family struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+var registry struct {
+	mu         sync.Mutex
+	families   []*family
+	collectors []func(*Writer)
+}
+
+func newFamily(name, help, metricType string, buckets []float64, labelNames []string) *family {
+	f := &family{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	registry.mu.Lock()
+	registry.families = append(registry.families, f)
+	registry.mu.Unlock()
+	return f
+}
+
+// get 返回标签值对应的序列，调用方需持有 f.mu
+func (f *family) get(labelValues []string) *series {
+	values := make([]string, len(f.labelNames))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	if len(f.series) >= maxSeriesPerFamily {
+		for i := range values {
+			values[i] = OverflowLabel
+		}
+		key = strings.Join(values, "\xff")
+		if s, ok := f.series[key]; ok {
+			return s
+		}
+	}
+	s := &series{labelValues: values}
+	if f.metricType == typeHistogram {
+		s.bucketCounts = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+	return s
+}
+
+// Counter 只增不减的计数器
+type Counter struct {
+	f *family
+}
+
+// NewCounter 注册计数器，labelValues 需与 labelNames 一一对应
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	return &Counter{f: newFamily(name, help, typeCounter, nil, labelNames)}
+}
+
+// Add 增加计数，负数会被忽略
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value <= 0 {
+		return
+	}
+	c.f.mu.Lock()
+	c.f.get(labelValues).value += value
+	c.f.mu.Unlock()
+}
+
+// Inc 计数加一
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge 可增可减的当前值
+type Gauge struct {
+	f *family
+}
+
+// NewGauge 注册 gauge
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{f: newFamily(name, help, typeGauge, nil, labelNames)}
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.f.mu.Lock()
+	g.f.get(labelValues).value = value
+	g.f.mu.Unlock()
+}
+
+// Histogram 分桶统计
+type Histogram struct {
+	f *family
+}
+
+// NewHistogram 注册直方图，buckets 需升序
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	return &Histogram{f: newFamily(name, help, typeHistogram, buckets, labelNames)}
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.f.mu.Lock()
+	s := h.f.get(labelValues)
+	for i, bound := range h.f.buckets {
+		if value <= bound {
+			s.bucketCounts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+	h.f.mu.Unlock()
+}
+
+// RegisterCollector 注册抓取时计算的指标（如数据库中的待处理数量）
+func RegisterCollector(collect func(*Writer)) {
+	registry.mu.Lock()
+	registry.collectors = append(registry.collectors, collect)
+	registry.mu.Unlock()
+}
+
+// Writer 以 Prometheus 文本格式输出指标
+type Writer struct {
+	out      *bufio.Writer
+	declared map[string]bool
+}
+
+// Gauge 输出一个 gauge 样本，labels 为 name、value 交替排列
+func (w *Writer) Gauge(name, help string, value float64, labels ...string) {
+	w.sample(name, help, typeGauge, name, value, labels)
+}
+
+// Counter 输出一个 counter 样本，labels 为 name、value 交替排列
+func (w *Writer) Counter(name, help string, value float64, labels ...string) {
+	w.sample(name, help, typeCounter, name, value, labels)
+}
+
+func (w *Writer) declare(name, help, metricType string) {
+	if w.declared[name] {
+		return
+	}
+	w.declared[name] = true
+	fmt.Fprintf(w.out, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w.out, "# TYPE %s %s\n", name, metricType)
+}
+
+func (w *Writer) sample(family, help, metricType, name string, value float64, labels []string) {
+	w.declare(family, help, metricType)
+	w.out.WriteString(name)
+	if len(labels) >= 2 {
+		w.out.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.out.WriteByte(',')
+			}
+			fmt.Fprintf(w.out, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		w.out.WriteByte('}')
+	}
+	w.out.WriteByte(' ')
+	w.out.WriteString(formatValue(value))
+	w.out.WriteByte('\n')
+}
+
+// WriteText 输出全部已注册指标
+func WriteText(out io.Writer) error {
+	w := &Writer{out: bufio.NewWriter(out), declared: make(map[string]bool)}
+
+	registry.mu.Lock()
+	families := append(make([]*family, 0, len(registry.families)), registry.families...)
+	collectors := append(make([]func(*Writer), 0, len(registry.collectors)), registry.collectors...)
+	registry.mu.Unlock()
+
+	for _, f := range families {
+		f.write(w)
+	}
+	for _, collect := range collectors {
+		collect(w)
+	}
+	return w.out.Flush()
+}
+
+func (f *family) write(w *Writer) {
+	f.mu.Lock()
+	items := make([]series, 0, len(f.series))
+	for _, s := range f.series {
+		snapshot := *s
+		snapshot.bucketCounts = append([]uint64(nil), s.bucketCounts...)
+		items = append(items, snapshot)
+	}
+	f.mu.Unlock()
+
+	w.declare(f.name, f.help, f.metricType)
+	sort.Slice(items, func(i, j int) bool {
+		return strings.Join(items[i].labelValues, "\xff") < strings.Join(items[j].labelValues, "\xff")
+	})
+	for _, s := range items {
+		labels := make([]string, 0, len(f.labelNames)*2+2)
+		for i, name := range f.labelNames {
+			labels = append(labels, name, s.labelValues[i])
+		}
+		if f.metricType != typeHistogram {
+			w.sample(f.name, f.help, f.metricType, f.name, s.value, labels)
+			continue
+		}
+		for i, bound := range f.buckets {
+			w.sample(f.name, f.help, f.metricType, f.name+"_bucket", float64(s.bucketCounts[i]),
+				append(labels, "le", formatValue(bound)))
+		}
+		w.sample(f.name, f.help, f.metricType, f.name+"_bucket", float64(s.count), append(labels, "le", "+Inf"))
+		w.sample(f.name, f.help, f.metricType, f.name+"_sum", s.value, labels)
+		w.sample(f.name, f.help, f.metricType, f.name+"_count", float64(s.count), labels)
+	}
+}
+
+// StatusClass 将状态码归为 1xx ~ 5xx，其他值为 other
+func StatusClass(status int) string {
+	if status >= 100 && status < 600 {
+		return strconv.Itoa(status/100) + "xx"
+	}
+	return OverflowLabel
+}
+
+var knownMethods = map[string]struct{}{
+	"GET": {}, "POST": {}, "PUT": {}, "DELETE": {}, "PATCH": {},
+	"HEAD": {}, "OPTIONS": {}, "CONNECT": {}, "TRACE": {},
+}
+
+// Method 标准 HTTP 方法保留原值（大写），其他值为 other
+func Method(method string) string {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if _, ok := knownMethods[method]; ok {
+		return method
+	}
+	return OverflowLabel
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
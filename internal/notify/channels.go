@@ -0,0 +1,443 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+const (
+	defaultTelegramAPI = "https://api.telegram.org"
+	maxResponseBytes   = 64 * 1024
+	smtpTimeout        = 30 * time.Second
+)
+
+// send 按渠道类型发送一条通知，返回 HTTP 状态码（邮件渠道为 0）
+func send(ctx context.Context, client *http.Client, channel config.NotificationChannelConfig, message Message) (int, error) {
+	switch strings.TrimSpace(channel.Type) {
+	case config.NotifyChannelWebhook:
+		return sendWebhook(ctx, client, channel, message)
+	case config.NotifyChannelSlack:
+		return postJSON(ctx, client, channel.URL, map[string]interface{}{
+			"text": plainText(message),
+		}, nil, checkSlackResponse)
+	case config.NotifyChannelTelegram:
+		return sendTelegram(ctx, client, channel, message)
+	case config.NotifyChannelDingTalk:
+		return sendDingTalk(ctx, client, channel, message)
+	case config.NotifyChannelWeCom:
+		return postJSON(ctx, client, channel.URL, map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": markdownText(message)},
+		}, nil, checkErrcodeResponse)
+	case config.NotifyChannelFeishu:
+		return sendFeishu(ctx, client, channel, message)
+	case config.NotifyChannelEmail:
+		return 0, sendEmail(channel.SMTP, message)
+	default:
+		return 0, fmt.Errorf("不支持的渠道类型: %s", channel.Type)
+	}
+}
+
+// sendWebhook 发送自定义 webhook。配置了 secret 时附带签名：
+// X-NginxPulse-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+func sendWebhook(ctx context.Context, client *http.Client, channel config.NotificationChannelConfig, message Message) (int, error) {
+	body, err := renderWebhookBody(channel.Template, message)
+	if err != nil {
+		return 0, err
+	}
+	return postBody(ctx, client, channel.URL, body, webhookHeaders(channel, body), nil)
+}
+
+// webhookHeaders 自定义请求头加上时间戳与签名头
+func webhookHeaders(channel config.NotificationChannelConfig, body []byte) map[string]string {
+	headers := make(map[string]string, len(channel.Headers)+2)
+	for key, value := range channel.Headers {
+		headers[key] = value
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	headers["X-NginxPulse-Timestamp"] = timestamp
+	if channel.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(channel.Secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		headers["X-NginxPulse-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	return headers
+}
+
+func renderWebhookBody(tpl string, message Message) ([]byte, error) {
+	if strings.TrimSpace(tpl) == "" {
+		return json.Marshal(message)
+	}
+	parsed, err := template.New("webhook").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+	}).Parse(tpl)
+	if err != nil {
+		return nil, fmt.Errorf("webhook 模板解析失败: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := parsed.Execute(&buf, message); err != nil {
+		return nil, fmt.Errorf("webhook 模板渲染失败: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("webhook 模板渲染结果不是合法 JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+func sendTelegram(ctx context.Context, client *http.Client, channel config.NotificationChannelConfig, message Message) (int, error) {
+	return postJSON(ctx, client, telegramEndpoint(channel), map[string]interface{}{
+		"chat_id":                  strings.TrimSpace(channel.ChatID),
+		"text":                     plainText(message),
+		"disable_web_page_preview": true,
+	}, nil, checkTelegramResponse)
+}
+
+func telegramEndpoint(channel config.NotificationChannelConfig) string {
+	base := strings.TrimRight(strings.TrimSpace(channel.URL), "/")
+	if base == "" {
+		base = defaultTelegramAPI
+	}
+	return fmt.Sprintf("%s/bot%s/sendMessage", base, strings.TrimSpace(channel.BotToken))
+}
+
+func checkTelegramResponse(body []byte) error {
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	if !resp.OK {
+		return fmt.Errorf("telegram 返回错误: %s", resp.Description)
+	}
+	return nil
+}
+
+// sendDingTalk 钉钉自定义机器人，配置 secret 时使用加签：base64(HMAC-SHA256(secret, timestamp + "\n" + secret))
+func sendDingTalk(ctx context.Context, client *http.Client, channel config.NotificationChannelConfig, message Message) (int, error) {
+	endpoint, err := dingTalkEndpoint(channel)
+	if err != nil {
+		return 0, err
+	}
+	return postJSON(ctx, client, endpoint, map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": message.Title,
+			"text":  markdownText(message),
+		},
+	}, nil, checkErrcodeResponse)
+}
+
+func dingTalkEndpoint(channel config.NotificationChannelConfig) (string, error) {
+	endpoint := strings.TrimSpace(channel.URL)
+	if channel.Secret == "" {
+		return endpoint, nil
+	}
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(channel.Secret))
+	mac.Write([]byte(timestamp + "\n" + channel.Secret))
+	sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("解析 url 失败: %w", err)
+	}
+	query := parsed.Query()
+	query.Set("timestamp", timestamp)
+	query.Set("sign", sign)
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// sendFeishu 飞书自定义机器人，配置 secret 时使用签名校验：base64(HMAC-SHA256(key=timestamp + "\n" + secret, ""))
+func sendFeishu(ctx context.Context, client *http.Client, channel config.NotificationChannelConfig, message Message) (int, error) {
+	return postFeishu(ctx, client, channel, plainText(message))
+}
+
+func postFeishu(ctx context.Context, client *http.Client, channel config.NotificationChannelConfig, text string) (int, error) {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": text},
+	}
+	if channel.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+channel.Secret))
+		payload["timestamp"] = timestamp
+		payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	return postJSON(ctx, client, channel.URL, payload, nil, func(body []byte) error {
+		var resp struct {
+			Code       *int   `json:"code"`
+			Msg        string `json:"msg"`
+			StatusCode *int   `json:"StatusCode"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("解析响应失败: %w", err)
+		}
+		if resp.Code != nil && *resp.Code != 0 {
+			return fmt.Errorf("飞书返回错误 %d: %s", *resp.Code, resp.Msg)
+		}
+		if resp.StatusCode != nil && *resp.StatusCode != 0 {
+			return fmt.Errorf("飞书返回错误 %d", *resp.StatusCode)
+		}
+		return nil
+	})
+}
+
+// checkErrcodeResponse 校验钉钉 / 企业微信的 {"errcode":0,"errmsg":"ok"} 响应
+func checkErrcodeResponse(body []byte) error {
+	var resp struct {
+		Errcode int    `json:"errcode"`
+		Errmsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	if resp.Errcode != 0 {
+		return fmt.Errorf("机器人返回错误 %d: %s", resp.Errcode, resp.Errmsg)
+	}
+	return nil
+}
+
+func checkSlackResponse(body []byte) error {
+	if text := strings.TrimSpace(string(body)); text != "" && text != "ok" {
+		return fmt.Errorf("slack 返回错误: %s", text)
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, endpoint string, payload interface{},
+	headers map[string]string, check func([]byte) error) (int, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	return postBody(ctx, client, endpoint, body, headers, check)
+}
+
+// postBody 发送 JSON 请求，非 2xx 视为失败；check 用于校验 2xx 响应体中的业务错误码
+func postBody(ctx context.Context, client *http.Client, endpoint string, body []byte,
+	headers map[string]string, check func([]byte) error) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSpace(endpoint), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncateText(strings.TrimSpace(string(respBody)), 200))
+	}
+	if check != nil {
+		if err := check(respBody); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// sendEmail 通过 SMTP 发送纯文本邮件
+func sendEmail(cfg *config.SMTPConfig, message Message) error {
+	return sendMail(cfg, func(from *mail.Address, recipients []*mail.Address) []byte {
+		return buildEmail(from, recipients, message)
+	})
+}
+
+// sendMail 通过 SMTP 发送 build 生成的邮件；465 端口 TLS 直连，其他端口在服务器支持时升级 STARTTLS
+func sendMail(cfg *config.SMTPConfig, build func(from *mail.Address, recipients []*mail.Address) []byte) error {
+	if cfg == nil {
+		return fmt.Errorf("未配置 smtp")
+	}
+	host := strings.TrimSpace(cfg.Host)
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	from, err := mail.ParseAddress(strings.TrimSpace(cfg.From))
+	if err != nil {
+		return fmt.Errorf("发件人地址无效: %w", err)
+	}
+	recipients := make([]*mail.Address, 0, len(cfg.To))
+	for _, raw := range cfg.To {
+		address, err := mail.ParseAddress(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("收件人地址无效: %w", err)
+		}
+		recipients = append(recipients, address)
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("收件人不能为空")
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	var conn net.Conn
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP 握手失败: %w", err)
+	}
+	defer client.Close()
+
+	if port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("STARTTLS 失败: %w", err)
+			}
+		}
+	}
+	if cfg.Username != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("SMTP 服务器不支持认证")
+		}
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient.Address); err != nil {
+			return fmt.Errorf("收件人 %s 被拒绝: %w", recipient.Address, err)
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(build(from, recipients)); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func buildEmail(from *mail.Address, recipients []*mail.Address, message Message) []byte {
+	subject := fmt.Sprintf("[NginxPulse][%s] %s", message.Level, message.Title)
+
+	var buf bytes.Buffer
+	writeEmailHeaders(&buf, from, recipients, subject)
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	writeBase64Lines(&buf, []byte(plainText(message)))
+	return buf.Bytes()
+}
+
+func writeEmailHeaders(buf *bytes.Buffer, from *mail.Address, recipients []*mail.Address, subject string) {
+	to := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		to = append(to, recipient.String())
+	}
+	fmt.Fprintf(buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+}
+
+// writeBase64Lines 按 76 字符折行写入 base64 内容
+func writeBase64Lines(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+}
+
+// plainText IM 与邮件使用的纯文本内容
+func plainText(message Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s\n", strings.ToUpper(message.Level), message.Title)
+	if site := siteLabel(message); site != "" {
+		fmt.Fprintf(&b, "站点: %s\n", site)
+	}
+	b.WriteString(message.Message)
+	b.WriteString("\n")
+	if message.Occurrences > 1 {
+		fmt.Fprintf(&b, "累计次数: %d\n", message.Occurrences)
+	}
+	fmt.Fprintf(&b, "时间: %s", message.Time.Format("2006-01-02 15:04:05"))
+	return b.String()
+}
+
+// markdownText 钉钉 / 企业微信使用的 markdown 内容
+func markdownText(message Message) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", message.Title)
+	fmt.Fprintf(&b, "> 级别: %s  \n> 分类: %s  \n", message.Level, message.Category)
+	if site := siteLabel(message); site != "" {
+		fmt.Fprintf(&b, "> 站点: %s  \n", site)
+	}
+	if message.Occurrences > 1 {
+		fmt.Fprintf(&b, "> 累计次数: %d  \n", message.Occurrences)
+	}
+	fmt.Fprintf(&b, "> 时间: %s\n\n", message.Time.Format("2006-01-02 15:04:05"))
+	b.WriteString(message.Message)
+	return b.String()
+}
+
+func siteLabel(message Message) string {
+	switch {
+	case message.WebsiteName != "" && message.WebsiteID != "":
+		return fmt.Sprintf("%s (%s)", message.WebsiteName, message.WebsiteID)
+	case message.WebsiteName != "":
+		return message.WebsiteName
+	default:
+		return message.WebsiteID
+	}
+}
+
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "..."
+}
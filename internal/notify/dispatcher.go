@@ -0,0 +1,349 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRepeatInterval = 30 * time.Minute
+	defaultRetries        = 3
+	queueSize             = 256
+	workerCount           = 2
+	requestTimeout        = 10 * time.Second
+	maxRetryBackoff       = time.Minute
+	// throttle 记录超过该数量时清理过期项
+	throttlePruneSize = 4096
+)
+
+// Message 发送给各渠道的通知内容，也是 webhook 模板的数据
+type Message struct {
+	ID          int64                  `json:"id"`
+	Level       string                 `json:"level"`
+	Category    string                 `json:"category"`
+	Title       string                 `json:"title"`
+	Message     string                 `json:"message"`
+	Fingerprint string                 `json:"fingerprint,omitempty"`
+	Occurrences int                    `json:"occurrences"`
+	WebsiteID   string                 `json:"website_id,omitempty"`
+	WebsiteName string                 `json:"website_name,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Time        time.Time              `json:"time"`
+}
+
+type job struct {
+	channel config.NotificationChannelConfig
+	message Message
+}
+
+// Dispatcher 按路由将系统通知异步分发到外部渠道，失败重试并记录外发日志
+type Dispatcher struct {
+	repo   *store.Repository
+	client *http.Client
+	queue  chan job
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// NewDispatcher 创建通知分发器，需调用 Start 启动发送协程
+func NewDispatcher(repo *store.Repository) *Dispatcher {
+	return &Dispatcher{
+		repo:     repo,
+		client:   &http.Client{Timeout: requestTimeout},
+		queue:    make(chan job, queueSize),
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+// Start 启动发送协程，ctx 取消后停止，队列中未发送的通知被丢弃
+func (d *Dispatcher) Start(ctx context.Context) {
+	for i := 0; i < workerCount; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case item := <-d.queue:
+					d.deliver(ctx, item)
+				}
+			}
+		}()
+	}
+}
+
+// Dispatch 实现 store.NotificationDispatcher，不阻塞调用方
+func (d *Dispatcher) Dispatch(notification store.SystemNotification) {
+	cfg := config.ReadConfig().Notifications
+	if cfg == nil || len(cfg.Channels) == 0 {
+		return
+	}
+	message := newMessage(notification)
+	interval := repeatInterval(cfg)
+	for _, channel := range matchChannels(cfg, message) {
+		if !d.allow(channel.Name, message.Fingerprint, interval) {
+			continue
+		}
+		select {
+		case d.queue <- job{channel: channel, message: message}:
+		default:
+			// 未发出的通知不占用节流窗口，并记一条失败的外发记录便于排查
+			logrus.Warnf("通知外发队列已满，丢弃发往渠道 %s 的通知: %s", channel.Name, message.Title)
+			d.forget(channel.Name, message.Fingerprint)
+			d.record(channel, message, 0, 0, errors.New("通知外发队列已满，未发送"))
+		}
+	}
+}
+
+// SendTest 同步向指定渠道发送一条测试通知（不重试），结果写入外发记录
+func (d *Dispatcher) SendTest(ctx context.Context, channelName string) error {
+	channel, ok := findChannel(channelName)
+	if !ok {
+		return fmt.Errorf("渠道不存在: %s", channelName)
+	}
+	message := Message{
+		Level:    "info",
+		Category: "test",
+		Title:    "NginxPulse 测试通知",
+		Message:  fmt.Sprintf("这是一条来自渠道 %s 的测试通知。", channel.Name),
+		Time:     time.Now(),
+	}
+	statusCode, err := send(ctx, d.client, channel, message)
+	d.record(channel, message, 1, statusCode, err)
+	return err
+}
+
+// ChannelInfo 渠道概要，不含地址与密钥
+type ChannelInfo struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Channels 返回已配置的渠道（含禁用）
+func Channels() []ChannelInfo {
+	cfg := config.ReadConfig().Notifications
+	channels := make([]ChannelInfo, 0)
+	if cfg == nil {
+		return channels
+	}
+	for _, channel := range cfg.Channels {
+		channels = append(channels, ChannelInfo{
+			Name:     strings.TrimSpace(channel.Name),
+			Type:     strings.TrimSpace(channel.Type),
+			Disabled: channel.Disabled,
+		})
+	}
+	return channels
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, item job) {
+	attempt, statusCode, err := withRetry(ctx, func() (int, error) {
+		return send(ctx, d.client, item.channel, item.message)
+	})
+	if err != nil {
+		logrus.WithError(err).Warnf("通知发送到渠道 %s 失败（已尝试 %d 次）: %s", item.channel.Name, attempt, item.message.Title)
+		// 失败后允许下次立即重发
+		d.forget(item.channel.Name, item.message.Fingerprint)
+	}
+	d.record(item.channel, item.message, attempt, statusCode, err)
+}
+
+// withRetry 按 2s、4s、8s…（最长 1 分钟）间隔重试 fn，返回尝试次数；ctx 取消时停止重试
+func withRetry(ctx context.Context, fn func() (int, error)) (int, int, error) {
+	attempts := 1 + retries(config.ReadConfig().Notifications)
+	backoff := 2 * time.Second
+	var (
+		statusCode int
+		err        error
+	)
+	for attempt := 1; ; attempt++ {
+		statusCode, err = fn()
+		if err == nil || attempt >= attempts {
+			return attempt, statusCode, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, statusCode, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+func (d *Dispatcher) record(channel config.NotificationChannelConfig, message Message, attempts, statusCode int, err error) {
+	delivery := store.NotificationDelivery{
+		NotificationID: message.ID,
+		Fingerprint:    message.Fingerprint,
+		Channel:        channel.Name,
+		ChannelType:    channel.Type,
+		Title:          message.Title,
+		Status:         store.NotificationDeliverySuccess,
+		Attempts:       attempts,
+		StatusCode:     statusCode,
+	}
+	if err != nil {
+		delivery.Status = store.NotificationDeliveryFailed
+		delivery.Error = err.Error()
+	}
+	if saveErr := d.repo.SaveNotificationDelivery(delivery); saveErr != nil {
+		logrus.WithError(saveErr).Warn("写入通知外发记录失败")
+	}
+}
+
+// allow 同一指纹在 interval 内只向同一渠道发送一次；无指纹的通知不限制
+func (d *Dispatcher) allow(channel, fingerprint string, interval time.Duration) bool {
+	if fingerprint == "" || interval <= 0 {
+		return true
+	}
+	now := time.Now()
+	key := channel + "|" + fingerprint
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if last, ok := d.lastSent[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+	if len(d.lastSent) >= throttlePruneSize {
+		for k, last := range d.lastSent {
+			if now.Sub(last) >= interval {
+				delete(d.lastSent, k)
+			}
+		}
+	}
+	d.lastSent[key] = now
+	return true
+}
+
+func (d *Dispatcher) forget(channel, fingerprint string) {
+	if fingerprint == "" {
+		return
+	}
+	d.mu.Lock()
+	delete(d.lastSent, channel+"|"+fingerprint)
+	d.mu.Unlock()
+}
+
+func newMessage(notification store.SystemNotification) Message {
+	message := Message{
+		ID:          notification.ID,
+		Level:       notification.Level,
+		Category:    notification.Category,
+		Title:       notification.Title,
+		Message:     notification.Message,
+		Fingerprint: notification.Fingerprint,
+		Occurrences: notification.Occurrences,
+		Metadata:    notification.Metadata,
+		Time:        time.Now(),
+	}
+	if notification.Metadata != nil {
+		message.WebsiteID = metadataString(notification.Metadata, "website_id")
+		message.WebsiteName = metadataString(notification.Metadata, "website_name")
+	}
+	return message
+}
+
+func metadataString(metadata map[string]interface{}, key string) string {
+	value, ok := metadata[key]
+	if !ok || value == nil {
+		return ""
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+// matchChannels 返回通知匹配到的启用渠道（按配置顺序去重）；未配置路由时返回全部启用渠道
+func matchChannels(cfg *config.NotificationsConfig, message Message) []config.NotificationChannelConfig {
+	selected := make(map[string]struct{})
+	if len(cfg.Routes) == 0 {
+		for _, channel := range cfg.Channels {
+			selected[strings.TrimSpace(channel.Name)] = struct{}{}
+		}
+	}
+	for _, route := range cfg.Routes {
+		if !matchAny(route.Levels, message.Level) ||
+			!matchAny(route.Categories, message.Category) ||
+			!matchAny(route.Websites, message.WebsiteID) {
+			continue
+		}
+		for _, name := range route.Channels {
+			selected[strings.TrimSpace(name)] = struct{}{}
+		}
+	}
+
+	channels := make([]config.NotificationChannelConfig, 0, len(selected))
+	for _, channel := range cfg.Channels {
+		if channel.Disabled {
+			continue
+		}
+		if _, ok := selected[strings.TrimSpace(channel.Name)]; ok {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+func matchAny(candidates []string, value string) bool {
+	if len(candidates) == 0 {
+		return true
+	}
+	for _, candidate := range candidates {
+		if strings.EqualFold(strings.TrimSpace(candidate), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func findChannel(name string) (config.NotificationChannelConfig, bool) {
+	cfg := config.ReadConfig().Notifications
+	if cfg == nil {
+		return config.NotificationChannelConfig{}, false
+	}
+	name = strings.TrimSpace(name)
+	for _, channel := range cfg.Channels {
+		if strings.TrimSpace(channel.Name) == name {
+			return channel, true
+		}
+	}
+	return config.NotificationChannelConfig{}, false
+}
+
+func repeatInterval(cfg *config.NotificationsConfig) time.Duration {
+	raw := strings.TrimSpace(cfg.RepeatInterval)
+	if raw == "" {
+		return defaultRepeatInterval
+	}
+	if raw == "0" {
+		return 0
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval < 0 {
+		return defaultRepeatInterval
+	}
+	return interval
+}
+
+func retries(cfg *config.NotificationsConfig) int {
+	if cfg == nil || cfg.Retries == nil {
+		return defaultRetries
+	}
+	if *cfg.Retries < 0 {
+		return 0
+	}
+	return *cfg.Retries
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+// IM 渠道的消息长度上限，超出部分截断（完整内容见邮件 / webhook 或预览接口）
+const (
+	reportWeComMaxBytes    = 4000
+	reportTelegramMaxRunes = 4000
+	reportIMMaxBytes       = 18000
+	reportTruncatedNotice  = "\n\n……（内容过长已截断，完整报告请查看预览接口）"
+)
+
+// Report 渲染完成的定时报告
+type Report struct {
+	ID       int64
+	Title    string
+	HTML     string
+	Markdown string
+	CSV      []byte
+	CSVName  string
+}
+
+// reportPayload webhook 渠道的报告请求体，不使用渠道的 template
+type reportPayload struct {
+	Type     string    `json:"type"`
+	ID       int64     `json:"id"`
+	Title    string    `json:"title"`
+	Markdown string    `json:"markdown"`
+	HTML     string    `json:"html"`
+	CSV      string    `json:"csv"`
+	CSVName  string    `json:"csv_name"`
+	Time     time.Time `json:"time"`
+}
+
+// SendReport 同步将报告发送到指定渠道，失败按 retries 重试，结果写入外发记录
+func (d *Dispatcher) SendReport(ctx context.Context, channelName string, report Report) error {
+	channel, ok := findChannel(channelName)
+	if !ok {
+		return fmt.Errorf("渠道不存在: %s", channelName)
+	}
+	if channel.Disabled {
+		return fmt.Errorf("渠道已停用: %s", channelName)
+	}
+	attempt, statusCode, err := withRetry(ctx, func() (int, error) {
+		return sendReport(ctx, d.client, channel, report)
+	})
+	message := Message{
+		Level:       "info",
+		Category:    "report",
+		Title:       report.Title,
+		Fingerprint: fmt.Sprintf("report:%d", report.ID),
+		Time:        time.Now(),
+	}
+	d.record(channel, message, attempt, statusCode, err)
+	return err
+}
+
+func sendReport(ctx context.Context, client *http.Client, channel config.NotificationChannelConfig, report Report) (int, error) {
+	switch strings.TrimSpace(channel.Type) {
+	case config.NotifyChannelWebhook:
+		body, err := json.Marshal(reportPayload{
+			Type:     "report",
+			ID:       report.ID,
+			Title:    report.Title,
+			Markdown: report.Markdown,
+			HTML:     report.HTML,
+			CSV:      string(report.CSV),
+			CSVName:  report.CSVName,
+			Time:     time.Now(),
+		})
+		if err != nil {
+			return 0, err
+		}
+		return postBody(ctx, client, channel.URL, body, webhookHeaders(channel, body), nil)
+	case config.NotifyChannelSlack:
+		return postJSON(ctx, client, channel.URL, map[string]interface{}{
+			"text": truncateBytes(report.Markdown, reportIMMaxBytes),
+		}, nil, checkSlackResponse)
+	case config.NotifyChannelTelegram:
+		text := report.Markdown
+		if utf8.RuneCountInString(text) > reportTelegramMaxRunes {
+			text = string([]rune(text)[:reportTelegramMaxRunes-utf8.RuneCountInString(reportTruncatedNotice)]) + reportTruncatedNotice
+		}
+		return postJSON(ctx, client, telegramEndpoint(channel), map[string]interface{}{
+			"chat_id":                  strings.TrimSpace(channel.ChatID),
+			"text":                     text,
+			"disable_web_page_preview": true,
+		}, nil, checkTelegramResponse)
+	case config.NotifyChannelDingTalk:
+		endpoint, err := dingTalkEndpoint(channel)
+		if err != nil {
+			return 0, err
+		}
+		return postJSON(ctx, client, endpoint, map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": report.Title,
+				"text":  truncateBytes(report.Markdown, reportIMMaxBytes),
+			},
+		}, nil, checkErrcodeResponse)
+	case config.NotifyChannelWeCom:
+		return postJSON(ctx, client, channel.URL, map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": truncateBytes(report.Markdown, reportWeComMaxBytes)},
+		}, nil, checkErrcodeResponse)
+	case config.NotifyChannelFeishu:
+		return postFeishu(ctx, client, channel, truncateBytes(report.Markdown, reportIMMaxBytes))
+	case config.NotifyChannelEmail:
+		return 0, sendMail(channel.SMTP, func(from *mail.Address, recipients []*mail.Address) []byte {
+			return buildReportEmail(from, recipients, report)
+		})
+	default:
+		return 0, fmt.Errorf("不支持的渠道类型: %s", channel.Type)
+	}
+}
+
+// buildReportEmail 生成 multipart/mixed 邮件：正文为 Markdown 纯文本与 HTML 两种形式，附带 CSV
+func buildReportEmail(from *mail.Address, recipients []*mail.Address, report Report) []byte {
+	var body bytes.Buffer
+	mixed := multipart.NewWriter(&body)
+
+	var alternative bytes.Buffer
+	alt := multipart.NewWriter(&alternative)
+	writeEmailPart(alt, "text/plain; charset=UTF-8", "", []byte(report.Markdown))
+	writeEmailPart(alt, "text/html; charset=UTF-8", "", []byte(report.HTML))
+	alt.Close()
+
+	part, _ := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alt.Boundary()},
+	})
+	part.Write(alternative.Bytes())
+	if len(report.CSV) > 0 {
+		writeEmailPart(mixed, "text/csv; charset=UTF-8", report.CSVName, report.CSV)
+	}
+	mixed.Close()
+
+	var buf bytes.Buffer
+	writeEmailHeaders(&buf, from, recipients, "[NginxPulse] "+report.Title)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+// writeEmailPart 写入 base64 编码的分段，filename 不为空时作为附件
+func writeEmailPart(writer *multipart.Writer, contentType, filename string, data []byte) {
+	header := textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+	if filename != "" {
+		header.Set("Content-Type", mime.FormatMediaType(strings.Split(contentType, ";")[0], map[string]string{
+			"charset": "UTF-8",
+			"name":    filename,
+		}))
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return
+	}
+	var encoded bytes.Buffer
+	writeBase64Lines(&encoded, data)
+	part.Write(encoded.Bytes())
+}
+
+// truncateBytes 按字节数截断（不切断 UTF-8 字符），截断时追加提示
+func truncateBytes(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit - len(reportTruncatedNotice)
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + reportTruncatedNotice
+}
@@ -55,6 +55,8 @@ func buildRouter(statsFactory *analytics.StatsFactory, logParser *ingest.LogPars
 
 	web.SetupRoutes(router, statsFactory, logParser)
 	attachAppConfig(router)
+	attachMetrics(router, statsFactory)
+	attachReceivers(router, statsFactory, logParser)
 	attachWebUI(router)
 
 	return router
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/likaia/nginxpulse/internal/analytics"
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/metrics"
+	"github.com/likaia/nginxpulse/internal/version"
+	"github.com/likaia/nginxpulse/internal/web"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+	// 活跃访客窗口与实时统计保持一致
+	activeVisitorsWindow = 30 * time.Minute
+	// 抓取时的数据库查询结果缓存时长，避免频繁抓取压垮数据库
+	metricsQueryCacheTTL = 30 * time.Second
+)
+
+var registerMetricsOnce sync.Once
+
+func attachMetrics(router *gin.Engine, statsFactory *analytics.StatsFactory) {
+	registerMetricsOnce.Do(func() {
+		collector := &dbMetricsCollector{statsFactory: statsFactory}
+		metrics.RegisterCollector(collector.collect)
+		metrics.RegisterCollector(web.CollectExportMetrics)
+		metrics.RegisterCollector(func(w *metrics.Writer) {
+			w.Gauge("nginxpulse_build_info", "构建信息", 1, "version", version.Version, "commit", version.GitCommit)
+		})
+	})
+
+	router.GET("/metrics", tokenAuthMiddleware(config.ReadConfig().System.MetricsToken), func(c *gin.Context) {
+		c.Header("Content-Type", metricsContentType)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+		if err := metrics.WriteText(c.Writer); err != nil {
+			logrus.WithError(err).Warn("输出监控指标失败")
+		}
+	})
+}
+
+// dbMetricsCollector 抓取时查询数据库的指标，结果短暂缓存
+type dbMetricsCollector struct {
+	statsFactory *analytics.StatsFactory
+
+	mu             sync.Mutex
+	updatedAt      time.Time
+	activeVisitors map[string]int
+	ipGeoPending   int64
+	ipGeoOK        bool
+}
+
+func (d *dbMetricsCollector) collect(w *metrics.Writer) {
+	// 初始化模式下没有数据库
+	if d.statsFactory == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Since(d.updatedAt) >= metricsQueryCacheTTL {
+		d.refresh()
+	}
+
+	for _, id := range config.GetAllWebsiteIDs() {
+		if count, ok := d.activeVisitors[id]; ok {
+			w.Gauge("nginxpulse_active_visitors", "最近 30 分钟的活跃访客数", float64(count), "website", id)
+		}
+	}
+	if d.ipGeoOK {
+		w.Gauge("nginxpulse_ip_geo_pending", "待解析归属地的 IP 数", float64(d.ipGeoPending))
+	}
+}
+
+func (d *dbMetricsCollector) refresh() {
+	d.updatedAt = time.Now()
+	d.activeVisitors = make(map[string]int)
+	if manager, ok := d.statsFactory.GetManager("realtime"); ok {
+		if realtime, ok := manager.(*analytics.RealtimeStatsManager); ok {
+			for _, id := range config.GetAllWebsiteIDs() {
+				count, err := realtime.ActiveVisitors(id, activeVisitorsWindow)
+				if err != nil {
+					logrus.WithError(err).Warnf("统计站点 %s 活跃访客失败", id)
+					continue
+				}
+				d.activeVisitors[id] = count
+			}
+		}
+	}
+
+	pending, err := d.statsFactory.Repo().CountIPGeoPending()
+	if err != nil {
+		logrus.WithError(err).Warn("统计待解析 IP 数失败")
+	}
+	d.ipGeoPending, d.ipGeoOK = pending, err == nil
+}
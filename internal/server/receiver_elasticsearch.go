@@ -0,0 +1,216 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/likaia/nginxpulse/internal/analytics"
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/ingest"
+	"github.com/likaia/nginxpulse/internal/ingest/receiver"
+	"github.com/likaia/nginxpulse/internal/version"
+)
+
+const (
+	// Elasticsearch 兼容端点的路径前缀，客户端的 hosts / path 需指向该前缀
+	esPathPrefix = "/es"
+	// 文档未命中路由时，按索引名查找站点（站点 ID 或名称）
+	esIndexLabel     = "_index"
+	esSourceID       = "elasticsearch"
+	esDefaultVersion = "8.17.0"
+	// 8.x 客户端会校验该响应头
+	esProductHeader = "X-Elastic-Product"
+)
+
+// attachElasticsearch 注册最小化的 Elasticsearch 兼容接口：_bulk 写入日志，
+// 客户端启动时探测的版本、许可证、模板、ILM、ingest pipeline 等接口返回固定应答
+func attachElasticsearch(router *gin.Engine, auth gin.HandlerFunc, cfg *config.ElasticsearchReceiverConfig,
+	statsFactory *analytics.StatsFactory, logParser *ingest.LogParser) {
+	esVersion := esDefaultVersion
+	var routeCfg *config.ReceiverConfig
+	if cfg != nil {
+		routeCfg = &cfg.ReceiverConfig
+		if value := strings.TrimSpace(cfg.Version); value != "" {
+			esVersion = value
+		}
+	}
+	esRouter := receiver.NewRouter(routeCfg, esSourceID, esIndexLabel)
+	clusterUUID := newClusterUUID()
+
+	handler := func(c *gin.Context) {
+		c.Header(esProductHeader, "Elasticsearch")
+		path := strings.Trim(strings.TrimPrefix(c.Request.URL.Path, esPathPrefix), "/")
+		segments := strings.Split(path, "/")
+		last := segments[len(segments)-1]
+
+		switch {
+		case path == "":
+			if c.Request.Method == http.MethodHead {
+				c.Status(http.StatusOK)
+				return
+			}
+			c.JSON(http.StatusOK, esInfoResponse(esVersion, clusterUUID))
+		case last == "_bulk" && (c.Request.Method == http.MethodPost || c.Request.Method == http.MethodPut):
+			index := ""
+			if len(segments) == 2 && !strings.HasPrefix(segments[0], "_") {
+				index = segments[0]
+			}
+			handleBulk(c, esRouter, statsFactory, logParser, index)
+		case segments[0] == "_license":
+			c.JSON(http.StatusOK, gin.H{"license": esLicense(clusterUUID)})
+		case segments[0] == "_xpack":
+			c.JSON(http.StatusOK, gin.H{
+				"build":    gin.H{"hash": version.GitCommit, "date": version.BuildTime},
+				"license":  esLicense(clusterUUID),
+				"features": gin.H{"ilm": gin.H{"available": true, "enabled": true}},
+			})
+		case c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead:
+			// 模板、策略、pipeline 均视为不存在，客户端随后会 PUT 创建
+			esError(c, http.StatusNotFound, "resource_not_found_exception", "nginxpulse 不保存 "+path)
+		default:
+			c.JSON(http.StatusOK, gin.H{"acknowledged": true})
+		}
+	}
+	router.Any(esPathPrefix, auth, handler)
+	router.Any(esPathPrefix+"/*path", auth, handler)
+}
+
+func handleBulk(c *gin.Context, esRouter *receiver.Router, statsFactory *analytics.StatsFactory,
+	logParser *ingest.LogParser, defaultIndex string) {
+	if logParser == nil {
+		esError(c, http.StatusServiceUnavailable, "unavailable_exception", "初始化模式暂不支持日志接收")
+		return
+	}
+	started := time.Now()
+	body, err := receiver.ReadBody(c.Request.Body, c.GetHeader("Content-Encoding"))
+	if err != nil {
+		esError(c, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+	items, err := receiver.ParseBulk(body, defaultIndex)
+	if err != nil {
+		esError(c, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return
+	}
+
+	batch := receiver.NewBatch("elasticsearch")
+	results := make([]gin.H, 0, len(items))
+	hasErrors := false
+	for i, item := range items {
+		if item.Err == nil {
+			// 复制一份再加入索引名，避免覆盖文档自身的 _index 字段
+			labels := make(map[string]string, len(item.Fields)+1)
+			for key, value := range item.Fields {
+				labels[key] = value
+			}
+			labels[esIndexLabel] = item.Index
+			target, routed := esRouter.Resolve(labels)
+			if !routed {
+				batch.Drop(1)
+			} else if structured, ok := receiver.StructuredFromFields(item.Fields, time.Time{}); ok {
+				structured.Raw = item.Source
+				batch.AddStructured(target, structured)
+			} else if message := item.Message(); message != "" {
+				batch.Add(target, message)
+			} else {
+				item.Err = errMissingMessage
+			}
+		}
+		results = append(results, esBulkItemResult(item, i, started))
+		if item.Err != nil {
+			hasErrors = true
+		}
+	}
+
+	if err := ingestReceiverBatch(statsFactory, logParser, batch); err != nil {
+		esError(c, http.StatusInternalServerError, "exception", "写入日志失败: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"took":   time.Since(started).Milliseconds(),
+		"errors": hasErrors,
+		"items":  results,
+	})
+}
+
+var errMissingMessage = errors.New("文档缺少 message 字段，且不包含可识别的结构化访问日志字段")
+
+// esBulkItemResult 单个操作的应答；未命中站点的文档同样返回成功，避免客户端重复投递
+func esBulkItemResult(item receiver.BulkItem, seq int, started time.Time) gin.H {
+	id := item.ID
+	if id == "" {
+		id = fmt.Sprintf("%x-%d", started.UnixNano(), seq)
+	}
+	result := gin.H{
+		"_index": item.Index,
+		"_id":    id,
+	}
+	if item.Err != nil {
+		result["status"] = http.StatusBadRequest
+		result["error"] = gin.H{"type": "illegal_argument_exception", "reason": item.Err.Error()}
+	} else {
+		result["status"] = http.StatusCreated
+		result["result"] = "created"
+		result["_version"] = 1
+		result["_seq_no"] = seq
+		result["_primary_term"] = 1
+		result["_shards"] = gin.H{"total": 1, "successful": 1, "failed": 0}
+	}
+	return gin.H{item.Action: result}
+}
+
+func esInfoResponse(esVersion, clusterUUID string) gin.H {
+	return gin.H{
+		"name":         "nginxpulse",
+		"cluster_name": "nginxpulse",
+		"cluster_uuid": clusterUUID,
+		"version": gin.H{
+			"number":                              esVersion,
+			"build_flavor":                        "default",
+			"build_type":                          "docker",
+			"build_hash":                          version.GitCommit,
+			"build_date":                          version.BuildTime,
+			"build_snapshot":                      false,
+			"lucene_version":                      "9.12.0",
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	}
+}
+
+func esLicense(clusterUUID string) gin.H {
+	return gin.H{
+		"status":                "active",
+		"uid":                   clusterUUID,
+		"type":                  "basic",
+		"mode":                  "basic",
+		"issue_date_in_millis":  0,
+		"expiry_date_in_millis": int64(2524607999999),
+		"max_nodes":             1000,
+		"issued_to":             "nginxpulse",
+		"issuer":                "elasticsearch",
+		"start_date_in_millis":  -1,
+	}
+}
+
+func esError(c *gin.Context, status int, errType, reason string) {
+	c.JSON(status, gin.H{
+		"error":  gin.H{"root_cause": []gin.H{{"type": errType, "reason": reason}}, "type": errType, "reason": reason},
+		"status": status,
+	})
+}
+
+func newClusterUUID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "nginxpulse"
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/likaia/nginxpulse/internal/analytics"
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/ingest"
+	"github.com/likaia/nginxpulse/internal/ingest/receiver"
+)
+
+const (
+	otlpSourceID = "otlp"
+	// gRPC 状态码，写入错误响应的 Status.code
+	otlpCodeInvalidArgument = 3
+	otlpCodeUnavailable     = 14
+)
+
+// 资源未命中路由时，依次按这些属性的值（站点 ID 或名称）查找站点
+var otlpWebsiteAttributes = []string{"service.name", "host.name"}
+
+// attachOTLP 注册 OTLP/HTTP 日志接收端点 /v1/logs。带 HTTP 语义约定属性的日志直接入库，
+// 否则把字符串类型的日志内容作为原始日志行解析
+func attachOTLP(router *gin.Engine, auth gin.HandlerFunc, cfg *config.ReceiverConfig,
+	statsFactory *analytics.StatsFactory, logParser *ingest.LogParser) {
+	otlpRouter := receiver.NewRouter(cfg, otlpSourceID, otlpWebsiteAttributes...)
+
+	router.POST("/v1/logs", auth, func(c *gin.Context) {
+		jsonEncoding := receiver.IsOTLPJSON(c.ContentType())
+		contentType := "application/x-protobuf"
+		if jsonEncoding {
+			contentType = "application/json"
+		}
+		// 客户端只对 429 / 502 / 503 / 504 重试，数据库错误同样返回 503
+		fail := func(status, code int, message string) {
+			c.Data(status, contentType, receiver.EncodeOTLPStatus(jsonEncoding, code, message))
+		}
+		if logParser == nil {
+			fail(http.StatusServiceUnavailable, otlpCodeUnavailable, "初始化模式暂不支持日志接收")
+			return
+		}
+		body, err := receiver.ReadBody(c.Request.Body, c.GetHeader("Content-Encoding"))
+		if err != nil {
+			fail(http.StatusBadRequest, otlpCodeInvalidArgument, err.Error())
+			return
+		}
+		resources, err := receiver.DecodeOTLPLogs(body, c.ContentType())
+		if err != nil {
+			fail(http.StatusBadRequest, otlpCodeInvalidArgument, err.Error())
+			return
+		}
+
+		batch := receiver.NewBatch("otlp")
+		rejected := 0
+		for _, resource := range resources {
+			target, ok := otlpRouter.Resolve(resource.Resource)
+			if !ok {
+				batch.Drop(len(resource.Records))
+				continue
+			}
+			for _, record := range resource.Records {
+				if structured, ok := receiver.StructuredFromFields(record.Fields, record.Time); ok {
+					batch.AddStructured(target, structured)
+				} else if record.Body != "" {
+					batch.Add(target, record.Body)
+				} else {
+					rejected++
+				}
+			}
+		}
+		if rejected > 0 {
+			batch.Drop(rejected)
+		}
+
+		if err := ingestReceiverBatch(statsFactory, logParser, batch); err != nil {
+			fail(http.StatusServiceUnavailable, otlpCodeUnavailable, "写入日志失败: "+err.Error())
+			return
+		}
+		c.Data(http.StatusOK, contentType,
+			receiver.EncodeOTLPResponse(jsonEncoding, rejected, "日志缺少字符串内容，也不包含可识别的 HTTP 属性"))
+	})
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/likaia/nginxpulse/internal/analytics"
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/ingest"
+	"github.com/likaia/nginxpulse/internal/ingest/receiver"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Loki 流未命中路由时，按该标签的值（站点 ID 或名称）查找站点
+	lokiWebsiteLabel = "website"
+	lokiSourceID     = "loki"
+)
+
+// attachReceivers 注册兼容第三方采集协议的日志接收端点。端点需逐个启用，
+// 且必须配置 receivers.token 或 accessKeys，避免任何人都能向站点写入日志
+func attachReceivers(router *gin.Engine, statsFactory *analytics.StatsFactory, logParser *ingest.LogParser) {
+	receivers := config.ReadConfig().Receivers
+	if receivers == nil {
+		return
+	}
+	lokiEnabled := receivers.Loki != nil && receivers.Loki.Enabled
+	esEnabled := receivers.Elasticsearch != nil && receivers.Elasticsearch.Enabled
+	otlpEnabled := receivers.OTLP != nil && receivers.OTLP.Enabled
+	if !lokiEnabled && !esEnabled && !otlpEnabled {
+		return
+	}
+	if len(tokenAuthKeys(receivers.Token)) == 0 {
+		logrus.Error("日志接收端点未配置 receivers.token 且 accessKeys 为空，已拒绝启动接收端点")
+		return
+	}
+	auth := tokenAuthMiddleware(receivers.Token)
+
+	if lokiEnabled {
+		lokiRouter := receiver.NewRouter(receivers.Loki, lokiSourceID, lokiWebsiteLabel)
+		router.POST("/loki/api/v1/push", auth, func(c *gin.Context) {
+			if logParser == nil {
+				c.String(http.StatusServiceUnavailable, "初始化模式暂不支持日志接收")
+				return
+			}
+			body, err := receiver.ReadBody(c.Request.Body, c.GetHeader("Content-Encoding"))
+			if err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+			streams, err := receiver.DecodeLokiPush(body, c.ContentType())
+			if err != nil {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+
+			batch := receiver.NewBatch("loki")
+			for _, stream := range streams {
+				target, ok := lokiRouter.Resolve(stream.Labels)
+				if !ok {
+					batch.Drop(len(stream.Lines))
+					continue
+				}
+				for _, line := range stream.Lines {
+					batch.Add(target, line)
+				}
+			}
+			if err := ingestReceiverBatch(statsFactory, logParser, batch); err != nil {
+				c.String(http.StatusInternalServerError, "写入日志失败: %v", err)
+				return
+			}
+			c.Status(http.StatusNoContent)
+		})
+	}
+
+	if esEnabled {
+		attachElasticsearch(router, auth, receivers.Elasticsearch, statsFactory, logParser)
+	}
+
+	if otlpEnabled {
+		attachOTLP(router, auth, receivers.OTLP, statsFactory, logParser)
+	}
+}
+
+// ingestReceiverBatch 写入日志；返回错误时调用方应响应 5xx，让客户端重试
+func ingestReceiverBatch(statsFactory *analytics.StatsFactory, logParser *ingest.LogParser, batch *receiver.Batch) error {
+	result, err := batch.Ingest(logParser)
+	if err != nil {
+		logrus.WithError(err).Error("接收端点写入日志失败")
+		return err
+	}
+	if result.Accepted > 0 && statsFactory != nil {
+		statsFactory.ClearCache()
+	}
+	return nil
+}
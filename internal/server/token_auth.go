@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+// tokenAuthMiddleware 用于 /api 以外的机器接口（/metrics、日志接收端点）：
+// 配置了 token 时只接受该令牌，否则沿用 accessKeys，两者都为空时不校验。
+// 令牌可放在 X-NginxPulse-Key、Authorization: Bearer 或 Basic 认证的密码中
+func tokenAuthMiddleware(token string) gin.HandlerFunc {
+	keys := tokenAuthKeys(token)
+
+	return func(c *gin.Context) {
+		if len(keys) == 0 {
+			c.Next()
+			return
+		}
+		value := requestToken(c.Request)
+		if value == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "需要访问密钥",
+			})
+			return
+		}
+		for _, key := range keys {
+			if subtle.ConstantTimeCompare([]byte(value), []byte(key)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "访问密钥无效",
+		})
+	}
+}
+
+// tokenAuthKeys 返回机器接口接受的令牌：token 不为空时只有它，否则为 accessKeys
+func tokenAuthKeys(token string) []string {
+	if token = strings.TrimSpace(token); token != "" {
+		return []string{token}
+	}
+	cfg := config.ReadConfig()
+	keys := make([]string, 0, len(cfg.System.AccessKeys))
+	for _, key := range cfg.System.AccessKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func requestToken(r *http.Request) string {
+	if value := strings.TrimSpace(r.Header.Get(accessKeyHeader)); value != "" {
+		return value
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return strings.TrimSpace(password)
+	}
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
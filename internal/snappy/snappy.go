@@ -0,0 +1,186 @@
+// Package snappy 实现 snappy 块格式（非 framing 格式）的编解码，用于 Loki push 请求体与 Parquet 导出
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errCorrupt = errors.New("snappy 数据损坏")
+
+// Decode 解码一个 snappy 块，解码后长度超过 maxLen 时返回错误
+func Decode(src []byte, maxLen int) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errCorrupt
+	}
+	if length > uint64(maxLen) {
+		return nil, fmt.Errorf("解压后超过 %d 字节", maxLen)
+	}
+	dst := make([]byte, 0, int(length))
+	src = src[n:]
+
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case 0x00: // literal
+			size := int(tag >> 2)
+			src = src[1:]
+			if size >= 60 {
+				extra := size - 59
+				if len(src) < extra {
+					return nil, errCorrupt
+				}
+				size = 0
+				for i := extra - 1; i >= 0; i-- {
+					size = size<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			size++
+			if size <= 0 || size > len(src) || len(dst)+size > int(length) {
+				return nil, errCorrupt
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+		case 0x01: // copy，1 字节偏移
+			if len(src) < 2 {
+				return nil, errCorrupt
+			}
+			size := 4 + int(tag>>2)&0x07
+			offset := int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+			if err := copyBack(&dst, offset, size, int(length)); err != nil {
+				return nil, err
+			}
+		case 0x02: // copy，2 字节偏移
+			if len(src) < 3 {
+				return nil, errCorrupt
+			}
+			size := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src[1:3]))
+			src = src[3:]
+			if err := copyBack(&dst, offset, size, int(length)); err != nil {
+				return nil, err
+			}
+		case 0x03: // copy，4 字节偏移
+			if len(src) < 5 {
+				return nil, errCorrupt
+			}
+			size := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint32(src[1:5]))
+			src = src[5:]
+			if err := copyBack(&dst, offset, size, int(length)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(dst) != int(length) {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
+
+// copyBack 从已解码数据中回溯复制，区间可能与写入位置重叠，需逐字节复制
+func copyBack(dst *[]byte, offset, size, limit int) error {
+	out := *dst
+	if offset <= 0 || offset > len(out) || len(out)+size > limit {
+		return errCorrupt
+	}
+	start := len(out) - offset
+	for i := 0; i < size; i++ {
+		out = append(out, out[start+i])
+	}
+	*dst = out
+	return nil
+}
+
+const (
+	// 块内回溯偏移不超过 64KB，与官方实现一致按 64KB 分块编码
+	maxBlockSize  = 1 << 16
+	hashTableBits = 14
+	// 短于该长度的块不查找匹配，直接写为字面量
+	minMatchInput = 16
+)
+
+// Encode 把 src 编码为一个 snappy 块并追加到 dst。只做贪心哈希匹配，压缩率略低于官方实现，但输出格式兼容
+func Encode(dst, src []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(src)))
+	var table [1 << hashTableBits]int32
+	for len(src) > 0 {
+		block := src
+		if len(block) > maxBlockSize {
+			block = block[:maxBlockSize]
+		}
+		src = src[len(block):]
+		if len(block) <= minMatchInput {
+			dst = emitLiteral(dst, block)
+			continue
+		}
+		for i := range table {
+			table[i] = 0
+		}
+		dst = encodeBlock(dst, block, &table)
+	}
+	return dst
+}
+
+// encodeBlock 编码不超过 64KB 的块；table 保存位置 + 1，0 表示空
+func encodeBlock(dst, src []byte, table *[1 << hashTableBits]int32) []byte {
+	literalStart := 0
+	for s := 0; s+4 <= len(src); {
+		current := binary.LittleEndian.Uint32(src[s:])
+		h := (current * 0x1e35a7bd) >> (32 - hashTableBits)
+		candidate := int(table[h]) - 1
+		table[h] = int32(s + 1)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != current {
+			s++
+			continue
+		}
+		dst = emitLiteral(dst, src[literalStart:s])
+		length := 4
+		for s+length < len(src) && src[candidate+length] == src[s+length] {
+			length++
+		}
+		dst = emitCopy(dst, s-candidate, length)
+		s += length
+		literalStart = s
+	}
+	return emitLiteral(dst, src[literalStart:])
+}
+
+func emitLiteral(dst, literal []byte) []byte {
+	if len(literal) == 0 {
+		return dst
+	}
+	n := len(literal) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n < 1<<8:
+		dst = append(dst, 60<<2, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	default:
+		dst = append(dst, 62<<2, byte(n), byte(n>>8), byte(n>>16))
+	}
+	return append(dst, literal...)
+}
+
+// emitCopy 写入回溯复制；单个元素最长 64 字节，超出时拆分，保证剩余部分不少于 4 字节
+func emitCopy(dst []byte, offset, length int) []byte {
+	for length >= 68 {
+		dst = append(dst, 63<<2|0x02, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|0x02, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 12 || offset >= 2048 {
+		return append(dst, byte(length-1)<<2|0x02, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|0x01, byte(offset))
+}
@@ -0,0 +1,426 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+)
+
+// 告警规则状态
+const (
+	AlertStateInactive = "inactive"
+	AlertStatePending  = "pending"
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// AlertRule 站点告警规则。Window / For 为时长字符串（如 5m），
+// 条件在 For 时长内持续满足才进入 firing，For 为空时立即触发
+type AlertRule struct {
+	ID        int64  `json:"id"`
+	WebsiteID string `json:"website_id"`
+	Name      string `json:"name"`
+	// Type 为 status_ratio / pv_drop / new_country / url_status
+	Type      string            `json:"type"`
+	Params    map[string]string `json:"params,omitempty"`
+	Threshold float64           `json:"threshold"`
+	Window    string            `json:"window"`
+	For       string            `json:"for,omitempty"`
+	// Severity 为写入系统通知的级别：info / warning
+	Severity string `json:"severity"`
+	Enabled  bool   `json:"enabled"`
+
+	State           string     `json:"state"`
+	StateSince      *time.Time `json:"state_since,omitempty"`
+	LastValue       float64    `json:"last_value"`
+	LastMessage     string     `json:"last_message,omitempty"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// AlertEvent 告警状态变化记录
+type AlertEvent struct {
+	ID        int64     `json:"id"`
+	RuleID    int64     `json:"rule_id"`
+	WebsiteID string    `json:"website_id"`
+	RuleName  string    `json:"rule_name"`
+	State     string    `json:"state"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AlertEventFilter 告警历史查询条件，零值表示不限
+type AlertEventFilter struct {
+	RuleID    int64
+	WebsiteID string
+	State     string
+}
+
+func (r *Repository) ensureAlertTables() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS "alert_rules" (
+            id BIGSERIAL PRIMARY KEY,
+            website_id TEXT NOT NULL,
+            name TEXT NOT NULL,
+            type TEXT NOT NULL,
+            params JSONB,
+            threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+            window_size TEXT NOT NULL DEFAULT '',
+            for_duration TEXT NOT NULL DEFAULT '',
+            severity TEXT NOT NULL DEFAULT 'warning',
+            enabled BOOLEAN NOT NULL DEFAULT TRUE,
+            state TEXT NOT NULL DEFAULT 'inactive',
+            state_since TIMESTAMPTZ,
+            last_value DOUBLE PRECISION NOT NULL DEFAULT 0,
+            last_message TEXT NOT NULL DEFAULT '',
+            last_evaluated_at TIMESTAMPTZ,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+            updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_rules_website ON "alert_rules"(website_id)`,
+		`CREATE TABLE IF NOT EXISTS "alert_events" (
+            id BIGSERIAL PRIMARY KEY,
+            rule_id BIGINT NOT NULL REFERENCES "alert_rules"(id) ON DELETE CASCADE,
+            website_id TEXT NOT NULL,
+            rule_name TEXT NOT NULL,
+            state TEXT NOT NULL,
+            value DOUBLE PRECISION NOT NULL DEFAULT 0,
+            threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+            message TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_events_rule_created ON "alert_events"(rule_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_events_created_at ON "alert_events"(created_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := r.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const alertRuleColumns = `id, website_id, name, type, params, threshold, window_size, for_duration, severity, enabled,
+                state, state_since, last_value, last_message, last_evaluated_at, created_at, updated_at`
+
+func scanAlertRule(scanner interface{ Scan(...interface{}) error }) (AlertRule, error) {
+	var (
+		rule          AlertRule
+		paramsBytes   []byte
+		stateSince    sql.NullTime
+		lastEvaluated sql.NullTime
+	)
+	if err := scanner.Scan(
+		&rule.ID, &rule.WebsiteID, &rule.Name, &rule.Type, &paramsBytes, &rule.Threshold, &rule.Window,
+		&rule.For, &rule.Severity, &rule.Enabled, &rule.State, &stateSince, &rule.LastValue,
+		&rule.LastMessage, &lastEvaluated, &rule.CreatedAt, &rule.UpdatedAt,
+	); err != nil {
+		return rule, err
+	}
+	if len(paramsBytes) > 0 {
+		_ = json.Unmarshal(paramsBytes, &rule.Params)
+	}
+	if stateSince.Valid {
+		value := stateSince.Time
+		rule.StateSince = &value
+	}
+	if lastEvaluated.Valid {
+		value := lastEvaluated.Time
+		rule.LastEvaluatedAt = &value
+	}
+	return rule, nil
+}
+
+func encodeAlertParams(params map[string]string) []byte {
+	if len(params) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// ListAlertRules 返回告警规则，websiteID 为空时返回全部站点
+func (r *Repository) ListAlertRules(websiteID string) ([]AlertRule, error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM "alert_rules"`
+	args := make([]interface{}, 0, 1)
+	if websiteID != "" {
+		query += ` WHERE website_id = ?`
+		args = append(args, websiteID)
+	}
+	query += ` ORDER BY website_id, id`
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]AlertRule, 0)
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// GetAlertRule 按 ID 查询规则，不存在时返回 sql.ErrNoRows
+func (r *Repository) GetAlertRule(id int64) (AlertRule, error) {
+	return scanAlertRule(r.db.QueryRow(sqlutil.ReplacePlaceholders(
+		`SELECT `+alertRuleColumns+` FROM "alert_rules" WHERE id = ?`,
+	), id))
+}
+
+// CreateAlertRule 新建规则并回填 ID 与状态
+func (r *Repository) CreateAlertRule(rule *AlertRule) error {
+	row := r.db.QueryRow(sqlutil.ReplacePlaceholders(
+		`INSERT INTO "alert_rules" (website_id, name, type, params, threshold, window_size, for_duration, severity, enabled)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+         RETURNING `+alertRuleColumns,
+	),
+		rule.WebsiteID, rule.Name, rule.Type, encodeAlertParams(rule.Params), rule.Threshold,
+		rule.Window, rule.For, rule.Severity, rule.Enabled,
+	)
+	created, err := scanAlertRule(row)
+	if err != nil {
+		return err
+	}
+	*rule = created
+	return nil
+}
+
+// UpdateAlertRule 更新规则定义，条件变化后之前的状态不再有意义，统一重置为 inactive
+func (r *Repository) UpdateAlertRule(rule *AlertRule) error {
+	row := r.db.QueryRow(sqlutil.ReplacePlaceholders(
+		`UPDATE "alert_rules" SET
+            website_id = ?, name = ?, type = ?, params = ?, threshold = ?, window_size = ?,
+            for_duration = ?, severity = ?, enabled = ?,
+            state = 'inactive', state_since = NULL, last_message = '', updated_at = NOW()
+         WHERE id = ?
+         RETURNING `+alertRuleColumns,
+	),
+		rule.WebsiteID, rule.Name, rule.Type, encodeAlertParams(rule.Params), rule.Threshold,
+		rule.Window, rule.For, rule.Severity, rule.Enabled, rule.ID,
+	)
+	updated, err := scanAlertRule(row)
+	if err != nil {
+		return err
+	}
+	*rule = updated
+	return nil
+}
+
+// DeleteAlertRule 删除规则及其历史
+func (r *Repository) DeleteAlertRule(id int64) (bool, error) {
+	result, err := r.db.Exec(sqlutil.ReplacePlaceholders(`DELETE FROM "alert_rules" WHERE id = ?`), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// SaveAlertRuleState 保存评估结果；event 不为空时在同一事务中写入历史。
+// 评估期间规则被修改（updated_at 变化）时放弃本次结果，返回 false
+func (r *Repository) SaveAlertRuleState(rule AlertRule, event *AlertEvent) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var stateSince interface{}
+	if rule.StateSince != nil {
+		stateSince = *rule.StateSince
+	}
+	result, err := tx.Exec(sqlutil.ReplacePlaceholders(
+		`UPDATE "alert_rules" SET
+            state = ?, state_since = ?, last_value = ?, last_message = ?, last_evaluated_at = NOW()
+         WHERE id = ? AND updated_at = ?`,
+	), rule.State, stateSince, rule.LastValue, sanitizeAndTruncate(rule.LastMessage, maxURLBytes), rule.ID, rule.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+	if event != nil {
+		if _, err := tx.Exec(sqlutil.ReplacePlaceholders(
+			`INSERT INTO "alert_events" (rule_id, website_id, rule_name, state, value, threshold, message)
+             VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		),
+			event.RuleID, event.WebsiteID, event.RuleName, event.State, event.Value, event.Threshold,
+			sanitizeAndTruncate(event.Message, maxURLBytes),
+		); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// ListAlertEvents 按时间倒序分页查询告警历史
+func (r *Repository) ListAlertEvents(filter AlertEventFilter, page, pageSize int) ([]AlertEvent, bool, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 200 {
+		pageSize = 200
+	}
+
+	conditions := make([]string, 0, 3)
+	args := make([]interface{}, 0, 5)
+	if filter.RuleID > 0 {
+		conditions = append(conditions, "rule_id = ?")
+		args = append(args, filter.RuleID)
+	}
+	if filter.WebsiteID != "" {
+		conditions = append(conditions, "website_id = ?")
+		args = append(args, filter.WebsiteID)
+	}
+	if filter.State != "" {
+		conditions = append(conditions, "state = ?")
+		args = append(args, filter.State)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, pageSize+1, (page-1)*pageSize)
+
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT id, rule_id, website_id, rule_name, state, value, threshold, message, created_at
+         FROM "alert_events"
+         %s
+         ORDER BY created_at DESC, id DESC
+         LIMIT ? OFFSET ?`, where,
+	)), args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	events := make([]AlertEvent, 0, pageSize)
+	hasMore := false
+	for rows.Next() {
+		var event AlertEvent
+		if err := rows.Scan(
+			&event.ID, &event.RuleID, &event.WebsiteID, &event.RuleName, &event.State,
+			&event.Value, &event.Threshold, &event.Message, &event.CreatedAt,
+		); err != nil {
+			return nil, false, err
+		}
+		if len(events) < pageSize {
+			events = append(events, event)
+		} else {
+			hasMore = true
+		}
+	}
+	return events, hasMore, rows.Err()
+}
+
+func (r *Repository) cleanupAlertEvents(cutoff time.Time) error {
+	_, err := r.db.Exec(
+		sqlutil.ReplacePlaceholders(`DELETE FROM "alert_events" WHERE created_at < ?`),
+		cutoff,
+	)
+	return err
+}
+
+// AlertStatusRatio 统计时间段内的请求数与指定状态码区间（[minStatus, maxStatus]）的请求数
+func (r *Repository) AlertStatusRatio(websiteID string, start, end int64, minStatus, maxStatus int) (int64, int64, error) {
+	var total, matched int64
+	err := r.db.QueryRow(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE status_code >= ? AND status_code <= ?)
+         FROM "%s_nginx_logs"
+         WHERE timestamp >= ? AND timestamp < ?`, websiteID,
+	)), minStatus, maxStatus, start, end).Scan(&total, &matched)
+	return total, matched, err
+}
+
+// AlertPageviews 统计时间段内的 PV
+func (r *Repository) AlertPageviews(websiteID string, start, end int64) (int64, error) {
+	var pv int64
+	err := r.db.QueryRow(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT COUNT(*) FROM "%s_nginx_logs"
+         WHERE pageview_flag = 1 AND timestamp >= ? AND timestamp < ?`, websiteID,
+	)), start, end).Scan(&pv)
+	return pv, err
+}
+
+// AlertNewCountries 返回 [start, end) 内出现、但在 [since, start) 内没有出现过的国家代码及其请求数
+func (r *Repository) AlertNewCountries(websiteID string, since, start, end int64) (map[string]int64, error) {
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT loc.country_code, COUNT(*)
+         FROM "%[1]s_nginx_logs" l
+         JOIN "%[1]s_dim_location" loc ON loc.id = l.location_id
+         WHERE l.timestamp >= ? AND l.timestamp < ?
+           AND loc.country_code IS NOT NULL AND loc.country_code <> ''
+           AND NOT EXISTS (
+               SELECT 1
+               FROM "%[1]s_nginx_logs" prev
+               JOIN "%[1]s_dim_location" prev_loc ON prev_loc.id = prev.location_id
+               WHERE prev_loc.country_code = loc.country_code
+                 AND prev.timestamp >= ? AND prev.timestamp < ?
+           )
+         GROUP BY loc.country_code
+         ORDER BY COUNT(*) DESC, loc.country_code`, websiteID,
+	)), start, end, since, start)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	countries := make(map[string]int64)
+	for rows.Next() {
+		var (
+			code  string
+			count int64
+		)
+		if err := rows.Scan(&code, &count); err != nil {
+			return nil, err
+		}
+		countries[code] = count
+	}
+	return countries, rows.Err()
+}
+
+// AlertURLStatusCount 统计时间段内 URL 返回指定状态码区间的次数；prefix 为 true 时按前缀匹配
+func (r *Repository) AlertURLStatusCount(
+	websiteID, url string, prefix bool, start, end int64, minStatus, maxStatus int,
+) (int64, error) {
+	urlCondition := "u.url = ?"
+	urlArg := url
+	if prefix {
+		urlCondition = "u.url LIKE ? ESCAPE '\\'"
+		urlArg = escapeLike(url) + "%"
+	}
+	var count int64
+	err := r.db.QueryRow(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT COUNT(*)
+         FROM "%[1]s_nginx_logs" l
+         JOIN "%[1]s_dim_url" u ON u.id = l.url_id
+         WHERE l.timestamp >= ? AND l.timestamp < ?
+           AND l.status_code >= ? AND l.status_code <= ?
+           AND %[2]s`, websiteID, urlCondition,
+	)), start, end, minStatus, maxStatus, urlArg).Scan(&count)
+	return count, err
+}
+
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+)
+
+// HourlyMetrics 单个小时桶的聚合指标（来自 {site}_agg_hourly / {site}_agg_hourly_ip）
+type HourlyMetrics struct {
+	Bucket int64
+	PV     int64
+	UV     int64
+	S4xx   int64
+	S5xx   int64
+	// Traffic 为 PV 请求的发送字节数
+	Traffic int64
+}
+
+// HourlyMetricsRange 返回 [start, end) 内有数据的小时桶，按 bucket 升序
+func (r *Repository) HourlyMetricsRange(websiteID string, start, end int64) ([]HourlyMetrics, error) {
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT h.bucket, h.pv, COALESCE(u.uv, 0), h.s4xx, h.s5xx, h.traffic
+         FROM "%[1]s_agg_hourly" h
+         LEFT JOIN (
+             SELECT bucket, COUNT(*) AS uv
+             FROM "%[1]s_agg_hourly_ip"
+             WHERE bucket >= ? AND bucket < ?
+             GROUP BY bucket
+         ) u ON u.bucket = h.bucket
+         WHERE h.bucket >= ? AND h.bucket < ?
+         ORDER BY h.bucket`, websiteID,
+	)), start, end, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]HourlyMetrics, 0)
+	for rows.Next() {
+		var point HourlyMetrics
+		if err := rows.Scan(&point.Bucket, &point.PV, &point.UV, &point.S4xx, &point.S5xx, &point.Traffic); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// FirstHourlyBucket 返回最早的小时桶，没有数据时返回 0
+func (r *Repository) FirstHourlyBucket(websiteID string) (int64, error) {
+	var bucket sql.NullInt64
+	if err := r.db.QueryRow(fmt.Sprintf(
+		`SELECT MIN(bucket) FROM "%s_agg_hourly"`, websiteID,
+	)).Scan(&bucket); err != nil {
+		return 0, err
+	}
+	return bucket.Int64, nil
+}
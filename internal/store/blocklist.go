@@ -0,0 +1,157 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+)
+
+// BlocklistEntry 封禁名单条目，同一站点同一 IP 只保留一条，重复加入时刷新原因、命中数与有效期
+type BlocklistEntry struct {
+	ID        int64  `json:"id"`
+	WebsiteID string `json:"website_id"`
+	IP        string `json:"ip"`
+	// Reason 为 rate / errors / security / filter:<name> / manual
+	Reason string `json:"reason"`
+	Hits   int64  `json:"hits"`
+	Note   string `json:"note,omitempty"`
+	// ExpiresAt 为空表示永久有效
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (r *Repository) ensureBlocklistTable() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS "security_blocklist" (
+            id BIGSERIAL PRIMARY KEY,
+            website_id TEXT NOT NULL DEFAULT '',
+            ip TEXT NOT NULL,
+            reason TEXT NOT NULL DEFAULT '',
+            hits BIGINT NOT NULL DEFAULT 0,
+            note TEXT NOT NULL DEFAULT '',
+            expires_at TIMESTAMPTZ,
+            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+            updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+            UNIQUE(website_id, ip)
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_security_blocklist_expires_at ON "security_blocklist"(expires_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := r.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpsertBlocklistEntries 批量写入封禁名单；已存在的条目累加命中数，有效期取较晚者（永久优先）
+func (r *Repository) UpsertBlocklistEntries(entries []BlocklistEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(sqlutil.ReplacePlaceholders(
+		`INSERT INTO "security_blocklist" (website_id, ip, reason, hits, note, expires_at)
+         VALUES (?, ?, ?, ?, ?, ?)
+         ON CONFLICT (website_id, ip) DO UPDATE SET
+            reason = EXCLUDED.reason,
+            hits = "security_blocklist".hits + EXCLUDED.hits,
+            note = EXCLUDED.note,
+            expires_at = CASE
+                WHEN "security_blocklist".expires_at IS NULL OR EXCLUDED.expires_at IS NULL THEN NULL
+                ELSE GREATEST("security_blocklist".expires_at, EXCLUDED.expires_at)
+            END,
+            updated_at = NOW()`,
+	))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		var expiresAt interface{}
+		if entry.ExpiresAt != nil {
+			expiresAt = *entry.ExpiresAt
+		}
+		if _, err := stmt.Exec(
+			entry.WebsiteID, entry.IP, entry.Reason, entry.Hits,
+			sanitizeAndTruncate(entry.Note, maxURLBytes), expiresAt,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListBlocklistEntries 返回未过期的封禁条目，websiteID 为空时返回全部站点
+func (r *Repository) ListBlocklistEntries(websiteID string) ([]BlocklistEntry, error) {
+	conditions := []string{"(expires_at IS NULL OR expires_at > NOW())"}
+	args := make([]interface{}, 0, 1)
+	if websiteID != "" {
+		conditions = append(conditions, "website_id = ?")
+		args = append(args, websiteID)
+	}
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT id, website_id, ip, reason, hits, note, expires_at, created_at, updated_at
+         FROM "security_blocklist"
+         WHERE %s
+         ORDER BY hits DESC, ip, website_id`, strings.Join(conditions, " AND "),
+	)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]BlocklistEntry, 0)
+	for rows.Next() {
+		var entry BlocklistEntry
+		var expiresAt sql.NullTime
+		if err := rows.Scan(
+			&entry.ID, &entry.WebsiteID, &entry.IP, &entry.Reason, &entry.Hits, &entry.Note,
+			&expiresAt, &entry.CreatedAt, &entry.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			value := expiresAt.Time
+			entry.ExpiresAt = &value
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteBlocklistEntry 删除封禁条目，websiteID 为空时删除该 IP 在所有站点下的条目
+func (r *Repository) DeleteBlocklistEntry(websiteID, ip string) (int64, error) {
+	query := `DELETE FROM "security_blocklist" WHERE ip = ?`
+	args := []interface{}{ip}
+	if websiteID != "" {
+		query += " AND website_id = ?"
+		args = append(args, websiteID)
+	}
+	result, err := r.db.Exec(sqlutil.ReplacePlaceholders(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CleanupExpiredBlocklist 删除已过期的封禁条目
+func (r *Repository) CleanupExpiredBlocklist() (int64, error) {
+	result, err := r.db.Exec(
+		`DELETE FROM "security_blocklist" WHERE expires_at IS NOT NULL AND expires_at <= NOW()`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
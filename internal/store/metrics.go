@@ -0,0 +1,52 @@
+package store
+
+import (
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounter(
+		"nginxpulse_requests_total",
+		"已写入的请求数（按站点、状态码分类、请求方法）",
+		"website", "status_class", "method",
+	)
+	responseBytesTotal = metrics.NewCounter(
+		"nginxpulse_response_bytes_total",
+		"已写入请求的响应字节数",
+		"website",
+	)
+	batchInsertDuration = metrics.NewHistogram(
+		"nginxpulse_db_batch_insert_duration_seconds",
+		"日志批量写入数据库的耗时（含死锁重试）",
+		metrics.DefaultDurationBuckets,
+		"website", "result",
+	)
+)
+
+// observeBatchInsert 记录批量写入耗时；写入成功时按状态码分类与请求方法累计请求数
+func observeBatchInsert(websiteID string, logs []NginxLogRecord, duration time.Duration, err error) {
+	if err != nil {
+		batchInsertDuration.Observe(duration.Seconds(), websiteID, "error")
+		return
+	}
+	batchInsertDuration.Observe(duration.Seconds(), websiteID, "success")
+
+	type requestKey struct {
+		statusClass string
+		method      string
+	}
+	counts := make(map[requestKey]int)
+	var bytesSent int64
+	for _, log := range logs {
+		counts[requestKey{metrics.StatusClass(log.Status), metrics.Method(log.Method)}]++
+		if log.BytesSent > 0 {
+			bytesSent += int64(log.BytesSent)
+		}
+	}
+	for key, count := range counts {
+		requestsTotal.Add(float64(count), websiteID, key.statusClass, key.method)
+	}
+	responseBytesTotal.Add(float64(bytesSent), websiteID)
+}
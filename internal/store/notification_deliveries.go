@@ -0,0 +1,158 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+)
+
+const (
+	NotificationDeliverySuccess = "success"
+	NotificationDeliveryFailed  = "failed"
+)
+
+// NotificationDelivery 通知外发记录，每次发送（含重试）写入一条
+type NotificationDelivery struct {
+	ID int64 `json:"id"`
+	// NotificationID 为 0 表示测试发送
+	NotificationID int64     `json:"notification_id"`
+	Fingerprint    string    `json:"fingerprint,omitempty"`
+	Channel        string    `json:"channel"`
+	ChannelType    string    `json:"channel_type"`
+	Title          string    `json:"title"`
+	Status         string    `json:"status"`
+	Attempts       int       `json:"attempts"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// NotificationDeliveryFilter 外发记录查询条件，空值表示不过滤
+type NotificationDeliveryFilter struct {
+	Channel        string
+	Status         string
+	NotificationID int64
+}
+
+func (r *Repository) ensureNotificationDeliveryTable() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS "notification_deliveries" (
+            id BIGSERIAL PRIMARY KEY,
+            notification_id BIGINT,
+            fingerprint TEXT NOT NULL DEFAULT '',
+            channel TEXT NOT NULL,
+            channel_type TEXT NOT NULL DEFAULT '',
+            title TEXT NOT NULL DEFAULT '',
+            status TEXT NOT NULL,
+            attempts INTEGER NOT NULL DEFAULT 0,
+            status_code INTEGER NOT NULL DEFAULT 0,
+            error TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_deliveries_created_at ON "notification_deliveries"(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_deliveries_channel ON "notification_deliveries"(channel, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_deliveries_notification ON "notification_deliveries"(notification_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := r.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveNotificationDelivery 写入一条外发记录
+func (r *Repository) SaveNotificationDelivery(delivery NotificationDelivery) error {
+	var notificationID interface{}
+	if delivery.NotificationID > 0 {
+		notificationID = delivery.NotificationID
+	}
+	_, err := r.db.Exec(sqlutil.ReplacePlaceholders(
+		`INSERT INTO "notification_deliveries"
+            (notification_id, fingerprint, channel, channel_type, title, status, attempts, status_code, error)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	),
+		notificationID, delivery.Fingerprint, delivery.Channel, delivery.ChannelType,
+		sanitizeAndTruncate(delivery.Title, maxURLBytes), delivery.Status, delivery.Attempts,
+		delivery.StatusCode, sanitizeAndTruncate(delivery.Error, maxURLBytes),
+	)
+	return err
+}
+
+// ListNotificationDeliveries 按时间倒序分页返回外发记录
+func (r *Repository) ListNotificationDeliveries(filter NotificationDeliveryFilter, page, pageSize int) ([]NotificationDelivery, bool, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 200 {
+		pageSize = 200
+	}
+
+	conditions := make([]string, 0, 3)
+	args := make([]interface{}, 0, 5)
+	if filter.Channel != "" {
+		conditions = append(conditions, "channel = ?")
+		args = append(args, filter.Channel)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.NotificationID > 0 {
+		conditions = append(conditions, "notification_id = ?")
+		args = append(args, filter.NotificationID)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, pageSize+1, (page-1)*pageSize)
+
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT id, notification_id, fingerprint, channel, channel_type, title, status,
+                attempts, status_code, error, created_at
+         FROM "notification_deliveries"
+         %s
+         ORDER BY created_at DESC, id DESC
+         LIMIT ? OFFSET ?`, where,
+	)), args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]NotificationDelivery, 0, pageSize)
+	hasMore := false
+	for rows.Next() {
+		var delivery NotificationDelivery
+		var notificationID sql.NullInt64
+		if err := rows.Scan(
+			&delivery.ID, &notificationID, &delivery.Fingerprint, &delivery.Channel, &delivery.ChannelType,
+			&delivery.Title, &delivery.Status, &delivery.Attempts, &delivery.StatusCode, &delivery.Error,
+			&delivery.CreatedAt,
+		); err != nil {
+			return nil, false, err
+		}
+		delivery.NotificationID = notificationID.Int64
+		if len(deliveries) < pageSize {
+			deliveries = append(deliveries, delivery)
+		} else {
+			hasMore = true
+		}
+	}
+	return deliveries, hasMore, rows.Err()
+}
+
+func (r *Repository) cleanupNotificationDeliveries(cutoff time.Time) error {
+	_, err := r.db.Exec(
+		sqlutil.ReplacePlaceholders(`DELETE FROM "notification_deliveries" WHERE created_at < ?`),
+		cutoff,
+	)
+	return err
+}
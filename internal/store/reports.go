@@ -0,0 +1,244 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+)
+
+// 报告发送周期
+const (
+	ReportScheduleDaily  = "daily"
+	ReportScheduleWeekly = "weekly"
+)
+
+// ReportDefinition 定时报告。WebsiteIDs 为空表示全部站点，多个站点合并为一份报告；
+// Channel 为 notifications.channels 中的渠道名称
+type ReportDefinition struct {
+	ID         int64    `json:"id"`
+	Name       string   `json:"name"`
+	WebsiteIDs []string `json:"website_ids"`
+	// Schedule 为 daily / weekly；Weekday 为 0（周日）~ 6，仅 weekly 使用；Hour 为发送的整点（本地时间）
+	Schedule string `json:"schedule"`
+	Weekday  int    `json:"weekday"`
+	Hour     int    `json:"hour"`
+	// TimeRange 为统计接口的时间范围，如 yesterday / lastweek / last7days
+	TimeRange string   `json:"time_range"`
+	Sections  []string `json:"sections"`
+	// Limit 各 Top N 分节的条数
+	Limit   int    `json:"limit"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastStatus string     `json:"last_status,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// ErrorURLCount 错误请求（4xx / 5xx）按 URL 与状态码汇总
+type ErrorURLCount struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Count      int    `json:"count"`
+}
+
+func (r *Repository) ensureReportTable() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS "report_definitions" (
+            id BIGSERIAL PRIMARY KEY,
+            name TEXT NOT NULL,
+            website_ids JSONB,
+            schedule TEXT NOT NULL DEFAULT 'daily',
+            weekday INTEGER NOT NULL DEFAULT 1,
+            hour INTEGER NOT NULL DEFAULT 8,
+            time_range TEXT NOT NULL DEFAULT 'yesterday',
+            sections JSONB,
+            top_limit INTEGER NOT NULL DEFAULT 10,
+            channel TEXT NOT NULL,
+            enabled BOOLEAN NOT NULL DEFAULT TRUE,
+            last_run_at TIMESTAMPTZ,
+            last_status TEXT NOT NULL DEFAULT '',
+            last_error TEXT NOT NULL DEFAULT '',
+            created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+            updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )`,
+	}
+	for _, stmt := range stmts {
+		if _, err := r.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const reportColumns = `id, name, website_ids, schedule, weekday, hour, time_range, sections, top_limit, channel,
+                enabled, last_run_at, last_status, last_error, created_at, updated_at`
+
+func scanReportDefinition(scanner interface{ Scan(...interface{}) error }) (ReportDefinition, error) {
+	var (
+		report        ReportDefinition
+		websitesBytes []byte
+		sectionsBytes []byte
+		lastRunAt     sql.NullTime
+	)
+	if err := scanner.Scan(
+		&report.ID, &report.Name, &websitesBytes, &report.Schedule, &report.Weekday, &report.Hour,
+		&report.TimeRange, &sectionsBytes, &report.Limit, &report.Channel, &report.Enabled, &lastRunAt,
+		&report.LastStatus, &report.LastError, &report.CreatedAt, &report.UpdatedAt,
+	); err != nil {
+		return report, err
+	}
+	report.WebsiteIDs = make([]string, 0)
+	report.Sections = make([]string, 0)
+	if len(websitesBytes) > 0 {
+		_ = json.Unmarshal(websitesBytes, &report.WebsiteIDs)
+	}
+	if len(sectionsBytes) > 0 {
+		_ = json.Unmarshal(sectionsBytes, &report.Sections)
+	}
+	if lastRunAt.Valid {
+		value := lastRunAt.Time
+		report.LastRunAt = &value
+	}
+	return report, nil
+}
+
+func encodeStringList(values []string) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// ListReportDefinitions 返回全部报告定义
+func (r *Repository) ListReportDefinitions() ([]ReportDefinition, error) {
+	rows, err := r.db.Query(`SELECT ` + reportColumns + ` FROM "report_definitions" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]ReportDefinition, 0)
+	for rows.Next() {
+		report, err := scanReportDefinition(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// GetReportDefinition 按 ID 查询报告定义，不存在时返回 sql.ErrNoRows
+func (r *Repository) GetReportDefinition(id int64) (ReportDefinition, error) {
+	return scanReportDefinition(r.db.QueryRow(sqlutil.ReplacePlaceholders(
+		`SELECT `+reportColumns+` FROM "report_definitions" WHERE id = ?`,
+	), id))
+}
+
+// CreateReportDefinition 新建报告定义并回填 ID
+func (r *Repository) CreateReportDefinition(report *ReportDefinition) error {
+	row := r.db.QueryRow(sqlutil.ReplacePlaceholders(
+		`INSERT INTO "report_definitions"
+            (name, website_ids, schedule, weekday, hour, time_range, sections, top_limit, channel, enabled)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+         RETURNING `+reportColumns,
+	),
+		report.Name, encodeStringList(report.WebsiteIDs), report.Schedule, report.Weekday, report.Hour,
+		report.TimeRange, encodeStringList(report.Sections), report.Limit, report.Channel, report.Enabled,
+	)
+	created, err := scanReportDefinition(row)
+	if err != nil {
+		return err
+	}
+	*report = created
+	return nil
+}
+
+// UpdateReportDefinition 更新报告定义
+func (r *Repository) UpdateReportDefinition(report *ReportDefinition) error {
+	row := r.db.QueryRow(sqlutil.ReplacePlaceholders(
+		`UPDATE "report_definitions" SET
+            name = ?, website_ids = ?, schedule = ?, weekday = ?, hour = ?, time_range = ?,
+            sections = ?, top_limit = ?, channel = ?, enabled = ?, updated_at = NOW()
+         WHERE id = ?
+         RETURNING `+reportColumns,
+	),
+		report.Name, encodeStringList(report.WebsiteIDs), report.Schedule, report.Weekday, report.Hour,
+		report.TimeRange, encodeStringList(report.Sections), report.Limit, report.Channel, report.Enabled,
+		report.ID,
+	)
+	updated, err := scanReportDefinition(row)
+	if err != nil {
+		return err
+	}
+	*report = updated
+	return nil
+}
+
+// DeleteReportDefinition 删除报告定义
+func (r *Repository) DeleteReportDefinition(id int64) (bool, error) {
+	result, err := r.db.Exec(sqlutil.ReplacePlaceholders(`DELETE FROM "report_definitions" WHERE id = ?`), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ClaimReportRun 将报告标记为已在 due 时刻运行；已运行过（last_run_at >= due）时返回 false，避免重复发送
+func (r *Repository) ClaimReportRun(id int64, due time.Time) (bool, error) {
+	result, err := r.db.Exec(sqlutil.ReplacePlaceholders(
+		`UPDATE "report_definitions" SET last_run_at = ?
+         WHERE id = ? AND (last_run_at IS NULL OR last_run_at < ?)`,
+	), due, id, due)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// SaveReportResult 记录最近一次发送结果
+func (r *Repository) SaveReportResult(id int64, status, message string) error {
+	_, err := r.db.Exec(sqlutil.ReplacePlaceholders(
+		`UPDATE "report_definitions" SET last_status = ?, last_error = ? WHERE id = ?`,
+	), status, sanitizeAndTruncate(message, maxURLBytes), id)
+	return err
+}
+
+// TopErrorURLs 返回时间段内 4xx / 5xx 请求最多的 URL 与状态码（包含非 PV 请求）
+func (r *Repository) TopErrorURLs(websiteID string, start, end int64, limit int) ([]ErrorURLCount, error) {
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT u.url, l.status_code, COUNT(*)
+         FROM "%[1]s_nginx_logs" l
+         JOIN "%[1]s_dim_url" u ON u.id = l.url_id
+         WHERE l.timestamp >= ? AND l.timestamp < ? AND l.status_code >= 400 AND l.status_code < 600
+         GROUP BY u.url, l.status_code
+         ORDER BY COUNT(*) DESC, u.url
+         LIMIT ?`, websiteID,
+	)), start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]ErrorURLCount, 0, limit)
+	for rows.Next() {
+		var item ErrorURLCount
+		if err := rows.Scan(&item.URL, &item.StatusCode, &item.Count); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -26,6 +27,7 @@ type NginxLogRecord struct {
 	Timestamp        time.Time `json:"timestamp"`
 	Method           string    `json:"method"`
 	Url              string    `json:"url"`
+	Route            string    `json:"route"`
 	Status           int       `json:"status"`
 	BytesSent        int       `json:"bytes_sent"`
 	Referer          string    `json:"referer"`
@@ -34,6 +36,81 @@ type NginxLogRecord struct {
 	UserDevice       string    `json:"user_device"`
 	DomesticLocation string    `json:"domestic_location"`
 	GlobalLocation   string    `json:"global_location"`
+	// Extra 额外字段（按站点 extraFields 白名单采集），以 JSONB 保存
+	Extra map[string]string `json:"extra,omitempty"`
+	// Campaign 从请求 URL 中提取的 UTM 参数 / 广告点击 ID
+	Campaign *CampaignInfo `json:"campaign,omitempty"`
+	// Channel 来源渠道分类（direct/search/social/referral/email/campaign/internal）
+	Channel *ChannelInfo `json:"channel,omitempty"`
+	// UserAgent 原始 UA 及版本 / 设备明细，为空时不记录
+	UserAgent *UserAgentInfo `json:"user_agent,omitempty"`
+	// Network IP 所属网络（ASN / 组织 / 机房或家庭宽带），无法识别时为空
+	Network *NetworkInfo `json:"network,omitempty"`
+	// Attack 命中的 Web 攻击特征（取最高严重级别的一条规则），未命中时为空
+	Attack *AttackInfo `json:"attack,omitempty"`
+	// Reputation IP 命中的信誉名单（黑名单、Tor 出口等），未命中时为空
+	Reputation *ReputationInfo `json:"reputation,omitempty"`
+}
+
+// GeoInfo 结构化归属地：ISO 3166-1 国家代码、ISO 3166-2 地区代码、城市与经纬度（经纬度均为 0 表示未知）
+type GeoInfo struct {
+	CountryCode string  `json:"country_code,omitempty"`
+	RegionCode  string  `json:"region_code,omitempty"`
+	City        string  `json:"city,omitempty"`
+	Latitude    float64 `json:"latitude,omitempty"`
+	Longitude   float64 `json:"longitude,omitempty"`
+}
+
+// LocationCodeResolver 由 domestic / global 文本推导结构化归属地，用于回填历史维度
+type LocationCodeResolver func(domestic, global string) GeoInfo
+
+// NetworkInfo IP 网络维度，Type 为 hosting / residential / unknown
+type NetworkInfo struct {
+	ASN  int64  `json:"asn,omitempty"`
+	Org  string `json:"org,omitempty"`
+	Type string `json:"type"`
+}
+
+// AttackInfo Web 攻击特征维度：攻击类型 / 规则 ID / 严重级别
+type AttackInfo struct {
+	Type     string `json:"type"`
+	RuleID   string `json:"rule_id"`
+	Severity string `json:"severity"`
+}
+
+// ReputationInfo IP 信誉维度：名单名称 / 分类
+type ReputationInfo struct {
+	List     string `json:"list"`
+	Category string `json:"category"`
+}
+
+// UserAgentInfo 原始 User-Agent 维度，按原始字符串去重
+type UserAgentInfo struct {
+	Raw            string `json:"raw"`
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os"`
+	OSVersion      string `json:"os_version,omitempty"`
+	DeviceBrand    string `json:"device_brand,omitempty"`
+	DeviceModel    string `json:"device_model,omitempty"`
+}
+
+// ChannelInfo 来源渠道维度
+type ChannelInfo struct {
+	Channel string `json:"channel"`
+	Source  string `json:"source,omitempty"`
+	Domain  string `json:"domain,omitempty"`
+	Keyword string `json:"keyword,omitempty"`
+}
+
+// CampaignInfo 推广活动维度，ClickID 仅记录命中的点击 ID 参数名（如 gclid），不保存其值
+type CampaignInfo struct {
+	Source  string `json:"source"`
+	Medium  string `json:"medium"`
+	Name    string `json:"name"`
+	Term    string `json:"term,omitempty"`
+	Content string `json:"content,omitempty"`
+	ClickID string `json:"click_id,omitempty"`
 }
 
 type IPGeoAnomalyLog struct {
@@ -82,6 +159,10 @@ const (
 	maxURLBytes     = 2000
 	maxRefererBytes = 2000
 	maxUABytes      = 256
+	// 单个额外字段值的最大长度
+	maxExtraValueBytes = 512
+	maxCampaignBytes   = 256
+	maxRawUABytes      = 1024
 )
 
 func truncateUTF8Bytes(s string, maxBytes int) string {
@@ -106,23 +187,118 @@ func sanitizeLogRecord(log NginxLogRecord) NginxLogRecord {
 	log.IP = sanitizeUTF8(log.IP)
 	log.Method = sanitizeUTF8(log.Method)
 	log.Url = sanitizeAndTruncate(log.Url, maxURLBytes)
+	log.Route = sanitizeAndTruncate(log.Route, maxURLBytes)
 	log.Referer = sanitizeAndTruncate(log.Referer, maxRefererBytes)
 	log.UserBrowser = sanitizeAndTruncate(log.UserBrowser, maxUABytes)
 	log.UserOs = sanitizeAndTruncate(log.UserOs, maxUABytes)
 	log.UserDevice = sanitizeAndTruncate(log.UserDevice, maxUABytes)
 	log.DomesticLocation = sanitizeUTF8(log.DomesticLocation)
 	log.GlobalLocation = sanitizeUTF8(log.GlobalLocation)
+	if log.Campaign != nil {
+		campaign := CampaignInfo{
+			Source:  sanitizeAndTruncate(log.Campaign.Source, maxCampaignBytes),
+			Medium:  sanitizeAndTruncate(log.Campaign.Medium, maxCampaignBytes),
+			Name:    sanitizeAndTruncate(log.Campaign.Name, maxCampaignBytes),
+			Term:    sanitizeAndTruncate(log.Campaign.Term, maxCampaignBytes),
+			Content: sanitizeAndTruncate(log.Campaign.Content, maxCampaignBytes),
+			ClickID: sanitizeAndTruncate(log.Campaign.ClickID, maxCampaignBytes),
+		}
+		log.Campaign = &campaign
+	}
+	if log.Channel != nil {
+		channel := ChannelInfo{
+			Channel: sanitizeAndTruncate(log.Channel.Channel, maxCampaignBytes),
+			Source:  sanitizeAndTruncate(log.Channel.Source, maxCampaignBytes),
+			Domain:  sanitizeAndTruncate(log.Channel.Domain, maxCampaignBytes),
+			Keyword: sanitizeAndTruncate(log.Channel.Keyword, maxCampaignBytes),
+		}
+		log.Channel = &channel
+	}
+	if log.UserAgent != nil {
+		userAgent := UserAgentInfo{
+			Raw:            sanitizeAndTruncate(log.UserAgent.Raw, maxRawUABytes),
+			Browser:        sanitizeAndTruncate(log.UserAgent.Browser, maxUABytes),
+			BrowserVersion: sanitizeAndTruncate(log.UserAgent.BrowserVersion, maxUABytes),
+			OS:             sanitizeAndTruncate(log.UserAgent.OS, maxUABytes),
+			OSVersion:      sanitizeAndTruncate(log.UserAgent.OSVersion, maxUABytes),
+			DeviceBrand:    sanitizeAndTruncate(log.UserAgent.DeviceBrand, maxUABytes),
+			DeviceModel:    sanitizeAndTruncate(log.UserAgent.DeviceModel, maxUABytes),
+		}
+		log.UserAgent = &userAgent
+	}
+	if log.Network != nil {
+		network := NetworkInfo{
+			ASN:  log.Network.ASN,
+			Org:  sanitizeAndTruncate(log.Network.Org, maxCampaignBytes),
+			Type: sanitizeAndTruncate(log.Network.Type, maxCampaignBytes),
+		}
+		log.Network = &network
+	}
+	if log.Attack != nil {
+		attack := AttackInfo{
+			Type:     sanitizeAndTruncate(log.Attack.Type, maxCampaignBytes),
+			RuleID:   sanitizeAndTruncate(log.Attack.RuleID, maxCampaignBytes),
+			Severity: sanitizeAndTruncate(log.Attack.Severity, maxCampaignBytes),
+		}
+		log.Attack = &attack
+	}
+	if log.Reputation != nil {
+		reputation := ReputationInfo{
+			List:     sanitizeAndTruncate(log.Reputation.List, maxCampaignBytes),
+			Category: sanitizeAndTruncate(log.Reputation.Category, maxCampaignBytes),
+		}
+		log.Reputation = &reputation
+	}
+	if len(log.Extra) > 0 {
+		extra := make(map[string]string, len(log.Extra))
+		for key, value := range log.Extra {
+			extra[sanitizeUTF8(key)] = sanitizeAndTruncate(value, maxExtraValueBytes)
+		}
+		log.Extra = extra
+	}
 	return log
 }
 
+// encodeExtraFields 将额外字段编码为 JSON 文本，无额外字段时返回 nil（写入 NULL）
+func encodeExtraFields(extra map[string]string) (interface{}, error) {
+	if len(extra) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(extra)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
 type IPGeoCacheEntry struct {
 	Domestic string
 	Global   string
 	Source   string
+	Geo      GeoInfo
 }
 
 type Repository struct {
-	db *sql.DB
+	db         *sql.DB
+	dispatcher NotificationDispatcher
+}
+
+// NotificationDispatcher 系统通知写入成功后的外发处理（Webhook、邮件、IM 机器人等）
+type NotificationDispatcher interface {
+	Dispatch(notification SystemNotification)
+}
+
+// SetNotificationDispatcher 设置系统通知外发处理，需在启动阶段调用
+func (r *Repository) SetNotificationDispatcher(dispatcher NotificationDispatcher) {
+	r.dispatcher = dispatcher
+}
+
+// dispatchNotification 将已写入的系统通知交给外发处理，未配置时忽略
+func (r *Repository) dispatchNotification(notification SystemNotification) {
+	if r.dispatcher == nil {
+		return
+	}
+	r.dispatcher.Dispatch(notification)
 }
 
 func NewRepository() (*Repository, error) {
@@ -225,7 +401,12 @@ func (r *Repository) GetIPGeoCache(ips []string) (map[string]IPGeoCacheEntry, er
 		args[i] = ip
 	}
 
-	query := fmt.Sprintf(`SELECT ip, domestic, global, source FROM "ip_geo_cache" WHERE ip IN (%s)`, strings.Join(placeholders, ","))
+	query := fmt.Sprintf(
+		`SELECT ip, domestic, global, source, country_code, region_code, city,
+                COALESCE(latitude, 0), COALESCE(longitude, 0)
+         FROM "ip_geo_cache" WHERE ip IN (%s)`,
+		strings.Join(placeholders, ","),
+	)
 	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(query), args...)
 	if err != nil {
 		return results, err
@@ -234,13 +415,18 @@ func (r *Repository) GetIPGeoCache(ips []string) (map[string]IPGeoCacheEntry, er
 
 	for rows.Next() {
 		var ip, domestic, global, source string
-		if err := rows.Scan(&ip, &domestic, &global, &source); err != nil {
+		var geo GeoInfo
+		if err := rows.Scan(
+			&ip, &domestic, &global, &source,
+			&geo.CountryCode, &geo.RegionCode, &geo.City, &geo.Latitude, &geo.Longitude,
+		); err != nil {
 			return results, err
 		}
 		results[ip] = IPGeoCacheEntry{
 			Domestic: domestic,
 			Global:   global,
 			Source:   source,
+			Geo:      geo,
 		}
 	}
 	if err := rows.Err(); err != nil {
@@ -287,6 +473,34 @@ func (r *Repository) DeleteIPGeoCache(ips []string) error {
 	return err
 }
 
+// ListIPGeoCacheIPs 按 IP 顺序分页读取缓存中的 IP，after 为上一页最后一个 IP
+func (r *Repository) ListIPGeoCacheIPs(after string, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	rows, err := r.db.Query(
+		sqlutil.ReplacePlaceholders(`SELECT ip FROM "ip_geo_cache" WHERE ip > ? ORDER BY ip ASC LIMIT ?`),
+		after, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ips := make([]string, 0, limit)
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ips, nil
+}
+
 func (r *Repository) ClearIPGeoPending() error {
 	_, err := r.db.Exec(`DELETE FROM "ip_geo_pending"`)
 	return err
@@ -494,7 +708,7 @@ func (r *Repository) UpsertIPGeoCache(entries map[string]IPGeoCacheEntry) error
 	}
 
 	values := make([]string, 0, len(entries))
-	args := make([]interface{}, 0, len(entries)*4)
+	args := make([]interface{}, 0, len(entries)*9)
 	for ip, entry := range entries {
 		if ip == "" {
 			continue
@@ -503,19 +717,30 @@ func (r *Repository) UpsertIPGeoCache(entries map[string]IPGeoCacheEntry) error
 		if source == "" {
 			source = "unknown"
 		}
-		values = append(values, "(?, ?, ?, ?)")
-		args = append(args, ip, entry.Domestic, entry.Global, source)
+		latitude, longitude := entry.Geo.coordinates()
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(
+			args, ip, entry.Domestic, entry.Global, source,
+			entry.Geo.CountryCode, entry.Geo.RegionCode, entry.Geo.City, latitude, longitude,
+		)
 	}
 	if len(values) == 0 {
 		return nil
 	}
 
-	query := fmt.Sprintf(`INSERT INTO "ip_geo_cache" (ip, domestic, global, source)
+	query := fmt.Sprintf(`INSERT INTO "ip_geo_cache" (
+            ip, domestic, global, source, country_code, region_code, city, latitude, longitude
+        )
         VALUES %s
         ON CONFLICT (ip) DO UPDATE SET
             domestic = excluded.domestic,
             global = excluded.global,
             source = excluded.source,
+            country_code = excluded.country_code,
+            region_code = excluded.region_code,
+            city = excluded.city,
+            latitude = excluded.latitude,
+            longitude = excluded.longitude,
             updated_at = NOW()`, strings.Join(values, ","))
 
 	_, err := r.db.Exec(sqlutil.ReplacePlaceholders(query), args...)
@@ -727,6 +952,10 @@ func (r *Repository) CreateSystemNotification(entry SystemNotification) (int64,
 		if err := row.Scan(&id); err != nil {
 			return 0, err
 		}
+		r.dispatchNotification(SystemNotification{
+			ID: id, Level: level, Category: category, Title: title, Message: message,
+			Occurrences: 1, Metadata: entry.Metadata,
+		})
 		return id, nil
 	}
 
@@ -743,13 +972,18 @@ func (r *Repository) CreateSystemNotification(entry SystemNotification) (int64,
             occurrences = "system_notifications".occurrences + 1,
             last_occurred_at = NOW(),
             read_at = NULL
-         RETURNING id`,
+         RETURNING id, occurrences`,
 		level, category, title, message, fingerprint, metadataJSON,
 	)
 	var id int64
-	if err := row.Scan(&id); err != nil {
+	var occurrences int
+	if err := row.Scan(&id, &occurrences); err != nil {
 		return 0, err
 	}
+	r.dispatchNotification(SystemNotification{
+		ID: id, Level: level, Category: category, Title: title, Message: message,
+		Fingerprint: fingerprint, Occurrences: occurrences, Metadata: entry.Metadata,
+	})
 	return id, nil
 }
 
@@ -799,13 +1033,18 @@ func (r *Repository) CreateSystemNotificationWithCount(entry SystemNotification,
             occurrences = "system_notifications".occurrences + EXCLUDED.occurrences,
             last_occurred_at = NOW(),
             read_at = NULL
-         RETURNING id`,
+         RETURNING id, occurrences`,
 		level, category, title, message, fingerprint, count, metadataJSON,
 	)
 	var id int64
-	if err := row.Scan(&id); err != nil {
+	var occurrences int
+	if err := row.Scan(&id, &occurrences); err != nil {
 		return 0, err
 	}
+	r.dispatchNotification(SystemNotification{
+		ID: id, Level: level, Category: category, Title: title, Message: message,
+		Fingerprint: fingerprint, Occurrences: occurrences, Metadata: entry.Metadata,
+	})
 	return id, nil
 }
 
@@ -968,7 +1207,7 @@ func (r *Repository) FetchIPGeoAnomalyLogs(websiteID string, page, pageSize int)
 	locationTable := fmt.Sprintf("%s_dim_location", websiteID)
 
 	args := make([]interface{}, 0, len(ipGeoAnomalyKeywords)*2)
-	whereClause := buildIPGeoAnomalyWhereClause("loc.domestic", "loc.global", &args)
+	whereClause := buildIPGeoAnomalyWhereClause("loc.domestic", "loc.country_code", &args)
 	if whereClause == "" {
 		return nil, nil
 	}
@@ -1015,12 +1254,12 @@ func (r *Repository) detectIPGeoAnomaliesForWebsite(websiteID string, limit int)
 	}
 
 	args := make([]interface{}, 0, len(ipGeoAnomalyKeywords)*2)
-	whereClause := buildIPGeoAnomalyWhereClause("domestic", "global", &args)
+	whereClause := buildIPGeoAnomalyWhereClause("domestic", "country_code", &args)
 	if whereClause == "" {
 		return 0, nil, nil
 	}
 
-	query := sqlutil.ReplacePlaceholders(fmt.Sprintf(`SELECT domestic, global FROM "%s" WHERE %s`, tableName, whereClause))
+	query := sqlutil.ReplacePlaceholders(fmt.Sprintf(`SELECT domestic FROM "%s" WHERE %s`, tableName, whereClause))
 	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return 0, nil, err
@@ -1031,11 +1270,10 @@ func (r *Repository) detectIPGeoAnomaliesForWebsite(websiteID string, limit int)
 	samples := make([]string, 0, limit)
 	for rows.Next() {
 		var domestic string
-		var global string
-		if err := rows.Scan(&domestic, &global); err != nil {
+		if err := rows.Scan(&domestic); err != nil {
 			return 0, nil, err
 		}
-		if !isIPGeoAnomalyLabel(domestic, global) {
+		if !isIPGeoAnomalyLabel(domestic) {
 			continue
 		}
 		count++
@@ -1053,7 +1291,8 @@ var ipGeoAnomalyKeywords = []string{
 	"电信", "联通", "移动", "铁通", "广电", "网通", "教育网", "长城宽带", "有线", "鹏博士",
 }
 
-func buildIPGeoAnomalyWhereClause(domesticColumn, globalColumn string, args *[]interface{}) string {
+// buildIPGeoAnomalyWhereClause 国内归属地中城市位置被运营商名称占用的记录
+func buildIPGeoAnomalyWhereClause(domesticColumn, countryCodeColumn string, args *[]interface{}) string {
 	keywordConditions := make([]string, 0, len(ipGeoAnomalyKeywords))
 	for _, keyword := range ipGeoAnomalyKeywords {
 		keywordConditions = append(keywordConditions, fmt.Sprintf("%s ILIKE ?", domesticColumn))
@@ -1072,38 +1311,21 @@ func buildIPGeoAnomalyWhereClause(domesticColumn, globalColumn string, args *[]i
 		*args = append(*args, value)
 	}
 
-	chinaConditions := []string{
-		fmt.Sprintf("%s = ?", globalColumn),
-		fmt.Sprintf("LOWER(%s) = ?", globalColumn),
-	}
-	*args = append(*args, "中国", "china")
+	*args = append(*args, "CN")
 
 	return fmt.Sprintf(
-		`%s IS NOT NULL AND %s <> '' AND (%s) AND %s NOT IN (%s) AND (%s)`,
+		`%s IS NOT NULL AND %s <> '' AND (%s) AND %s NOT IN (%s) AND %s = ?`,
 		domesticColumn,
 		domesticColumn,
 		strings.Join(keywordConditions, " OR "),
 		domesticColumn,
 		strings.Join(excludedPlaceholders, ", "),
-		strings.Join(chinaConditions, " OR "),
+		countryCodeColumn,
 	)
 }
 
-func isChinaGlobalLabel(value string) bool {
-	trimmed := strings.TrimSpace(value)
-	if trimmed == "" {
-		return false
-	}
-	if trimmed == "中国" {
-		return true
-	}
-	return strings.EqualFold(trimmed, "china")
-}
-
-func isIPGeoAnomalyLabel(domestic, global string) bool {
-	if !isChinaGlobalLabel(global) {
-		return false
-	}
+// isIPGeoAnomalyLabel 国家代码已在 SQL 中限定为 CN，这里只检查末段是否为运营商
+func isIPGeoAnomalyLabel(domestic string) bool {
 	trimmed := strings.TrimSpace(domestic)
 	if trimmed == "" {
 		return false
@@ -1144,6 +1366,78 @@ func isISPKeyword(value string) bool {
 	return false
 }
 
+// BackfillLocationCodes 为缺少国家代码的地理位置维度补齐代码与城市，无法识别的记为空字符串避免重复处理；
+// 每次最多处理 limit 行，返回处理的行数
+func (r *Repository) BackfillLocationCodes(websiteID string, resolve LocationCodeResolver, limit int) (int, error) {
+	tableName := fmt.Sprintf("%s_dim_location", websiteID)
+	exists, err := r.tableExists(tableName)
+	if err != nil || !exists {
+		return 0, err
+	}
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT id, domestic, global FROM "%s" WHERE country_code IS NULL ORDER BY id LIMIT ?`,
+		tableName,
+	)), limit)
+	if err != nil {
+		return 0, err
+	}
+	type locationRow struct {
+		id       int64
+		domestic string
+		global   string
+	}
+	pending := make([]locationRow, 0, limit)
+	for rows.Next() {
+		var row locationRow
+		if err := rows.Scan(&row.id, &row.domestic, &row.global); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	stmt, err := tx.Prepare(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`UPDATE "%s" SET country_code = ?, region_code = ?, city = ?
+         WHERE id = ? AND country_code IS NULL`,
+		tableName,
+	)))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, row := range pending {
+		geo := resolve(row.domestic, row.global)
+		if _, err = stmt.Exec(geo.CountryCode, geo.RegionCode, geo.City, row.id); err != nil {
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
+
 func (r *Repository) HasLogs(websiteID string) (bool, error) {
 	tableName := fmt.Sprintf("%s_nginx_logs", websiteID)
 	query := fmt.Sprintf(`SELECT 1 FROM "%s" LIMIT 1`, tableName)
@@ -1209,6 +1503,13 @@ func (r *Repository) BatchInsertLogsForWebsite(websiteID string, logs []NginxLog
 		return nil
 	}
 
+	start := time.Now()
+	err := r.batchInsertLogsWithRetry(websiteID, logs)
+	observeBatchInsert(websiteID, logs, time.Since(start), err)
+	return err
+}
+
+func (r *Repository) batchInsertLogsWithRetry(websiteID string, logs []NginxLogRecord) error {
 	// 不修改调用方的 slice，避免潜在副作用
 	logsCopy := append([]NginxLogRecord(nil), logs...)
 	sortLogsForLocking(logsCopy)
@@ -1296,8 +1597,8 @@ func (r *Repository) batchInsertLogsForWebsiteOnce(websiteID string, logs []Ngin
 	stmtNginx, err := tx.Prepare(sqlutil.ReplacePlaceholders(fmt.Sprintf(`
         INSERT INTO "%s" (
         ip_id, pageview_flag, timestamp, method, url_id, 
-        status_code, bytes_sent, referer_id, ua_id, location_id)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        status_code, bytes_sent, referer_id, ua_id, location_id, route_id, campaign_id, channel_id, user_agent_id, network_id, attack_id, reputation_id, extra)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CAST(CAST(? AS TEXT) AS JSONB))
     `, logTable)))
 	if err != nil {
 		return err
@@ -1352,17 +1653,116 @@ func (r *Repository) batchInsertLogsForWebsiteOnce(websiteID string, logs []Ngin
 		}
 
 		locationKey := locationCacheKey(log.DomesticLocation, log.GlobalLocation)
-		locationID, err := getOrCreateDimID(
-			cache.location, dims.insertLocation, dims.selectLocation, locationKey,
-			log.DomesticLocation, log.GlobalLocation,
+		locationID, err := getOrCreateLocationID(
+			cache.location, dims, locationKey, log.DomesticLocation, log.GlobalLocation, nil,
 		)
 		if err != nil {
 			return err
 		}
 
+		// 未归一化的记录（如演示数据）route_id 为空，统计时回退到原始 URL
+		var routeID interface{}
+		if log.Route != "" {
+			id, err := getOrCreateDimID(
+				cache.route, dims.insertRoute, dims.selectRoute, log.Route, log.Route,
+			)
+			if err != nil {
+				return err
+			}
+			routeID = id
+		}
+
+		// 会话归因取入口 PV 的推广活动与来源渠道
+		var attribution sessionAttribution
+		var campaignID interface{}
+		if log.Campaign != nil {
+			c := log.Campaign
+			id, err := getOrCreateDimID(
+				cache.campaign, dims.insertCampaign, dims.selectCampaign,
+				campaignCacheKey(*c), c.Source, c.Medium, c.Name, c.Term, c.Content, c.ClickID,
+			)
+			if err != nil {
+				return err
+			}
+			campaignID = id
+			attribution.campaignID = sql.NullInt64{Int64: id, Valid: true}
+		}
+
+		var channelID interface{}
+		if log.Channel != nil {
+			c := log.Channel
+			id, err := getOrCreateDimID(
+				cache.channel, dims.insertChannel, dims.selectChannel,
+				channelCacheKey(*c), c.Channel, c.Source, c.Domain, c.Keyword,
+			)
+			if err != nil {
+				return err
+			}
+			channelID = id
+			attribution.channelID = sql.NullInt64{Int64: id, Valid: true}
+		}
+
+		var userAgentID interface{}
+		if log.UserAgent != nil && log.UserAgent.Raw != "" {
+			ua := log.UserAgent
+			id, err := getOrCreateDimIDByLookup(
+				cache.uaDetail, dims.insertUADetail, dims.selectUADetail, ua.Raw,
+				[]any{ua.Raw},
+				ua.Raw, ua.Browser, ua.BrowserVersion, ua.OS, ua.OSVersion, ua.DeviceBrand, ua.DeviceModel,
+			)
+			if err != nil {
+				return err
+			}
+			userAgentID = id
+		}
+
+		var networkID interface{}
+		if log.Network != nil {
+			n := log.Network
+			id, err := getOrCreateDimID(
+				cache.network, dims.insertNetwork, dims.selectNetwork,
+				networkCacheKey(*n), n.ASN, n.Org, n.Type,
+			)
+			if err != nil {
+				return err
+			}
+			networkID = id
+		}
+
+		var attackID interface{}
+		if log.Attack != nil && log.Attack.Type != "" {
+			a := log.Attack
+			id, err := getOrCreateDimID(
+				cache.attack, dims.insertAttack, dims.selectAttack,
+				attackCacheKey(*a), a.Type, a.RuleID, a.Severity,
+			)
+			if err != nil {
+				return err
+			}
+			attackID = id
+		}
+
+		var reputationID interface{}
+		if log.Reputation != nil && log.Reputation.List != "" {
+			rep := log.Reputation
+			id, err := getOrCreateDimID(
+				cache.reputation, dims.insertReputation, dims.selectReputation,
+				reputationCacheKey(*rep), rep.List, rep.Category,
+			)
+			if err != nil {
+				return err
+			}
+			reputationID = id
+		}
+
+		extra, err := encodeExtraFields(log.Extra)
+		if err != nil {
+			return err
+		}
+
 		_, err = stmtNginx.Exec(
 			ipID, log.PageviewFlag, log.Timestamp.Unix(), log.Method, urlID,
-			log.Status, log.BytesSent, refererID, uaID, locationID,
+			log.Status, log.BytesSent, refererID, uaID, locationID, routeID, campaignID, channelID, userAgentID, networkID, attackID, reputationID, extra,
 		)
 		if err != nil {
 			return err
@@ -1385,6 +1785,7 @@ func (r *Repository) batchInsertLogsForWebsiteOnce(websiteID string, logs []Ngin
 				uaID,
 				locationID,
 				urlID,
+				attribution,
 				ts,
 			); err != nil {
 				return err
@@ -1503,11 +1904,21 @@ func (r *Repository) CleanOldLogs() error {
 			if err := r.cleanupSessions(websiteID, cutoff); err != nil {
 				logrus.WithError(err).Warnf("清理网站 %s 的会话数据失败", websiteID)
 			}
+			if err := r.cleanupSecurityIncidents(websiteID, cutoff); err != nil {
+				logrus.WithError(err).Warnf("清理网站 %s 的安全事件失败", websiteID)
+			}
 		}
 
 		logrus.Infof("删除了 %d 条 %d 天前的日志记录", deletedCount, retentionDays)
 	}
 
+	if err := r.cleanupAlertEvents(cutoff); err != nil {
+		logrus.WithError(err).Warn("清理告警历史失败")
+	}
+	if err := r.cleanupNotificationDeliveries(cutoff); err != nil {
+		logrus.WithError(err).Warn("清理通知外发记录失败")
+	}
+
 	return nil
 }
 
@@ -1532,6 +1943,9 @@ func (r *Repository) ClearLogsForWebsite(websiteID string) error {
 	if err := r.clearSessionAggTablesForWebsite(websiteID); err != nil {
 		return fmt.Errorf("清空网站会话聚合表失败: %w", err)
 	}
+	if err := r.clearSecurityIncidentsForWebsite(websiteID); err != nil {
+		return fmt.Errorf("清空网站安全事件失败: %w", err)
+	}
 	return nil
 }
 
@@ -1558,6 +1972,18 @@ func (r *Repository) createTables() error {
 	if err := r.ensureSystemNotificationTable(); err != nil {
 		return err
 	}
+	if err := r.ensureBlocklistTable(); err != nil {
+		return err
+	}
+	if err := r.ensureAlertTables(); err != nil {
+		return err
+	}
+	if err := r.ensureNotificationDeliveryTable(); err != nil {
+		return err
+	}
+	if err := r.ensureReportTable(); err != nil {
+		return err
+	}
 	for _, id := range config.GetAllWebsiteIDs() {
 		if err := r.ensureWebsiteSchema(id); err != nil {
 			return err
@@ -1573,9 +1999,19 @@ func (r *Repository) ensureIPGeoCacheTable() error {
             domestic TEXT NOT NULL,
             global TEXT NOT NULL,
             source TEXT NOT NULL DEFAULT 'unknown',
+            country_code TEXT NOT NULL DEFAULT '',
+            region_code TEXT NOT NULL DEFAULT '',
+            city TEXT NOT NULL DEFAULT '',
+            latitude DOUBLE PRECISION,
+            longitude DOUBLE PRECISION,
             created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
             updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
         )`,
+		`ALTER TABLE "ip_geo_cache" ADD COLUMN IF NOT EXISTS country_code TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE "ip_geo_cache" ADD COLUMN IF NOT EXISTS region_code TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE "ip_geo_cache" ADD COLUMN IF NOT EXISTS city TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE "ip_geo_cache" ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION`,
+		`ALTER TABLE "ip_geo_cache" ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION`,
 		`CREATE INDEX IF NOT EXISTS idx_ip_geo_cache_created_at ON "ip_geo_cache"(created_at)`,
 	}
 	for _, stmt := range stmts {
@@ -1725,14 +2161,7 @@ func (r *Repository) MarkIPGeoPendingForWebsite(
 
 	cache := newDimCaches()
 	pendingKey := locationCacheKey(pendingLabel, pendingLabel)
-	pendingID, err := getOrCreateDimID(
-		cache.location,
-		dims.insertLocation,
-		dims.selectLocation,
-		pendingKey,
-		pendingLabel,
-		pendingLabel,
-	)
+	pendingID, err := getOrCreateLocationID(cache.location, dims, pendingKey, pendingLabel, pendingLabel, nil)
 	if err != nil {
 		return err
 	}
@@ -1879,14 +2308,7 @@ func (r *Repository) updateIPGeoLocationsForWebsiteOnce(
 
 	cache := newDimCaches()
 	pendingKey := locationCacheKey(pendingLabel, pendingLabel)
-	pendingID, err := getOrCreateDimID(
-		cache.location,
-		dims.insertLocation,
-		dims.selectLocation,
-		pendingKey,
-		pendingLabel,
-		pendingLabel,
-	)
+	pendingID, err := getOrCreateLocationID(cache.location, dims, pendingKey, pendingLabel, pendingLabel, nil)
 	if err != nil {
 		return err
 	}
@@ -1932,14 +2354,7 @@ func (r *Repository) updateIPGeoLocationsForWebsiteOnce(
 			continue
 		}
 		locationKey := locationCacheKey(domestic, global)
-		locationID, err := getOrCreateDimID(
-			cache.location,
-			dims.insertLocation,
-			dims.selectLocation,
-			locationKey,
-			domestic,
-			global,
-		)
+		locationID, err := getOrCreateLocationID(cache.location, dims, locationKey, domestic, global, &entry.Geo)
 		if err != nil {
 			return err
 		}
@@ -1961,24 +2376,45 @@ type sqlExecer interface {
 }
 
 type dimStatements struct {
-	insertIP       *sql.Stmt
-	selectIP       *sql.Stmt
-	insertURL      *sql.Stmt
-	selectURL      *sql.Stmt
-	insertReferer  *sql.Stmt
-	selectReferer  *sql.Stmt
-	insertUA       *sql.Stmt
-	selectUA       *sql.Stmt
-	insertLocation *sql.Stmt
-	selectLocation *sql.Stmt
+	insertIP         *sql.Stmt
+	selectIP         *sql.Stmt
+	insertURL        *sql.Stmt
+	selectURL        *sql.Stmt
+	insertReferer    *sql.Stmt
+	selectReferer    *sql.Stmt
+	insertUA         *sql.Stmt
+	selectUA         *sql.Stmt
+	insertLocation   *sql.Stmt
+	selectLocation   *sql.Stmt
+	insertRoute      *sql.Stmt
+	selectRoute      *sql.Stmt
+	insertCampaign   *sql.Stmt
+	selectCampaign   *sql.Stmt
+	insertChannel    *sql.Stmt
+	selectChannel    *sql.Stmt
+	insertUADetail   *sql.Stmt
+	selectUADetail   *sql.Stmt
+	insertNetwork    *sql.Stmt
+	selectNetwork    *sql.Stmt
+	insertAttack     *sql.Stmt
+	selectAttack     *sql.Stmt
+	insertReputation *sql.Stmt
+	selectReputation *sql.Stmt
 }
 
 type dimCaches struct {
-	ip       map[string]int64
-	url      map[string]int64
-	referer  map[string]int64
-	ua       map[string]int64
-	location map[string]int64
+	ip         map[string]int64
+	url        map[string]int64
+	referer    map[string]int64
+	ua         map[string]int64
+	location   map[string]int64
+	route      map[string]int64
+	campaign   map[string]int64
+	channel    map[string]int64
+	uaDetail   map[string]int64
+	network    map[string]int64
+	attack     map[string]int64
+	reputation map[string]int64
 }
 
 type aggStatements struct {
@@ -2027,6 +2463,12 @@ type pendingSessionUpdate struct {
 	pageCountDelta int64
 }
 
+// sessionAttribution 新建会话时记录的归因维度（入口 PV 的推广活动 / 来源渠道）
+type sessionAttribution struct {
+	campaignID sql.NullInt64
+	channelID  sql.NullInt64
+}
+
 type pendingSessionStateUpsert struct {
 	ipID      int64
 	uaID      int64
@@ -2038,11 +2480,18 @@ const sessionGapSeconds = int64(1800)
 
 func newDimCaches() dimCaches {
 	return dimCaches{
-		ip:       make(map[string]int64),
-		url:      make(map[string]int64),
-		referer:  make(map[string]int64),
-		ua:       make(map[string]int64),
-		location: make(map[string]int64),
+		ip:         make(map[string]int64),
+		url:        make(map[string]int64),
+		referer:    make(map[string]int64),
+		ua:         make(map[string]int64),
+		location:   make(map[string]int64),
+		route:      make(map[string]int64),
+		campaign:   make(map[string]int64),
+		channel:    make(map[string]int64),
+		uaDetail:   make(map[string]int64),
+		network:    make(map[string]int64),
+		attack:     make(map[string]int64),
+		reputation: make(map[string]int64),
 	}
 }
 
@@ -2071,6 +2520,20 @@ func (d *dimStatements) Close() {
 	closeStmt(d.selectUA)
 	closeStmt(d.insertLocation)
 	closeStmt(d.selectLocation)
+	closeStmt(d.insertRoute)
+	closeStmt(d.selectRoute)
+	closeStmt(d.insertCampaign)
+	closeStmt(d.selectCampaign)
+	closeStmt(d.insertChannel)
+	closeStmt(d.selectChannel)
+	closeStmt(d.insertUADetail)
+	closeStmt(d.selectUADetail)
+	closeStmt(d.insertNetwork)
+	closeStmt(d.selectNetwork)
+	closeStmt(d.insertAttack)
+	closeStmt(d.selectAttack)
+	closeStmt(d.insertReputation)
+	closeStmt(d.selectReputation)
 }
 
 func (a *aggStatements) Close() {
@@ -2189,7 +2652,8 @@ func prepareDimStatements(tx *sql.Tx, websiteID string) (*dimStatements, error)
 	}
 
 	insertLocation, err := tx.Prepare(sqlutil.ReplacePlaceholders(fmt.Sprintf(
-		`INSERT INTO "%s" (domestic, global) VALUES (?, ?) ON CONFLICT DO NOTHING`, locationTable,
+		`INSERT INTO "%s" (domestic, global, country_code, region_code, city, latitude, longitude)
+         VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`, locationTable,
 	)))
 	if err != nil {
 		selectUA.Close()
@@ -2218,7 +2682,7 @@ func prepareDimStatements(tx *sql.Tx, websiteID string) (*dimStatements, error)
 		return nil, err
 	}
 
-	return &dimStatements{
+	dims := &dimStatements{
 		insertIP:       insertIP,
 		selectIP:       selectIP,
 		insertURL:      insertURL,
@@ -2229,7 +2693,116 @@ func prepareDimStatements(tx *sql.Tx, websiteID string) (*dimStatements, error)
 		selectUA:       selectUA,
 		insertLocation: insertLocation,
 		selectLocation: selectLocation,
-	}, nil
+	}
+
+	// 后续新增的维表：出错时由 Close 统一释放已创建的语句
+	prepareDim := func(target **sql.Stmt, query string) error {
+		stmt, err := tx.Prepare(sqlutil.ReplacePlaceholders(query))
+		if err != nil {
+			return err
+		}
+		*target = stmt
+		return nil
+	}
+	routeTable := fmt.Sprintf("%s_dim_route", websiteID)
+	if err := prepareDim(&dims.insertRoute, fmt.Sprintf(
+		`INSERT INTO "%s" (route) VALUES (?) ON CONFLICT DO NOTHING`, routeTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	if err := prepareDim(&dims.selectRoute, fmt.Sprintf(
+		`SELECT id FROM "%s" WHERE route = ?`, routeTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	campaignTable := fmt.Sprintf("%s_dim_campaign", websiteID)
+	if err := prepareDim(&dims.insertCampaign, fmt.Sprintf(
+		`INSERT INTO "%s" (source, medium, campaign, term, content, click_id)
+         VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`, campaignTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	if err := prepareDim(&dims.selectCampaign, fmt.Sprintf(
+		`SELECT id FROM "%s"
+         WHERE source = ? AND medium = ? AND campaign = ? AND term = ? AND content = ? AND click_id = ?`,
+		campaignTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	channelTable := fmt.Sprintf("%s_dim_channel", websiteID)
+	if err := prepareDim(&dims.insertChannel, fmt.Sprintf(
+		`INSERT INTO "%s" (channel, source, domain, keyword) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		channelTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	if err := prepareDim(&dims.selectChannel, fmt.Sprintf(
+		`SELECT id FROM "%s" WHERE channel = ? AND source = ? AND domain = ? AND keyword = ?`,
+		channelTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	uaDetailTable := fmt.Sprintf("%s_dim_user_agent", websiteID)
+	if err := prepareDim(&dims.insertUADetail, fmt.Sprintf(
+		`INSERT INTO "%s" (user_agent, browser, browser_version, os, os_version, device_brand, device_model)
+         VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`, uaDetailTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	if err := prepareDim(&dims.selectUADetail, fmt.Sprintf(
+		`SELECT id FROM "%s" WHERE user_agent = ?`, uaDetailTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	networkTable := fmt.Sprintf("%s_dim_network", websiteID)
+	if err := prepareDim(&dims.insertNetwork, fmt.Sprintf(
+		`INSERT INTO "%s" (asn, org, network_type) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`, networkTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	if err := prepareDim(&dims.selectNetwork, fmt.Sprintf(
+		`SELECT id FROM "%s" WHERE asn = ? AND org = ? AND network_type = ?`, networkTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	attackTable := fmt.Sprintf("%s_dim_attack", websiteID)
+	if err := prepareDim(&dims.insertAttack, fmt.Sprintf(
+		`INSERT INTO "%s" (attack_type, rule_id, severity) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`, attackTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	if err := prepareDim(&dims.selectAttack, fmt.Sprintf(
+		`SELECT id FROM "%s" WHERE attack_type = ? AND rule_id = ? AND severity = ?`, attackTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	reputationTable := fmt.Sprintf("%s_dim_reputation", websiteID)
+	if err := prepareDim(&dims.insertReputation, fmt.Sprintf(
+		`INSERT INTO "%s" (list_name, category) VALUES (?, ?) ON CONFLICT DO NOTHING`, reputationTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+	if err := prepareDim(&dims.selectReputation, fmt.Sprintf(
+		`SELECT id FROM "%s" WHERE list_name = ? AND category = ?`, reputationTable,
+	)); err != nil {
+		dims.Close()
+		return nil, err
+	}
+
+	return dims, nil
 }
 
 func prepareAggStatements(tx *sql.Tx, websiteID string) (*aggStatements, error) {
@@ -2337,8 +2910,8 @@ func prepareSessionStatements(tx *sql.Tx, websiteID string) (*sessionStatements,
 	}
 
 	insertSession, err := tx.Prepare(sqlutil.ReplacePlaceholders(fmt.Sprintf(
-		`INSERT INTO "%s" (ip_id, ua_id, location_id, start_ts, end_ts, entry_url_id, exit_url_id, page_count)
-         VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`INSERT INTO "%s" (ip_id, ua_id, location_id, start_ts, end_ts, entry_url_id, exit_url_id, page_count, campaign_id, channel_id)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
          RETURNING id`, sessionTable,
 	)))
 	if err != nil {
@@ -2728,6 +3301,59 @@ func getOrCreateDimID(
 	return id, nil
 }
 
+// getOrCreateDimIDByLookup 与 getOrCreateDimID 相同，但查询 ID 时只使用唯一键参数
+func getOrCreateDimIDByLookup(
+	cache map[string]int64,
+	insertStmt *sql.Stmt,
+	selectStmt *sql.Stmt,
+	cacheKey string,
+	lookupArgs []any,
+	insertArgs ...any,
+) (int64, error) {
+	if id, ok := cache[cacheKey]; ok {
+		return id, nil
+	}
+	if _, err := insertStmt.Exec(insertArgs...); err != nil {
+		return 0, err
+	}
+	var id int64
+	if err := selectStmt.QueryRow(lookupArgs...).Scan(&id); err != nil {
+		return 0, err
+	}
+	cache[cacheKey] = id
+	return id, nil
+}
+
+// getOrCreateLocationID 写入地理位置维度，geo 为空或缺少国家代码时代码列留空（NULL），由 BackfillLocationCodes 补齐；
+// 维度已存在时不覆盖
+func getOrCreateLocationID(
+	cache map[string]int64,
+	dims *dimStatements,
+	cacheKey string,
+	domestic string,
+	global string,
+	geo *GeoInfo,
+) (int64, error) {
+	var countryCode, regionCode, city, latitude, longitude interface{}
+	if geo != nil && geo.CountryCode != "" {
+		countryCode, regionCode, city = geo.CountryCode, geo.RegionCode, geo.City
+		latitude, longitude = geo.coordinates()
+	}
+	return getOrCreateDimIDByLookup(
+		cache, dims.insertLocation, dims.selectLocation, cacheKey,
+		[]any{domestic, global},
+		domestic, global, countryCode, regionCode, city, latitude, longitude,
+	)
+}
+
+// coordinates 经纬度均为 0 时写入 NULL
+func (g GeoInfo) coordinates() (interface{}, interface{}) {
+	if g.Latitude == 0 && g.Longitude == 0 {
+		return nil, nil
+	}
+	return g.Latitude, g.Longitude
+}
+
 func uaCacheKey(browser, osName, device string) string {
 	return browser + "\x1f" + osName + "\x1f" + device
 }
@@ -2736,6 +3362,26 @@ func locationCacheKey(domestic, global string) string {
 	return domestic + "\x1f" + global
 }
 
+func channelCacheKey(c ChannelInfo) string {
+	return strings.Join([]string{c.Channel, c.Source, c.Domain, c.Keyword}, "\x1f")
+}
+
+func networkCacheKey(n NetworkInfo) string {
+	return strconv.FormatInt(n.ASN, 10) + "\x1f" + n.Org + "\x1f" + n.Type
+}
+
+func attackCacheKey(a AttackInfo) string {
+	return a.Type + "\x1f" + a.RuleID + "\x1f" + a.Severity
+}
+
+func reputationCacheKey(r ReputationInfo) string {
+	return r.List + "\x1f" + r.Category
+}
+
+func campaignCacheKey(c CampaignInfo) string {
+	return strings.Join([]string{c.Source, c.Medium, c.Name, c.Term, c.Content, c.ClickID}, "\x1f")
+}
+
 func fetchIPIDs(tx *sql.Tx, websiteID string, ips []string) (map[string]int64, error) {
 	results := make(map[string]int64)
 	if len(ips) == 0 {
@@ -2856,6 +3502,7 @@ func updateSessionFromLog(
 	uaID,
 	locationID,
 	urlID int64,
+	attribution sessionAttribution,
 	timestamp int64,
 ) error {
 	if stmts == nil {
@@ -2897,6 +3544,8 @@ func updateSessionFromLog(
 			urlID,
 			urlID,
 			1,
+			attribution.campaignID,
+			attribution.channelID,
 		).Scan(&sessionID); err != nil {
 			return err
 		}
@@ -2952,6 +3601,125 @@ func dayBucket(ts time.Time) string {
 	return ts.In(time.Local).Format("2006-01-02")
 }
 
+const routeRebuildBatchSize = 1000
+
+// RebuildRoutes 按 normalize 重新计算已有日志的 route_id（URL 归一化规则变更后使用），返回更新的日志条数。
+// 按 URL 分批更新、每批单独提交，不长时间持有锁，可与实时入库并行执行；
+// 清理无引用路由时只处理重建开始前已存在的路由，避免误删入库事务刚创建、尚未提交引用的路由。
+func (r *Repository) RebuildRoutes(websiteID string, normalize func(string) string) (int64, error) {
+	logTable := fmt.Sprintf("%s_nginx_logs", websiteID)
+	urlTable := fmt.Sprintf("%s_dim_url", websiteID)
+	routeTable := fmt.Sprintf("%s_dim_route", websiteID)
+
+	exists, err := r.tableExists(logTable)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("站点 %s 的日志表不存在", websiteID)
+	}
+	if err := r.ensureWebsiteSchema(websiteID); err != nil {
+		return 0, err
+	}
+
+	var maxRouteID int64
+	if err := r.db.QueryRow(fmt.Sprintf(
+		`SELECT COALESCE(MAX(id), 0) FROM "%s"`, routeTable,
+	)).Scan(&maxRouteID); err != nil {
+		return 0, err
+	}
+
+	insertRoute, err := r.db.Prepare(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`INSERT INTO "%s" (route) VALUES (?) ON CONFLICT DO NOTHING`, routeTable,
+	)))
+	if err != nil {
+		return 0, err
+	}
+	defer insertRoute.Close()
+	selectRoute, err := r.db.Prepare(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT id FROM "%s" WHERE route = ?`, routeTable,
+	)))
+	if err != nil {
+		return 0, err
+	}
+	defer selectRoute.Close()
+
+	type urlRow struct {
+		id  int64
+		url string
+	}
+	routeCache := make(map[string]int64)
+	var (
+		updated int64
+		lastID  int64
+	)
+	for {
+		batch := make([]urlRow, 0, routeRebuildBatchSize)
+		rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+			`SELECT id, url FROM "%s" WHERE id > ? ORDER BY id LIMIT ?`, urlTable,
+		)), lastID, routeRebuildBatchSize)
+		if err != nil {
+			return updated, err
+		}
+		for rows.Next() {
+			var row urlRow
+			if err := rows.Scan(&row.id, &row.url); err != nil {
+				rows.Close()
+				return updated, err
+			}
+			batch = append(batch, row)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return updated, err
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			break
+		}
+		lastID = batch[len(batch)-1].id
+
+		placeholders := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, len(batch)*2)
+		for _, row := range batch {
+			route := sanitizeAndTruncate(normalize(row.url), maxURLBytes)
+			if route == "" {
+				continue
+			}
+			routeID, err := getOrCreateDimID(routeCache, insertRoute, selectRoute, route, route)
+			if err != nil {
+				return updated, err
+			}
+			placeholders = append(placeholders, "(?::BIGINT, ?::BIGINT)")
+			args = append(args, row.id, routeID)
+		}
+		if len(placeholders) == 0 {
+			continue
+		}
+		result, err := r.db.Exec(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+			`UPDATE "%s" l SET route_id = m.route_id
+             FROM (VALUES %s) AS m(url_id, route_id)
+             WHERE l.url_id = m.url_id AND l.route_id IS DISTINCT FROM m.route_id`,
+			logTable, strings.Join(placeholders, ", "),
+		)), args...)
+		if err != nil {
+			return updated, err
+		}
+		affected, _ := result.RowsAffected()
+		updated += affected
+	}
+
+	if _, err := r.db.Exec(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`DELETE FROM "%s" r
+         WHERE r.id <= ?
+           AND NOT EXISTS (SELECT 1 FROM "%s" l WHERE l.route_id = r.id)`,
+		routeTable, logTable,
+	)), maxRouteID); err != nil {
+		return updated, err
+	}
+	return updated, nil
+}
+
 func (r *Repository) cleanupOrphanDims(websiteID string) error {
 	logTable := fmt.Sprintf("%s_nginx_logs", websiteID)
 	hasIPID, err := r.tableHasColumn(logTable, "ip_id")
@@ -2969,6 +3737,13 @@ func (r *Repository) cleanupOrphanDims(websiteID string) error {
 		{table: fmt.Sprintf("%s_dim_referer", websiteID), column: "referer_id"},
 		{table: fmt.Sprintf("%s_dim_ua", websiteID), column: "ua_id"},
 		{table: fmt.Sprintf("%s_dim_location", websiteID), column: "location_id"},
+		{table: fmt.Sprintf("%s_dim_route", websiteID), column: "route_id"},
+		{table: fmt.Sprintf("%s_dim_campaign", websiteID), column: "campaign_id"},
+		{table: fmt.Sprintf("%s_dim_channel", websiteID), column: "channel_id"},
+		{table: fmt.Sprintf("%s_dim_user_agent", websiteID), column: "user_agent_id"},
+		{table: fmt.Sprintf("%s_dim_network", websiteID), column: "network_id"},
+		{table: fmt.Sprintf("%s_dim_attack", websiteID), column: "attack_id"},
+		{table: fmt.Sprintf("%s_dim_reputation", websiteID), column: "reputation_id"},
 	}
 
 	for _, dim := range dims {
@@ -2980,8 +3755,8 @@ func (r *Repository) cleanupOrphanDims(websiteID string) error {
 			continue
 		}
 		if _, err := r.db.Exec(fmt.Sprintf(
-			`DELETE FROM "%s" WHERE id NOT IN (SELECT %s FROM "%s")`,
-			dim.table, dim.column, logTable,
+			`DELETE FROM "%s" WHERE id NOT IN (SELECT %s FROM "%s" WHERE %s IS NOT NULL)`,
+			dim.table, dim.column, logTable, dim.column,
 		)); err != nil {
 			return err
 		}
@@ -2996,6 +3771,13 @@ func (r *Repository) clearDimTablesForWebsite(websiteID string) error {
 		fmt.Sprintf("%s_dim_referer", websiteID),
 		fmt.Sprintf("%s_dim_ua", websiteID),
 		fmt.Sprintf("%s_dim_location", websiteID),
+		fmt.Sprintf("%s_dim_route", websiteID),
+		fmt.Sprintf("%s_dim_campaign", websiteID),
+		fmt.Sprintf("%s_dim_channel", websiteID),
+		fmt.Sprintf("%s_dim_user_agent", websiteID),
+		fmt.Sprintf("%s_dim_network", websiteID),
+		fmt.Sprintf("%s_dim_attack", websiteID),
+		fmt.Sprintf("%s_dim_reputation", websiteID),
 	}
 	for _, table := range dimTables {
 		exists, err := r.tableExists(table)
@@ -3096,6 +3878,9 @@ func (r *Repository) ensureWebsiteSchema(websiteID string) error {
 		if err := createSessionAggTables(r.db, websiteID); err != nil {
 			return err
 		}
+		if err := createSecurityIncidentTable(r.db, websiteID); err != nil {
+			return err
+		}
 		if err := r.backfillAggregatesIfEmpty(websiteID); err != nil {
 			return err
 		}
@@ -3120,6 +3905,9 @@ func (r *Repository) ensureWebsiteSchema(websiteID string) error {
 	if err := createDimTables(r.db, websiteID); err != nil {
 		return err
 	}
+	if err := ensureLogColumns(r.db, logTable); err != nil {
+		return err
+	}
 	if err := createLogIndexes(r.db, websiteID); err != nil {
 		return err
 	}
@@ -3135,6 +3923,9 @@ func (r *Repository) ensureWebsiteSchema(websiteID string) error {
 	if err := createSessionAggTables(r.db, websiteID); err != nil {
 		return err
 	}
+	if err := createSecurityIncidentTable(r.db, websiteID); err != nil {
+		return err
+	}
 	if err := r.backfillAggregatesIfEmpty(websiteID); err != nil {
 		return err
 	}
@@ -3184,6 +3975,9 @@ func (r *Repository) migrateLegacyLogs(websiteID string) error {
 	if err := createSessionAggTables(tx, websiteID); err != nil {
 		return err
 	}
+	if err := createSecurityIncidentTable(tx, websiteID); err != nil {
+		return err
+	}
 
 	if _, err = tx.Exec(fmt.Sprintf(
 		`INSERT INTO "%s_dim_ip"(ip) SELECT DISTINCT ip FROM "%s" ON CONFLICT DO NOTHING`,
@@ -3364,9 +4158,86 @@ func createDimTables(execer sqlExecer, websiteID string) error {
                 id BIGSERIAL PRIMARY KEY,
                 domestic TEXT NOT NULL,
                 global TEXT NOT NULL,
+                country_code TEXT,
+                region_code TEXT,
+                city TEXT,
+                latitude DOUBLE PRECISION,
+                longitude DOUBLE PRECISION,
                 UNIQUE(domestic, global)
             )`, websiteID,
 		),
+		// 结构化归属地，country_code 为 NULL 表示待由 BackfillLocationCodes 回填
+		fmt.Sprintf(`ALTER TABLE "%s_dim_location" ADD COLUMN IF NOT EXISTS country_code TEXT`, websiteID),
+		fmt.Sprintf(`ALTER TABLE "%s_dim_location" ADD COLUMN IF NOT EXISTS region_code TEXT`, websiteID),
+		fmt.Sprintf(`ALTER TABLE "%s_dim_location" ADD COLUMN IF NOT EXISTS city TEXT`, websiteID),
+		fmt.Sprintf(`ALTER TABLE "%s_dim_location" ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION`, websiteID),
+		fmt.Sprintf(`ALTER TABLE "%s_dim_location" ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION`, websiteID),
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS "%s_dim_route" (
+                id BIGSERIAL PRIMARY KEY,
+                route TEXT NOT NULL UNIQUE
+            )`, websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS "%s_dim_campaign" (
+                id BIGSERIAL PRIMARY KEY,
+                source TEXT NOT NULL,
+                medium TEXT NOT NULL,
+                campaign TEXT NOT NULL,
+                term TEXT NOT NULL,
+                content TEXT NOT NULL,
+                click_id TEXT NOT NULL,
+                UNIQUE(source, medium, campaign, term, content, click_id)
+            )`, websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS "%s_dim_channel" (
+                id BIGSERIAL PRIMARY KEY,
+                channel TEXT NOT NULL,
+                source TEXT NOT NULL,
+                domain TEXT NOT NULL,
+                keyword TEXT NOT NULL,
+                UNIQUE(channel, source, domain, keyword)
+            )`, websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS "%s_dim_user_agent" (
+                id BIGSERIAL PRIMARY KEY,
+                user_agent TEXT NOT NULL UNIQUE,
+                browser TEXT NOT NULL,
+                browser_version TEXT NOT NULL,
+                os TEXT NOT NULL,
+                os_version TEXT NOT NULL,
+                device_brand TEXT NOT NULL,
+                device_model TEXT NOT NULL
+            )`, websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS "%s_dim_network" (
+                id BIGSERIAL PRIMARY KEY,
+                asn BIGINT NOT NULL,
+                org TEXT NOT NULL,
+                network_type TEXT NOT NULL,
+                UNIQUE(asn, org, network_type)
+            )`, websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS "%s_dim_attack" (
+                id BIGSERIAL PRIMARY KEY,
+                attack_type TEXT NOT NULL,
+                rule_id TEXT NOT NULL,
+                severity TEXT NOT NULL,
+                UNIQUE(attack_type, rule_id, severity)
+            )`, websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS "%s_dim_reputation" (
+                id BIGSERIAL PRIMARY KEY,
+                list_name TEXT NOT NULL,
+                category TEXT NOT NULL,
+                UNIQUE(list_name, category)
+            )`, websiteID,
+		),
 	}
 
 	for _, stmt := range stmts {
@@ -3391,6 +4262,14 @@ func createLogTable(execer sqlExecer, tableName string) error {
             referer_id BIGINT NOT NULL,
             ua_id BIGINT NOT NULL,
             location_id BIGINT NOT NULL,
+            route_id BIGINT,
+            campaign_id BIGINT,
+            channel_id BIGINT,
+            user_agent_id BIGINT,
+            network_id BIGINT,
+            attack_id BIGINT,
+            reputation_id BIGINT,
+            extra JSONB,
             PRIMARY KEY (id, timestamp)
         ) PARTITION BY RANGE (timestamp)`, tableName,
 	)
@@ -3406,6 +4285,26 @@ func createLogTable(execer sqlExecer, tableName string) error {
 	return err
 }
 
+// ensureLogColumns 为已有日志表补齐后续版本新增的列
+func ensureLogColumns(execer sqlExecer, tableName string) error {
+	stmts := []string{
+		fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS extra JSONB`, tableName),
+		fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS route_id BIGINT`, tableName),
+		fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS campaign_id BIGINT`, tableName),
+		fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS channel_id BIGINT`, tableName),
+		fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS user_agent_id BIGINT`, tableName),
+		fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS network_id BIGINT`, tableName),
+		fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS attack_id BIGINT`, tableName),
+		fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN IF NOT EXISTS reputation_id BIGINT`, tableName),
+	}
+	for _, stmt := range stmts {
+		if _, err := execer.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func createLogIndexes(execer sqlExecer, websiteID string) error {
 	tableName := fmt.Sprintf("%s_nginx_logs", websiteID)
 	stmts := []string{
@@ -3421,6 +4320,18 @@ func createLogIndexes(execer sqlExecer, websiteID string) error {
 			`CREATE INDEX IF NOT EXISTS idx_%s_session_key ON "%s"(ip_id, ua_id, timestamp) WHERE pageview_flag = 1`,
 			websiteID, tableName,
 		),
+		fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS idx_%s_extra ON "%s" USING GIN (extra jsonb_path_ops) WHERE extra IS NOT NULL`,
+			websiteID, tableName,
+		),
+		fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS idx_%s_attack_ts ON "%s"(timestamp, attack_id) WHERE attack_id IS NOT NULL`,
+			websiteID, tableName,
+		),
+		fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS idx_%s_reputation_ts ON "%s"(timestamp, reputation_id) WHERE reputation_id IS NOT NULL`,
+			websiteID, tableName,
+		),
 	}
 	for _, stmt := range stmts {
 		if _, err := execer.Exec(stmt); err != nil {
@@ -3503,9 +4414,24 @@ func createSessionTables(execer sqlExecer, websiteID string) error {
                 end_ts BIGINT NOT NULL,
                 entry_url_id BIGINT NOT NULL,
                 exit_url_id BIGINT NOT NULL,
-                page_count INT NOT NULL DEFAULT 1
+                page_count INT NOT NULL DEFAULT 1,
+                campaign_id BIGINT,
+                channel_id BIGINT
             )`, websiteID,
 		),
+		// 会话按入口 PV 归因到推广活动与来源渠道
+		fmt.Sprintf(
+			`ALTER TABLE "%s_sessions" ADD COLUMN IF NOT EXISTS campaign_id BIGINT`,
+			websiteID,
+		),
+		fmt.Sprintf(
+			`ALTER TABLE "%s_sessions" ADD COLUMN IF NOT EXISTS channel_id BIGINT`,
+			websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS idx_%s_sessions_campaign ON "%s_sessions"(campaign_id, start_ts) WHERE campaign_id IS NOT NULL`,
+			websiteID, websiteID,
+		),
 		fmt.Sprintf(
 			`CREATE INDEX IF NOT EXISTS idx_%s_sessions_start ON "%s_sessions"(start_ts)`,
 			websiteID, websiteID,
@@ -3809,7 +4735,7 @@ func (r *Repository) backfillSessions(websiteID string) error {
 
 	if _, err = tx.Exec(fmt.Sprintf(
 		`WITH ordered AS (
-            SELECT id, ip_id, ua_id, location_id, url_id, timestamp,
+            SELECT id, ip_id, ua_id, location_id, url_id, campaign_id, channel_id, timestamp,
                    CASE
                        WHEN LAG(timestamp) OVER (
                            PARTITION BY ip_id, ua_id ORDER BY timestamp, id
@@ -3840,7 +4766,7 @@ func (r *Repository) backfillSessions(websiteID string) error {
                    ) AS rn_desc
             FROM sessions
         )
-        INSERT INTO "%s" (ip_id, ua_id, location_id, start_ts, end_ts, entry_url_id, exit_url_id, page_count)
+        INSERT INTO "%s" (ip_id, ua_id, location_id, start_ts, end_ts, entry_url_id, exit_url_id, page_count, campaign_id, channel_id)
         SELECT
             ip_id,
             ua_id,
@@ -3849,7 +4775,9 @@ func (r *Repository) backfillSessions(websiteID string) error {
             MAX(timestamp) AS end_ts,
             MAX(CASE WHEN rn_asc = 1 THEN url_id END) AS entry_url_id,
             MAX(CASE WHEN rn_desc = 1 THEN url_id END) AS exit_url_id,
-            COUNT(*) AS page_count
+            COUNT(*) AS page_count,
+            MAX(CASE WHEN rn_asc = 1 THEN campaign_id END) AS campaign_id,
+            MAX(CASE WHEN rn_asc = 1 THEN channel_id END) AS channel_id
         FROM ranked
         GROUP BY ip_id, ua_id, session_no`,
 		sessionGapSeconds, logTable, sessionTable,
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/sqlutil"
+)
+
+// SecurityIncident 暴力破解 / 撞库事件：同一 IP 或网段在滑动窗口内超过阈值后开始，
+// 之后持续命中（间隔不超过窗口）都计入同一事件
+type SecurityIncident struct {
+	ID int64 `json:"id"`
+	// Kind 为 login（登录接口 POST）或 auth_failure（401/403/429）
+	Kind string `json:"kind"`
+	// Scope 为 ip 或 subnet，Subject 为对应的 IP / CIDR
+	Scope        string         `json:"scope"`
+	Subject      string         `json:"subject"`
+	FirstTs      int64          `json:"first_ts"`
+	LastTs       int64          `json:"last_ts"`
+	Requests     int64          `json:"requests"`
+	IPCount      int            `json:"ip_count"`
+	SampleURL    string         `json:"sample_url"`
+	StatusCounts map[string]int `json:"status_counts,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+// SecurityIncidentFilter 事件查询条件，零值表示不限
+type SecurityIncidentFilter struct {
+	Kind    string
+	Scope   string
+	Subject string
+	StartTs int64
+	EndTs   int64
+}
+
+func createSecurityIncidentTable(execer sqlExecer, websiteID string) error {
+	stmts := []string{
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS "%s_security_incidents" (
+                id BIGSERIAL PRIMARY KEY,
+                kind TEXT NOT NULL,
+                scope TEXT NOT NULL,
+                subject TEXT NOT NULL,
+                first_ts BIGINT NOT NULL,
+                last_ts BIGINT NOT NULL,
+                requests BIGINT NOT NULL DEFAULT 0,
+                ip_count INT NOT NULL DEFAULT 1,
+                sample_url TEXT NOT NULL DEFAULT '',
+                status_counts JSONB,
+                created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+                updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+            )`, websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS idx_%s_security_incidents_last_ts ON "%s_security_incidents"(last_ts)`,
+			websiteID, websiteID,
+		),
+		fmt.Sprintf(
+			`CREATE INDEX IF NOT EXISTS idx_%s_security_incidents_subject ON "%s_security_incidents"(subject, last_ts)`,
+			websiteID, websiteID,
+		),
+	}
+	for _, stmt := range stmts {
+		if _, err := execer.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSecurityIncident 新事件（ID 为 0）插入并回填 ID，已有事件更新计数与时间范围
+func (r *Repository) SaveSecurityIncident(websiteID string, incident *SecurityIncident) error {
+	table := fmt.Sprintf("%s_security_incidents", websiteID)
+	var statusJSON []byte
+	if len(incident.StatusCounts) > 0 {
+		if encoded, err := json.Marshal(incident.StatusCounts); err == nil {
+			statusJSON = encoded
+		}
+	}
+	sampleURL := sanitizeAndTruncate(incident.SampleURL, maxURLBytes)
+
+	if incident.ID == 0 {
+		return r.db.QueryRow(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+			`INSERT INTO "%s" (kind, scope, subject, first_ts, last_ts, requests, ip_count, sample_url, status_counts)
+             VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+             RETURNING id`, table,
+		)),
+			incident.Kind, incident.Scope, incident.Subject, incident.FirstTs, incident.LastTs,
+			incident.Requests, incident.IPCount, sampleURL, statusJSON,
+		).Scan(&incident.ID)
+	}
+	_, err := r.db.Exec(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`UPDATE "%s" SET
+             first_ts = LEAST(first_ts, ?),
+             last_ts = GREATEST(last_ts, ?),
+             requests = ?,
+             ip_count = ?,
+             status_counts = COALESCE(?, status_counts),
+             updated_at = NOW()
+         WHERE id = ?`, table,
+	)),
+		incident.FirstTs, incident.LastTs, incident.Requests, incident.IPCount, statusJSON, incident.ID,
+	)
+	return err
+}
+
+// ListSecurityIncidents 按最近命中时间倒序分页查询事件
+func (r *Repository) ListSecurityIncidents(
+	websiteID string, filter SecurityIncidentFilter, page, pageSize int,
+) ([]SecurityIncident, bool, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 200 {
+		pageSize = 200
+	}
+	table := fmt.Sprintf("%s_security_incidents", websiteID)
+	exists, err := r.tableExists(table)
+	if err != nil || !exists {
+		return []SecurityIncident{}, false, err
+	}
+
+	conditions := make([]string, 0, 5)
+	args := make([]interface{}, 0, 7)
+	if filter.Kind != "" {
+		conditions = append(conditions, "kind = ?")
+		args = append(args, filter.Kind)
+	}
+	if filter.Scope != "" {
+		conditions = append(conditions, "scope = ?")
+		args = append(args, filter.Scope)
+	}
+	if filter.Subject != "" {
+		conditions = append(conditions, "subject LIKE ?")
+		args = append(args, "%"+filter.Subject+"%")
+	}
+	if filter.StartTs > 0 {
+		conditions = append(conditions, "last_ts >= ?")
+		args = append(args, filter.StartTs)
+	}
+	if filter.EndTs > 0 {
+		conditions = append(conditions, "first_ts < ?")
+		args = append(args, filter.EndTs)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, pageSize+1, (page-1)*pageSize)
+
+	rows, err := r.db.Query(sqlutil.ReplacePlaceholders(fmt.Sprintf(
+		`SELECT id, kind, scope, subject, first_ts, last_ts, requests, ip_count, sample_url,
+                status_counts, created_at, updated_at
+         FROM "%s"
+         %s
+         ORDER BY last_ts DESC, id DESC
+         LIMIT ? OFFSET ?`, table, where,
+	)), args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	incidents := make([]SecurityIncident, 0, pageSize)
+	hasMore := false
+	for rows.Next() {
+		var incident SecurityIncident
+		var statusBytes []byte
+		if err := rows.Scan(
+			&incident.ID, &incident.Kind, &incident.Scope, &incident.Subject,
+			&incident.FirstTs, &incident.LastTs, &incident.Requests, &incident.IPCount, &incident.SampleURL,
+			&statusBytes, &incident.CreatedAt, &incident.UpdatedAt,
+		); err != nil {
+			return nil, false, err
+		}
+		if len(statusBytes) > 0 {
+			_ = json.Unmarshal(statusBytes, &incident.StatusCounts)
+		}
+		if len(incidents) < pageSize {
+			incidents = append(incidents, incident)
+		} else {
+			hasMore = true
+		}
+	}
+	return incidents, hasMore, rows.Err()
+}
+
+func (r *Repository) clearSecurityIncidentsForWebsite(websiteID string) error {
+	table := fmt.Sprintf("%s_security_incidents", websiteID)
+	exists, err := r.tableExists(table)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = r.db.Exec(fmt.Sprintf(`DELETE FROM "%s"`, table))
+	return err
+}
+
+func (r *Repository) cleanupSecurityIncidents(websiteID string, cutoff time.Time) error {
+	table := fmt.Sprintf("%s_security_incidents", websiteID)
+	exists, err := r.tableExists(table)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = r.db.Exec(
+		sqlutil.ReplacePlaceholders(fmt.Sprintf(`DELETE FROM "%s" WHERE last_ts < ?`, table)),
+		cutoff.Unix(),
+	)
+	return err
+}
@@ -25,6 +25,10 @@ func TimePeriod(timeRange string) (time.Time, time.Time, error) {
 		endTime = setTime(now.AddDate(0, 0, -1), 23, 59, 59)
 	case "week":
 		startTime, endTime = weekBounds(now)
+	case "lastweek":
+		// 上一个自然周（周一至周日）
+		startTime, endTime = weekBounds(now.AddDate(0, 0, -7))
+		endTime = setTime(endTime, 23, 59, 59)
 	case "last7days":
 		startTime = setTime(now.AddDate(0, 0, -6), 0, 0, 0)
 	case "month":
@@ -78,6 +82,8 @@ func TimePointsAndLabels(
 	switch timeRangeType {
 	case "week":
 		startDay, endDay = weekBounds(now)
+	case "lastweek":
+		startDay, endDay = weekBounds(now.AddDate(0, 0, -7))
 	case "last7days":
 		startDay = setTime(now.AddDate(0, 0, -6), 0, 0, 0)
 		endDay = setTime(now, 23, 0, 0)
@@ -89,7 +95,8 @@ func TimePointsAndLabels(
 	}
 
 	includeWeekday := (viewType == "daily" && timeRangeType == "last7days") ||
-		(viewType == "daily" && timeRangeType == "week")
+		(viewType == "daily" && timeRangeType == "week") ||
+		(viewType == "daily" && timeRangeType == "lastweek")
 	hourly := viewType == "hourly"
 
 	for day := startDay; !day.After(endDay); day = day.AddDate(0, 0, 1) {
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/ingest"
+	"github.com/sirupsen/logrus"
+)
+
+// 默认日志路径的检测结果缓存时长，过期后下次查询时在后台重新检测
+const defaultFormatDetectTTL = 5 * time.Minute
+
+const (
+	defaultDetectStatusNone    = "none"
+	defaultDetectStatusPending = "pending"
+	defaultDetectStatusReady   = "ready"
+	defaultDetectStatusFailed  = "failed"
+)
+
+// defaultFormatDetectState 初始化模式下对 SuggestDefaultLogPath 的格式检测结果
+type defaultFormatDetectState struct {
+	Status  string                     `json:"status"`
+	LogPath string                     `json:"log_path"`
+	Result  *ingest.LogFormatDetection `json:"result,omitempty"`
+	Error   string                     `json:"error,omitempty"`
+}
+
+// defaultFormatDetector 按日志路径缓存检测结果，检测在后台执行，查询不等待检测完成
+type defaultFormatDetector struct {
+	mu         sync.Mutex
+	state      defaultFormatDetectState
+	finishedAt time.Time
+}
+
+var defaultFormatDetection = &defaultFormatDetector{}
+
+// Lookup 返回 logPath 的检测状态；尚无结果、路径变化或结果过期时在后台启动检测
+func (d *defaultFormatDetector) Lookup(logPath string) defaultFormatDetectState {
+	if logPath == "" {
+		return defaultFormatDetectState{Status: defaultDetectStatusNone}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state.LogPath == logPath {
+		if d.state.Status == defaultDetectStatusPending ||
+			time.Since(d.finishedAt) < defaultFormatDetectTTL {
+			return d.state
+		}
+	}
+	d.state = defaultFormatDetectState{Status: defaultDetectStatusPending, LogPath: logPath}
+	go d.detect(logPath)
+	return d.state
+}
+
+func (d *defaultFormatDetector) detect(logPath string) {
+	ctx, cancel := context.WithTimeout(context.Background(), formatDetectTimeout)
+	defer cancel()
+	result, err := ingest.DetectLogFormatFromPath(ctx, logPath)
+
+	state := defaultFormatDetectState{Status: defaultDetectStatusReady, LogPath: logPath, Result: &result}
+	if err != nil {
+		logrus.WithError(err).Debug("检测默认日志格式失败")
+		state = defaultFormatDetectState{Status: defaultDetectStatusFailed, LogPath: logPath, Error: err.Error()}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// 检测期间默认路径已变化时丢弃旧结果
+	if d.state.LogPath != logPath {
+		return
+	}
+	d.state = state
+	d.finishedAt = time.Now()
+}
+
+// lookupSetupFormatDetection 仅在初始化模式下检测建议的默认日志路径
+func lookupSetupFormatDetection() defaultFormatDetectState {
+	if !config.IsSetupMode() {
+		return defaultFormatDetectState{Status: defaultDetectStatusNone}
+	}
+	return defaultFormatDetection.Lookup(config.SuggestDefaultLogPath())
+}
@@ -1,9 +1,12 @@
 package web
 
 import (
+	"context"
+	"database/sql"
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -17,10 +20,17 @@ import (
 	"github.com/likaia/nginxpulse/internal/config"
 	"github.com/likaia/nginxpulse/internal/enrich"
 	"github.com/likaia/nginxpulse/internal/ingest"
+	"github.com/likaia/nginxpulse/internal/notify"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/likaia/nginxpulse/internal/timeutil"
 	"github.com/likaia/nginxpulse/internal/version"
+	"github.com/likaia/nginxpulse/internal/worker"
 	"github.com/sirupsen/logrus"
 )
 
+// 日志格式检测的采样超时
+const formatDetectTimeout = 15 * time.Second
+
 // 初始化Web路由
 func SetupRoutes(
 	router *gin.Engine,
@@ -62,6 +72,7 @@ func SetupRoutes(
 			"log_parsing_progress":                    ingest.GetIPParsingProgress(),
 			"log_parsing_estimated_total_seconds":     ingest.GetIPParsingEstimatedTotalSeconds(),
 			"log_parsing_estimated_remaining_seconds": ingest.GetIPParsingEstimatedRemainingSeconds(),
+			"log_parsing_throughput":                  ingest.GetIPParsingThroughput(),
 			"ip_geo_parsing":                          ingest.IsIPGeoParsing(),
 			"ip_geo_pending":                          ipGeoPendingCount > 0,
 			"ip_geo_progress":                         ingest.GetIPGeoParsingProgress(ipGeoPendingCount),
@@ -158,15 +169,22 @@ func SetupRoutes(
 			})
 			return
 		}
-		defaultLogPath := ""
-		if config.IsSetupMode() {
-			defaultLogPath = config.SuggestDefaultLogPath()
+		// 默认日志路径的格式检测在后台执行，这里只带上已完成的结果，不阻塞配置加载
+		detection := lookupSetupFormatDetection()
+		var defaultParse *config.ParseConfig
+		defaultParseConfidence := 0.0
+		if detection.Result != nil {
+			defaultParse = detection.Result.Suggested
+			defaultParseConfidence = detection.Result.Confidence
 		}
 		c.JSON(http.StatusOK, gin.H{
-			"config":           cfg,
-			"readonly":         config.ConfigReadOnly(),
-			"setup_required":   config.IsSetupMode(),
-			"default_log_path": defaultLogPath,
+			"config":                   cfg,
+			"readonly":                 config.ConfigReadOnly(),
+			"setup_required":           config.IsSetupMode(),
+			"default_log_path":         detection.LogPath,
+			"default_parse":            defaultParse,
+			"default_parse_confidence": defaultParseConfidence,
+			"default_parse_status":     detection.Status,
 		})
 	})
 
@@ -184,6 +202,116 @@ func SetupRoutes(
 		c.JSON(http.StatusOK, result)
 	})
 
+	router.POST("/api/parse/test", func(c *gin.Context) {
+		type parseTestRequest struct {
+			WebsiteID string              `json:"website_id"`
+			SourceID  string              `json:"source_id"`
+			Parse     *config.ParseConfig `json:"parse"`
+			Lines     []string            `json:"lines"`
+		}
+
+		var req parseTestRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		if len(req.Lines) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "日志内容为空",
+			})
+			return
+		}
+		if len(req.Lines) > ingest.MaxParsePreviewLines {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("样例日志最多 %d 行", ingest.MaxParsePreviewLines),
+			})
+			return
+		}
+
+		result, err := ingest.PreviewParseLines(req.WebsiteID, req.SourceID, req.Parse, req.Lines)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// 初始化模式下默认日志路径的检测状态，检测在后台执行，前端轮询到 status 为 ready 即可
+	router.GET("/api/parse/detect/default", func(c *gin.Context) {
+		c.JSON(http.StatusOK, lookupSetupFormatDetection())
+	})
+
+	// 只检测请求中的样例行或已配置站点的来源，不接受任意路径或来源配置
+	router.POST("/api/parse/detect", func(c *gin.Context) {
+		type parseDetectRequest struct {
+			WebsiteID string   `json:"website_id"`
+			SourceID  string   `json:"source_id"`
+			Lines     []string `json:"lines"`
+		}
+
+		var req parseDetectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+
+		if len(req.Lines) > 0 {
+			c.JSON(http.StatusOK, ingest.DetectLogFormat(req.Lines))
+			return
+		}
+
+		websiteID := strings.TrimSpace(req.WebsiteID)
+		sourceID := strings.TrimSpace(req.SourceID)
+		if websiteID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "缺少样例日志或日志来源",
+			})
+			return
+		}
+		website, ok := config.GetWebsiteByID(websiteID)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "站点不存在",
+			})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), formatDetectTimeout)
+		defer cancel()
+
+		var (
+			result ingest.LogFormatDetection
+			err    error
+		)
+		var srcCfg *config.SourceConfig
+		for i := range website.Sources {
+			if sourceID == "" || strings.TrimSpace(website.Sources[i].ID) == sourceID {
+				srcCfg = &website.Sources[i]
+				break
+			}
+		}
+		if srcCfg != nil {
+			result, err = ingest.DetectLogFormatFromSource(ctx, *srcCfg)
+		} else if sourceID != "" {
+			err = fmt.Errorf("未找到日志来源: %s", sourceID)
+		} else {
+			result, err = ingest.DetectLogFormatFromPath(ctx, website.LogPath)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
 	router.POST("/api/config/save", func(c *gin.Context) {
 		if config.ConfigReadOnly() {
 			c.JSON(http.StatusForbidden, gin.H{
@@ -199,243 +327,1006 @@ func SetupRoutes(
 			})
 			return
 		}
-
-		result := config.ValidateConfig(cfg, config.ValidateOptions{
-			CheckPaths: true,
-		})
-		if len(result.Errors) > 0 {
-			c.JSON(http.StatusBadRequest, result)
+
+		result := config.ValidateConfig(cfg, config.ValidateOptions{
+			CheckPaths: true,
+		})
+		if len(result.Errors) > 0 {
+			c.JSON(http.StatusBadRequest, result)
+			return
+		}
+
+		if err := config.WriteConfigFile(cfg); err != nil {
+			logrus.WithError(err).Error("保存配置失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("保存配置失败: %v", err),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":          true,
+			"restart_required": true,
+		})
+	})
+
+	router.POST("/api/system/restart", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			if proc, err := os.FindProcess(os.Getpid()); err == nil {
+				_ = proc.Signal(syscall.SIGTERM)
+			}
+		}()
+	})
+
+	router.GET("/api/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"version":    version.Version,
+			"git_commit": version.GitCommit,
+		})
+	})
+
+	router.POST("/api/logs/reparse", func(c *gin.Context) {
+		if logParser == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持日志解析",
+			})
+			return
+		}
+		type reparseRequest struct {
+			ID        string `json:"id"`
+			Migration bool   `json:"migration"`
+		}
+
+		var req reparseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+
+		websiteID := strings.TrimSpace(req.ID)
+		if websiteID != "" {
+			if _, ok := config.GetWebsiteByID(websiteID); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "站点不存在",
+				})
+				return
+			}
+		}
+
+		if err := logParser.TriggerReparse(websiteID); err != nil {
+			if errors.Is(err, ingest.ErrParsingInProgress) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			logrus.WithError(err).Error("触发重新解析失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("重新解析失败: %v", err),
+			})
+			return
+		}
+
+		if req.Migration {
+			if err := markPGMigrationDone(); err != nil {
+				logrus.WithError(err).Warn("记录迁移状态失败")
+			}
+		}
+
+		statsFactory.ClearCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+
+	router.GET("/api/ip-geo/anomaly", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "统计模块暂不可用",
+			})
+			return
+		}
+		websiteID := strings.TrimSpace(c.Query("id"))
+		if websiteID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "站点不存在",
+			})
+			return
+		}
+		if _, ok := config.GetWebsiteByID(websiteID); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "站点不存在",
+			})
+			return
+		}
+		page := 1
+		pageSize := 50
+		if rawPage := strings.TrimSpace(c.Query("page")); rawPage != "" {
+			if parsed, err := strconv.Atoi(rawPage); err == nil && parsed > 0 {
+				page = parsed
+			}
+		}
+		if rawPageSize := strings.TrimSpace(c.Query("pageSize")); rawPageSize != "" {
+			if parsed, err := strconv.Atoi(rawPageSize); err == nil && parsed > 0 {
+				pageSize = parsed
+			}
+		} else if rawLimit := strings.TrimSpace(c.Query("limit")); rawLimit != "" {
+			if parsed, err := strconv.Atoi(rawLimit); err == nil && parsed > 0 {
+				pageSize = parsed
+			}
+		}
+		count, samples, err := statsFactory.Repo().DetectIPGeoAnomalies(websiteID, 5)
+		if err != nil {
+			logrus.WithError(err).Error("检测 IP 归属地异常失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("检测失败: %v", err),
+			})
+			return
+		}
+		logs, err := statsFactory.Repo().FetchIPGeoAnomalyLogs(websiteID, page, pageSize)
+		if err != nil {
+			logrus.WithError(err).Error("读取 IP 归属地异常日志失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("读取异常日志失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"has_issue": count > 0,
+			"count":     count,
+			"samples":   samples,
+			"logs":      logs,
+		})
+	})
+
+	router.POST("/api/ip-geo/repair", func(c *gin.Context) {
+		if logParser == nil || statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持日志解析",
+			})
+			return
+		}
+		type repairRequest struct {
+			ID  string   `json:"id"`
+			IPs []string `json:"ips"`
+		}
+		var req repairRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		websiteID := strings.TrimSpace(req.ID)
+		if websiteID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "站点不存在",
+			})
+			return
+		}
+		if _, ok := config.GetWebsiteByID(websiteID); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "站点不存在",
+			})
+			return
+		}
+
+		repo := statsFactory.Repo()
+		ips := make([]string, 0, len(req.IPs))
+		seen := make(map[string]struct{}, len(req.IPs))
+		for _, raw := range req.IPs {
+			ip := strings.TrimSpace(raw)
+			if ip == "" {
+				continue
+			}
+			if _, ok := seen[ip]; ok {
+				continue
+			}
+			seen[ip] = struct{}{}
+			ips = append(ips, ip)
+		}
+		if len(ips) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请选择需要处理的异常日志",
+			})
+			return
+		}
+
+		if err := repo.DeleteIPGeoCache(ips); err != nil {
+			logrus.WithError(err).Error("删除 IP 归属地缓存失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("删除 IP 归属地缓存失败: %v", err),
+			})
+			return
+		}
+		enrich.DeleteIPGeoCacheEntries(ips)
+		if err := repo.MarkIPGeoPendingForWebsite(websiteID, ips, "待解析"); err != nil {
+			logrus.WithError(err).Error("标记 IP 归属地待解析失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("标记待解析失败: %v", err),
+			})
+			return
+		}
+		if err := repo.UpsertIPGeoPending(ips); err != nil {
+			logrus.WithError(err).Error("补充 IP 归属地待解析队列失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("补充待解析队列失败: %v", err),
+			})
+			return
+		}
+		statsFactory.ClearCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+
+	router.GET("/api/ip-geo/databases", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"databases": enrich.ListIPGeoDBs(),
+		})
+	})
+
+	// 攻击特征规则：内置规则与规则文件合并后的结果
+	router.GET("/api/security/rules", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"rules":     enrich.ListSecurityRules(),
+			"rulesFile": enrich.SecurityRulesFile(),
+		})
+	})
+
+	// 保存自定义规则（覆盖规则文件），同 id 覆盖内置规则，仅填 id + disabled 可禁用内置规则
+	router.POST("/api/security/rules", func(c *gin.Context) {
+		var req struct {
+			Rules []enrich.SecurityRule `json:"rules"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		if err := enrich.SaveSecurityRules(req.Rules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"rules":   enrich.ListSecurityRules(),
+		})
+	})
+
+	// IP 信誉名单：已加载的名单与前缀数量
+	router.GET("/api/reputation/lists", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"lists": enrich.ListIPReputationLists(),
+			"dir":   enrich.IPReputationDir(),
+		})
+	})
+
+	// 立即重新加载信誉名单，只影响之后入库的日志
+	router.POST("/api/reputation/reload", func(c *gin.Context) {
+		if err := enrich.InitIPReputation(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("加载信誉名单失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"lists":   enrich.ListIPReputationLists(),
+		})
+	})
+
+	// 暴力破解 / 撞库事件列表，按最近命中时间倒序
+	router.GET("/api/security/incidents", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持安全事件",
+			})
+			return
+		}
+		websiteID := strings.TrimSpace(c.Query("id"))
+		if _, ok := config.GetWebsiteByID(websiteID); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "站点不存在",
+			})
+			return
+		}
+		filter := store.SecurityIncidentFilter{
+			Kind:    strings.TrimSpace(c.Query("kind")),
+			Scope:   strings.TrimSpace(c.Query("scope")),
+			Subject: strings.TrimSpace(c.Query("subject")),
+		}
+		if timeRange := strings.TrimSpace(c.Query("timeRange")); timeRange != "" {
+			startTime, endTime, err := timeutil.TimePeriod(timeRange)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("时间范围错误: %v", err),
+				})
+				return
+			}
+			filter.StartTs = startTime.Unix()
+			filter.EndTs = endTime.Unix()
+		}
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+
+		incidents, hasMore, err := statsFactory.Repo().ListSecurityIncidents(websiteID, filter, page, pageSize)
+		if err != nil {
+			logrus.WithError(err).Error("读取安全事件失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("读取安全事件失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"incidents": incidents,
+			"has_more":  hasMore,
+		})
+	})
+
+	// 按查询挑选 IP 加入封禁名单，并渲染为 nginx deny / geo、ipset 或 nftables 格式；
+	// output 只能引用 security.blocklist.outputs 中配置的名称
+	router.POST("/api/security/blocklist/build", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持封禁名单",
+			})
+			return
+		}
+		var req analytics.BlocklistRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		result, err := statsFactory.BuildBlocklist(req)
+		if err != nil {
+			if errors.Is(err, analytics.ErrInvalidBlocklistRequest) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			logrus.WithError(err).Error("生成封禁名单失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("生成封禁名单失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	})
+
+	// 当前有效的封禁名单，id 为空时返回全部站点
+	router.GET("/api/security/blocklist", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持封禁名单",
+			})
+			return
+		}
+		websiteID := strings.TrimSpace(c.Query("id"))
+		if websiteID != "" {
+			if _, ok := config.GetWebsiteByID(websiteID); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "站点不存在",
+				})
+				return
+			}
+		}
+		entries, err := statsFactory.Repo().ListBlocklistEntries(websiteID)
+		if err != nil {
+			logrus.WithError(err).Error("读取封禁名单失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("读取封禁名单失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"entries": entries,
+		})
+	})
+
+	// 移除封禁条目（不会自动重写输出文件，需再调用 build 接口），id 为空时移除所有站点下的该 IP
+	router.DELETE("/api/security/blocklist", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持封禁名单",
+			})
+			return
+		}
+		ip := strings.TrimSpace(c.Query("ip"))
+		if net.ParseIP(ip) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "IP 格式错误",
+			})
+			return
+		}
+		removed, err := statsFactory.Repo().DeleteBlocklistEntry(strings.TrimSpace(c.Query("id")), ip)
+		if err != nil {
+			logrus.WithError(err).Error("删除封禁条目失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("删除封禁条目失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"removed": removed,
+		})
+	})
+
+	// 告警规则：id 为空时返回全部站点的规则
+	router.GET("/api/alerts/rules", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持告警规则",
+			})
+			return
+		}
+		rules, err := statsFactory.Repo().ListAlertRules(strings.TrimSpace(c.Query("id")))
+		if err != nil {
+			logrus.WithError(err).Error("读取告警规则失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("读取告警规则失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"rules": rules,
+		})
+	})
+
+	router.POST("/api/alerts/rules", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持告警规则",
+			})
+			return
+		}
+		rule := store.AlertRule{Enabled: true}
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		if err := ingest.NormalizeAlertRule(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err := statsFactory.Repo().CreateAlertRule(&rule); err != nil {
+			logrus.WithError(err).Error("创建告警规则失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("创建告警规则失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"rule": rule,
+		})
+	})
+
+	// 修改规则会把状态重置为 inactive，下一轮定时任务重新评估
+	router.PUT("/api/alerts/rules/:ruleId", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持告警规则",
+			})
+			return
+		}
+		ruleID, err := strconv.ParseInt(c.Param("ruleId"), 10, 64)
+		if err != nil || ruleID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "规则 ID 错误",
+			})
+			return
+		}
+		// 未提交的字段保留原值，params 按键合并，值为空字符串表示删除该参数
+		rule, err := statsFactory.Repo().GetAlertRule(ruleID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "告警规则不存在",
+				})
+				return
+			}
+			logrus.WithError(err).Error("读取告警规则失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("读取告警规则失败: %v", err),
+			})
+			return
+		}
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		rule.ID = ruleID
+		if err := ingest.NormalizeAlertRule(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if err := statsFactory.Repo().UpdateAlertRule(&rule); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "告警规则不存在",
+				})
+				return
+			}
+			logrus.WithError(err).Error("更新告警规则失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("更新告警规则失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"rule": rule,
+		})
+	})
+
+	router.DELETE("/api/alerts/rules/:ruleId", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持告警规则",
+			})
+			return
+		}
+		ruleID, err := strconv.ParseInt(c.Param("ruleId"), 10, 64)
+		if err != nil || ruleID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "规则 ID 错误",
+			})
+			return
+		}
+		deleted, err := statsFactory.Repo().DeleteAlertRule(ruleID)
+		if err != nil {
+			logrus.WithError(err).Error("删除告警规则失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("删除告警规则失败: %v", err),
+			})
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "告警规则不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+
+	// 告警历史（pending / firing / resolved），按时间倒序
+	router.GET("/api/alerts/history", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持告警规则",
+			})
+			return
+		}
+		filter := store.AlertEventFilter{
+			WebsiteID: strings.TrimSpace(c.Query("id")),
+			State:     strings.TrimSpace(c.Query("state")),
+		}
+		if raw := strings.TrimSpace(c.Query("ruleId")); raw != "" {
+			ruleID, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || ruleID <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "规则 ID 错误",
+				})
+				return
+			}
+			filter.RuleID = ruleID
+		}
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+
+		events, hasMore, err := statsFactory.Repo().ListAlertEvents(filter, page, pageSize)
+		if err != nil {
+			logrus.WithError(err).Error("读取告警历史失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("读取告警历史失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"events":   events,
+			"has_more": hasMore,
+		})
+	})
+
+	router.GET("/api/notifications/channels", func(c *gin.Context) {
+		routes := make([]config.NotificationRouteConfig, 0)
+		if cfg := config.ReadConfig().Notifications; cfg != nil && cfg.Routes != nil {
+			routes = cfg.Routes
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"channels": notify.Channels(),
+			"routes":   routes,
+		})
+	})
+
+	// 同步发送一条测试通知，用于校验渠道配置
+	router.POST("/api/notifications/channels/test", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持通知外发",
+			})
+			return
+		}
+		var req struct {
+			Channel string `json:"channel"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Channel) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		known := false
+		for _, channel := range notify.Channels() {
+			if channel.Name == strings.TrimSpace(req.Channel) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "渠道不存在",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		if err := notify.NewDispatcher(statsFactory.Repo()).SendTest(ctx, req.Channel); err != nil {
+			logrus.WithError(err).Warnf("测试通知发送失败: %s", req.Channel)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": fmt.Sprintf("发送失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
+
+	router.GET("/api/notifications/deliveries", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持通知外发",
+			})
+			return
+		}
+		filter := store.NotificationDeliveryFilter{
+			Channel: strings.TrimSpace(c.Query("channel")),
+			Status:  strings.TrimSpace(c.Query("status")),
+		}
+		if raw := strings.TrimSpace(c.Query("notificationId")); raw != "" {
+			notificationID, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || notificationID <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "通知 ID 错误",
+				})
+				return
+			}
+			filter.NotificationID = notificationID
+		}
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+
+		deliveries, hasMore, err := statsFactory.Repo().ListNotificationDeliveries(filter, page, pageSize)
+		if err != nil {
+			logrus.WithError(err).Error("读取通知外发记录失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("读取通知外发记录失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"deliveries": deliveries,
+			"has_more":   hasMore,
+		})
+	})
+
+	router.GET("/api/reports", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持定时报告",
+			})
+			return
+		}
+		reports, err := statsFactory.Repo().ListReportDefinitions()
+		if err != nil {
+			logrus.WithError(err).Error("读取定时报告失败")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("读取定时报告失败: %v", err),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"reports":  reports,
+			"sections": analytics.ReportSections,
+		})
+	})
+
+	router.POST("/api/reports", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持定时报告",
+			})
+			return
+		}
+		report := store.ReportDefinition{Enabled: true, Weekday: 1, Hour: 8}
+		if err := c.ShouldBindJSON(&report); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		if err := analytics.NormalizeReportDefinition(&report); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
 			return
 		}
-
-		if err := config.WriteConfigFile(cfg); err != nil {
-			logrus.WithError(err).Error("保存配置失败")
+		if err := statsFactory.Repo().CreateReportDefinition(&report); err != nil {
+			logrus.WithError(err).Error("创建定时报告失败")
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("保存配置失败: %v", err),
+				"error": fmt.Sprintf("创建定时报告失败: %v", err),
 			})
 			return
 		}
-
 		c.JSON(http.StatusOK, gin.H{
-			"success":          true,
-			"restart_required": true,
-		})
-	})
-
-	router.POST("/api/system/restart", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
+			"report": report,
 		})
-
-		go func() {
-			time.Sleep(200 * time.Millisecond)
-			if proc, err := os.FindProcess(os.Getpid()); err == nil {
-				_ = proc.Signal(syscall.SIGTERM)
-			}
-		}()
 	})
 
-	router.GET("/api/version", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"version":    version.Version,
-			"git_commit": version.GitCommit,
-		})
+	// 预览未保存的报告定义，不需要配置渠道
+	router.POST("/api/reports/preview", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持定时报告",
+			})
+			return
+		}
+		report := store.ReportDefinition{Name: "报告预览"}
+		if err := c.ShouldBindJSON(&report); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "请求参数错误",
+			})
+			return
+		}
+		if err := analytics.NormalizeReportPreview(&report); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		writeReportPreview(c, statsFactory, report)
 	})
 
-	router.POST("/api/logs/reparse", func(c *gin.Context) {
-		if logParser == nil {
+	// 未提交的字段保留原值
+	router.PUT("/api/reports/:reportId", func(c *gin.Context) {
+		if statsFactory == nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "初始化模式暂不支持日志解析",
+				"error": "初始化模式暂不支持定时报告",
 			})
 			return
 		}
-		type reparseRequest struct {
-			ID        string `json:"id"`
-			Migration bool   `json:"migration"`
+		report, ok := loadReportDefinition(c, statsFactory)
+		if !ok {
+			return
 		}
-
-		var req reparseRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		reportID := report.ID
+		if err := c.ShouldBindJSON(&report); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "请求参数错误",
 			})
 			return
 		}
-
-		websiteID := strings.TrimSpace(req.ID)
-		if websiteID != "" {
-			if _, ok := config.GetWebsiteByID(websiteID); !ok {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": "站点不存在",
-				})
-				return
-			}
+		report.ID = reportID
+		if err := analytics.NormalizeReportDefinition(&report); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
 		}
-
-		if err := logParser.TriggerReparse(websiteID); err != nil {
-			if errors.Is(err, ingest.ErrParsingInProgress) {
-				c.JSON(http.StatusConflict, gin.H{
-					"error": err.Error(),
+		if err := statsFactory.Repo().UpdateReportDefinition(&report); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "定时报告不存在",
 				})
 				return
 			}
-			logrus.WithError(err).Error("触发重新解析失败")
+			logrus.WithError(err).Error("更新定时报告失败")
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("重新解析失败: %v", err),
+				"error": fmt.Sprintf("更新定时报告失败: %v", err),
 			})
 			return
 		}
-
-		if req.Migration {
-			if err := markPGMigrationDone(); err != nil {
-				logrus.WithError(err).Warn("记录迁移状态失败")
-			}
-		}
-
-		statsFactory.ClearCache()
 		c.JSON(http.StatusOK, gin.H{
-			"success": true,
+			"report": report,
 		})
 	})
 
-	router.GET("/api/ip-geo/anomaly", func(c *gin.Context) {
+	router.DELETE("/api/reports/:reportId", func(c *gin.Context) {
 		if statsFactory == nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "统计模块暂不可用",
-			})
-			return
-		}
-		websiteID := strings.TrimSpace(c.Query("id"))
-		if websiteID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "站点不存在",
+				"error": "初始化模式暂不支持定时报告",
 			})
 			return
 		}
-		if _, ok := config.GetWebsiteByID(websiteID); !ok {
+		reportID, err := strconv.ParseInt(c.Param("reportId"), 10, 64)
+		if err != nil || reportID <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "站点不存在",
+				"error": "报告 ID 错误",
 			})
 			return
 		}
-		page := 1
-		pageSize := 50
-		if rawPage := strings.TrimSpace(c.Query("page")); rawPage != "" {
-			if parsed, err := strconv.Atoi(rawPage); err == nil && parsed > 0 {
-				page = parsed
-			}
-		}
-		if rawPageSize := strings.TrimSpace(c.Query("pageSize")); rawPageSize != "" {
-			if parsed, err := strconv.Atoi(rawPageSize); err == nil && parsed > 0 {
-				pageSize = parsed
-			}
-		} else if rawLimit := strings.TrimSpace(c.Query("limit")); rawLimit != "" {
-			if parsed, err := strconv.Atoi(rawLimit); err == nil && parsed > 0 {
-				pageSize = parsed
-			}
-		}
-		count, samples, err := statsFactory.Repo().DetectIPGeoAnomalies(websiteID, 5)
+		deleted, err := statsFactory.Repo().DeleteReportDefinition(reportID)
 		if err != nil {
-			logrus.WithError(err).Error("检测 IP 归属地异常失败")
+			logrus.WithError(err).Error("删除定时报告失败")
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("检测失败: %v", err),
+				"error": fmt.Sprintf("删除定时报告失败: %v", err),
 			})
 			return
 		}
-		logs, err := statsFactory.Repo().FetchIPGeoAnomalyLogs(websiteID, page, pageSize)
-		if err != nil {
-			logrus.WithError(err).Error("读取 IP 归属地异常日志失败")
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("读取异常日志失败: %v", err),
+		if !deleted {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "定时报告不存在",
 			})
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{
-			"has_issue": count > 0,
-			"count":     count,
-			"samples":   samples,
-			"logs":      logs,
+			"success": true,
 		})
 	})
 
-	router.POST("/api/ip-geo/repair", func(c *gin.Context) {
-		if logParser == nil || statsFactory == nil {
+	// format: html（默认）/ markdown / csv / json
+	router.GET("/api/reports/:reportId/preview", func(c *gin.Context) {
+		if statsFactory == nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "初始化模式暂不支持日志解析",
+				"error": "初始化模式暂不支持定时报告",
 			})
 			return
 		}
-		type repairRequest struct {
-			ID  string   `json:"id"`
-			IPs []string `json:"ips"`
+		report, ok := loadReportDefinition(c, statsFactory)
+		if !ok {
+			return
 		}
-		var req repairRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "请求参数错误",
+		writeReportPreview(c, statsFactory, report)
+	})
+
+	// 立即发送一次报告（不影响定时发送）
+	router.POST("/api/reports/:reportId/send", func(c *gin.Context) {
+		if statsFactory == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "初始化模式暂不支持定时报告",
 			})
 			return
 		}
-		websiteID := strings.TrimSpace(req.ID)
-		if websiteID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "站点不存在",
-			})
+		report, ok := loadReportDefinition(c, statsFactory)
+		if !ok {
 			return
 		}
-		if _, ok := config.GetWebsiteByID(websiteID); !ok {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "站点不存在",
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
+		defer cancel()
+		dispatcher := notify.NewDispatcher(statsFactory.Repo())
+		if err := worker.DeliverReport(ctx, statsFactory, dispatcher, report); err != nil {
+			logrus.WithError(err).Warnf("定时报告发送失败: %s", report.Name)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": fmt.Sprintf("发送失败: %v", err),
 			})
 			return
 		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+		})
+	})
 
-		repo := statsFactory.Repo()
-		ips := make([]string, 0, len(req.IPs))
-		seen := make(map[string]struct{}, len(req.IPs))
-		for _, raw := range req.IPs {
-			ip := strings.TrimSpace(raw)
-			if ip == "" {
-				continue
+	// 更新离线库：multipart 上传 file（直接写入 DataDir 下的临时文件），或传入 DataDir 内的 path
+	router.POST("/api/ip-geo/databases", func(c *gin.Context) {
+		var (
+			req       ipGeoDBInstallRequest
+			localPath string
+			uploaded  bool
+			err       error
+		)
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, enrich.MaxIPGeoDBSize+1024*1024)
+			reader, readerErr := c.Request.MultipartReader()
+			if readerErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "请求参数错误",
+				})
+				return
 			}
-			if _, ok := seen[ip]; ok {
-				continue
+			req, localPath, err = receiveIPGeoDBUpload(reader)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+				return
 			}
-			seen[ip] = struct{}{}
-			ips = append(ips, ip)
-		}
-		if len(ips) == 0 {
+			if localPath != "" {
+				// 安装成功时临时文件已移动到目标路径，删除只清理失败残留
+				defer os.Remove(localPath)
+				uploaded = true
+			}
+		} else if err := c.ShouldBind(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "请选择需要处理的异常日志",
+				"error": "请求参数错误",
 			})
 			return
 		}
+		if localPath == "" {
+			path := strings.TrimSpace(req.Path)
+			if path == "" {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "请上传离线库文件或指定 path",
+				})
+				return
+			}
+			if localPath, err = resolveIPGeoDBLocalPath(path); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+		}
 
-		if err := repo.DeleteIPGeoCache(ips); err != nil {
-			logrus.WithError(err).Error("删除 IP 归属地缓存失败")
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("删除 IP 归属地缓存失败: %v", err),
-			})
-			return
+		opts := enrich.IPGeoDBInstallOptions{
+			Provider: strings.TrimSpace(req.Provider),
+			Role:     strings.TrimSpace(req.Role),
 		}
-		enrich.DeleteIPGeoCacheEntries(ips)
-		if err := repo.MarkIPGeoPendingForWebsite(websiteID, ips, "待解析"); err != nil {
-			logrus.WithError(err).Error("标记 IP 归属地待解析失败")
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("标记待解析失败: %v", err),
-			})
-			return
+		var info enrich.IPGeoDBInfo
+		if uploaded {
+			info, err = enrich.InstallUploadedIPGeoDB(localPath, opts)
+		} else {
+			info, err = enrich.InstallIPGeoDBFromFile(localPath, opts)
 		}
-		if err := repo.UpsertIPGeoPending(ips); err != nil {
-			logrus.WithError(err).Error("补充 IP 归属地待解析队列失败")
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("补充待解析队列失败: %v", err),
+		if err != nil {
+			logrus.WithError(err).Warn("安装 IP 离线库失败")
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
 			})
 			return
 		}
-		statsFactory.ClearCache()
+
+		regeolocate := req.Regeolocate && statsFactory != nil
+		if regeolocate {
+			repo := statsFactory.Repo()
+			go func() {
+				count, err := ingest.RequeueCachedIPGeo(repo)
+				if err != nil {
+					logrus.WithError(err).Error("重新解析 IP 归属地失败")
+					return
+				}
+				statsFactory.ClearCache()
+				logrus.Infof("已将 %d 个 IP 加入重新解析队列", count)
+			}()
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"success": true,
+			"success":     true,
+			"database":    info,
+			"regeolocate": regeolocate,
 		})
 	})
 
@@ -627,8 +1518,16 @@ func SetupRoutes(
 			return
 		}
 
+		format, err := resolveLogsExportFormat(params["format"])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
 		lang := params["lang"]
-		job, err := exportJobs.Create(statsFactory, query, lang, params)
+		job, err := exportJobs.Create(statsFactory, query, lang, format, params)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -664,6 +1563,7 @@ func SetupRoutes(
 			"processed":  job.Processed,
 			"total":      job.Total,
 			"fileName":   job.FileName,
+			"format":     job.Format,
 			"error":      job.Error,
 			"created_at": job.CreatedAt,
 			"updated_at": job.UpdatedAt,
@@ -763,8 +1663,15 @@ func SetupRoutes(
 			})
 			return
 		}
+		format, err := resolveLogsExportFormat(params["format"])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		lang := params["lang"]
-		job, err := exportJobs.Create(statsFactory, query, lang, params)
+		job, err := exportJobs.Create(statsFactory, query, lang, format, params)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -812,11 +1719,15 @@ func SetupRoutes(
 			return
 		}
 
+		format, err := resolveLogsExportFormat(job.Format)
+		if err != nil {
+			format = logsExportCSV
+		}
 		filename := job.FileName
 		if filename == "" {
-			filename = fmt.Sprintf("nginxpulse_logs_%s.csv", time.Now().Format("20060102_150405"))
+			filename = fmt.Sprintf("nginxpulse_logs_%s%s", time.Now().Format("20060102_150405"), format.Extension)
 		}
-		c.Header("Content-Type", csvContentType)
+		c.Header("Content-Type", format.ContentType)
 		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 		c.Header("Cache-Control", "no-store")
 		c.File(job.FilePath)
@@ -960,3 +1871,61 @@ func markPGMigrationDone() error {
 	}
 	return nil
 }
+
+// loadReportDefinition 读取路径参数 reportId 对应的报告定义，失败时已写入响应
+func loadReportDefinition(c *gin.Context, statsFactory *analytics.StatsFactory) (store.ReportDefinition, bool) {
+	reportID, err := strconv.ParseInt(c.Param("reportId"), 10, 64)
+	if err != nil || reportID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "报告 ID 错误",
+		})
+		return store.ReportDefinition{}, false
+	}
+	report, err := statsFactory.Repo().GetReportDefinition(reportID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "定时报告不存在",
+			})
+			return report, false
+		}
+		logrus.WithError(err).Error("读取定时报告失败")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("读取定时报告失败: %v", err),
+		})
+		return report, false
+	}
+	return report, true
+}
+
+// writeReportPreview 按 format 参数输出渲染后的报告
+func writeReportPreview(c *gin.Context, statsFactory *analytics.StatsFactory, report store.ReportDefinition) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "html")))
+	if format != "html" && format != "markdown" && format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "format 仅支持 html、markdown、csv、json",
+		})
+		return
+	}
+	rendered, err := statsFactory.RenderReport(report)
+	if err != nil {
+		logrus.WithError(err).Error("生成报告预览失败")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("生成报告预览失败: %v", err),
+		})
+		return
+	}
+	switch format {
+	case "markdown":
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(rendered.Markdown))
+	case "csv":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", rendered.CSVName))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", rendered.CSV)
+	case "json":
+		c.JSON(http.StatusOK, gin.H{
+			"report": rendered.Data,
+		})
+	default:
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(rendered.HTML))
+	}
+}
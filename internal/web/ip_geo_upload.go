@@ -0,0 +1,130 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/enrich"
+)
+
+// 表单字段最大长度，防止超长字段占用内存
+const maxIPGeoDBFormFieldSize = 4096
+
+type ipGeoDBInstallRequest struct {
+	Path        string `json:"path" form:"path"`
+	Provider    string `json:"provider" form:"provider"`
+	Role        string `json:"role" form:"role"`
+	Regeolocate bool   `json:"regeolocate" form:"regeolocate"`
+}
+
+// receiveIPGeoDBUpload 逐段读取 multipart 请求，把 file 字段直接写入 DataDir 下的临时文件，
+// 返回其余表单字段与临时文件路径（未上传文件时为空，调用方负责删除）
+func receiveIPGeoDBUpload(reader *multipart.Reader) (ipGeoDBInstallRequest, string, error) {
+	var (
+		req     ipGeoDBInstallRequest
+		tmpPath string
+	)
+	fail := func(err error) (ipGeoDBInstallRequest, string, error) {
+		if tmpPath != "" {
+			os.Remove(tmpPath)
+		}
+		return ipGeoDBInstallRequest{}, "", err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(fmt.Errorf("读取上传内容失败: %v", err))
+		}
+		name := part.FormName()
+		if name == "file" {
+			if tmpPath != "" {
+				part.Close()
+				return fail(errors.New("只能上传一个离线库文件"))
+			}
+			tmpPath, err = saveIPGeoDBUpload(part)
+			part.Close()
+			if err != nil {
+				return fail(err)
+			}
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxIPGeoDBFormFieldSize+1))
+		part.Close()
+		if err != nil {
+			return fail(fmt.Errorf("读取上传内容失败: %v", err))
+		}
+		if len(value) > maxIPGeoDBFormFieldSize {
+			return fail(fmt.Errorf("表单字段 %s 过长", name))
+		}
+		switch name {
+		case "path":
+			req.Path = string(value)
+		case "provider":
+			req.Provider = string(value)
+		case "role":
+			req.Role = string(value)
+		case "regeolocate":
+			req.Regeolocate, _ = strconv.ParseBool(strings.TrimSpace(string(value)))
+		}
+	}
+	return req, tmpPath, nil
+}
+
+func saveIPGeoDBUpload(src io.Reader) (string, error) {
+	if err := os.MkdirAll(config.DataDir, 0o755); err != nil {
+		return "", fmt.Errorf("创建数据目录失败: %v", err)
+	}
+	file, err := os.CreateTemp(config.DataDir, ".ip-geo-upload-*")
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	written, err := io.Copy(file, io.LimitReader(src, enrich.MaxIPGeoDBSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > enrich.MaxIPGeoDBSize {
+		err = errors.New("离线库文件过大")
+	} else if err != nil {
+		err = fmt.Errorf("读取上传文件失败: %v", err)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// resolveIPGeoDBLocalPath 只允许通过接口安装 DataDir 内的文件，防止借此读取服务器上的任意文件
+func resolveIPGeoDBLocalPath(path string) (string, error) {
+	root, err := filepath.Abs(config.DataDir)
+	if err != nil {
+		return "", err
+	}
+	target := path
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	target = filepath.Clean(target)
+	// 解析符号链接，避免 DataDir 内的链接指向外部文件
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	if resolvedRoot, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolvedRoot
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path 只能指向数据目录 %s 内的文件", config.DataDir)
+	}
+	return target, nil
+}
@@ -36,20 +36,27 @@ func exportLogsCSVWithProgress(
 	lang string,
 	onProgress exportProgressFunc,
 	shouldCancel exportCancelFunc,
+) error {
+	return exportLogsWithProgress(writer, logsExportCSV, statsFactory, query, lang, onProgress, shouldCancel)
+}
+
+// exportLogsWithProgress 按页读取日志并交给对应格式的 writer，每页结束后刷新并回报进度
+func exportLogsWithProgress(
+	writer io.Writer,
+	format logsExportFormat,
+	statsFactory *analytics.StatsFactory,
+	query analytics.StatsQuery,
+	lang string,
+	onProgress exportProgressFunc,
+	shouldCancel exportCancelFunc,
 ) error {
 	manager, ok := statsFactory.GetManager("logs")
 	if !ok {
 		return fmt.Errorf("\u65e5\u5fd7\u7ba1\u7406\u5668\u672a\u521d\u59cb\u5316")
 	}
 
-	if _, err := writer.Write([]byte("\ufeff")); err != nil {
-		return err
-	}
-
-	normalizedLang := normalizeExportLang(lang)
-
-	csvWriter := csv.NewWriter(writer)
-	if err := csvWriter.Write(logsExportHeaders(normalizedLang)); err != nil {
+	rowWriter, err := format.newWriter(writer, normalizeExportLang(lang))
+	if err != nil {
 		return err
 	}
 
@@ -78,13 +85,11 @@ func exportLogsCSVWithProgress(
 			if shouldCancel != nil && i%200 == 0 && shouldCancel() {
 				return ErrExportCanceled
 			}
-			row := buildLogExportRow(log, normalizedLang)
-			if err := csvWriter.Write(row); err != nil {
+			if err := rowWriter.WriteLog(log); err != nil {
 				return err
 			}
 		}
-		csvWriter.Flush()
-		if err := csvWriter.Error(); err != nil {
+		if err := rowWriter.Flush(); err != nil {
 			return err
 		}
 
@@ -101,7 +106,79 @@ func exportLogsCSVWithProgress(
 		}
 	}
 
-	return csvWriter.Error()
+	return rowWriter.Close()
+}
+
+// logsExportWriter 某种导出格式的写入器：WriteLog 逐条写入，Flush 在每页结束时调用，Close 写入文件尾
+type logsExportWriter interface {
+	WriteLog(log analytics.LogEntry) error
+	Flush() error
+	Close() error
+}
+
+// logsExportFormat 导出格式，Name 即请求参数 format 的取值
+type logsExportFormat struct {
+	Name        string
+	Extension   string
+	ContentType string
+	newWriter   func(writer io.Writer, lang string) (logsExportWriter, error)
+}
+
+var (
+	logsExportCSV     = logsExportFormat{Name: "csv", Extension: ".csv", ContentType: csvContentType, newWriter: newCSVExportWriter}
+	logsExportNDJSON  = logsExportFormat{Name: "ndjson", Extension: ".ndjson", ContentType: "application/x-ndjson", newWriter: newNDJSONExportWriter}
+	logsExportParquet = logsExportFormat{Name: "parquet", Extension: ".parquet", ContentType: "application/vnd.apache.parquet", newWriter: newParquetExportWriter}
+	logsExportXLSX    = logsExportFormat{Name: "xlsx", Extension: ".xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newWriter: newXLSXExportWriter}
+
+	logsExportFormats = map[string]logsExportFormat{
+		logsExportCSV.Name:     logsExportCSV,
+		logsExportNDJSON.Name:  logsExportNDJSON,
+		logsExportParquet.Name: logsExportParquet,
+		logsExportXLSX.Name:    logsExportXLSX,
+	}
+)
+
+// resolveLogsExportFormat 解析 format 参数，为空时为 CSV
+func resolveLogsExportFormat(name string) (logsExportFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return logsExportCSV, nil
+	}
+	format, ok := logsExportFormats[name]
+	if !ok {
+		return logsExportFormat{}, fmt.Errorf("不支持的导出格式: %s", name)
+	}
+	return format, nil
+}
+
+// csvExportWriter 带 BOM 的 CSV，表头与列值按语言本地化
+type csvExportWriter struct {
+	writer *csv.Writer
+	lang   string
+}
+
+func newCSVExportWriter(writer io.Writer, lang string) (logsExportWriter, error) {
+	if _, err := writer.Write([]byte("\ufeff")); err != nil {
+		return nil, err
+	}
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(logsExportHeaders(lang)); err != nil {
+		return nil, err
+	}
+	return &csvExportWriter{writer: csvWriter, lang: lang}, nil
+}
+
+func (w *csvExportWriter) WriteLog(log analytics.LogEntry) error {
+	return w.writer.Write(buildLogExportRow(log, w.lang))
+}
+
+func (w *csvExportWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvExportWriter) Close() error {
+	return w.Flush()
 }
 
 func buildLogExportRow(log analytics.LogEntry, lang string) []string {
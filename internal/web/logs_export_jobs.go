@@ -13,6 +13,7 @@ import (
 
 	"github.com/likaia/nginxpulse/internal/analytics"
 	"github.com/likaia/nginxpulse/internal/config"
+	"github.com/likaia/nginxpulse/internal/metrics"
 )
 
 const (
@@ -35,6 +36,7 @@ type LogsExportJob struct {
 	CreatedAt time.Time           `json:"created_at"`
 	UpdatedAt time.Time           `json:"updated_at"`
 	FileName  string              `json:"file_name,omitempty"`
+	Format    string              `json:"format,omitempty"`
 	FilePath  string              `json:"-"`
 	Error     string              `json:"error,omitempty"`
 	Processed int64               `json:"processed,omitempty"`
@@ -53,7 +55,9 @@ var exportJobs = &logsExportManager{
 	jobs: make(map[string]*LogsExportJob),
 }
 
-func (m *logsExportManager) Create(statsFactory *analytics.StatsFactory, query analytics.StatsQuery, lang string, params map[string]string) (*LogsExportJob, error) {
+var exportJobsTotal = metrics.NewCounter("nginxpulse_export_jobs_total", "已结束的日志导出任务数", "status")
+
+func (m *logsExportManager) Create(statsFactory *analytics.StatsFactory, query analytics.StatsQuery, lang string, format logsExportFormat, params map[string]string) (*LogsExportJob, error) {
 	if statsFactory == nil {
 		return nil, fmt.Errorf("统计模块暂不可用")
 	}
@@ -62,12 +66,12 @@ func (m *logsExportManager) Create(statsFactory *analytics.StatsFactory, query a
 	if err != nil {
 		return nil, err
 	}
-	fileName := fmt.Sprintf("nginxpulse_logs_%s.csv", time.Now().Format("20060102_150405"))
+	fileName := fmt.Sprintf("nginxpulse_logs_%s%s", time.Now().Format("20060102_150405"), format.Extension)
 	exportDir := filepath.Join(config.DataDir, "exports")
 	if err := os.MkdirAll(exportDir, 0755); err != nil {
 		return nil, err
 	}
-	filePath := filepath.Join(exportDir, fmt.Sprintf("%s.csv", jobID))
+	filePath := filepath.Join(exportDir, jobID+format.Extension)
 
 	job := &LogsExportJob{
 		ID:        jobID,
@@ -75,6 +79,7 @@ func (m *logsExportManager) Create(statsFactory *analytics.StatsFactory, query a
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		FileName:  fileName,
+		Format:    format.Name,
 		FilePath:  filePath,
 	}
 
@@ -91,7 +96,7 @@ func (m *logsExportManager) Create(statsFactory *analytics.StatsFactory, query a
 	m.jobs[jobID] = job
 	m.mu.Unlock()
 
-	go m.run(jobID, statsFactory, query, lang)
+	go m.run(jobID, statsFactory, query, lang, format)
 	return job, nil
 }
 
@@ -176,7 +181,13 @@ func (m *logsExportManager) Cancel(id string) (*LogsExportJob, error) {
 	return &snapshot, nil
 }
 
-func (m *logsExportManager) run(jobID string, statsFactory *analytics.StatsFactory, query analytics.StatsQuery, lang string) {
+func (m *logsExportManager) run(jobID string, statsFactory *analytics.StatsFactory, query analytics.StatsQuery, lang string, format logsExportFormat) {
+	defer func() {
+		if job, ok := m.Get(jobID); ok {
+			exportJobsTotal.Inc(string(job.Status))
+		}
+	}()
+
 	if m.isCanceled(jobID) {
 		m.update(jobID, func(job *LogsExportJob) {
 			job.Status = logsExportCanceled
@@ -204,8 +215,9 @@ func (m *logsExportManager) run(jobID string, statsFactory *analytics.StatsFacto
 	defer file.Close()
 
 	buffered := bufio.NewWriter(file)
-	err = exportLogsCSVWithProgress(
+	err = exportLogsWithProgress(
 		buffered,
+		format,
 		statsFactory,
 		query,
 		lang,
@@ -244,6 +256,21 @@ func (m *logsExportManager) run(jobID string, statsFactory *analytics.StatsFacto
 	})
 }
 
+// CollectExportMetrics 输出当前各状态的导出任务数
+func CollectExportMetrics(w *metrics.Writer) {
+	counts := make(map[LogsExportJobStatus]int)
+	exportJobs.mu.Lock()
+	for _, job := range exportJobs.jobs {
+		counts[job.Status]++
+	}
+	exportJobs.mu.Unlock()
+
+	statuses := []LogsExportJobStatus{logsExportPending, logsExportRunning, logsExportSuccess, logsExportFailed, logsExportCanceled}
+	for _, status := range statuses {
+		w.Gauge("nginxpulse_export_jobs", "当前保留的日志导出任务数", float64(counts[status]), "status", string(status))
+	}
+}
+
 func (m *logsExportManager) isCanceled(jobID string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
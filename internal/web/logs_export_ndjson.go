@@ -0,0 +1,93 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/analytics"
+)
+
+// logsExportRecord NDJSON 与 Parquet 共用的列，字段名不随语言变化，数值列保持原始类型
+type logsExportRecord struct {
+	Time        string            `json:"time"`
+	Timestamp   int64             `json:"timestamp"`
+	IP          string            `json:"ip"`
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	Route       string            `json:"route"`
+	Status      int               `json:"status"`
+	BytesSent   int64             `json:"bytes_sent"`
+	Referer     string            `json:"referer"`
+	UserAgent   string            `json:"user_agent"`
+	Browser     string            `json:"browser"`
+	OS          string            `json:"os"`
+	Device      string            `json:"device"`
+	Location    string            `json:"location"`
+	CountryCode string            `json:"country_code"`
+	RegionCode  string            `json:"region_code"`
+	ASN         int64             `json:"asn"`
+	NetworkOrg  string            `json:"network_org"`
+	Pageview    bool              `json:"pageview"`
+	NewVisitor  bool              `json:"new_visitor"`
+	AttackType  string            `json:"attack_type"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+func buildLogsExportRecord(log analytics.LogEntry) logsExportRecord {
+	location := strings.TrimSpace(log.DomesticLocation)
+	if location == "" {
+		location = strings.TrimSpace(log.GlobalLocation)
+	}
+	record := logsExportRecord{
+		Timestamp:   log.Timestamp,
+		IP:          log.IP,
+		Method:      log.Method,
+		URL:         log.URL,
+		Route:       log.Route,
+		Status:      log.StatusCode,
+		BytesSent:   int64(log.BytesSent),
+		Referer:     log.Referer,
+		UserAgent:   log.UserAgent,
+		Browser:     log.UserBrowser,
+		OS:          log.UserOS,
+		Device:      log.UserDevice,
+		Location:    location,
+		CountryCode: log.CountryCode,
+		RegionCode:  log.RegionCode,
+		ASN:         log.ASN,
+		NetworkOrg:  log.NetworkOrg,
+		Pageview:    log.PageviewFlag,
+		NewVisitor:  log.IsNewVisitor,
+		AttackType:  log.AttackType,
+		Extra:       log.Extra,
+	}
+	if log.Timestamp > 0 {
+		record.Time = time.Unix(log.Timestamp, 0).Format(time.RFC3339)
+	}
+	return record
+}
+
+// ndjsonExportWriter 每行一个 JSON 对象，便于导入 jq、ClickHouse、BigQuery 等工具
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONExportWriter(writer io.Writer, _ string) (logsExportWriter, error) {
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	return &ndjsonExportWriter{encoder: encoder}, nil
+}
+
+func (w *ndjsonExportWriter) WriteLog(log analytics.LogEntry) error {
+	return w.encoder.Encode(buildLogsExportRecord(log))
+}
+
+func (w *ndjsonExportWriter) Flush() error {
+	return nil
+}
+
+func (w *ndjsonExportWriter) Close() error {
+	return nil
+}
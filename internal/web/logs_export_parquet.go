@@ -0,0 +1,378 @@
+package web
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/likaia/nginxpulse/internal/analytics"
+	"github.com/likaia/nginxpulse/internal/snappy"
+	"github.com/likaia/nginxpulse/internal/version"
+)
+
+// Parquet 导出：所有列为 REQUIRED、PLAIN 编码、snappy 压缩，每个行组的每列写一个数据页。
+// 行组达到行数或字节上限后立即写出，内存占用与导出总量无关。
+const (
+	parquetRowGroupRows  = 100000
+	parquetRowGroupBytes = 16 << 20
+	parquetMagic         = "PAR1"
+)
+
+// parquet.thrift 中的枚举值
+const (
+	parquetTypeBoolean   = 0
+	parquetTypeInt32     = 1
+	parquetTypeInt64     = 2
+	parquetTypeByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetRepetitionRequired = 0
+	parquetEncodingPlain      = 0
+	parquetEncodingRLE        = 3
+	parquetCodecSnappy        = 1
+	parquetPageData           = 0
+)
+
+type parquetKind int
+
+const (
+	parquetString parquetKind = iota
+	parquetTimestamp
+	parquetInt32
+	parquetInt64
+	parquetBool
+)
+
+type parquetColumn struct {
+	name string
+	kind parquetKind
+	str  func(r *logsExportRecord) string
+	num  func(r *logsExportRecord) int64
+	flag func(r *logsExportRecord) bool
+}
+
+// parquetColumns 与 NDJSON 的字段一致；time 为 UTC 毫秒时间戳
+var parquetColumns = []parquetColumn{
+	{name: "time", kind: parquetTimestamp, num: func(r *logsExportRecord) int64 { return r.Timestamp * 1000 }},
+	{name: "ip", kind: parquetString, str: func(r *logsExportRecord) string { return r.IP }},
+	{name: "method", kind: parquetString, str: func(r *logsExportRecord) string { return r.Method }},
+	{name: "url", kind: parquetString, str: func(r *logsExportRecord) string { return r.URL }},
+	{name: "route", kind: parquetString, str: func(r *logsExportRecord) string { return r.Route }},
+	{name: "status", kind: parquetInt32, num: func(r *logsExportRecord) int64 { return int64(r.Status) }},
+	{name: "bytes_sent", kind: parquetInt64, num: func(r *logsExportRecord) int64 { return r.BytesSent }},
+	{name: "referer", kind: parquetString, str: func(r *logsExportRecord) string { return r.Referer }},
+	{name: "user_agent", kind: parquetString, str: func(r *logsExportRecord) string { return r.UserAgent }},
+	{name: "browser", kind: parquetString, str: func(r *logsExportRecord) string { return r.Browser }},
+	{name: "os", kind: parquetString, str: func(r *logsExportRecord) string { return r.OS }},
+	{name: "device", kind: parquetString, str: func(r *logsExportRecord) string { return r.Device }},
+	{name: "location", kind: parquetString, str: func(r *logsExportRecord) string { return r.Location }},
+	{name: "country_code", kind: parquetString, str: func(r *logsExportRecord) string { return r.CountryCode }},
+	{name: "region_code", kind: parquetString, str: func(r *logsExportRecord) string { return r.RegionCode }},
+	{name: "asn", kind: parquetInt64, num: func(r *logsExportRecord) int64 { return r.ASN }},
+	{name: "network_org", kind: parquetString, str: func(r *logsExportRecord) string { return r.NetworkOrg }},
+	{name: "pageview", kind: parquetBool, flag: func(r *logsExportRecord) bool { return r.Pageview }},
+	{name: "new_visitor", kind: parquetBool, flag: func(r *logsExportRecord) bool { return r.NewVisitor }},
+	{name: "attack_type", kind: parquetString, str: func(r *logsExportRecord) string { return r.AttackType }},
+}
+
+func (c parquetColumn) physicalType() int32 {
+	switch c.kind {
+	case parquetTimestamp, parquetInt64:
+		return parquetTypeInt64
+	case parquetInt32:
+		return parquetTypeInt32
+	case parquetBool:
+		return parquetTypeBoolean
+	}
+	return parquetTypeByteArray
+}
+
+type parquetExportWriter struct {
+	writer    io.Writer
+	offset    int64
+	columns   [][]byte
+	rows      int
+	size      int
+	totalRows int64
+	rowGroups [][]parquetChunkMeta
+	scratch   []byte
+}
+
+type parquetChunkMeta struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+	rows             int
+}
+
+func newParquetExportWriter(writer io.Writer, _ string) (logsExportWriter, error) {
+	w := &parquetExportWriter{writer: writer, columns: make([][]byte, len(parquetColumns))}
+	if err := w.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *parquetExportWriter) WriteLog(log analytics.LogEntry) error {
+	record := buildLogsExportRecord(log)
+	for i, column := range parquetColumns {
+		data := w.columns[i]
+		before := len(data)
+		switch column.kind {
+		case parquetString:
+			value := column.str(&record)
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(value)))
+			data = append(data, value...)
+		case parquetTimestamp, parquetInt64:
+			data = binary.LittleEndian.AppendUint64(data, uint64(column.num(&record)))
+		case parquetInt32:
+			data = binary.LittleEndian.AppendUint32(data, uint32(int32(column.num(&record))))
+		case parquetBool:
+			// 布尔值按位打包，低位在前
+			if w.rows%8 == 0 {
+				data = append(data, 0)
+			}
+			if column.flag(&record) {
+				data[len(data)-1] |= 1 << (w.rows % 8)
+			}
+		}
+		w.columns[i] = data
+		w.size += len(data) - before
+	}
+	w.rows++
+	if w.rows >= parquetRowGroupRows || w.size >= parquetRowGroupBytes {
+		return w.flushRowGroup()
+	}
+	return nil
+}
+
+// Flush 行组按大小写出，不随分页刷新，避免产生过多小行组
+func (w *parquetExportWriter) Flush() error {
+	return nil
+}
+
+func (w *parquetExportWriter) Close() error {
+	if err := w.flushRowGroup(); err != nil {
+		return err
+	}
+	footer := w.fileMetaData()
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	if err := w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+		return err
+	}
+	return w.write([]byte(parquetMagic))
+}
+
+func (w *parquetExportWriter) write(data []byte) error {
+	n, err := w.writer.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+func (w *parquetExportWriter) flushRowGroup() error {
+	if w.rows == 0 {
+		return nil
+	}
+	chunks := make([]parquetChunkMeta, len(parquetColumns))
+	for i, data := range w.columns {
+		w.scratch = snappy.Encode(w.scratch[:0], data)
+		header := parquetPageHeader(len(data), len(w.scratch), w.rows)
+		chunks[i] = parquetChunkMeta{
+			offset:           w.offset,
+			uncompressedSize: int64(len(header) + len(data)),
+			compressedSize:   int64(len(header) + len(w.scratch)),
+			rows:             w.rows,
+		}
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(w.scratch); err != nil {
+			return err
+		}
+		w.columns[i] = data[:0]
+	}
+	w.rowGroups = append(w.rowGroups, chunks)
+	w.totalRows += int64(w.rows)
+	w.rows = 0
+	w.size = 0
+	return nil
+}
+
+// parquetPageHeader 编码 PageHeader；REQUIRED 列不写重复与定义级别
+func parquetPageHeader(uncompressed, compressed, rows int) []byte {
+	t := &thriftWriter{}
+	t.writeStruct(func() {
+		t.i32(1, parquetPageData)
+		t.i32(2, int32(uncompressed))
+		t.i32(3, int32(compressed))
+		t.structField(5, func() {
+			t.i32(1, int32(rows))
+			t.i32(2, parquetEncodingPlain)
+			t.i32(3, parquetEncodingRLE)
+			t.i32(4, parquetEncodingRLE)
+		})
+	})
+	return t.buf
+}
+
+// fileMetaData 编码文件尾的 FileMetaData
+func (w *parquetExportWriter) fileMetaData() []byte {
+	t := &thriftWriter{}
+	t.writeStruct(func() {
+		t.i32(1, 1)
+		t.listHeader(2, thriftStruct, len(parquetColumns)+1)
+		t.writeStruct(func() {
+			t.binary(4, "schema")
+			t.i32(5, int32(len(parquetColumns)))
+		})
+		for _, column := range parquetColumns {
+			column := column
+			t.writeStruct(func() {
+				t.i32(1, column.physicalType())
+				t.i32(3, parquetRepetitionRequired)
+				t.binary(4, column.name)
+				switch column.kind {
+				case parquetString:
+					t.i32(6, parquetConvertedUTF8)
+					t.structField(10, func() {
+						t.structField(1, func() {})
+					})
+				case parquetTimestamp:
+					t.i32(6, parquetConvertedTimestampMillis)
+					t.structField(10, func() {
+						t.structField(8, func() {
+							t.boolean(1, true)
+							t.structField(2, func() {
+								t.structField(1, func() {})
+							})
+						})
+					})
+				}
+			})
+		}
+		t.i64(3, w.totalRows)
+		t.listHeader(4, thriftStruct, len(w.rowGroups))
+		for _, chunks := range w.rowGroups {
+			chunks := chunks
+			t.writeStruct(func() {
+				var uncompressed, compressed int64
+				t.listHeader(1, thriftStruct, len(chunks))
+				for i, chunk := range chunks {
+					column := parquetColumns[i]
+					chunk := chunk
+					uncompressed += chunk.uncompressedSize
+					compressed += chunk.compressedSize
+					t.writeStruct(func() {
+						t.i64(2, chunk.offset)
+						t.structField(3, func() {
+							t.i32(1, column.physicalType())
+							t.listHeader(2, thriftI32, 2)
+							t.appendI32(parquetEncodingPlain)
+							t.appendI32(parquetEncodingRLE)
+							t.listHeader(3, thriftBinary, 1)
+							t.appendBinary(column.name)
+							t.i32(4, parquetCodecSnappy)
+							t.i64(5, int64(chunk.rows))
+							t.i64(6, chunk.uncompressedSize)
+							t.i64(7, chunk.compressedSize)
+							t.i64(9, chunk.offset)
+						})
+					})
+				}
+				t.i64(2, uncompressed)
+				t.i64(3, int64(chunks[0].rows))
+				t.i64(5, chunks[0].offset)
+				t.i64(6, compressed)
+			})
+		}
+		t.binary(6, fmt.Sprintf("nginxpulse version %s", version.Version))
+	})
+	return t.buf
+}
+
+// thrift compact protocol 的类型编号
+const (
+	thriftBoolTrue  = 1
+	thriftBoolFalse = 2
+	thriftI32       = 5
+	thriftI64       = 6
+	thriftBinary    = 8
+	thriftList      = 9
+	thriftStruct    = 12
+)
+
+// thriftWriter 只实现 Parquet 元数据用到的 thrift compact protocol 子集
+type thriftWriter struct {
+	buf    []byte
+	lastID int16
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendUvarint(t.buf, uint64(uint16((id<<1)^(id>>15))))
+	}
+	t.lastID = id
+}
+
+// writeStruct 写入结构体内容与结束标记，字段编号在结构体内重新计数
+func (t *thriftWriter) writeStruct(body func()) {
+	saved := t.lastID
+	t.lastID = 0
+	body()
+	t.buf = append(t.buf, 0)
+	t.lastID = saved
+}
+
+func (t *thriftWriter) structField(id int16, body func()) {
+	t.fieldHeader(id, thriftStruct)
+	t.writeStruct(body)
+}
+
+func (t *thriftWriter) listHeader(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elemType)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elemType)
+	t.buf = binary.AppendUvarint(t.buf, uint64(size))
+}
+
+func (t *thriftWriter) i32(id int16, value int32) {
+	t.fieldHeader(id, thriftI32)
+	t.appendI32(value)
+}
+
+func (t *thriftWriter) i64(id int16, value int64) {
+	t.fieldHeader(id, thriftI64)
+	t.buf = binary.AppendUvarint(t.buf, uint64((value<<1)^(value>>63)))
+}
+
+func (t *thriftWriter) binary(id int16, value string) {
+	t.fieldHeader(id, thriftBinary)
+	t.appendBinary(value)
+}
+
+func (t *thriftWriter) boolean(id int16, value bool) {
+	if value {
+		t.fieldHeader(id, thriftBoolTrue)
+	} else {
+		t.fieldHeader(id, thriftBoolFalse)
+	}
+}
+
+func (t *thriftWriter) appendI32(value int32) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(uint32((value<<1)^(value>>31))))
+}
+
+func (t *thriftWriter) appendBinary(value string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(value)))
+	t.buf = append(t.buf, value...)
+}
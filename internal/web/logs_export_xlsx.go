@@ -0,0 +1,167 @@
+package web
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/likaia/nginxpulse/internal/analytics"
+	"github.com/likaia/nginxpulse/internal/config"
+)
+
+const (
+	// Excel 单个工作表最多 1048576 行，含表头
+	xlsxMaxRows = 1048576
+	// 单元格最多 32767 个字符
+	xlsxMaxCellChars = 32767
+	// cellXfs 中的样式序号：1 为粗体表头，2 为日期时间
+	xlsxStyleHeader = 1
+	xlsxStyleTime   = 2
+)
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`
+
+// 列宽与 logsExportHeaders 的列一一对应
+var xlsxColumnWidths = []int{20, 16, 24, 60, 8, 12, 40, 16, 16, 12, 6}
+
+// xlsxExportWriter 单工作表的 XLSX，表头与 CSV 一致按语言本地化；时间、状态码、流量写为数值单元格。
+// 行数据以内联字符串直接写入 zip 流，不构建共享字符串表
+type xlsxExportWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	lang    string
+	rows    int
+}
+
+func newXLSXExportWriter(writer io.Writer, lang string) (logsExportWriter, error) {
+	sheetName := "访问日志"
+	if lang == config.EnglishLanguage {
+		sheetName = "Logs"
+	}
+	archive := zip.NewWriter(writer)
+	workbook := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="` + sheetName + `" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		entry, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(entry, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	w := &xlsxExportWriter{archive: archive, sheet: bufio.NewWriter(entry), lang: lang}
+	w.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><cols>`)
+	for i, width := range xlsxColumnWidths {
+		fmt.Fprintf(w.sheet, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+	}
+	w.sheet.WriteString(`</cols><sheetData>`)
+
+	w.startRow()
+	for i, header := range logsExportHeaders(lang) {
+		w.stringCell(i, header, xlsxStyleHeader)
+	}
+	w.sheet.WriteString(`</row>`)
+	return w, nil
+}
+
+func (w *xlsxExportWriter) WriteLog(log analytics.LogEntry) error {
+	if w.rows >= xlsxMaxRows {
+		return fmt.Errorf("XLSX 最多导出 %d 行，请缩小筛选范围或改用 CSV / Parquet", xlsxMaxRows-1)
+	}
+	row := buildLogExportRow(log, w.lang)
+	w.startRow()
+	for i, value := range row {
+		switch {
+		case i == 0 && log.Timestamp > 0:
+			w.numberCell(i, strconv.FormatFloat(xlsxSerialTime(log.Timestamp), 'f', -1, 64), xlsxStyleTime)
+		case i == 4:
+			w.numberCell(i, strconv.Itoa(log.StatusCode), 0)
+		case i == 5:
+			w.numberCell(i, strconv.Itoa(log.BytesSent), 0)
+		default:
+			w.stringCell(i, value, 0)
+		}
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (w *xlsxExportWriter) Flush() error {
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.archive.Flush()
+}
+
+func (w *xlsxExportWriter) Close() error {
+	if _, err := w.sheet.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
+
+func (w *xlsxExportWriter) startRow() {
+	w.rows++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.rows)
+}
+
+func (w *xlsxExportWriter) cellStart(col, style int) {
+	fmt.Fprintf(w.sheet, `<c r="%c%d"`, 'A'+col, w.rows)
+	if style > 0 {
+		fmt.Fprintf(w.sheet, ` s="%d"`, style)
+	}
+}
+
+func (w *xlsxExportWriter) stringCell(col int, value string, style int) {
+	if utf8.RuneCountInString(value) > xlsxMaxCellChars {
+		value = string([]rune(value)[:xlsxMaxCellChars])
+	}
+	w.cellStart(col, style)
+	w.sheet.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+	// 控制字符等 XML 不允许的字符会被替换为 U+FFFD
+	xml.EscapeText(w.sheet, []byte(value))
+	w.sheet.WriteString(`</t></is></c>`)
+}
+
+func (w *xlsxExportWriter) numberCell(col int, value string, style int) {
+	w.cellStart(col, style)
+	w.sheet.WriteString(`><v>` + value + `</v></c>`)
+}
+
+// xlsxSerialTime 把 Unix 时间转为 Excel 日期序列值（1900 日期系统，按服务器时区显示）
+func xlsxSerialTime(timestamp int64) float64 {
+	_, offset := time.Unix(timestamp, 0).Zone()
+	return float64(timestamp+int64(offset))/86400 + 25569
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/likaia/nginxpulse/internal/analytics"
+	"github.com/likaia/nginxpulse/internal/notify"
+	"github.com/likaia/nginxpulse/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	reportCheckInterval = time.Minute
+	// 服务停机错过发送时间时，超过该时长不再补发
+	reportCatchUpWindow = 6 * time.Hour
+)
+
+// RunReportScheduler 每分钟检查定时报告，到期的报告渲染后发送到对应渠道，直到 ctx 取消
+func RunReportScheduler(ctx context.Context, statsFactory *analytics.StatsFactory, dispatcher *notify.Dispatcher) {
+	ticker := time.NewTicker(reportCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			runDueReports(ctx, statsFactory, dispatcher, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func runDueReports(ctx context.Context, statsFactory *analytics.StatsFactory, dispatcher *notify.Dispatcher, now time.Time) {
+	repo := statsFactory.Repo()
+	reports, err := repo.ListReportDefinitions()
+	if err != nil {
+		logrus.WithError(err).Warn("读取定时报告失败")
+		return
+	}
+	for _, report := range reports {
+		if !report.Enabled {
+			continue
+		}
+		due := lastReportDue(report, now)
+		// 新建的报告从下一个发送时间开始
+		if !due.After(report.CreatedAt) || now.Sub(due) > reportCatchUpWindow {
+			continue
+		}
+		if report.LastRunAt != nil && !report.LastRunAt.Before(due) {
+			continue
+		}
+		claimed, err := repo.ClaimReportRun(report.ID, due)
+		if err != nil {
+			logrus.WithError(err).Warnf("更新定时报告 %s 运行时间失败", report.Name)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := DeliverReport(ctx, statsFactory, dispatcher, report); err != nil {
+			logrus.WithError(err).Warnf("定时报告 %s 发送失败", report.Name)
+		} else {
+			logrus.Infof("定时报告 %s 已发送到渠道 %s", report.Name, report.Channel)
+		}
+	}
+}
+
+// DeliverReport 渲染报告并同步发送到报告配置的渠道，结果写入报告的最近状态
+func DeliverReport(ctx context.Context, statsFactory *analytics.StatsFactory, dispatcher *notify.Dispatcher, report store.ReportDefinition) error {
+	rendered, err := statsFactory.RenderReport(report)
+	if err == nil {
+		err = dispatcher.SendReport(ctx, report.Channel, notify.Report{
+			ID:       report.ID,
+			Title:    rendered.Data.Title,
+			HTML:     rendered.HTML,
+			Markdown: rendered.Markdown,
+			CSV:      rendered.CSV,
+			CSVName:  rendered.CSVName,
+		})
+	}
+
+	status, message := store.NotificationDeliverySuccess, ""
+	if err != nil {
+		status, message = store.NotificationDeliveryFailed, err.Error()
+	}
+	if saveErr := statsFactory.Repo().SaveReportResult(report.ID, status, message); saveErr != nil {
+		logrus.WithError(saveErr).Warn("保存定时报告发送结果失败")
+	}
+	return err
+}
+
+// lastReportDue 返回不晚于 now 的最近一次发送时间
+func lastReportDue(report store.ReportDefinition, now time.Time) time.Time {
+	due := time.Date(now.Year(), now.Month(), now.Day(), report.Hour, 0, 0, 0, now.Location())
+	step := 1
+	if report.Schedule == store.ReportScheduleWeekly {
+		step = 7
+		due = due.AddDate(0, 0, -((int(now.Weekday()) - report.Weekday + 7) % 7))
+	}
+	if due.After(now) {
+		due = due.AddDate(0, 0, -step)
+	}
+	return due
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/likaia/nginxpulse/internal/enrich"
 	"github.com/likaia/nginxpulse/internal/ingest"
 	"github.com/likaia/nginxpulse/internal/logging"
 	"github.com/sirupsen/logrus"
@@ -49,6 +50,14 @@ func ExecutePeriodicTasks(parser *ingest.LogParser, interval time.Duration) {
 	}
 
 	{ // 3 Nginx日志扫描
+		// 攻击特征规则文件修改后重新加载
+		if enrich.ReloadSecurityRulesIfChanged() {
+			logrus.Info("攻击特征规则已重新加载")
+		}
+		// 信誉名单按 refreshInterval 检查文件变化
+		if enrich.ReloadIPReputationIfChanged() {
+			logrus.Info("IP 信誉名单已重新加载")
+		}
 		startTime := time.Now()
 		results := parser.ScanNginxLogs()
 		totalDuration := time.Since(startTime)
@@ -79,6 +88,15 @@ func ExecutePeriodicTasks(parser *ingest.LogParser, interval time.Duration) {
 			logrus.Infof("Nginx日志扫描完成: %d/%d 个站点成功, 共 %d 条记录, 总耗时 %.2fs",
 				successCount, len(results), totalEntries, totalDuration.Seconds())
 		}
+
+		// 本轮入库后评估告警规则
+		if fired := parser.EvaluateAlertRules(); fired > 0 {
+			logrus.Infof("告警规则评估完成: %d 条规则触发", fired)
+		}
+		// 上一个整点小时与历史同期基线比较
+		if found := parser.EvaluateAnomalies(); found > 0 {
+			logrus.Infof("流量异常检测完成: 发现 %d 处异常", found)
+		}
 	}
 
 	{ // 4 历史日志回填
@@ -92,10 +110,15 @@ func ExecutePeriodicTasks(parser *ingest.LogParser, interval time.Duration) {
 	}
 
 	{ // 5 IP 归属地回填
+		// 加载命令行安装的新离线库
+		enrich.ReloadIPGeoDBsIfChanged()
 		processed := parser.ProcessPendingIPGeo(0)
 		if processed > 0 {
 			logrus.Infof("IP 归属地回填完成: %d 个 IP", processed)
 		}
+		if updated := parser.BackfillLocationCodes(); updated > 0 {
+			logrus.Infof("归属地代码回填完成: %d 条", updated)
+		}
 	}
 }
 
@@ -171,6 +171,7 @@ export interface LogsExportJob {
   processed?: number;
   total?: number;
   fileName?: string;
+  format?: string;
   error?: string;
   created_at?: string;
   updated_at?: string;
@@ -183,6 +184,7 @@ export interface LogsExportStatusResponse {
   processed?: number;
   total?: number;
   fileName?: string;
+  format?: string;
   error?: string;
   created_at?: string;
   updated_at?: string;